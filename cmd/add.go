@@ -0,0 +1,678 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/generator"
+	"gopkg.in/yaml.v3"
+)
+
+// Flags of the add subcommands. Each subcommand binds only the ones it takes.
+var (
+	addArgs        []string
+	addReturn      string
+	addMode        string
+	addDescription string
+	addCategory    string
+	addCaller      bool
+	addShortcut    string
+	addHandler     string
+)
+
+// Import paths a handler stub may need besides the generated package.
+const (
+	protocolImportPath = "github.com/xll-gen/types/go/protocol"
+	serverImportPath   = "github.com/xll-gen/xll-gen/pkg/server"
+)
+
+// addCmd groups the subcommands that add an entry to xll.yaml.
+var addCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a function, command or event to xll.yaml and stub its handler",
+	Long: `Appends an entry to xll.yaml, keeping its comments, runs 'xll-gen generate',
+and appends a handler stub with the exact XllService signature to the type
+package main passes to Serve, unless that type already has the method.`,
+}
+
+// addFunctionCmd adds a worksheet function.
+var addFunctionCmd = &cobra.Command{
+	Use:   "function <Name>",
+	Short: "Add a worksheet function",
+	Example: `  xll-gen add function Scale --arg x:float --arg k:float --return float
+  xll-gen add function Quote --arg symbol:string --return any --mode rtd`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fn := config.Function{
+			Name:        args[0],
+			Description: addDescription,
+			Return:      addReturn,
+			Mode:        addMode,
+			Category:    addCategory,
+			Caller:      addCaller,
+		}
+		for _, spec := range addArgs {
+			arg, err := parseArgSpec(spec)
+			if err != nil {
+				printError("Add", fmt.Sprintf("%v", err))
+				os.Exit(1)
+			}
+			fn.Args = append(fn.Args, arg)
+		}
+		runAddOrExit("functions", functionNode(fn), func(cfg *config.Config) serviceMethod {
+			for _, f := range cfg.Functions {
+				if f.Name == fn.Name {
+					return functionMethod(f)
+				}
+			}
+			return serviceMethod{}
+		})
+	},
+}
+
+// addCommandCmd adds a macro command.
+var addCommandCmd = &cobra.Command{
+	Use:     "command <Name>",
+	Short:   "Add a macro command",
+	Example: `  xll-gen add command Refresh --shortcut R --description "Refresh all quotes"`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.Command{Name: args[0], Description: addDescription, Handler: addHandler, Shortcut: addShortcut}
+		runAddOrExit("commands", commandNode(c), func(cfg *config.Config) serviceMethod {
+			for _, cc := range cfg.Commands {
+				if cc.Name == c.Name {
+					return commandMethod(cc)
+				}
+			}
+			return serviceMethod{}
+		})
+	},
+}
+
+// addEventCmd subscribes to an Excel event.
+var addEventCmd = &cobra.Command{
+	Use:     "event <CalculationEnded|CalculationCanceled>",
+	Short:   "Subscribe to an Excel event",
+	Example: `  xll-gen add event CalculationCanceled`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		e := config.Event{Type: args[0], Handler: addHandler}
+		runAddOrExit("events", eventNode(e), func(cfg *config.Config) serviceMethod {
+			for _, ev := range cfg.Events {
+				if ev.Type == e.Type {
+					return eventMethod(ev)
+				}
+			}
+			return serviceMethod{}
+		})
+	},
+}
+
+func init() {
+	f := addFunctionCmd.Flags()
+	f.StringArrayVar(&addArgs, "arg", nil, "Argument as name:type[:description] (repeatable, in order)")
+	f.StringVar(&addReturn, "return", "", "Return type")
+	f.StringVar(&addMode, "mode", "", "Execution mode: sync, async, rtd or rtd-once (default sync)")
+	f.StringVar(&addDescription, "description", "", "Description shown in the function wizard")
+	f.StringVar(&addCategory, "category", "", "Function wizard category")
+	f.BoolVar(&addCaller, "caller", false, "Pass the calling cell to the handler")
+	addFunctionCmd.MarkFlagRequired("return")
+
+	c := addCommandCmd.Flags()
+	c.StringVar(&addDescription, "description", "", "Description of the command")
+	c.StringVar(&addShortcut, "shortcut", "", "Shortcut letter; Excel binds it as Ctrl+Shift+<letter>")
+	c.StringVar(&addHandler, "handler", "", "Handler method name (default: the command name)")
+
+	addEventCmd.Flags().StringVar(&addHandler, "handler", "", "Handler method name (default: On<Type>)")
+
+	addCmd.AddCommand(addFunctionCmd, addCommandCmd, addEventCmd)
+	rootCmd.AddCommand(addCmd)
+}
+
+func runAddOrExit(section string, item *yaml.Node, method func(*config.Config) serviceMethod) {
+	if err := runAdd(section, item, method); err != nil {
+		printError("Add", fmt.Sprintf("%v", err))
+		os.Exit(1)
+	}
+}
+
+// runAdd appends item to section of ./xll.yaml, regenerates, and appends the
+// handler method returns for the defaulted config to the service type.
+func runAdd(section string, item *yaml.Node, method func(*config.Config) serviceMethod) error {
+	data, err := os.ReadFile("xll.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to read xll.yaml: %w", err)
+	}
+	out, err := addToConfig(data, section, item)
+	if err != nil {
+		return err
+	}
+	// Validate before writing, so a bad type, a name collision or an id
+	// xll.lock refuses leaves xll.yaml as it was.
+	cfg, err := config.ParseWithLock(out, config.LockFile)
+	if err != nil {
+		return err
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return err
+	}
+	if err := os.WriteFile("xll.yaml", out, 0644); err != nil {
+		return err
+	}
+	printSuccess("xll.yaml", fmt.Sprintf("added %s %s", strings.TrimSuffix(section, "s"), itemKey(item)))
+
+	if err := runGenerate(); err != nil {
+		return fmt.Errorf("xll.yaml was updated, but generate failed: %w", err)
+	}
+
+	m := method(cfg)
+	modName, err := getModuleName()
+	if err != nil {
+		return err
+	}
+	importPath := modName + "/" + cfg.GoPackage()
+	file, added, err := appendServiceMethod(".", importPath, m)
+	if err != nil {
+		printWarning("Stub", fmt.Sprintf("%v; add this method to the type you pass to Serve:\n\n%s", err, m.source("s", "*Service", cfg.GoPackage())))
+		return nil
+	}
+	if added {
+		printSuccess("Stub", fmt.Sprintf("added %s to %s", m.Name, file))
+	} else {
+		printSuccess("Stub", fmt.Sprintf("%s already has %s", file, m.Name))
+	}
+	return nil
+}
+
+// parseArgSpec parses a --arg value, name:type[:description].
+func parseArgSpec(spec string) (config.Arg, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return config.Arg{}, fmt.Errorf("--arg %q: want name:type[:description]", spec)
+	}
+	arg := config.Arg{Name: parts[0], Type: parts[1]}
+	if len(parts) == 3 {
+		arg.Description = parts[2]
+	}
+	return arg, nil
+}
+
+// addToConfig appends item to the top-level sequence section of the xll.yaml
+// in data, creating the section if it is missing or empty. Editing the node
+// tree rather than a Config keeps the file's comments and key order.
+func addToConfig(data []byte, section string, item *yaml.Node) ([]byte, error) {
+	doc, seq, err := configSection(data, section)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range seq.Content {
+		if itemKey(n) == itemKey(item) {
+			return nil, fmt.Errorf("xll.yaml already has %s %s", strings.TrimSuffix(section, "s"), itemKey(item))
+		}
+	}
+	seq.Content = append(seq.Content, item)
+	return encodeConfig(doc)
+}
+
+// configSection parses the xll.yaml in data and returns it with its
+// top-level sequence section, which is created if it is missing or empty.
+func configSection(data []byte, section string) (*yaml.Node, *yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse xll.yaml: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("xll.yaml is not a mapping")
+	}
+	root := doc.Content[0]
+	seq := mappingValue(root, section)
+	switch {
+	case seq == nil:
+		seq = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, yamlKey(section), seq)
+	case seq.Kind == yaml.ScalarNode && seq.Tag == "!!null":
+		seq.Kind, seq.Tag, seq.Value = yaml.SequenceNode, "!!seq", ""
+	case seq.Kind != yaml.SequenceNode:
+		return nil, nil, fmt.Errorf("xll.yaml: %s is not a list", section)
+	}
+	seq.Style = 0
+	return &doc, seq, nil
+}
+
+// encodeConfig writes doc back out with the scaffold's two-space indent.
+func encodeConfig(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mappingValue returns the value of key in mapping n, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// itemKey returns what identifies a functions:, commands: or events: entry:
+// its name, or an event's type.
+func itemKey(n *yaml.Node) string {
+	if n.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if k := n.Content[i].Value; k == "name" || k == "type" {
+			return n.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+func yamlKey(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+// yamlMapping builds a block mapping from key, value pairs, quoting values
+// like the scaffold's xll.yaml and skipping empty ones.
+func yamlMapping(pairs ...string) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			continue
+		}
+		n.Content = append(n.Content, yamlKey(pairs[i]),
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: pairs[i+1], Style: yaml.DoubleQuotedStyle})
+	}
+	return n
+}
+
+func functionNode(fn config.Function) *yaml.Node {
+	mode := fn.Mode
+	if strings.EqualFold(mode, "sync") {
+		mode = ""
+	}
+	n := yamlMapping("name", fn.Name, "description", fn.Description, "category", fn.Category, "mode", mode)
+	if fn.Caller {
+		n.Content = append(n.Content, yamlKey("caller"), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	}
+	if len(fn.Args) > 0 {
+		args := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, a := range fn.Args {
+			args.Content = append(args.Content, yamlMapping("name", a.Name, "type", a.Type, "description", a.Description))
+		}
+		n.Content = append(n.Content, yamlKey("args"), args)
+	}
+	n.Content = append(n.Content, yamlMapping("return", fn.Return).Content...)
+	return n
+}
+
+func commandNode(c config.Command) *yaml.Node {
+	return yamlMapping("name", c.Name, "description", c.Description, "handler", c.Handler, "shortcut", c.Shortcut)
+}
+
+func eventNode(e config.Event) *yaml.Node {
+	return yamlMapping("type", e.Type, "handler", e.Handler)
+}
+
+// serviceMethod is an XllService method a stub is written for.
+type serviceMethod struct {
+	Name string
+	// Params follow ctx context.Context, e.g. []string{"a int32"}.
+	Params []string
+	// Results are the non-error results; the method always returns an error.
+	Results []string
+	// NotImplemented makes the stub return the generated ErrNotImplemented
+	// instead of nil.
+	NotImplemented bool
+	// Imports are the packages the signature uses besides the generated one.
+	Imports []string
+}
+
+// functionMethod mirrors XllService's method for fn, as interface.go.tmpl
+// declares it.
+func functionMethod(fn config.Function) serviceMethod {
+	m := serviceMethod{Name: fn.Name, NotImplemented: true}
+	if fn.Mode == "rtd" {
+		m.Name += "_RTD"
+		m.Params = append(m.Params, "topicID int32")
+	}
+	for _, a := range fn.Args {
+		m.Params = append(m.Params, a.Name+" "+generator.LookupGoType(a.Type))
+	}
+	if fn.Mode != "rtd" {
+		if fn.Caller {
+			m.Params = append(m.Params, "caller *protocol.Range")
+		}
+		m.Results = []string{generator.LookupRetGoType(fn.Return)}
+	}
+	m.Imports = []string{"context"}
+	sig := strings.Join(append(append([]string{}, m.Params...), m.Results...), " ")
+	if strings.Contains(sig, "time.") {
+		m.Imports = append(m.Imports, "time")
+	}
+	if strings.Contains(sig, "protocol.") {
+		m.Imports = append(m.Imports, protocolImportPath)
+	}
+	return m
+}
+
+func commandMethod(c config.Command) serviceMethod {
+	return serviceMethod{
+		Name:           c.Handler,
+		Params:         []string{"cmd server.CommandContext"},
+		NotImplemented: true,
+		Imports:        []string{"context", serverImportPath},
+	}
+}
+
+// eventMethod's stub returns nil: an event handler runs on every
+// recalculation, and an error would be logged each time.
+func eventMethod(e config.Event) serviceMethod {
+	return serviceMethod{Name: e.Handler, Imports: []string{"context"}}
+}
+
+// zeroValue returns the literal a stub returns for a result of Go type t.
+func zeroValue(t string) string {
+	switch t {
+	case "int32", "float64":
+		return "0"
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	case "time.Time":
+		return "time.Time{}"
+	}
+	return "nil"
+}
+
+// source renders the stub with receiver recv of type recvType; pkg is the
+// name the generated package is imported under. recv is dropped when a
+// parameter has the same name.
+func (m serviceMethod) source(recv, recvType, pkg string) string {
+	for _, p := range append([]string{"ctx"}, m.Params...) {
+		if strings.Fields(p)[0] == recv {
+			recv = ""
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "func (%s) %s(%s) ", strings.TrimSpace(recv+" "+recvType), m.Name,
+		strings.Join(append([]string{"ctx context.Context"}, m.Params...), ", "))
+	ret := []string{}
+	for _, r := range m.Results {
+		ret = append(ret, zeroValue(r))
+	}
+	if len(m.Results) > 0 {
+		fmt.Fprintf(&b, "(%s, error) {\n", strings.Join(m.Results, ", "))
+	} else {
+		b.WriteString("error {\n")
+	}
+	if m.NotImplemented {
+		fmt.Fprintf(&b, "\t// TODO: implement %s.\n", m.Name)
+		ret = append(ret, pkg+".ErrNotImplemented")
+	} else {
+		ret = append(ret, "nil")
+	}
+	fmt.Fprintf(&b, "\treturn %s\n}\n", strings.Join(ret, ", "))
+	return b.String()
+}
+
+// appendServiceMethod appends m's stub to the file of package main in dir that
+// declares the service type passed to Serve from importPath, unless the type
+// already has a method of that name. It returns the file and whether it was
+// changed.
+func appendServiceMethod(dir, importPath string, m serviceMethod) (string, bool, error) {
+	expr, err := findService(dir, importPath)
+	if err != nil {
+		return "", false, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", false, err
+	}
+	fset := token.NewFileSet()
+	files := map[string]*ast.File{}
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return "", false, err
+		}
+		if f.Name.Name == "main" {
+			files[name] = f
+		}
+	}
+	typeName, ptr, err := serviceTypeOf(expr, files)
+	if err != nil {
+		return "", false, err
+	}
+
+	var typeFile string
+	recv := ""
+	for _, name := range names {
+		f := files[name]
+		if f == nil {
+			continue
+		}
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == typeName {
+						typeFile = name
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Recv == nil || len(d.Recv.List) == 0 {
+					continue
+				}
+				field := d.Recv.List[0]
+				base, star := field.Type, false
+				if s, ok := base.(*ast.StarExpr); ok {
+					base, star = s.X, true
+				}
+				if id, ok := base.(*ast.Ident); !ok || id.Name != typeName {
+					continue
+				}
+				if d.Name.Name == m.Name {
+					return filepath.Base(name), false, nil
+				}
+				if recv == "" && len(field.Names) > 0 {
+					recv, ptr = field.Names[0].Name, star
+				}
+			}
+		}
+	}
+	if typeFile == "" {
+		return "", false, fmt.Errorf("type %s is not declared in package main", typeName)
+	}
+	if recv == "" || recv == "_" {
+		recv = "s"
+	}
+	recvType := typeName
+	if ptr {
+		recvType = "*" + typeName
+	}
+
+	src, err := os.ReadFile(typeFile)
+	if err != nil {
+		return "", false, err
+	}
+	imports := m.Imports
+	if m.NotImplemented {
+		imports = append(imports, importPath)
+	}
+	src, err = addImports(src, imports...)
+	if err != nil {
+		return "", false, err
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), typeFile, src, parser.ImportsOnly)
+	if err != nil {
+		return "", false, err
+	}
+	stub := m.source(recv, recvType, importName(f, importPath))
+	src = append(bytes.TrimRight(src, "\n"), "\n\n"+stub...)
+	if src, err = format.Source(src); err != nil {
+		return "", false, err
+	}
+	return filepath.Base(typeFile), true, os.WriteFile(typeFile, src, 0644)
+}
+
+// serviceTypeOf resolves the named type of the Serve argument expr: a
+// composite literal, its address, a package-level variable, or a call to a
+// package-level constructor. ptr reports whether the value is a pointer.
+func serviceTypeOf(expr string, files map[string]*ast.File) (name string, ptr bool, err error) {
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return "", false, err
+	}
+	lookup := func(ident string) ast.Node {
+		for _, f := range files {
+			for _, d := range f.Decls {
+				switch d := d.(type) {
+				case *ast.FuncDecl:
+					if d.Recv == nil && d.Name.Name == ident {
+						return d
+					}
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						if vs, ok := spec.(*ast.ValueSpec); ok {
+							for i, n := range vs.Names {
+								if n.Name != ident {
+									continue
+								}
+								if vs.Type != nil {
+									return vs.Type
+								}
+								if i < len(vs.Values) {
+									return vs.Values[i]
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+		return nil
+	}
+	for depth := 0; depth < 8; depth++ {
+		switch x := e.(type) {
+		case *ast.UnaryExpr:
+			if x.Op != token.AND {
+				return "", false, fmt.Errorf("cannot resolve the type of %s", expr)
+			}
+			e, ptr = x.X, true
+			continue
+		case *ast.StarExpr:
+			e, ptr = x.X, true
+			continue
+		case *ast.CompositeLit:
+			e = x.Type
+			continue
+		case *ast.ParenExpr:
+			e = x.X
+			continue
+		case *ast.CallExpr:
+			id, ok := x.Fun.(*ast.Ident)
+			if !ok {
+				return "", false, fmt.Errorf("cannot resolve the type of %s", expr)
+			}
+			fd, ok := lookup(id.Name).(*ast.FuncDecl)
+			if !ok || fd.Type.Results == nil || len(fd.Type.Results.List) == 0 {
+				return "", false, fmt.Errorf("cannot resolve the type of %s", expr)
+			}
+			e = fd.Type.Results.List[0].Type
+			continue
+		case *ast.Ident:
+			// A type name ends the walk; a variable is followed to its type
+			// or initial value.
+			switch n := lookup(x.Name).(type) {
+			case ast.Expr:
+				e = n
+				continue
+			case nil:
+				return x.Name, ptr, nil
+			}
+		}
+		break
+	}
+	return "", false, fmt.Errorf("cannot resolve the type of %s", expr)
+}
+
+// addImports adds the import paths src lacks: standard-library ones to the
+// first group of its import block, others to the last.
+func addImports(src []byte, paths ...string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	var std, other string
+	seen := map[string]bool{}
+	for _, p := range paths {
+		if seen[p] || importName(f, p) != "" {
+			continue
+		}
+		seen[p] = true
+		line := "\t" + strconv.Quote(p) + "\n"
+		if strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+			other += line
+		} else {
+			std += line
+		}
+	}
+	if std == "" && other == "" {
+		return src, nil
+	}
+	var decl *ast.GenDecl
+	for _, d := range f.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			decl = gd
+			break
+		}
+	}
+	off := func(p token.Pos) int { return fset.Position(p).Offset }
+	var out []byte
+	switch {
+	case decl == nil:
+		at := off(f.Name.End())
+		out = append(append([]byte{}, src[:at]...), "\n\nimport (\n"+std+other+")"...)
+		out = append(out, src[at:]...)
+	case !decl.Lparen.IsValid():
+		spec := string(src[off(decl.Specs[0].Pos()):off(decl.End())])
+		out = append(append([]byte{}, src[:off(decl.Pos())]...), "import (\n"+std+"\t"+spec+"\n"+other+")"...)
+		out = append(out, src[off(decl.End()):]...)
+	default:
+		lp, rp := off(decl.Lparen)+1, off(decl.Rparen)
+		if src[lp] == '\n' {
+			lp++
+		}
+		out = append(append([]byte{}, src[:lp]...), std...)
+		out = append(out, src[lp:rp]...)
+		out = append(out, other...)
+		out = append(out, src[rp:]...)
+	}
+	return format.Source(out)
+}
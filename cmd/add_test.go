@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+const addYAML = `project:
+  name: "demo" # project name
+# Worksheet functions
+functions:
+  - name: "Add" # keep me
+    args:
+      - name: "a"
+        type: "int"
+    return: "int"
+server:
+  timeout: "10s"
+`
+
+// TestAddToConfig: the new entry lands at the end of its section, comments
+// and key order survive, and the result parses back.
+func TestAddToConfig(t *testing.T) {
+	fn := config.Function{
+		Name:   "Scale",
+		Return: "float",
+		Mode:   "async",
+		Args:   []config.Arg{{Name: "x", Type: "float"}, {Name: "k", Type: "float", Description: "factor"}},
+	}
+	out, err := addToConfig([]byte(addYAML), "functions", functionNode(fn))
+	if err != nil {
+		t.Fatalf("addToConfig: %v", err)
+	}
+	s := string(out)
+	for _, want := range []string{"# project name", "# Worksheet functions", "# keep me", `mode: "async"`, `description: "factor"`} {
+		if !strings.Contains(s, want) {
+			t.Errorf("output lacks %q:\n%s", want, s)
+		}
+	}
+	if strings.Index(s, "Scale") > strings.Index(s, "server:") {
+		t.Errorf("Scale must be appended to functions, not after server:\n%s", s)
+	}
+
+	cfg, err := config.Parse(out)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(cfg.Functions) != 2 || cfg.Functions[1].Name != "Scale" || len(cfg.Functions[1].Args) != 2 {
+		t.Errorf("want Add then Scale(x, k), got %+v", cfg.Functions)
+	}
+
+	if _, err := addToConfig(out, "functions", functionNode(fn)); err == nil {
+		t.Error("adding Scale twice must fail")
+	}
+}
+
+// TestAddToConfigNewSection: a missing or empty section is created.
+func TestAddToConfigNewSection(t *testing.T) {
+	for _, src := range []string{addYAML, addYAML + "events:\n"} {
+		out, err := addToConfig([]byte(src), "events", eventNode(config.Event{Type: "CalculationCanceled"}))
+		if err != nil {
+			t.Fatalf("addToConfig: %v", err)
+		}
+		cfg, err := config.Parse(out)
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		if len(cfg.Events) != 1 || cfg.Events[0].Type != "CalculationCanceled" {
+			t.Errorf("want one CalculationCanceled event, got %+v", cfg.Events)
+		}
+	}
+}
+
+func TestParseArgSpec(t *testing.T) {
+	arg, err := parseArgSpec("when:date:Trade date: UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arg.Name != "when" || arg.Type != "date" || arg.Description != "Trade date: UTC" {
+		t.Errorf("got %+v", arg)
+	}
+	for _, bad := range []string{"x", "x:", ":int"} {
+		if _, err := parseArgSpec(bad); err == nil {
+			t.Errorf("parseArgSpec(%q) must fail", bad)
+		}
+	}
+}
+
+const addMainGo = `package main
+
+import (
+	"context"
+
+	"demo/generated"
+)
+
+type MyService struct{}
+
+func (s *MyService) Add(ctx context.Context, a int32) (int32, error) {
+	return a, nil
+}
+
+func main() {
+	generated.Serve(&MyService{})
+}
+`
+
+// TestAppendServiceMethod: stubs take the existing receiver and the imports
+// their signature needs; a method the type already has is left alone.
+func TestAppendServiceMethod(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte(addMainGo), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scale := functionMethod(config.Function{
+		Name:   "Scale",
+		Return: "float",
+		Caller: true,
+		Args:   []config.Arg{{Name: "x", Type: "float"}, {Name: "d", Type: "date"}},
+	})
+	file, added, err := appendServiceMethod(dir, "demo/generated", scale)
+	if err != nil || !added || file != "main.go" {
+		t.Fatalf("appendServiceMethod = %q, %v, %v", file, added, err)
+	}
+	quote := functionMethod(config.Function{Name: "Quote", Mode: "rtd", Args: []config.Arg{{Name: "s", Type: "string"}}})
+	if _, _, err := appendServiceMethod(dir, "demo/generated", quote); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := appendServiceMethod(dir, "demo/generated", commandMethod(config.Command{Handler: "Refresh"})); err != nil {
+		t.Fatal(err)
+	}
+	_, added, err = appendServiceMethod(dir, "demo/generated", functionMethod(config.Function{Name: "Add", Return: "int"}))
+	if err != nil || added {
+		t.Errorf("Add exists: want added=false, got %v, %v", added, err)
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(src)
+	for _, want := range []string{
+		`"time"`,
+		`"` + protocolImportPath + `"`,
+		`"` + serverImportPath + `"`,
+		"func (s *MyService) Scale(ctx context.Context, x float64, d time.Time, caller *protocol.Range) (float64, error) {",
+		"return 0, generated.ErrNotImplemented",
+		// s is a parameter, so the receiver goes unnamed.
+		"func (*MyService) Quote_RTD(ctx context.Context, topicID int32, s string) error {",
+		"func (s *MyService) Refresh(ctx context.Context, cmd server.CommandContext) error {",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("main.go lacks %q:\n%s", want, s)
+		}
+	}
+	if strings.Count(s, ") Add(") != 1 {
+		t.Errorf("Add must not be stubbed again:\n%s", s)
+	}
+}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/pkg/xllbench"
+)
+
+// benchTestFile is the go test `xll-gen bench` writes into the project root
+// for the length of one run.
+const benchTestFile = "xllgen_bench_test.go"
+
+// benchTestMarker is the first line of benchTestFile; a file by that name
+// without it belongs to the user and is never overwritten.
+const benchTestMarker = "// Code generated by xll-gen bench. DO NOT EDIT."
+
+var (
+	benchPlanFile    string
+	benchConcurrency int
+	benchDuration    string
+	benchRequests    int
+	benchFuncs       []string
+	benchGrid        string
+	benchSeed        int64
+	benchJSONPath    string
+	benchComparePath string
+	benchTolerance   float64
+	benchService     string
+	benchVerbose     bool
+)
+
+// benchCmd drives the generated server with synthetic load.
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Load-test the project's functions through the generated server",
+	Long: `Calls the project's worksheet functions from many concurrent callers through
+the generated Go server, with no Excel (pkg/xllhost plays the XLL), and reports
+throughput, p50/p99/max latency, "Server Busy" rejects and the chunk reassembly
+memory the server needed. Use it to size server.workers, timeouts and
+server.chunk before a rollout.
+
+Arguments come from xll.bench.yaml when it exists, and are otherwise random:
+grid, numgrid and range arguments are --grid in size, so a large grid forces
+the requests through chunking. Flags override the plan file.
+
+--json saves the report; --compare checks this run against a saved one and
+exits non-zero when throughput, latency, busy rejects or errors got worse by
+more than --tolerance.
+
+Run 'xll-gen generate' first; the project must compile with 'go test'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		report, regressions, err := runBench(cmd)
+		if err != nil {
+			printError("Bench", fmt.Sprintf("%v", err))
+			os.Exit(1)
+		}
+		if len(regressions) > 0 {
+			printError("Bench", fmt.Sprintf("%d regressions against %s", len(regressions), benchComparePath))
+			os.Exit(1)
+		}
+		printSuccess("Bench", fmt.Sprintf("%d calls, %.1f calls/s", report.Total.Calls, report.Total.Throughput))
+	},
+}
+
+func init() {
+	benchCmd.Flags().StringVarP(&benchPlanFile, "file", "f", xllbench.DefaultFile, "Bench plan file (optional)")
+	benchCmd.Flags().IntVarP(&benchConcurrency, "concurrency", "c", 0, "Concurrent callers (default: NumCPU)")
+	benchCmd.Flags().StringVarP(&benchDuration, "duration", "d", "", "How long to run, e.g. 30s (default 10s)")
+	benchCmd.Flags().IntVarP(&benchRequests, "requests", "n", 0, "Run this many calls instead of for a duration")
+	benchCmd.Flags().StringSliceVar(&benchFuncs, "func", nil, "Bench only these functions (repeatable)")
+	benchCmd.Flags().StringVar(&benchGrid, "grid", "", "ROWSxCOLS of generated grid/numgrid/range arguments (default 10x10)")
+	benchCmd.Flags().Int64Var(&benchSeed, "seed", 0, "Seed for the random arguments")
+	benchCmd.Flags().StringVar(&benchJSONPath, "json", "", "Save the report as JSON to this path")
+	benchCmd.Flags().StringVar(&benchComparePath, "compare", "", "Compare with a report saved by --json")
+	benchCmd.Flags().Float64Var(&benchTolerance, "tolerance", 0.1, "Relative change --compare tolerates (0.1 = 10%)")
+	benchCmd.Flags().StringVar(&benchService, "service", "", "Go expression for the service under test (default: the argument main passes to Serve)")
+	benchCmd.Flags().BoolVarP(&benchVerbose, "verbose", "v", false, "Show the go test output")
+	rootCmd.AddCommand(benchCmd)
+}
+
+// runBench builds the plan, runs it with go test, prints the table, and saves
+// and compares the report as asked.
+func runBench(cmd *cobra.Command) (*xllbench.Report, []xllbench.Regression, error) {
+	cfg, err := config.Load("xll.yaml")
+	if err != nil {
+		return nil, nil, err
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return nil, nil, err
+	}
+	plan, err := benchPlan(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Read the baseline before the run, so a bad path fails before a build.
+	var base *xllbench.Report
+	if benchComparePath != "" {
+		if base, err = xllbench.ReadReport(benchComparePath); err != nil {
+			return nil, nil, err
+		}
+	}
+	pkg := cfg.GoPackage()
+	if _, err := os.Stat(filepath.Join(pkg, "server.go")); err != nil {
+		return nil, nil, fmt.Errorf("%s/server.go not found; run 'xll-gen generate' first", pkg)
+	}
+	modName, err := getModuleName()
+	if err != nil {
+		return nil, nil, err
+	}
+	service := benchService
+	if service == "" {
+		if service, err = findService(".", modName+"/"+pkg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	src, err := renderBenchTest(modName, pkg, service)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeProjectTest(benchTestFile, benchTestMarker, src); err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(benchTestFile)
+
+	planPath, err := writeTempJSON("xllgen-bench-plan-*.json", plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(planPath)
+	reportFile, err := os.CreateTemp("", "xllgen-bench-*.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	reportPath := reportFile.Name()
+	reportFile.Close()
+	defer os.Remove(reportPath)
+
+	printHeader("Benchmarking " + cfg.Project.Name + "...")
+	goTest := exec.Command("go", "test", "-count=1", "-timeout=0", "-run", "^TestXllGenBench$", ".")
+	goTest.Env = append(os.Environ(),
+		xllbench.EnvPlan+"="+planPath,
+		xllbench.EnvReport+"="+reportPath)
+	out, runErr := goTest.CombinedOutput()
+	if benchVerbose {
+		os.Stdout.Write(out)
+	}
+	report, err := xllbench.ReadReport(reportPath)
+	if err != nil || runErr != nil {
+		if runErr == nil {
+			runErr = err
+		}
+		return nil, nil, fmt.Errorf("go test did not run the bench (%v):\n%s", runErr, out)
+	}
+	report.Config = benchSettings(cfg)
+
+	fmt.Println()
+	if err := xllbench.WriteTable(os.Stdout, report); err != nil {
+		return nil, nil, err
+	}
+	if benchJSONPath != "" {
+		if err := xllbench.WriteReport(benchJSONPath, report); err != nil {
+			return nil, nil, fmt.Errorf("failed to write the report: %w", err)
+		}
+		printSuccess("Report", benchJSONPath)
+	}
+
+	var regressions []xllbench.Regression
+	if base != nil {
+		regressions = xllbench.Compare(base, report, benchTolerance)
+		fmt.Println()
+		for k, v := range report.Config {
+			if base.Config[k] != v {
+				printWarning("Config", fmt.Sprintf("%s changed: %q -> %q", k, base.Config[k], v))
+			}
+		}
+		for _, r := range regressions {
+			printWarning("Regression", r.String())
+		}
+		if len(regressions) == 0 {
+			printSuccess("Compare", fmt.Sprintf("no regressions against %s", benchComparePath))
+		}
+	}
+	return report, regressions, nil
+}
+
+// renderBenchTest renders the bench test for module/pkg serving service.
+func renderBenchTest(module, pkg, service string) ([]byte, error) {
+	return renderProjectTest("bench_test.go.tmpl", service, map[string]string{
+		"Module":  module,
+		"Package": pkg,
+		"Service": service,
+		"EnvPlan": xllbench.EnvPlan,
+	})
+}
+
+// benchPlan loads the plan file (optional when it is the default) and
+// applies the flags that were given.
+func benchPlan(cmd *cobra.Command) (*xllbench.Plan, error) {
+	plan := &xllbench.Plan{}
+	if p, err := xllbench.LoadPlan(benchPlanFile); err == nil {
+		plan = p
+	} else if !errors.Is(err, os.ErrNotExist) || cmd.Flags().Changed("file") {
+		return nil, err
+	}
+	flags := cmd.Flags()
+	if flags.Changed("concurrency") {
+		plan.Concurrency = benchConcurrency
+	}
+	if flags.Changed("duration") {
+		plan.Duration = benchDuration
+		plan.Requests = 0
+	}
+	if flags.Changed("requests") {
+		plan.Requests = benchRequests
+	}
+	if flags.Changed("grid") {
+		plan.Grid = benchGrid
+	}
+	if flags.Changed("seed") {
+		plan.Seed = benchSeed
+	}
+	if len(benchFuncs) > 0 {
+		plan.Functions = selectFuncs(plan.Functions, benchFuncs)
+	}
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// selectFuncs keeps the plan entries for names, in names order, adding a
+// random-argument entry for a name the plan does not list.
+func selectFuncs(planned []xllbench.FuncPlan, names []string) []xllbench.FuncPlan {
+	byName := make(map[string]xllbench.FuncPlan, len(planned))
+	for _, f := range planned {
+		byName[f.Func] = f
+	}
+	out := make([]xllbench.FuncPlan, 0, len(names))
+	for _, name := range names {
+		f, ok := byName[name]
+		if !ok {
+			f = xllbench.FuncPlan{Func: name}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// benchSettings records the xll.yaml settings a bench is meant to size.
+func benchSettings(cfg *config.Config) map[string]string {
+	s := map[string]string{
+		"server.workers":           strconv.Itoa(cfg.Server.Workers),
+		"server.timeout":           cfg.Server.Timeout,
+		"server.async_ack_timeout": cfg.Server.AsyncAckTimeout,
+	}
+	if c := cfg.Server.Chunk; c != nil {
+		s["server.chunk.max_buffer_bytes"] = strconv.FormatInt(c.MaxBufferBytes, 10)
+		s["server.chunk.max_concurrent_transfers"] = strconv.Itoa(c.MaxConcurrentTransfers)
+		s["server.chunk.compress_threshold"] = strconv.FormatInt(c.CompressThreshold, 10)
+	}
+	return s
+}
+
+// writeTempJSON writes v as JSON to a new temporary file and returns its path.
+func writeTempJSON(pattern string, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/pkg/xllbench"
+)
+
+func TestRenderBenchTest(t *testing.T) {
+	src, err := renderBenchTest("demo", "generated", "&MyService{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(src)
+	for _, want := range []string{
+		`"demo/generated"`,
+		"go generated.ServeConn(&MyService{}, h)",
+		"func TestXllGenBench(t *testing.T)",
+		"xllbench.Run(context.Background(), h, plan, generated.ChunkStats)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered test lacks %q:\n%s", want, out)
+		}
+	}
+	if !strings.HasPrefix(out, benchTestMarker) {
+		t.Error("the marker must be the first line, or writeProjectTest refuses to overwrite its own file")
+	}
+}
+
+func TestSelectFuncs(t *testing.T) {
+	planned := []xllbench.FuncPlan{
+		{Func: "Add", Args: [][]any{{1, 2}}, Weight: 3},
+		{Func: "Slow"},
+	}
+	got := selectFuncs(planned, []string{"Quote", "Add"})
+	if len(got) != 2 || got[0].Func != "Quote" || got[0].Args != nil || got[1].Func != "Add" || got[1].Weight != 3 {
+		t.Errorf("selectFuncs = %+v", got)
+	}
+}
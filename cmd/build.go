@@ -1,71 +1,134 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"runtime"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/cross"
 )
 
-var debugBuild bool
+var (
+	debugBuild     bool
+	buildTarget    string
+	buildToolchain string
+)
 
 // buildCmd represents the build command.
 var buildCmd = &cobra.Command{
 	Use:   "build",
 	Short: "Build the XLL project using Taskfile",
-	Long:  `Executes 'task build' to build the Go server and C++ XLL. It requires the 'task' (or 'go-task') command to be available in the system PATH.`,
+	Long: `Executes 'task build' to build the Go server and C++ XLL. It requires the 'task' (or 'go-task') command to be available in the system PATH.
+
+--target windows-amd64 --toolchain mingw cross-builds the XLL on a Linux host:
+it writes a CMake toolchain file for the x86_64-w64-mingw32 compilers on PATH
+to build/toolchain-windows-amd64-mingw.cmake and runs 'task
+build-windows-amd64', which builds the Go server with GOOS=windows and the
+XLL in build/cpp-windows-amd64. The .xll lands in build/ as in a native build.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		runBuildCommand(debugBuild)
+		taskName := "build"
+		if buildTarget != "" {
+			var err error
+			if taskName, err = prepareCrossBuild(buildTarget, buildToolchain); err != nil {
+				printError("Build", err.Error())
+				os.Exit(1)
+			}
+		}
+		if debugBuild {
+			taskName += "-debug"
+		}
+		runBuildCommand(taskName)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(buildCmd)
 	buildCmd.Flags().BoolVar(&debugBuild, "debug", false, "Build in debug mode (task build-debug)")
+	buildCmd.Flags().StringVar(&buildTarget, "target", "", "Cross-compile for this target (windows-amd64)")
+	buildCmd.Flags().StringVar(&buildToolchain, "toolchain", cross.Mingw, "Cross toolchain for --target (mingw)")
 }
 
-// runBuildCommand checks for the presence of a Taskfile and executes the 'task build' command.
-// It searches for 'task' or 'go-task' executables in the system PATH.
-// If the build fails, it exits the process with a non-zero status code.
-func runBuildCommand(debug bool) {
-	start := time.Now()
+// prepareCrossBuild checks target and toolchain, writes the CMake toolchain
+// file for the located compilers, and returns the task that cross-builds.
+func prepareCrossBuild(target, toolchain string) (string, error) {
+	if target != cross.Target {
+		return "", fmt.Errorf("unsupported --target %q (supported: %s)", target, cross.Target)
+	}
+	if toolchain != cross.Mingw {
+		return "", fmt.Errorf("unsupported --toolchain %q (supported: %s)", toolchain, cross.Mingw)
+	}
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf("--target %s is this host's own target; run 'xll-gen build' without it", target)
+	}
+	tc, err := cross.Find()
+	if err != nil {
+		return "", err
+	}
+	if err := cross.WriteToolchainFile(cross.ToolchainFile, tc); err != nil {
+		return "", err
+	}
+	printSuccess("Toolchain", fmt.Sprintf("%s (%s)", tc.CXX, cross.ToolchainFile))
+	if tc.ThreadModel == "win32" {
+		printWarning("Toolchain", cross.Win32ThreadsHint)
+	}
+	return "build-" + target, nil
+}
+
+// errNoTask reports that neither 'task' nor 'go-task' is on PATH.
+var errNoTask = errors.New("'task' command not found.")
 
+// findTask checks for the presence of a Taskfile and returns the Taskfile
+// runner on PATH: 'task', or 'go-task' as some package managers name it.
+func findTask() (string, error) {
 	if _, err := os.Stat("Taskfile.yml"); os.IsNotExist(err) {
 		if _, err := os.Stat("Taskfile.yaml"); os.IsNotExist(err) {
-			printError("Error", "Taskfile.yml not found. Are you in the project root?")
-			os.Exit(1)
+			return "", errors.New("Taskfile.yml not found. Are you in the project root?")
 		}
 	}
+	if _, err := exec.LookPath("task"); err == nil {
+		return "task", nil
+	}
+	if _, err := exec.LookPath("go-task"); err == nil {
+		return "go-task", nil
+	}
+	return "", errNoTask
+}
 
-	taskExe := "task"
-	if _, err := exec.LookPath("task"); err != nil {
-		if _, err := exec.LookPath("go-task"); err == nil {
-			taskExe = "go-task"
-		} else {
-			printError("Error", "'task' command not found.")
+// runTask runs taskExe taskName with its output going to stdout and stderr.
+func runTask(taskExe, taskName string, stdout, stderr io.Writer) error {
+	cmd := exec.Command(taskExe, taskName)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// runBuildCommand executes the given task (e.g. 'build' or 'build-debug')
+// with the Taskfile runner findTask locates. If the build fails, it exits the
+// process with a non-zero status code.
+func runBuildCommand(taskName string) {
+	start := time.Now()
+
+	taskExe, err := findTask()
+	if err != nil {
+		printError("Error", err.Error())
+		if errors.Is(err, errNoTask) {
 			if _, err := exec.LookPath("go"); err == nil {
 				printWarning("Action Required", "Run: go install github.com/go-task/task/v3/cmd/task@latest")
 			} else {
 				printWarning("Action Required", "Install from https://taskfile.dev")
 			}
-			os.Exit(1)
 		}
-	}
-
-	taskName := "build"
-	if debug {
-		taskName = "build-debug"
+		os.Exit(1)
 	}
 
 	printHeader(fmt.Sprintf("Building project using '%s %s'...", taskExe, taskName))
 
-	cmd := exec.Command(taskExe, taskName)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	if err := runTask(taskExe, taskName, os.Stdout, os.Stderr); err != nil {
 		printError("Build", fmt.Sprintf("Failed: %v", err))
 		os.Exit(1)
 	}
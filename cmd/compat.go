@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/compat"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/generator"
+	"github.com/xll-gen/xll-gen/internal/templates"
+)
+
+var compatBase string
+
+// compatCmd compares the project's wire schema against a baseline.
+var compatCmd = &cobra.Command{
+	Use:   "compat --base <xll.yaml|schema.fbs|dir>",
+	Short: "Check the wire schema for changes that break an XLL or server built from a baseline",
+	Long: `Compares the schema.fbs that 'xll-gen generate' would write for ./xll.yaml, and
+the protocol.fbs of this xll-gen, against a baseline, and classifies every
+difference as BREAKING or safe for a peer built from the baseline:
+
+  - a function whose message ID changes, or that is removed, is breaking, as
+    is a new function on a freed ID; a function is sent as MsgUserStart + its
+    ID, which is its position unless id: or xll.lock pins it
+  - a table field that is reordered, retyped, removed or given a new default
+    is breaking; appending, deprecating or renaming one is safe
+  - struct layouts, enum values, union members and message ID constants must
+    not change
+
+The baseline is an older xll.yaml, an older generated schema.fbs (its sibling
+protocol.fbs is used when present), or a project directory holding either.
+Exits non-zero if any change is breaking.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		changes, err := runCompat(compatBase)
+		if err != nil {
+			printError("Compat", fmt.Sprintf("%v", err))
+			os.Exit(1)
+		}
+		if len(changes) == 0 {
+			printSuccess("Compat", "the wire schema is unchanged")
+			return
+		}
+		fmt.Println()
+		if err := compat.WriteTable(os.Stdout, changes); err != nil {
+			printError("Compat", fmt.Sprintf("%v", err))
+			os.Exit(1)
+		}
+		fmt.Println()
+		if compat.Breaking(changes) {
+			printError("Compat", "breaking changes: rebuild and redeploy the XLL and the server together")
+			os.Exit(1)
+		}
+		printSuccess("Compat", fmt.Sprintf("%d changes, all safe", len(changes)))
+	},
+}
+
+func init() {
+	compatCmd.Flags().StringVar(&compatBase, "base", "", "Baseline xll.yaml, generated schema.fbs, or project directory")
+	compatCmd.MarkFlagRequired("base")
+	rootCmd.AddCommand(compatCmd)
+}
+
+// runCompat parses the baseline and the current project and compares them.
+func runCompat(base string) ([]compat.Change, error) {
+	printHeader(fmt.Sprintf("Comparing against %s...", base))
+	cfg, err := loadCompatConfig("xll.yaml")
+	if err != nil {
+		return nil, err
+	}
+	nextSchema, err := generator.RenderSchema(cfg)
+	if err != nil {
+		return nil, err
+	}
+	protocol, err := templates.Get("protocol.fbs")
+	if err != nil {
+		return nil, err
+	}
+	next, err := compat.Parse(nextSchema, protocol)
+	if err != nil {
+		return nil, fmt.Errorf("generated schema: %w", err)
+	}
+
+	baseSchema, baseProtocol, err := readCompatBase(base, protocol)
+	if err != nil {
+		return nil, err
+	}
+	old, err := compat.Parse(baseSchema, baseProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", base, err)
+	}
+	if old.MsgIDs == nil {
+		printWarning("Compat", "the baseline predates the msgid manifest; message ID constants are not compared")
+	}
+	return compat.Compare(old, next), nil
+}
+
+// readCompatBase returns the baseline's schema.fbs and protocol.fbs. A
+// baseline that carries no protocol.fbs is compared with currentProtocol.
+func readCompatBase(base, currentProtocol string) (schema, protocol string, err error) {
+	info, err := os.Stat(base)
+	if err != nil {
+		return "", "", err
+	}
+	if info.IsDir() {
+		found := ""
+		for _, name := range []string{"schema.fbs", filepath.Join("generated", "schema.fbs"), "xll.yaml"} {
+			if _, err := os.Stat(filepath.Join(base, name)); err == nil {
+				found = filepath.Join(base, name)
+				break
+			}
+		}
+		if found == "" {
+			return "", "", fmt.Errorf("%s holds neither schema.fbs, generated/schema.fbs nor xll.yaml", base)
+		}
+		base = found
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(base)); ext {
+	case ".yaml", ".yml":
+		cfg, err := loadCompatConfig(base)
+		if err != nil {
+			return "", "", err
+		}
+		schema, err := generator.RenderSchema(cfg)
+		if err != nil {
+			return "", "", err
+		}
+		printWarning("Compat", "an xll.yaml baseline is rendered by this xll-gen; protocol.fbs and message IDs are compared with themselves")
+		return schema, currentProtocol, nil
+	case ".fbs":
+		data, err := os.ReadFile(base)
+		if err != nil {
+			return "", "", err
+		}
+		proto, err := os.ReadFile(filepath.Join(filepath.Dir(base), "protocol.fbs"))
+		if os.IsNotExist(err) {
+			printWarning("Compat", "no protocol.fbs next to the baseline; comparing with this xll-gen's")
+			return string(data), currentProtocol, nil
+		} else if err != nil {
+			return "", "", err
+		}
+		return string(data), string(proto), nil
+	default:
+		return "", "", fmt.Errorf("%s: baseline must be an xll.yaml, a schema.fbs or a directory", base)
+	}
+}
+
+func loadCompatConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/compat"
+)
+
+const compatYAML = `
+project:
+  name: "demo"
+  version: "0.1.0"
+functions:
+%s
+`
+
+const (
+	compatAdd = `  - name: "Add"
+    args:
+      - name: "a"
+        type: "int"
+      - name: "b"
+        type: "int"
+    return: "int"`
+	compatJoin = `  - name: "JoinText"
+    args:
+      - name: "s"
+        type: "string"
+    return: "string"`
+)
+
+func writeCompatYAML(t *testing.T, dir string, fns ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, "xll.yaml")
+	src := strings.Replace(compatYAML, "%s", strings.Join(fns, "\n"), 1)
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestRunCompat: reordering functions shifts their message IDs and is
+// breaking; appending one is not.
+func TestRunCompat(t *testing.T) {
+	base := t.TempDir()
+	writeCompatYAML(t, base, compatAdd)
+
+	project := t.TempDir()
+	originalWd, _ := os.Getwd()
+	if err := os.Chdir(project); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	writeCompatYAML(t, project, compatAdd, compatJoin)
+	changes, err := runCompat(base)
+	if err != nil {
+		t.Fatalf("runCompat: %v", err)
+	}
+	if compat.Breaking(changes) {
+		t.Errorf("appending a function must be safe, got %+v", changes)
+	}
+	if len(changes) != 1 || changes[0].Subject != "function JoinText" {
+		t.Errorf("want only function JoinText added, got %+v", changes)
+	}
+
+	writeCompatYAML(t, project, compatJoin, compatAdd)
+	changes, err = runCompat(filepath.Join(base, "xll.yaml"))
+	if err != nil {
+		t.Fatalf("runCompat: %v", err)
+	}
+	if !compat.Breaking(changes) {
+		t.Errorf("moving Add to MsgUserStart+1 must be breaking, got %+v", changes)
+	}
+}
+
+// TestReadCompatBaseFbs: a generated/ directory baseline brings its own
+// protocol.fbs.
+func TestReadCompatBaseFbs(t *testing.T) {
+	dir := t.TempDir()
+	gen := filepath.Join(dir, "generated")
+	if err := os.MkdirAll(gen, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(gen, "schema.fbs"), []byte("namespace ipc;\n"), 0644)
+	os.WriteFile(filepath.Join(gen, "protocol.fbs"), []byte("namespace protocol;\n"), 0644)
+
+	schema, protocol, err := readCompatBase(dir, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema != "namespace ipc;\n" || protocol != "namespace protocol;\n" {
+		t.Errorf("got schema %q, protocol %q", schema, protocol)
+	}
+
+	if _, _, err := readCompatBase(t.TempDir(), "current"); err == nil {
+		t.Error("an empty directory must be rejected")
+	}
+}
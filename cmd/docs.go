@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/docs"
+)
+
+var (
+	docsOutput string
+	docsFormat string
+)
+
+// docsCmd renders the reference documentation of xll.yaml.
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate a Markdown and HTML reference from xll.yaml",
+	Long: `Renders every function, command, event and ribbon button declared in
+xll.yaml into reference.md and a standalone reference.html (no external
+assets, with a function filter) in the output directory.
+
+Functions are grouped by category. Each lists its description, an example
+formula (example:, or one built from the argument types), its arguments with
+types and descriptions, the return type, the execution mode and what it
+means, timeout, caching/memoize and retry settings, and help_topic.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runDocs(docsOutput, docsFormat); err != nil {
+			printError("Docs", fmt.Sprintf("%v", err))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	docsCmd.Flags().StringVarP(&docsOutput, "output", "o", "docs", "Output directory")
+	docsCmd.Flags().StringVar(&docsFormat, "format", "all", "Output format: md, html or all")
+	rootCmd.AddCommand(docsCmd)
+}
+
+func runDocs(outDir, format string) error {
+	renderers := map[string]func(*config.Config) ([]byte, error){}
+	switch format {
+	case "md":
+		renderers["reference.md"] = docs.Markdown
+	case "html":
+		renderers["reference.html"] = docs.HTML
+	case "all":
+		renderers["reference.md"] = docs.Markdown
+		renderers["reference.html"] = docs.HTML
+	default:
+		return fmt.Errorf("unknown format %q (want md, html or all)", format)
+	}
+
+	cfg, err := config.Load("xll.yaml")
+	if err != nil {
+		return err
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	for _, name := range []string{"reference.md", "reference.html"} {
+		render, ok := renderers[name]
+		if !ok {
+			continue
+		}
+		out, err := render(cfg)
+		if err != nil {
+			return fmt.Errorf("rendering %s: %w", name, err)
+		}
+		path := filepath.Join(outDir, name)
+		if err := os.WriteFile(path, out, 0644); err != nil {
+			return err
+		}
+		printSuccess(path, fmt.Sprintf("%d functions, %d commands", len(cfg.Functions), len(cfg.Commands)))
+	}
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/cross"
 	"github.com/xll-gen/xll-gen/internal/flatc"
 	"github.com/xll-gen/xll-gen/internal/platform"
 )
@@ -38,6 +39,7 @@ var doctorCmd = &cobra.Command{
 		checkSystem()
 		checkExcelTrustedLocation()
 		checkCompiler()
+		checkCrossToolchain()
 		checkFlatc()
 		checkGo()
 		checkCMake()
@@ -138,6 +140,26 @@ func checkCompiler() {
 	}
 }
 
+// checkCrossToolchain reports the mingw-w64 toolchain that `xll-gen build
+// --target windows-amd64` cross-compiles with. Advisory (WARN) when missing:
+// it is only needed for cross builds, and Windows hosts build natively.
+func checkCrossToolchain() {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	tc, err := cross.Find()
+	if err != nil {
+		printWarning("Cross Compiler", "mingw-w64 NOT FOUND (needed only for `xll-gen build --target windows-amd64`)")
+		printWarning("Action Required", cross.Install)
+		return
+	}
+	if tc.ThreadModel == "win32" {
+		printWarning("Cross Compiler", fmt.Sprintf("Found %s, but %s", tc.CXX, cross.Win32ThreadsHint))
+		return
+	}
+	printSuccess("Cross Compiler", fmt.Sprintf("Found %s (%s threads)", tc.CXX, tc.ThreadModel))
+}
+
 // detectVisualStudio uses vswhere (shipped with VS 2017+ at a fixed location) to
 // report whether a Visual Studio installation with the VC C++ toolset is present,
 // even when cl.exe is not on PATH.
@@ -3,10 +3,12 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/drift"
 	"github.com/xll-gen/xll-gen/internal/generator"
 )
 
@@ -14,11 +16,31 @@ import (
 // This is set via the --no-pid-suffix flag.
 var disablePidSuffix bool
 
+// generateCheck is set via the --check flag.
+var generateCheck bool
+
+// checkDiffLines caps the diff lines --check prints per file.
+const checkDiffLines = 40
+
 // generateCmd represents the generate command.
 var generateCmd = &cobra.Command{
 	Use:   "generate",
 	Short: "Generate Go and C++ code from xll.yaml",
 	Run: func(cmd *cobra.Command, args []string) {
+		if generateCheck {
+			files, err := runGenerateCheck()
+			if err != nil {
+				printError("Check", fmt.Sprintf("%v", err))
+				os.Exit(1)
+			}
+			if len(files) > 0 {
+				printDrift("Out of date:", files)
+				printError("Check", fmt.Sprintf("%d generated files are out of date; run 'xll-gen generate'", len(files)))
+				os.Exit(1)
+			}
+			printSuccess("Check", "generated files are up to date")
+			return
+		}
 		if err := runGenerate(); err != nil {
 			printError("Generation", fmt.Sprintf("%v", err))
 			os.Exit(1)
@@ -28,6 +50,7 @@ var generateCmd = &cobra.Command{
 
 func init() {
 	generateCmd.Flags().BoolVar(&disablePidSuffix, "no-pid-suffix", false, "Disable appending PID to SHM name")
+	generateCmd.Flags().BoolVar(&generateCheck, "check", false, "Write nothing; exit non-zero if the generated files or xll.lock are out of date")
 	rootCmd.AddCommand(generateCmd)
 }
 
@@ -49,6 +72,12 @@ func runGenerate() error {
 		return err
 	}
 
+	// 2. Pin the function IDs just assigned, so the next generate gives every
+	// function the same message ID whatever happens to functions: meanwhile.
+	if err := writeLock(cfg); err != nil {
+		return err
+	}
+
 	warnRtdWithoutComAddIn(cfg)
 
 	modName, err := getModuleName()
@@ -63,6 +92,90 @@ func runGenerate() error {
 	return generator.Generate(cfg, ".", modName, opts)
 }
 
+// runGenerateCheck runs the whole generation into a temporary directory, with
+// the xll.lock generate would write, and compares the result with the project.
+// The project is only read.
+func runGenerateCheck() ([]drift.File, error) {
+	cfg, err := config.Load("xll.yaml")
+	if err != nil {
+		return nil, err
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return nil, err
+	}
+	modName, err := getModuleName()
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "xll-gen-check-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := renderProject(cfg, modName, tmp); err != nil {
+		return nil, err
+	}
+	return drift.Compare(tmp, ".", generator.OwnedPaths(cfg))
+}
+
+// renderProject writes what generate would, xll.lock included, to dir
+// instead of the project.
+func renderProject(cfg *config.Config, modName, dir string) error {
+	prev, err := config.ReadLock(config.LockFile)
+	if err != nil {
+		return err
+	}
+	if err := config.WriteLock(filepath.Join(dir, config.LockFile), config.NewLock(cfg, prev)); err != nil {
+		return err
+	}
+	opts := generator.Options{
+		DisablePidSuffix: disablePidSuffix,
+		OutputDir:        dir,
+	}
+	return generator.Generate(cfg, ".", modName, opts)
+}
+
+// printDrift lists files under header, then the start of each diff.
+func printDrift(header string, files []drift.File) {
+	printHeader(header)
+	for _, f := range files {
+		fmt.Printf("  %-9s %s (+%d -%d)\n", f.Status, f.Path, f.Added, f.Removed)
+	}
+	for _, f := range files {
+		if f.Diff == "" {
+			continue
+		}
+		fmt.Println()
+		lines := strings.SplitAfter(strings.TrimSuffix(f.Diff, "\n"), "\n")
+		if len(lines) > checkDiffLines {
+			fmt.Print(strings.Join(lines[:checkDiffLines], ""))
+			fmt.Printf("\n... %d more lines\n", len(lines)-checkDiffLines)
+			continue
+		}
+		fmt.Println(strings.Join(lines, ""))
+	}
+	fmt.Println()
+}
+
+// writeLock rewrites xll.lock with cfg's function IDs, retiring the IDs of
+// functions that are gone.
+func writeLock(cfg *config.Config) error {
+	prev, err := config.ReadLock(config.LockFile)
+	if err != nil {
+		return err
+	}
+	next := config.NewLock(cfg, prev)
+	if prev != nil {
+		for _, r := range next.Retired[len(prev.Retired):] {
+			printWarning("xll.lock", fmt.Sprintf("retired id %d of function '%s'; it will not be reused", r.ID, r.Name))
+		}
+	}
+	return config.WriteLock(config.LockFile, next)
+}
+
 // warnRtdWithoutComAddIn warns when a project enables RTD but has no ribbon AND no
 // commands, because that combination silently opts out of the close-time
 // use-after-unload protection.
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/drift"
+)
+
+// TestGenerateCheck: a freshly generated project passes; a hand edit and a
+// file generate would prune fail it, and the check leaves both in place.
+func TestGenerateCheck(t *testing.T) {
+	projectDir := filepath.Join(t.TempDir(), "check-project")
+	if err := runInit(projectDir, false, false); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	originalWd, _ := os.Getwd()
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+	defer os.Chdir(originalWd)
+
+	if err := runGenerate(); err != nil {
+		t.Fatalf("runGenerate: %v", err)
+	}
+	files, err := runGenerateCheck()
+	if err != nil {
+		t.Fatalf("runGenerateCheck: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("fresh project must be up to date, got %+v", files)
+	}
+
+	iface := filepath.Join("generated", "interface.go")
+	src, err := os.ReadFile(iface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(iface, append(src, "// edited\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join("generated", "cpp", "src", "stale.cpp")
+	if err := os.WriteFile(stale, []byte("int stale;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err = runGenerateCheck()
+	if err != nil {
+		t.Fatalf("runGenerateCheck: %v", err)
+	}
+	want := map[string]drift.Status{
+		"generated/cpp/src/stale.cpp": drift.Stale,
+		"generated/interface.go":      drift.Modified,
+	}
+	if len(files) != len(want) {
+		t.Fatalf("want %v, got %+v", want, files)
+	}
+	for _, f := range files {
+		if want[f.Path] != f.Status {
+			t.Errorf("%s: got %s, want %s", f.Path, f.Status, want[f.Path])
+		}
+	}
+	if _, err := os.Stat(stale); err != nil {
+		t.Errorf("--check must not prune: %v", err)
+	}
+}
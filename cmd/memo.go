@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/pkg/rtd"
+	"github.com/xll-gen/xll-gen/pkg/server"
+)
+
+// memoPurgeDir overrides the store directory derived from xll.yaml
+// (--dir on `memo purge`).
+var memoPurgeDir string
+
+// memoCmd groups the rtd-once disk memoize store (memoize_store: "disk")
+// maintenance commands.
+var memoCmd = &cobra.Command{
+	Use:   "memo",
+	Short: "Manage the rtd-once disk memoize store",
+}
+
+// memoPurgeCmd deletes every persisted rtd-once result.
+var memoPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete all rtd-once results persisted by memoize_store: disk",
+	Long: `Deletes every rtd-once result persisted by memoize_store: "disk", so the
+next Excel session recomputes them. The directory is rtd.memoize_dir (or
+<logging.dir>/<project>_memo) from xll.yaml, resolved on THIS machine; use
+--dir for a store elsewhere. Only files the store owns are removed.
+
+Run it while Excel is closed: a running add-in keeps serving the results it
+already holds in memory, and re-persists them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := runMemoPurge(memoPurgeDir)
+		if err != nil {
+			printError("Memo purge", fmt.Sprintf("%v", err))
+			os.Exit(1)
+		}
+		printSuccess("Memo purge", "purged "+dir)
+	},
+}
+
+func init() {
+	memoPurgeCmd.Flags().StringVar(&memoPurgeDir, "dir", "", "Store directory (default: derived from xll.yaml)")
+	memoCmd.AddCommand(memoPurgeCmd)
+	rootCmd.AddCommand(memoCmd)
+}
+
+// runMemoPurge purges dir, or the store directory xll.yaml names when dir is
+// empty, and returns the directory it purged.
+func runMemoPurge(dir string) (string, error) {
+	if dir == "" {
+		cfg, err := config.Load("xll.yaml")
+		if err != nil {
+			return "", err
+		}
+		dir, err = memoStoreDir(cfg)
+		if err != nil {
+			return "", err
+		}
+	}
+	return dir, rtd.PurgeDiskMemo(dir)
+}
+
+// memoStoreDir resolves the store directory from xll.yaml the way the
+// generated server does. ${XLL_DIR} and ${BIN_DIR} are only known inside the
+// running add-in, so a path built from them is refused instead of guessed.
+func memoStoreDir(cfg *config.Config) (string, error) {
+	dirSpec := cfg.Rtd.MemoizeDir
+	if dirSpec == "" {
+		dirSpec = cfg.Logging.Dir
+	}
+	for _, ph := range []string{"${XLL_DIR}", "${BIN_DIR}"} {
+		if strings.Contains(dirSpec, ph) {
+			return "", fmt.Errorf("the memoize store path %q uses %s, which only resolves inside the running add-in; pass --dir", dirSpec, ph)
+		}
+	}
+	return server.RtdMemoizeDir(cfg.Logging.Dir, cfg.Rtd.MemoizeDir, cfg.Project.Name), nil
+}
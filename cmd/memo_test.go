@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/pkg/rtd"
+)
+
+// TestRunMemoPurge_ClearsTheStore: after a purge a reopened store misses.
+func TestRunMemoPurge_ClearsTheStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := rtd.OpenDiskMemo(dir, "1.0.0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = store.WrapValue("k", 0, func(context.Context) (any, error) { return "v", nil })(context.Background())
+
+	if got, err := runMemoPurge(dir); err != nil || got != dir {
+		t.Fatalf("runMemoPurge = (%q, %v)", got, err)
+	}
+	ents, _ := os.ReadDir(dir)
+	if len(ents) != 0 {
+		t.Fatalf("store not empty after purge: %v", ents)
+	}
+}
+
+// TestMemoStoreDir_RefusesAddinOnlyPlaceholders: ${XLL_DIR} / ${BIN_DIR} would
+// resolve to the CLI's own location here, which is never the add-in's store.
+func TestMemoStoreDir_RefusesAddinOnlyPlaceholders(t *testing.T) {
+	cfg := &config.Config{Project: config.ProjectConfig{Name: "Proj"}}
+	cfg.Logging.Dir = "${XLL_DIR}/logs"
+	if _, err := memoStoreDir(cfg); err == nil || !strings.Contains(err.Error(), "--dir") {
+		t.Fatalf("want a --dir hint, got %v", err)
+	}
+
+	base := t.TempDir()
+	t.Setenv("MEMO_BASE", base)
+	cfg.Rtd.MemoizeDir = "${MEMO_BASE}/memo"
+	got, err := memoStoreDir(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(base, "memo"); filepath.Clean(got) != want {
+		t.Errorf("memoStoreDir = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/pkg/msgid"
+	"github.com/xll-gen/xll-gen/pkg/record"
+)
+
+// replayTestFile is the go test `xll-gen replay` writes into the project root
+// for the length of one run.
+const replayTestFile = "xllgen_replay_test.go"
+
+// replayTestMarker is the first line of replayTestFile; a file by that name
+// without it belongs to the user and is never overwritten.
+const replayTestMarker = "// Code generated by xll-gen replay. DO NOT EDIT."
+
+var (
+	replayService string
+	replayVerbose bool
+)
+
+// replayCmd feeds an IPC recording back through the generated server.
+var replayCmd = &cobra.Command{
+	Use:   "replay <file>",
+	Short: "Replay a recorded IPC session against the generated server and diff the responses",
+	Long: `Replays a recording made with server.record_dir (or XLLGEN_RECORD_DIR) through
+the generated Go server of the project in the current directory, with no
+Excel: every recorded request goes over the real dispatch path (pkg/xllhost
+plays the XLL) in the order the server first received it, and each response
+is compared byte for byte with the recorded one. Prints one row per request
+and exits non-zero if any response differs.
+
+The service under test is the value main passes to <package>.Serve; use
+--service when main builds it in a way a test cannot repeat.
+
+Run 'xll-gen generate' first; the project must compile with 'go test'.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		results, err := runReplay(args[0])
+		if err != nil {
+			printError("Replay", fmt.Sprintf("%v", err))
+			os.Exit(1)
+		}
+		if failed := record.Failed(results); failed > 0 {
+			printError("Replay", fmt.Sprintf("%d of %d responses differ from the recording", failed, len(results)))
+			os.Exit(1)
+		}
+		printSuccess("Replay", fmt.Sprintf("all %d responses match the recording", len(results)))
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayService, "service", "", "Go expression for the service under test (default: the argument main passes to Serve)")
+	replayCmd.Flags().BoolVarP(&replayVerbose, "verbose", "v", false, "Show the go test output")
+	rootCmd.AddCommand(replayCmd)
+}
+
+// runReplay generates the replay test, runs it with go test and prints the
+// table. A differing response is not an error, but a run that produced no
+// results is.
+func runReplay(file string) ([]record.Result, error) {
+	cfg, err := config.Load("xll.yaml")
+	if err != nil {
+		return nil, err
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return nil, err
+	}
+	// Read here too, so a file that is not a recording fails before a build.
+	frames, err := record.ReadFile(file)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		printWarning("Replay", fmt.Sprintf("%v; replaying the complete frames", err))
+	} else if err != nil {
+		return nil, err
+	}
+	exchanges := record.Pair(frames)
+	if len(exchanges) == 0 {
+		return nil, fmt.Errorf("%s holds no requests", file)
+	}
+	recPath, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	pkg := cfg.GoPackage()
+	if _, err := os.Stat(filepath.Join(pkg, "server.go")); err != nil {
+		return nil, fmt.Errorf("%s/server.go not found; run 'xll-gen generate' first", pkg)
+	}
+	modName, err := getModuleName()
+	if err != nil {
+		return nil, err
+	}
+	service := replayService
+	if service == "" {
+		if service, err = findService(".", modName+"/"+pkg); err != nil {
+			return nil, err
+		}
+	}
+
+	src, err := renderReplayTest(modName, pkg, service)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeProjectTest(replayTestFile, replayTestMarker, src); err != nil {
+		return nil, err
+	}
+	defer os.Remove(replayTestFile)
+
+	resultsFile, err := os.CreateTemp("", "xllgen-replay-*.json")
+	if err != nil {
+		return nil, err
+	}
+	resultsPath := resultsFile.Name()
+	resultsFile.Close()
+	defer os.Remove(resultsPath)
+
+	printHeader(fmt.Sprintf("Replaying %d requests from %s...", len(exchanges), file))
+	start := time.Now()
+	goTest := exec.Command("go", "test", "-count=1", "-run", "^TestXllGenReplay$", ".")
+	goTest.Env = append(os.Environ(),
+		record.EnvReplayFile+"="+recPath,
+		record.EnvReplayResults+"="+resultsPath)
+	out, runErr := goTest.CombinedOutput()
+	if replayVerbose {
+		os.Stdout.Write(out)
+	}
+
+	// go test exits non-zero when a response differs, so its exit status
+	// alone says nothing; the results file says whether the replay ran.
+	results, err := record.ReadResults(resultsPath)
+	if err != nil {
+		if runErr == nil {
+			runErr = err
+		}
+		return nil, fmt.Errorf("go test did not replay the recording (%v):\n%s", runErr, out)
+	}
+
+	fmt.Println()
+	if err := record.WriteTable(os.Stdout, results, msgTypeNamer(cfg)); err != nil {
+		return nil, err
+	}
+	fmt.Printf("\n%d requests in %v\n", len(results), time.Since(start).Round(time.Millisecond))
+	return results, nil
+}
+
+// renderReplayTest renders the replay test for module/pkg serving service.
+func renderReplayTest(module, pkg, service string) ([]byte, error) {
+	return renderProjectTest("replay_test.go.tmpl", service, map[string]string{
+		"Module":  module,
+		"Package": pkg,
+		"Service": service,
+		"EnvFile": record.EnvReplayFile,
+	})
+}
+
+// systemMsgNames labels the host->guest system messages in the replay table.
+var systemMsgNames = map[uint32]string{
+	msgid.MsgSetRefCache:         "SetRefCache",
+	msgid.MsgCalculationEnded:    "CalculationEnded",
+	msgid.MsgCalculationCanceled: "CalculationCanceled",
+	msgid.MsgRtdConnect:          "RtdConnect",
+	msgid.MsgRtdDisconnect:       "RtdDisconnect",
+	msgid.MsgCommandInvoke:       "CommandInvoke",
+	msgid.MsgHandshake:           "Handshake",
+}
+
+// msgTypeNamer labels a message ID with the function or system message it
+// dispatches to under cfg.
+func msgTypeNamer(cfg *config.Config) func(uint32) string {
+	return func(t uint32) string {
+		if name, ok := systemMsgNames[t]; ok {
+			return name
+		}
+		for i, fn := range cfg.Functions {
+			if t == uint32(msgid.MsgUserStart+fn.MsgOffset(i)) {
+				return fn.Name
+			}
+		}
+		return fmt.Sprintf("msg %d", t)
+	}
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+func TestRenderReplayTest(t *testing.T) {
+	src, err := renderReplayTest("demo", "generated", "&MyService{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(src)
+	for _, want := range []string{
+		`"demo/generated"`,
+		"go generated.ServeConn(&MyService{}, h)",
+		"func TestXllGenReplay(t *testing.T)",
+		"record.Replay(",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered test lacks %q:\n%s", want, out)
+		}
+	}
+	if !strings.HasPrefix(out, replayTestMarker) {
+		t.Error("the marker must be the first line, or writeProjectTest refuses to overwrite its own file")
+	}
+}
+
+func TestMsgTypeNamer(t *testing.T) {
+	pinned := 4
+	name := msgTypeNamer(&config.Config{Functions: []config.Function{{Name: "Add"}, {Name: "Quote"}, {Name: "Bid", ID: &pinned}}})
+	for msgType, want := range map[uint32]string{
+		131: "CalculationEnded",
+		141: "Handshake",
+		142: "Add",
+		143: "Quote",
+		144: "msg 144",
+		146: "Bid",
+		7:   "msg 7",
+	} {
+		if got := name(msgType); got != want {
+			t.Errorf("name(%d) = %q, want %q", msgType, got, want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/scan"
+	"gopkg.in/yaml.v3"
+)
+
+var scanDryRun bool
+
+// scanCmd derives the functions: section of xll.yaml from Go declarations.
+var scanCmd = &cobra.Command{
+	Use:   "scan [packages]",
+	Short: "Derive xll.yaml functions from an annotated Go service",
+	Long: `Reads the methods of the type marked //xll:service whose doc comment has an
+//xll:function directive, maps their signatures back to xll.yaml types, and
+adds or updates those functions in ./xll.yaml (created if missing):
+
+  // Scale multiplies x by k.
+  //xll:function mode=async category=Math
+  func (s *Service) Scale(ctx context.Context, x, k float64) (float64, error)
+
+The doc comment is the description. The directive takes id, description,
+category, mode, return (_RTD methods only), shortcut, help_topic, example,
+timeout, memoize_ttl, memoize_store, loading_placeholder, and the bools
+volatile, resizable, macro and memoize; quote a value with spaces. A method named
+<Name>_RTD declares the mode:"rtd" function <Name>, and a last parameter
+'caller *protocol.Range' sets caller: true.
+
+An existing function keeps the keys the scan does not set, such as cache and
+retry, and its argument descriptions. Functions only xll.yaml declares are
+kept and listed. Any method that cannot be mapped is reported with its
+position, and nothing is written. Packages default to ./... .`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			args = []string{"./..."}
+		}
+		if err := runScan(args); err != nil {
+			printError("Scan", fmt.Sprintf("%v", err))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	scanCmd.Flags().BoolVar(&scanDryRun, "dry-run", false, "Print the updated xll.yaml instead of writing it")
+	rootCmd.AddCommand(scanCmd)
+}
+
+func runScan(patterns []string) error {
+	dirs, err := scan.Dirs(patterns)
+	if err != nil {
+		return err
+	}
+	printHeader(fmt.Sprintf("Scanning %d packages...", len(dirs)))
+	res, err := scan.Scan(dirs)
+	if err != nil {
+		return err
+	}
+	if len(res.Problems) > 0 {
+		for _, p := range res.Problems {
+			fmt.Fprintf(os.Stderr, "  %s\n", p)
+		}
+		return fmt.Errorf("%d declarations of %s cannot be mapped to xll.yaml; nothing was written", len(res.Problems), res.Service)
+	}
+
+	data, err := os.ReadFile("xll.yaml")
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = newScanConfig()
+	}
+	if err != nil {
+		return err
+	}
+	out, stale, err := mergeScanned(data, res.Functions)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.ParseWithLock(out, config.LockFile)
+	if err != nil {
+		return err
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return fmt.Errorf("the scanned functions do not validate: %w", err)
+	}
+
+	if scanDryRun {
+		os.Stdout.Write(out)
+	} else {
+		if err := os.WriteFile("xll.yaml", out, 0644); err != nil {
+			return err
+		}
+		printSuccess("xll.yaml", fmt.Sprintf("%d functions from %s", len(res.Functions), res.Service))
+	}
+	if len(stale) > 0 {
+		printWarning("Scan", fmt.Sprintf("xll.yaml also declares %s, which %s does not mark //xll:function", strings.Join(stale, ", "), res.Service))
+	}
+	if !scanDryRun {
+		fmt.Println("Run 'xll-gen generate' to regenerate the service interface.")
+	}
+	return nil
+}
+
+// newScanConfig returns a minimal xll.yaml named after the module.
+func newScanConfig() ([]byte, error) {
+	mod, err := getModuleName()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("project:\n  name: %q\n  version: \"0.1.0\"\nfunctions:\n", path.Base(mod))), nil
+}
+
+// ownedKeys are the function keys a scan derives from the signature, so an
+// existing entry drops them when the scan leaves them out.
+var ownedKeys = []string{"mode", "caller", "async"}
+
+// mergeScanned adds fns to the functions: section of the xll.yaml in data,
+// replacing what the scan sets on an existing function of the same name. It
+// returns the functions only xll.yaml declares.
+func mergeScanned(data []byte, fns []scan.Function) ([]byte, []string, error) {
+	doc, seq, err := configSection(data, "functions")
+	if err != nil {
+		return nil, nil, err
+	}
+	scanned := map[string]bool{}
+	for _, fn := range fns {
+		scanned[fn.Name] = true
+		n := scannedNode(fn)
+		var old *yaml.Node
+		for _, item := range seq.Content {
+			if itemKey(item) == fn.Name {
+				old = item
+			}
+		}
+		if old == nil {
+			seq.Content = append(seq.Content, n)
+			continue
+		}
+		for _, k := range ownedKeys {
+			if mappingValue(n, k) == nil {
+				deleteMappingKey(old, k)
+			}
+		}
+		if args, oldArgs := mappingValue(n, "args"), mappingValue(old, "args"); args != nil && oldArgs != nil {
+			keepArgDescriptions(args, oldArgs)
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			setMappingValue(old, n.Content[i].Value, n.Content[i+1])
+		}
+		if mappingValue(n, "args") == nil {
+			deleteMappingKey(old, "args")
+		}
+	}
+	var stale []string
+	for _, item := range seq.Content {
+		if k := itemKey(item); !scanned[k] {
+			stale = append(stale, k)
+		}
+	}
+	out, err := encodeConfig(doc)
+	return out, stale, err
+}
+
+// scannedNode is the functions: entry of fn: what `add function` writes, plus
+// the other keys its directive sets.
+func scannedNode(fn scan.Function) *yaml.Node {
+	n := functionNode(fn.Function)
+	for _, d := range fn.Directives {
+		switch d.Key {
+		case "description", "category", "mode", "return":
+			continue
+		}
+		v := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: d.Value, Style: yaml.DoubleQuotedStyle}
+		switch d.Kind {
+		case "bool":
+			v.Tag, v.Style = "!!bool", 0
+		case "int":
+			v.Tag, v.Style = "!!int", 0
+		}
+		setMappingValue(n, d.Key, v)
+	}
+	return n
+}
+
+// keepArgDescriptions copies the description of each argument in old to the
+// argument of the same name in args that has none.
+func keepArgDescriptions(args, old *yaml.Node) {
+	for _, a := range args.Content {
+		if mappingValue(a, "description") != nil {
+			continue
+		}
+		for _, o := range old.Content {
+			if o.Kind == yaml.MappingNode && mappingValue(o, "name") != nil &&
+				mappingValue(o, "name").Value == mappingValue(a, "name").Value {
+				if d := mappingValue(o, "description"); d != nil {
+					a.Content = append(a.Content, yamlKey("description"), d)
+				}
+			}
+		}
+	}
+}
+
+// setMappingValue replaces the value of key in mapping n, keeping its line
+// comment, or appends it.
+func setMappingValue(n *yaml.Node, key string, v *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			if v.LineComment == "" {
+				v.LineComment = n.Content[i+1].LineComment
+			}
+			n.Content[i+1] = v
+			return
+		}
+	}
+	n.Content = append(n.Content, yamlKey(key), v)
+}
+
+func deleteMappingKey(n *yaml.Node, key string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return
+		}
+	}
+}
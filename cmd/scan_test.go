@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/scan"
+)
+
+const scanYAML = `project:
+  name: "demo"
+functions:
+  - name: "Scale" # from Go
+    description: "Old text"
+    mode: "async"
+    args:
+      - name: "x"
+        type: "float"
+        description: "The value"
+    return: "float"
+    retry:
+      attempts: 3
+  - name: "Legacy"
+    return: "int"
+`
+
+// TestMergeScanned: a scanned function replaces what the scan sets and keeps
+// the rest of its entry; a new one is appended; one only xll.yaml declares is
+// kept and reported.
+func TestMergeScanned(t *testing.T) {
+	id := 9
+	fns := []scan.Function{
+		{Function: config.Function{
+			Name:   "Scale",
+			Return: "float",
+			Args:   []config.Arg{{Name: "x", Type: "float"}, {Name: "k", Type: "float"}},
+		}},
+		{
+			Function: config.Function{Name: "Quote", Mode: "rtd", Return: "any", ID: &id, Volatile: true,
+				Args: []config.Arg{{Name: "symbol", Type: "string"}}},
+			Directives: []scan.Directive{{Key: "id", Value: "9", Kind: "int"}, {Key: "volatile", Value: "true", Kind: "bool"}},
+		},
+	}
+	out, stale, err := mergeScanned([]byte(scanYAML), fns)
+	if err != nil {
+		t.Fatalf("mergeScanned: %v", err)
+	}
+	if len(stale) != 1 || stale[0] != "Legacy" {
+		t.Errorf("stale = %v, want [Legacy]", stale)
+	}
+	s := string(out)
+	for _, want := range []string{"# from Go", `description: "Old text"`, `description: "The value"`, "attempts: 3", "id: 9", "volatile: true"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("output lacks %q:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, `mode: "async"`) {
+		t.Errorf("Scale is sync now; mode must be dropped:\n%s", s)
+	}
+
+	cfg, err := config.Parse(out)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(cfg.Functions) != 3 {
+		t.Fatalf("want Scale, Legacy, Quote; got %+v", cfg.Functions)
+	}
+	scale, quote := cfg.Functions[0], cfg.Functions[2]
+	if len(scale.Args) != 2 || scale.Args[1].Name != "k" || scale.Retry == nil {
+		t.Errorf("Scale = %+v", scale)
+	}
+	if quote.Name != "Quote" || quote.Mode != "rtd" || quote.ID == nil || *quote.ID != 9 || !quote.Volatile {
+		t.Errorf("Quote = %+v", quote)
+	}
+}
@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/drift"
+	"github.com/xll-gen/xll-gen/internal/generator"
+	"github.com/xll-gen/xll-gen/internal/ui"
+	"github.com/xll-gen/xll-gen/internal/upgrade"
+	"github.com/xll-gen/xll-gen/version"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	upgradeTo    string
+	upgradeForce bool
+)
+
+// upgradeDelegatedEnv marks an upgrade that another xll-gen started with
+// `go run`, so a release that misreports its version cannot loop.
+const upgradeDelegatedEnv = "XLL_GEN_UPGRADE_DELEGATED"
+
+// upgradeCmd migrates the project in the current directory to a release.
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Migrate the project to a newer xll-gen release",
+	Long: `Moves the project in the current directory to an xll-gen release (default:
+this one). It rewrites deprecated xll.yaml keys and says why, requires the
+release in go.mod, regenerates, and prints the behavior-relevant changes
+between the release that last generated the project and the new one.
+
+Before writing anything it compares the generated files with
+<package>/xll-gen.sum, which generate writes. A generated file edited by hand
+that the new release would overwrite stops the upgrade, with its diff; move the
+edit out of the generated package or pass --force to overwrite it.
+
+--to a release other than this binary's runs that release's upgrade with
+'go run github.com/xll-gen/xll-gen@<version>', since only it has its own
+templates.`,
+	Example: `  xll-gen upgrade
+  xll-gen upgrade --to v0.9.0`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runUpgrade(upgradeTo, upgradeForce); err != nil {
+			printError("Upgrade", fmt.Sprintf("%v", err))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	upgradeCmd.Flags().StringVar(&upgradeTo, "to", version.Version, "Release to upgrade to")
+	upgradeCmd.Flags().BoolVar(&upgradeForce, "force", false, "Overwrite generated files edited by hand")
+	rootCmd.AddCommand(upgradeCmd)
+}
+
+// runUpgrade upgrades the project in the current directory to release to.
+func runUpgrade(to string, force bool) error {
+	if !upgrade.IsVersion(to) {
+		return fmt.Errorf("--to %q: want a release such as %s", to, version.Version)
+	}
+	from := upgrade.ProjectVersion(".")
+	if upgrade.IsVersion(from) && upgrade.Compare(to, from) < 0 {
+		return fmt.Errorf("the project was generated by xll-gen %s, newer than %s; upgrade does not downgrade", from, to)
+	}
+	if to != version.Version {
+		return delegateUpgrade(to, force)
+	}
+
+	data, err := os.ReadFile("xll.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to read xll.yaml: %w", err)
+	}
+	migrated, changes, err := migrateConfig(data)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.ParseWithLock(migrated, config.LockFile)
+	if err != nil {
+		return err
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return err
+	}
+
+	// Find hand edits before anything is written, so a refused upgrade
+	// leaves the project as it was.
+	sums, err := generator.ReadSum(cfg, ".")
+	if err != nil {
+		return err
+	}
+	var overwritten []drift.File
+	if sums == nil {
+		printWarning("Hand edits", fmt.Sprintf("no %s/%s, so generated files edited by hand cannot be told apart; "+
+			"they will be overwritten. Commit or stash them first", cfg.GoPackage(), generator.SumFile))
+	} else {
+		edited, err := generator.Edited(".", sums)
+		if err != nil {
+			return err
+		}
+		if len(edited) > 0 {
+			if overwritten, err = renderConflicts(cfg, edited); err != nil {
+				return err
+			}
+		}
+	}
+	if len(overwritten) > 0 {
+		printDrift("Generated files edited by hand:", overwritten)
+		if !force {
+			return fmt.Errorf("%d generated files edited by hand would be overwritten; move the edits out of %s/ or rerun with --force",
+				len(overwritten), cfg.GoPackage())
+		}
+	}
+
+	if len(changes) > 0 {
+		if err := os.WriteFile("xll.yaml", migrated, 0644); err != nil {
+			return err
+		}
+		printHeader("xll.yaml:")
+		for _, c := range changes {
+			fmt.Printf("  line %d: %s\n      %s\n", c.Line, c.summary(), c.Why)
+		}
+		fmt.Println()
+	}
+
+	if err := requireRelease(to); err != nil {
+		return err
+	}
+	if err := runGenerate(); err != nil {
+		return err
+	}
+	for _, f := range overwritten {
+		printWarning("Overwritten", f.Path)
+	}
+
+	printChangelog(from, to)
+	return nil
+}
+
+// delegateUpgrade runs release to's own upgrade in the current directory.
+func delegateUpgrade(to string, force bool) error {
+	if os.Getenv(upgradeDelegatedEnv) != "" {
+		return fmt.Errorf("xll-gen %s was asked to upgrade to %s; run 'go run %s@%s upgrade' yourself", version.Version, to, upgrade.Module, to)
+	}
+	args := []string{"run", upgrade.Module + "@" + to, "upgrade", "--to", to}
+	if force {
+		args = append(args, "--force")
+	}
+	printHeader(fmt.Sprintf("Running xll-gen %s: go %s", to, strings.Join(args, " ")))
+	c := exec.Command("go", args...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	c.Env = append(os.Environ(), upgradeDelegatedEnv+"=1")
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("xll-gen %s upgrade: %w", to, err)
+	}
+	return nil
+}
+
+// renderConflicts renders cfg into a temporary directory and returns the
+// hand-edited files it would overwrite.
+func renderConflicts(cfg *config.Config, edited []string) ([]drift.File, error) {
+	modName, err := getModuleName()
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "xll-gen-upgrade-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := renderProject(cfg, modName, tmp); err != nil {
+		return nil, err
+	}
+	return editConflicts(".", tmp, edited)
+}
+
+// editConflicts returns the edited files under project, slash-separated
+// paths, whose content differs from the rendered output: Modified with the
+// diff to the new file, or Stale when the new release no longer writes it.
+func editConflicts(project, rendered string, edited []string) ([]drift.File, error) {
+	var out []drift.File
+	for _, p := range edited {
+		have, err := os.ReadFile(filepath.Join(project, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, err
+		}
+		want, err := os.ReadFile(filepath.Join(rendered, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			_, _, removed := drift.Unified(p, have, nil)
+			out = append(out, drift.File{Path: p, Status: drift.Stale, Removed: removed})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		norm := func(b []byte) []byte { return bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n")) }
+		if bytes.Equal(norm(have), norm(want)) {
+			continue
+		}
+		f := drift.File{Path: p, Status: drift.Modified}
+		f.Diff, f.Added, f.Removed = drift.Unified(p, have, want)
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// requireRelease points go.mod's xll-gen requirement at release to; the
+// regenerate that follows tidies it.
+func requireRelease(to string) error {
+	if upgrade.Required(".") == to {
+		return nil
+	}
+	err := ui.RunSpinner("Updating xll-gen dependency...", func() error {
+		out, err := exec.Command("go", "get", upgrade.Module+"@"+to).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("go get %s@%s: %w: %s", upgrade.Module, to, err, out)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	printSuccess("go.mod", fmt.Sprintf("requires %s %s", upgrade.Module, to))
+	return nil
+}
+
+// printChangelog prints the behavior-relevant changes from release from to
+// release to.
+func printChangelog(from, to string) {
+	notes := upgrade.Changelog(from, to)
+	if !upgrade.IsVersion(from) {
+		from = "an unknown release"
+	}
+	if len(notes) == 0 {
+		printSuccess("Upgraded", fmt.Sprintf("%s to %s; no behavior-relevant changes", from, to))
+		return
+	}
+	printHeader(fmt.Sprintf("Changes from %s to %s:", from, to))
+	for _, n := range notes {
+		fmt.Printf("  %s%s%s (%s)\n      %s\n", colorBold, n.Title, colorReset, n.Version, n.Detail)
+	}
+	fmt.Println()
+}
+
+// configChange is one deprecated xll.yaml key migrateConfig rewrote.
+type configChange struct {
+	// Line is where the key was.
+	Line int
+	// From is the old key; To the new one, or "" when the key was dropped.
+	From, To string
+	Why      string
+}
+
+func (c configChange) summary() string {
+	if c.To == "" {
+		return "removed " + c.From
+	}
+	return c.From + " -> " + c.To
+}
+
+// migrateConfig rewrites the deprecated keys of the xll.yaml in data and
+// returns the result with what it changed. Like add, it edits the node tree,
+// keeping comments and key order; data comes back untouched when nothing is
+// deprecated.
+func migrateConfig(data []byte) ([]byte, []configChange, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse xll.yaml: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("xll.yaml is not a mapping")
+	}
+	root := doc.Content[0]
+
+	var changes []configChange
+	if server := mappingValue(root, "server"); server != nil && server.Kind == yaml.MappingNode {
+		if c, ok := migrateServerCommand(server); ok {
+			changes = append(changes, c)
+		}
+	}
+	if fns := mappingValue(root, "functions"); fns != nil && fns.Kind == yaml.SequenceNode {
+		for _, fn := range fns.Content {
+			if fn.Kind != yaml.MappingNode {
+				continue
+			}
+			c, ok, err := migrateAsync(fn)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				changes = append(changes, c)
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return data, nil, nil
+	}
+	out, err := encodeConfig(&doc)
+	return out, changes, err
+}
+
+// migrateServerCommand moves server.command to server.launch.command, or
+// drops it when server.launch.command, which wins, is already set.
+func migrateServerCommand(server *yaml.Node) (configChange, bool) {
+	i := mappingIndex(server, "command")
+	if i < 0 {
+		return configChange{}, false
+	}
+	key, val := server.Content[i], server.Content[i+1]
+	c := configChange{Line: key.Line, From: "server.command"}
+
+	launch := mappingValue(server, "launch")
+	if launch != nil && launch.Kind == yaml.MappingNode {
+		if cur := mappingValue(launch, "command"); cur != nil && cur.Value != "" {
+			c.Why = "server.launch.command is set and takes precedence, so this value was never used"
+			server.Content = append(server.Content[:i], server.Content[i+2:]...)
+			return c, true
+		}
+	}
+	switch {
+	case launch == nil:
+		launch = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		server.Content = append(server.Content, yamlKey("launch"), launch)
+	case launch.Kind == yaml.ScalarNode && launch.Tag == "!!null":
+		launch.Kind, launch.Tag, launch.Value = yaml.MappingNode, "!!map", ""
+	}
+	if j := mappingIndex(launch, "command"); j >= 0 {
+		launch.Content[j+1] = val
+	} else {
+		launch.Content = append(launch.Content, key, val)
+	}
+	c.To = "server.launch.command"
+	c.Why = "server.command is deprecated; server.launch.command is the same setting"
+	server.Content = append(server.Content[:i], server.Content[i+2:]...)
+	return c, true
+}
+
+// migrateAsync replaces a function's async flag with the mode it means, or
+// drops it when mode, which supersedes it, is set.
+func migrateAsync(fn *yaml.Node) (configChange, bool, error) {
+	i := mappingIndex(fn, "async")
+	if i < 0 {
+		return configChange{}, false, nil
+	}
+	key, val := fn.Content[i], fn.Content[i+1]
+	c := configChange{Line: key.Line, From: fmt.Sprintf("functions[%s].async", itemKey(fn))}
+	var async bool
+	if err := val.Decode(&async); err != nil {
+		return c, false, fmt.Errorf("xll.yaml:%d: async: %w", val.Line, err)
+	}
+	mode := mappingValue(fn, "mode")
+	switch {
+	case mode != nil && mode.Value != "":
+		c.Why = "mode is set and supersedes async, so this flag was ignored"
+	case async:
+		c.To = fmt.Sprintf("functions[%s].mode", itemKey(fn))
+		c.Why = `async: true is deprecated; it means mode: "async"`
+		if mode != nil {
+			mode.Value, mode.Tag = "async", "!!str"
+			break
+		}
+		key.Value = "mode"
+		fn.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "async", Style: yaml.DoubleQuotedStyle,
+			LineComment: val.LineComment}
+		return c, true, nil
+	default:
+		c.Why = `async: false is deprecated; it means the default, mode: "sync"`
+	}
+	fn.Content = append(fn.Content[:i], fn.Content[i+2:]...)
+	return c, true, nil
+}
+
+// mappingIndex returns the index of key's node in mapping n, or -1.
+func mappingIndex(n *yaml.Node, key string) int {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/drift"
+)
+
+const legacyYAML = `project:
+  name: "demo"
+functions:
+  - name: "Fetch"
+    return: "string"
+    async: true # slow
+  - name: "Add"
+    return: "int"
+    async: false
+  - name: "Quote"
+    return: "any"
+    mode: "rtd"
+    async: true
+server:
+  # launch the wrapper
+  command: "\"${BIN}\" --verbose"
+  timeout: "10s"
+`
+
+// TestMigrateConfig: deprecated keys become their replacements with the same
+// meaning, comments survive, and the result parses back.
+func TestMigrateConfig(t *testing.T) {
+	out, changes, err := migrateConfig([]byte(legacyYAML))
+	if err != nil {
+		t.Fatalf("migrateConfig: %v", err)
+	}
+	want := []configChange{
+		{Line: 16, From: "server.command", To: "server.launch.command"},
+		{Line: 6, From: "functions[Fetch].async", To: "functions[Fetch].mode"},
+		{Line: 9, From: "functions[Add].async"},
+		{Line: 13, From: "functions[Quote].async"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %+v", changes)
+	}
+	for i, c := range changes {
+		if c.Line != want[i].Line || c.From != want[i].From || c.To != want[i].To || c.Why == "" {
+			t.Errorf("change %d = %+v, want %+v", i, c, want[i])
+		}
+	}
+	s := string(out)
+	for _, keep := range []string{"# slow", "# launch the wrapper"} {
+		if !strings.Contains(s, keep) {
+			t.Errorf("comment %q lost:\n%s", keep, s)
+		}
+	}
+	if strings.Contains(s, "async:") {
+		t.Errorf("async left in:\n%s", s)
+	}
+
+	cfg, err := config.Parse(out)
+	if err != nil {
+		t.Fatalf("Parse: %v\n%s", err, s)
+	}
+	if cfg.Server.Command != "" || cfg.Server.Launch == nil || cfg.Server.Launch.Command != `"${BIN}" --verbose` {
+		t.Errorf("server = %+v, launch = %+v", cfg.Server, cfg.Server.Launch)
+	}
+	for i, mode := range []string{"async", "", "rtd"} {
+		if fn := cfg.Functions[i]; fn.Mode != mode || fn.Async {
+			t.Errorf("%s: mode %q async %v, want mode %q", fn.Name, fn.Mode, fn.Async, mode)
+		}
+	}
+
+	again, changes, err := migrateConfig(out)
+	if err != nil || len(changes) != 0 || string(again) != s {
+		t.Errorf("second migration changed %+v (%v)", changes, err)
+	}
+}
+
+// TestMigrateConfigLaunchWins: server.command is dropped, not moved, when
+// server.launch.command already overrides it.
+func TestMigrateConfigLaunchWins(t *testing.T) {
+	in := `project:
+  name: "demo"
+server:
+  command: "old.exe"
+  launch:
+    command: "\"${BIN}\""
+`
+	out, changes, err := migrateConfig([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].To != "" {
+		t.Fatalf("changes = %+v", changes)
+	}
+	cfg, err := config.Parse(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Command != "" || cfg.Server.Launch.Command != `"${BIN}"` {
+		t.Errorf("server = %+v, launch = %+v", cfg.Server, cfg.Server.Launch)
+	}
+}
+
+// TestEditConflicts: a hand edit the new output keeps is no conflict; one it
+// overwrites is Modified with the diff, and one it no longer writes is Stale.
+func TestEditConflicts(t *testing.T) {
+	project, rendered := t.TempDir(), t.TempDir()
+	write := func(root, rel, content string) {
+		t.Helper()
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(project, "generated/server.go", "package generated\n// fix\n")
+	write(rendered, "generated/server.go", "package generated\n// fix\n")
+	write(project, "generated/client.go", "package generated\n// mine\n")
+	write(rendered, "generated/client.go", "package generated\n// new\n")
+	write(project, "generated/cpp/src/gone.cpp", "int gone;\n")
+
+	files, err := editConflicts(project, rendered, []string{"generated/client.go", "generated/cpp/src/gone.cpp", "generated/server.go"})
+	if err != nil {
+		t.Fatalf("editConflicts: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("files = %+v", files)
+	}
+	if f := files[0]; f.Path != "generated/client.go" || f.Status != drift.Modified || !strings.Contains(f.Diff, "-// mine") {
+		t.Errorf("client.go = %+v", f)
+	}
+	if f := files[1]; f.Path != "generated/cpp/src/gone.cpp" || f.Status != drift.Stale || f.Removed != 1 {
+		t.Errorf("gone.cpp = %+v", f)
+	}
+}
@@ -0,0 +1,430 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/cross"
+	"github.com/xll-gen/xll-gen/internal/ui"
+)
+
+var (
+	watchDebug     bool
+	watchTarget    string
+	watchToolchain string
+	watchDebounce  time.Duration
+	watchVerbose   bool
+)
+
+// watchPoll is how often watch stats its inputs. Polling needs no
+// per-platform notification API and sees a file replaced by an editor's
+// atomic save like any other write.
+const watchPoll = 250 * time.Millisecond
+
+// maxErrorLines caps the lines watch prints for a failed build.
+const maxErrorLines = 20
+
+// watchCmd regenerates and rebuilds the project whenever its inputs change.
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Regenerate and rebuild whenever xll.yaml, ribbon files or Go sources change",
+	Long: `Builds the project, then watches xll.yaml, the ribbon XML and image files it
+references, and the project's Go sources (go.mod, go.sum and *.go outside the
+generated package, build/ and dist/; tests are skipped), and re-runs only the
+stages a change affects:
+
+  xll.yaml or a ribbon file   generate, then the full build
+  Go sources only             the Go server build ('task build-go'), no C++
+
+With build.singlefile: xll, or with --target, a Go change runs the full build
+task, since the XLL embeds the server; CMake recompiles no C++ for it.
+
+Changes are collected until none arrives for --debounce, so an editor saving
+several files triggers one rebuild. A failed generate prints its error, with
+the xll.yaml line for a parse error; a failed build prints only its error
+lines (-v shows the whole output). Stop with Ctrl+C.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := runWatch(ctx); err != nil {
+			printError("Watch", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	watchCmd.Flags().BoolVar(&watchDebug, "debug", false, "Build in debug mode")
+	watchCmd.Flags().StringVar(&watchTarget, "target", "", "Cross-compile for this target (windows-amd64)")
+	watchCmd.Flags().StringVar(&watchToolchain, "toolchain", cross.Mingw, "Cross toolchain for --target (mingw)")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 300*time.Millisecond, "Quiet period before a rebuild")
+	watchCmd.Flags().BoolVarP(&watchVerbose, "verbose", "v", false, "Show the full build output")
+	rootCmd.AddCommand(watchCmd)
+}
+
+// stage is how much of the pipeline a change re-runs; a larger stage
+// includes the smaller ones.
+type stage int
+
+const (
+	stageNone stage = iota
+	// stageGo rebuilds the Go server.
+	stageGo
+	// stageGenerate regenerates, then runs the full build.
+	stageGenerate
+)
+
+func (s stage) String() string {
+	switch s {
+	case stageGo:
+		return "Go build"
+	case stageGenerate:
+		return "generate + build"
+	}
+	return "none"
+}
+
+// stamp is what watch compares to see that a file changed.
+type stamp struct {
+	mod  time.Time
+	size int64
+}
+
+// watcher is the state of one `xll-gen watch`.
+type watcher struct {
+	taskExe string
+	// crossTask is the cross-build task, without -debug, when --target is set.
+	crossTask string
+	// cfg is the last xll.yaml that loaded; it names the ribbon files and the
+	// generated package, which is not watched.
+	cfg *config.Config
+}
+
+// runWatch builds once, then rebuilds on every change until ctx is done.
+func runWatch(ctx context.Context) error {
+	w := &watcher{}
+	var err error
+	if w.taskExe, err = findTask(); err != nil {
+		return err
+	}
+	if watchTarget != "" {
+		if w.crossTask, err = prepareCrossBuild(watchTarget, watchToolchain); err != nil {
+			return err
+		}
+	}
+	w.reloadConfig()
+
+	base, err := w.snapshot()
+	if err != nil {
+		return err
+	}
+	base = w.round(stageGenerate, nil, base)
+
+	ticker := time.NewTicker(watchPoll)
+	defer ticker.Stop()
+	var (
+		pending stage
+		paths   []string
+		last    time.Time
+	)
+	for {
+		printHeader("Watching for changes (Ctrl+C to stop)...")
+		for pending == stageNone || time.Since(last) < watchDebounce {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			cur, err := w.snapshot()
+			if err != nil {
+				return err
+			}
+			diff := diffSnapshots(base, cur)
+			if len(diff) == 0 {
+				continue
+			}
+			for _, p := range diff {
+				pending = max(pending, w.stageOf(p))
+				if p == "xll.yaml" {
+					w.reloadConfig()
+				}
+			}
+			paths = appendUnique(paths, diff...)
+			base, last = cur, time.Now()
+		}
+		base = w.round(pending, paths, base)
+		pending, paths = stageNone, nil
+	}
+}
+
+// round runs stage st for the changed paths and returns the snapshot to
+// compare the next poll with: base, plus the go.mod and go.sum that generate
+// and the Go build may rewrite. Anything else saved during the round is
+// still a change.
+func (w *watcher) round(st stage, paths []string, base map[string]stamp) map[string]stamp {
+	if len(paths) > 0 {
+		printHeader(fmt.Sprintf("Changed: %s (%s)", summarizePaths(paths), st))
+	}
+	w.runStage(st)
+
+	if post, err := w.snapshot(); err == nil {
+		for _, p := range []string{"go.mod", "go.sum"} {
+			if s, ok := post[p]; ok {
+				base[p] = s
+			} else {
+				delete(base, p)
+			}
+		}
+	}
+	return base
+}
+
+// runStage runs st, printing what failed.
+func (w *watcher) runStage(st stage) {
+	if st == stageGenerate {
+		if err := runGenerate(); err != nil {
+			printError("Generate", err.Error())
+			return
+		}
+		w.reloadConfig()
+	}
+	task := w.task(st)
+	start := time.Now()
+	var buf bytes.Buffer
+	var stdout, stderr io.Writer = &buf, &buf
+	if watchVerbose {
+		stdout, stderr = io.MultiWriter(&buf, os.Stdout), io.MultiWriter(&buf, os.Stderr)
+	}
+	run := func() error { return runTask(w.taskExe, task, stdout, stderr) }
+	var err error
+	if watchVerbose {
+		err = run()
+	} else {
+		err = ui.RunSpinner(fmt.Sprintf("Running '%s %s'...", w.taskExe, task), run)
+	}
+	if err != nil {
+		printError("Build", fmt.Sprintf("'%s %s' failed: %v", w.taskExe, task, err))
+		if !watchVerbose {
+			for _, line := range conciseErrors(buf.Bytes()) {
+				fmt.Println("  " + line)
+			}
+		}
+		return
+	}
+	printSuccess("Build", fmt.Sprintf("'%s %s' in %v", w.taskExe, task, time.Since(start).Round(time.Millisecond)))
+}
+
+// task returns the Taskfile task for st.
+func (w *watcher) task(st stage) string {
+	return watchTask(st, w.cfg, w.crossTask, watchDebug)
+}
+
+// watchTask returns the Taskfile task that rebuilds after a change of stage
+// st: the full build after generate, and the Go server alone for Go
+// sources, unless the XLL embeds the server (singlefile: xll) or builds
+// through the cross task, which has no Go-only variant.
+func watchTask(st stage, cfg *config.Config, crossTask string, debug bool) string {
+	task := "build"
+	switch {
+	case crossTask != "":
+		task = crossTask
+	case st == stageGo && (cfg == nil || cfg.Build.Singlefile != "xll"):
+		task = "build-go"
+	}
+	if debug {
+		task += "-debug"
+	}
+	return task
+}
+
+// reloadConfig loads xll.yaml, keeping the previous config if it does not
+// load: generate reports the error.
+func (w *watcher) reloadConfig() {
+	cfg, err := config.Load("xll.yaml")
+	if err != nil {
+		return
+	}
+	config.ApplyDefaults(cfg)
+	w.cfg = cfg
+}
+
+// stageOf returns the stage a change of path, slash-separated and relative
+// to the project root, re-runs.
+func (w *watcher) stageOf(path string) stage {
+	if path == "xll.yaml" || w.ribbonFiles()[path] {
+		return stageGenerate
+	}
+	return stageGo
+}
+
+// ribbonFiles returns the files the ribbon embeds: the raw customUI XML, or
+// the file images of the structured ribbon's buttons.
+func (w *watcher) ribbonFiles() map[string]bool {
+	files := map[string]bool{}
+	if w.cfg == nil || !w.cfg.Ribbon.Enabled() {
+		return files
+	}
+	if w.cfg.Ribbon.XML != "" {
+		files[filepath.ToSlash(filepath.Clean(w.cfg.Ribbon.XML))] = true
+	}
+	for _, g := range w.cfg.Ribbon.Groups {
+		for _, btn := range g.Buttons {
+			if isFile, err := config.ClassifyRibbonImage(btn.Image); err == nil && isFile {
+				files[filepath.ToSlash(filepath.Clean(btn.Image))] = true
+			}
+		}
+	}
+	return files
+}
+
+// snapshot stats every watched file under the current directory.
+func (w *watcher) snapshot() (map[string]stamp, error) {
+	pkg := config.DefaultGoPackage
+	if w.cfg != nil {
+		pkg = w.cfg.GoPackage()
+	}
+	return snapshotDir(".", pkg, w.ribbonFiles())
+}
+
+// skipDirs are the top-level directories watch never looks into besides the
+// generated package: build output and the package bundles.
+var skipDirs = map[string]bool{"build": true, "dist": true}
+
+// snapshotDir stats, under root, xll.yaml, the extra files, go.mod, go.sum
+// and the non-test Go sources outside the generated package pkg, build
+// output and hidden, vendor and testdata directories. Keys are
+// slash-separated paths relative to root.
+func snapshotDir(root, pkg string, extra map[string]bool) (map[string]stamp, error) {
+	snap := map[string]stamp{}
+	add := func(rel string, info fs.FileInfo) {
+		snap[filepath.ToSlash(rel)] = stamp{info.ModTime(), info.Size()}
+	}
+	for _, f := range []string{"xll.yaml", "go.mod", "go.sum"} {
+		if info, err := os.Stat(filepath.Join(root, f)); err == nil {
+			add(f, info)
+		}
+	}
+	for f := range extra {
+		if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(f))); err == nil {
+			add(f, info)
+		}
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if rel != "." && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" ||
+				rel == pkg || skipDirs[rel]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		add(rel, info)
+		return nil
+	})
+	return snap, err
+}
+
+// diffSnapshots returns the files added, removed or changed from old to
+// cur, sorted.
+func diffSnapshots(old, cur map[string]stamp) []string {
+	var diff []string
+	for p, s := range cur {
+		if o, ok := old[p]; !ok || !o.mod.Equal(s.mod) || o.size != s.size {
+			diff = append(diff, p)
+		}
+	}
+	for p := range old {
+		if _, ok := cur[p]; !ok {
+			diff = append(diff, p)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, it := range items {
+		found := false
+		for _, l := range list {
+			if l == it {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, it)
+		}
+	}
+	return list
+}
+
+// summarizePaths names the first few changed files.
+func summarizePaths(paths []string) string {
+	const show = 3
+	if len(paths) <= show {
+		return strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(paths[:show], ", "), len(paths)-show)
+}
+
+// errorLineRe matches the lines of a build log that carry an error: a
+// compiler diagnostic with a file and line, or a line that says error.
+var errorLineRe = regexp.MustCompile(`(?i)(^\S+\.(go|c|cc|cpp|h|hpp|cmake|txt)[:(]\d+|\berror\b|^FAILED:)`)
+
+// conciseErrors returns the error lines of a failed build's output, without
+// repeats and at most maxErrorLines of them, or its last lines when none
+// looks like an error.
+func conciseErrors(out []byte) []string {
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(string(out), "\r\n", "\n"), "\n"), "\n")
+	var errs []string
+	seen := map[string]bool{}
+	for _, l := range lines {
+		l = strings.TrimRight(l, " \t")
+		if !errorLineRe.MatchString(strings.TrimSpace(l)) || seen[l] {
+			continue
+		}
+		seen[l] = true
+		errs = append(errs, l)
+	}
+	if len(errs) == 0 {
+		errs = lines
+		if len(errs) > maxErrorLines {
+			errs = errs[len(errs)-maxErrorLines:]
+		}
+		return errs
+	}
+	if len(errs) > maxErrorLines {
+		more := len(errs) - maxErrorLines
+		errs = append(errs[:maxErrorLines], fmt.Sprintf("... %d more", more))
+	}
+	return errs
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+// TestSnapshotDir: watch sees xll.yaml, go.mod, the ribbon files and the Go
+// sources, but not tests, the generated package or build output.
+func TestSnapshotDir(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{
+		"xll.yaml", "go.mod", "main.go", "main_test.go", "handlers/quote.go",
+		"ribbon/icon.png", "generated/server.go", "build/tmp.go", ".git/x.go", "README.md",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := snapshotDir(root, "generated", map[string]bool{"ribbon/icon.png": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for p := range snap {
+		got = append(got, p)
+	}
+	want := []string{"go.mod", "handlers/quote.go", "main.go", "ribbon/icon.png", "xll.yaml"}
+	if !reflect.DeepEqual(diffSnapshots(nil, snap), want) {
+		t.Errorf("watched %v, want %v", got, want)
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "main.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "handlers", "quote.go")); err != nil {
+		t.Fatal(err)
+	}
+	cur, err := snapshotDir(root, "generated", map[string]bool{"ribbon/icon.png": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := diffSnapshots(snap, cur); !reflect.DeepEqual(diff, []string{"handlers/quote.go", "main.go"}) {
+		t.Errorf("diff = %v, want [handlers/quote.go main.go]", diff)
+	}
+}
+
+// TestWatchStages: xll.yaml and ribbon files regenerate; Go sources rebuild
+// only the server unless the XLL embeds it or the build is a cross build.
+func TestWatchStages(t *testing.T) {
+	cfg, err := config.Parse([]byte(`project:
+  name: "demo"
+commands:
+  - name: "Hello"
+ribbon:
+  tab: "Demo"
+  groups:
+    - label: "G"
+      buttons:
+        - label: "Hi"
+          command: "Hello"
+          image: "img/hi.png"
+        - label: "Mso"
+          command: "Hello"
+          image: "HappyFace"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ApplyDefaults(cfg)
+	w := &watcher{cfg: cfg}
+	for path, want := range map[string]stage{
+		"xll.yaml":   stageGenerate,
+		"img/hi.png": stageGenerate,
+		"main.go":    stageGo,
+		"go.sum":     stageGo,
+	} {
+		if got := w.stageOf(path); got != want {
+			t.Errorf("stageOf(%s) = %v, want %v", path, got, want)
+		}
+	}
+
+	for _, tc := range []struct {
+		st         stage
+		singlefile string
+		cross      string
+		debug      bool
+		want       string
+	}{
+		{stageGo, "", "", false, "build-go"},
+		{stageGo, "", "", true, "build-go-debug"},
+		{stageGenerate, "", "", false, "build"},
+		{stageGo, "xll", "", false, "build"},
+		{stageGo, "", "build-windows-amd64", true, "build-windows-amd64-debug"},
+	} {
+		cfg.Build.Singlefile = tc.singlefile
+		if got := watchTask(tc.st, cfg, tc.cross, tc.debug); got != tc.want {
+			t.Errorf("watchTask(%v, singlefile %q, cross %q, debug %v) = %s, want %s",
+				tc.st, tc.singlefile, tc.cross, tc.debug, got, tc.want)
+		}
+	}
+}
+
+// TestWatchTasksExist: every task watch can run is in the generated
+// Taskfile for the project's singlefile mode.
+func TestWatchTasksExist(t *testing.T) {
+	tmpl, err := os.ReadFile(filepath.Join("..", "internal", "templates", "Taskfile.yml.tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range []string{"build", "build-debug", "build-go", "build-go-debug", "build-windows-amd64", "build-windows-amd64-debug"} {
+		if !strings.Contains(string(tmpl), "\n  "+task+":") {
+			t.Errorf("Taskfile.yml.tmpl has no %s task", task)
+		}
+	}
+}
+
+func TestConciseErrors(t *testing.T) {
+	out := "task: [build-go] go build -o build/demo.exe .\n" +
+		"# demo\n" +
+		"./main.go:12:2: undefined: Foo\n" +
+		"./main.go:12:2: undefined: Foo\n" +
+		"task: Failed to run task \"build-go\": exit status 1\n"
+	if got := conciseErrors([]byte(out)); !reflect.DeepEqual(got, []string{"./main.go:12:2: undefined: Foo"}) {
+		t.Errorf("conciseErrors = %q", got)
+	}
+
+	var long strings.Builder
+	for i := 0; i < 30; i++ {
+		long.WriteString("line\n")
+	}
+	if got := conciseErrors([]byte(long.String())); len(got) != maxErrorLines {
+		t.Errorf("no error lines: got %d lines, want the last %d", len(got), maxErrorLines)
+	}
+	if got := conciseErrors(nil); got != nil {
+		t.Errorf("empty output: %q", got)
+	}
+}
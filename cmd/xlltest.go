@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/templates"
+	"github.com/xll-gen/xll-gen/pkg/xlltest"
+)
+
+// casesTestFile is the go test `xll-gen test` writes into the project root for
+// the length of one run.
+const casesTestFile = "xllgen_cases_test.go"
+
+// casesTestMarker is the first line of casesTestFile; a file by that name
+// without it belongs to the user and is never overwritten.
+const casesTestMarker = "// Code generated by xll-gen test. DO NOT EDIT."
+
+var (
+	testCasesFile string
+	testJUnitPath string
+	testService   string
+	testVerbose   bool
+)
+
+// testCmd runs xll.test.yaml cases through the generated server.
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Run xll.test.yaml function test cases against the generated server",
+	Long: `Runs the test cases in xll.test.yaml through the generated Go server with
+no Excel: each case calls a worksheet function over the real dispatch path
+(pkg/xllhost plays the XLL) and compares the result with the case's expect or
+error. Prints a pass/fail table and, with --junit, writes a JUnit XML report.
+
+The service under test is the value main passes to <package>.Serve; use
+--service when main builds it in a way a test cannot repeat.
+
+Run 'xll-gen generate' first; the project must compile with 'go test'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		results, err := runTest()
+		if err != nil {
+			printError("Test", fmt.Sprintf("%v", err))
+			os.Exit(1)
+		}
+		if failed := xlltest.Failed(results); failed > 0 {
+			printError("Test", fmt.Sprintf("%d of %d cases failed", failed, len(results)))
+			os.Exit(1)
+		}
+		printSuccess("Test", fmt.Sprintf("all %d cases passed", len(results)))
+	},
+}
+
+func init() {
+	testCmd.Flags().StringVarP(&testCasesFile, "file", "f", xlltest.DefaultFile, "Test-case file")
+	testCmd.Flags().StringVar(&testJUnitPath, "junit", "", "Write a JUnit XML report to this path")
+	testCmd.Flags().StringVar(&testService, "service", "", "Go expression for the service under test (default: the argument main passes to Serve)")
+	testCmd.Flags().BoolVarP(&testVerbose, "verbose", "v", false, "Show the go test output")
+	rootCmd.AddCommand(testCmd)
+}
+
+// runTest generates the cases test, runs it with go test, prints the table and
+// writes the JUnit report. It returns the results; a failing case is not an
+// error, but a run that produced no results is.
+func runTest() ([]xlltest.Result, error) {
+	cfg, err := config.Load("xll.yaml")
+	if err != nil {
+		return nil, err
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return nil, err
+	}
+	// Parse here too, so a malformed case file fails before a build.
+	suite, err := xlltest.Load(testCasesFile)
+	if err != nil {
+		return nil, err
+	}
+	casesPath, err := filepath.Abs(testCasesFile)
+	if err != nil {
+		return nil, err
+	}
+	pkg := cfg.GoPackage()
+	if _, err := os.Stat(filepath.Join(pkg, "server.go")); err != nil {
+		return nil, fmt.Errorf("%s/server.go not found; run 'xll-gen generate' first", pkg)
+	}
+	modName, err := getModuleName()
+	if err != nil {
+		return nil, err
+	}
+	service := testService
+	if service == "" {
+		if service, err = findService(".", modName+"/"+pkg); err != nil {
+			return nil, err
+		}
+	}
+
+	src, err := renderCasesTest(modName, pkg, service)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCasesTest(casesTestFile, src); err != nil {
+		return nil, err
+	}
+	defer os.Remove(casesTestFile)
+
+	resultsFile, err := os.CreateTemp("", "xllgen-test-*.json")
+	if err != nil {
+		return nil, err
+	}
+	resultsPath := resultsFile.Name()
+	resultsFile.Close()
+	defer os.Remove(resultsPath)
+
+	printHeader(fmt.Sprintf("Running %d test cases from %s...", len(suite.Cases), testCasesFile))
+	start := time.Now()
+	goTest := exec.Command("go", "test", "-count=1", "-run", "^TestXllGenCases$", ".")
+	goTest.Env = append(os.Environ(),
+		xlltest.EnvCases+"="+casesPath,
+		xlltest.EnvResults+"="+resultsPath)
+	out, runErr := goTest.CombinedOutput()
+	if testVerbose {
+		os.Stdout.Write(out)
+	}
+
+	// go test exits non-zero when a case fails, so its exit status alone says
+	// nothing; the results file says whether the cases ran at all.
+	results, err := xlltest.ReadResults(resultsPath)
+	if err != nil || len(results) == 0 {
+		if runErr == nil {
+			runErr = errors.New("no results were written")
+		}
+		return nil, fmt.Errorf("go test did not run the cases (%v):\n%s", runErr, out)
+	}
+
+	fmt.Println()
+	if err := xlltest.WriteTable(os.Stdout, results); err != nil {
+		return nil, err
+	}
+	fmt.Printf("\n%d cases in %v\n", len(results), time.Since(start).Round(time.Millisecond))
+
+	if testJUnitPath != "" {
+		var buf bytes.Buffer
+		if err := xlltest.WriteJUnit(&buf, cfg.Project.Name, results); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(testJUnitPath, buf.Bytes(), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write JUnit report: %w", err)
+		}
+		printSuccess("JUnit", testJUnitPath)
+	}
+	return results, nil
+}
+
+// renderCasesTest renders the cases test for module/pkg serving service.
+func renderCasesTest(module, pkg, service string) ([]byte, error) {
+	return renderProjectTest("xlltest_test.go.tmpl", service, map[string]string{
+		"Module":   module,
+		"Package":  pkg,
+		"Service":  service,
+		"EnvCases": xlltest.EnvCases,
+	})
+}
+
+// renderProjectTest renders one of the throwaway go tests xll-gen writes into
+// a project, serving service.
+func renderProjectTest(name, service string, data map[string]string) ([]byte, error) {
+	tmplContent, err := templates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New(name).Parse(tmplContent)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("the service expression %q does not fit a Go test: %w", service, err)
+	}
+	return src, nil
+}
+
+// writeCasesTest writes src to path unless path is a file of the user's.
+func writeCasesTest(path string, src []byte) error {
+	return writeProjectTest(path, casesTestMarker, src)
+}
+
+// writeProjectTest writes src to path unless path exists without marker as
+// its first line, i.e. is a file of the user's.
+func writeProjectTest(path, marker string, src []byte) error {
+	existing, err := os.ReadFile(path)
+	if err == nil && !bytes.HasPrefix(existing, []byte(marker)) {
+		return fmt.Errorf("%s exists and was not written by xll-gen; rename it", path)
+	}
+	return os.WriteFile(path, src, 0o644)
+}
+
+// findService returns the source of the argument package main in dir passes to
+// Serve from the generated package importPath, e.g. "&MyService{}". Only an
+// expression a test in the same package can evaluate again is accepted: a
+// composite literal, a call, or a package-level variable — not a local.
+func findService(dir, importPath string) (string, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", err
+	}
+	type mainFile struct {
+		name string
+		src  []byte
+		ast  *ast.File
+	}
+	fset := token.NewFileSet()
+	var files []mainFile
+	vars := map[string]bool{}
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.SkipObjectResolution)
+		if err != nil {
+			return "", err
+		}
+		if f.Name.Name != "main" {
+			continue
+		}
+		files = append(files, mainFile{name, src, f})
+		for _, v := range packageLevelVars(f) {
+			vars[v] = true
+		}
+	}
+
+	for _, mf := range files {
+		local := importName(mf.ast, importPath)
+		if local == "" {
+			continue
+		}
+		var arg ast.Expr
+		ast.Inspect(mf.ast, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok && len(call.Args) == 1 {
+				if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Serve" {
+					if id, ok := sel.X.(*ast.Ident); ok && id.Name == local {
+						arg = call.Args[0]
+					}
+				}
+			}
+			return arg == nil
+		})
+		if arg == nil {
+			continue
+		}
+		if id, ok := arg.(*ast.Ident); ok && !vars[id.Name] {
+			return "", fmt.Errorf("%s passes the local variable %s to %s.Serve; pass --service with an expression that builds the service",
+				filepath.Base(mf.name), id.Name, local)
+		}
+		return string(mf.src[fset.Position(arg.Pos()).Offset:fset.Position(arg.End()).Offset]), nil
+	}
+	return "", fmt.Errorf("no call to Serve from %s found in package main; pass --service", importPath)
+}
+
+// importName returns the name importPath is imported under in f, or "".
+func importName(f *ast.File, importPath string) string {
+	for _, imp := range f.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err != nil || p != importPath {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return filepath.Base(importPath)
+	}
+	return ""
+}
+
+// packageLevelVars lists the variables f declares at package level.
+func packageLevelVars(f *ast.File) []string {
+	var names []string
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			for _, n := range spec.(*ast.ValueSpec).Names {
+				names = append(names, n.Name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindService(t *testing.T) {
+	const imp = "demo/generated"
+	cases := []struct {
+		name, src, want, wantErr string
+	}{
+		{"Literal", `package main
+import "demo/generated"
+type MyService struct{}
+func main() { generated.Serve(&MyService{}) }
+`, "&MyService{}", ""},
+		{"AliasedImport", `package main
+import gen "demo/generated"
+func main() { gen.Serve(newService("x")) }
+`, `newService("x")`, ""},
+		{"PackageVar", `package main
+import "demo/generated"
+var svc = &MyService{}
+func main() { generated.Serve(svc) }
+`, "svc", ""},
+		{"LocalVar", `package main
+import "demo/generated"
+func main() {
+	svc := &MyService{}
+	generated.Serve(svc)
+}
+`, "", "local variable svc"},
+		{"OtherServe", `package main
+import "net/http"
+func main() { http.Serve(nil, nil) }
+`, "", "no call to Serve"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(tc.src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := findService(dir, imp)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("findService = (%q, %v), want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderCasesTest(t *testing.T) {
+	src, err := renderCasesTest("demo", "generated", "&MyService{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(src)
+	for _, want := range []string{
+		casesTestMarker,
+		`"demo/generated"`,
+		"go generated.ServeConn(&MyService{}, h)",
+		"func TestXllGenCases(t *testing.T)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered test lacks %q:\n%s", want, out)
+		}
+	}
+	if !strings.HasPrefix(out, casesTestMarker) {
+		t.Error("the marker must be the first line, or writeCasesTest refuses to overwrite its own file")
+	}
+	if _, err := renderCasesTest("demo", "generated", "&MyService{"); err == nil {
+		t.Error("a malformed service expression was rendered")
+	}
+
+	// The file is ours to overwrite, but never a user file of the same name.
+	path := filepath.Join(t.TempDir(), casesTestFile)
+	if err := writeCasesTest(path, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCasesTest(path, src); err != nil {
+		t.Errorf("overwriting a previous run's file: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCasesTest(path, src); err == nil {
+		t.Error("a user's file was overwritten")
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/go-ole/go-ole v1.3.0
 	github.com/google/flatbuffers v25.9.23+incompatible
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
 	github.com/spf13/cobra v1.10.2
 	github.com/xll-gen/shm v0.9.1
 	github.com/xll-gen/sugar v0.8.15
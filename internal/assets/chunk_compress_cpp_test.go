@@ -0,0 +1,77 @@
+package assets
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/pkg/chunk"
+)
+
+// Chunk compression (server.chunk.compress_threshold): the Go sender sets
+// chunk.CompressedFlag on msg_type and the C++ HandleChunk inflates the
+// reassembled zstd frame before dispatch. xll_worker.cpp cannot be linked
+// offline, so its half of the contract is pinned at the source level.
+
+// TestChunkCompressedFlagMirrorsGo: the #define must be the Go flag's value,
+// or one side would dispatch zstd bytes as a FlatBuffer.
+func TestChunkCompressedFlagMirrorsGo(t *testing.T) {
+	t.Parallel()
+	m, err := Assets()
+	if err != nil {
+		t.Fatalf("Assets(): %v", err)
+	}
+	ipc := m["include/xll_ipc.h"]
+	match := regexp.MustCompile(`(?m)^#define\s+CHUNK_COMPRESSED_FLAG\s+0x([0-9A-Fa-f]+)u\s*$`).FindStringSubmatch(ipc)
+	if match == nil {
+		t.Fatal("include/xll_ipc.h must #define CHUNK_COMPRESSED_FLAG as a hex literal")
+	}
+	v, err := strconv.ParseUint(match[1], 16, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint32(v) != chunk.CompressedFlag {
+		t.Fatalf("CHUNK_COMPRESSED_FLAG = %#x, pkg/chunk.CompressedFlag = %#x", v, chunk.CompressedFlag)
+	}
+}
+
+// TestHandleChunkInflatesBeforeDispatch: the flag is tested and stripped, the
+// payload inflated under the reassembly cap, and a failed inflate poisons the
+// transfer — all before the first dispatch branch reads `type`.
+func TestHandleChunkInflatesBeforeDispatch(t *testing.T) {
+	t.Parallel()
+	m, err := Assets()
+	if err != nil {
+		t.Fatalf("Assets(): %v", err)
+	}
+	worker := stripCppCommentsAsset(m["src/xll_worker.cpp"])
+
+	start := strings.Index(worker, "bool HandleChunk(const protocol::Chunk* chunk) {")
+	if start < 0 {
+		t.Fatal("xll_worker.cpp must define HandleChunk")
+	}
+	body := worker[start:]
+	dispatch := strings.Index(body, "type == (int32_t)MSG_BATCH_ASYNC_RESPONSE")
+	if dispatch < 0 {
+		t.Fatal("HandleChunk completion dispatch not found")
+	}
+	pre := body[:dispatch]
+	for _, want := range []string{
+		"& CHUNK_COMPRESSED_FLAG",
+		"DecompressChunkPayload(pm.buffer, g_chunkRegistry.maxTotalSize(), inflated, why)",
+		"g_chunkRegistry.Poison(msgId, now);",
+		"& ~CHUNK_COMPRESSED_FLAG",
+		"data = inflated.data();",
+	} {
+		if !strings.Contains(pre, want) {
+			t.Errorf("HandleChunk must contain %q before its dispatch", want)
+		}
+	}
+	if !strings.Contains(body, "ProcessRtdOnceGrid(data, size);") {
+		t.Error("MSG_RTD_ONCE_GRID must receive the inflated size, not pm.totalSize")
+	}
+	if !strings.Contains(worker, "#ifdef XLL_CHUNK_COMPRESSION\n#include <zstd.h>") {
+		t.Error("zstd.h must only be included when the CMake template defines XLL_CHUNK_COMPRESSION")
+	}
+}
@@ -0,0 +1,55 @@
+#pragma once
+#include <cstdint>
+#include <string>
+
+// xll_handshake.h — connect handshake with the Go server (MSG_HANDSHAKE).
+//
+// A user function travels as MSG_USER_START + its ID, and both sides derive
+// the ID from their own copy of xll.yaml (and xll.lock). A stale server binary
+// left in temp_dir, or a rebuild of only one side, therefore routes a call to
+// whichever function holds that ID on the other side — silently. As soon as the
+// server connects (from the worker loop, HandshakeOnConnect) the XLL sends what it was generated from (xll-gen version, schema hash, user
+// message ID range) and the server answers with its own. On any difference
+// both sides refuse: the server answers every user message with SYSTEM_ERROR
+// (pkg/server.Handshaker) and the wrappers here return HandshakeErrorText() to
+// the cell instead of sending. Until the handshake has succeeded neither side
+// serves a function call either: the server refuses user messages from a peer
+// that has not handshaken, and EnsureHandshake returns false while pending.
+//
+// The payload is a protocol::Grid of N x 2 Str cells (key, value); see
+// pkg/server.Handshake for the keys.
+//
+// THREADING: EnsureHandshake is callable from any calc thread and
+// HandshakeOnConnect from the worker. One attempt sends at a time under a
+// mutex; once it has an outcome, callers read an atomic. A transport failure
+// (server not up yet, timeout) leaves the handshake pending: the worker retries
+// on its next iteration and the call that hit it is refused with the pending
+// text, never sent unchecked.
+namespace xll {
+    // InitHandshake records this XLL's generated identity and resets any
+    // earlier outcome. Called from xlAutoOpen after the host is initialized.
+    void InitHandshake(const std::string& version, const std::string& schemaHash,
+                       uint32_t userStart, uint32_t userEnd);
+
+    // Timeout of the attempt a function call makes when the worker has not
+    // completed the handshake yet.
+    constexpr uint32_t kHandshakeCallTimeoutMs = 2000;
+
+    // HandshakeOnConnect attempts the handshake while it is pending, waiting at
+    // most timeoutMs for the server. It never blocks behind another attempt, so
+    // the worker loop can call it on every iteration.
+    void HandshakeOnConnect(uint32_t timeoutMs);
+
+    // HandshakePending reports that no attempt has reached the server yet.
+    bool HandshakePending();
+
+    // EnsureHandshake returns true once the handshake has succeeded. While it
+    // is pending it makes one attempt (or waits for the one in flight); false
+    // means the caller must not send, because the server was generated
+    // differently or is not reachable yet.
+    bool EnsureHandshake();
+
+    // HandshakeErrorText is the cell text shown when EnsureHandshake returned
+    // false: the mismatch reason, or that the server is not connected yet.
+    std::wstring HandshakeErrorText();
+}
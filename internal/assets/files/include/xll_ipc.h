@@ -46,8 +46,25 @@ extern std::mutex g_refCacheMutex;
 // cannot be read as a transport heartbeat.
 #define MSG_ACK 139
 
+// RTD-once interim progress (140): an RtdUpdate that is DISPLAYED but never
+// stored as the one-shot result (see ProcessRtdProgress). Took 140 from
+// MSG_USER_START.
+#define MSG_RTD_PROGRESS 140
+
+// Version handshake (141): the XLL's first message after connect, carrying the
+// xll-gen version, schema hash and user msgid range (see xll_handshake.h).
+// Took 141 from MSG_USER_START.
+#define MSG_HANDSHAKE 141
+
 // User Functions Start
-#define MSG_USER_START 140
+#define MSG_USER_START 142
+
+// Chunk compression flag. NOT a message ID: OR-ed into protocol::Chunk's
+// msg_type (whose real IDs all sit far below it) to mark a transfer whose
+// reassembled bytes are ONE zstd frame, to be inflated before dispatch on
+// msg_type & ~CHUNK_COMPRESSED_FLAG. Mirrors pkg/chunk.CompressedFlag; see
+// DecompressChunkPayload in xll_worker.cpp.
+#define CHUNK_COMPRESSED_FLAG 0x80000000u
 
 // Helper for logging SHM errors
 std::string SHMErrorToString(shm::Error err);
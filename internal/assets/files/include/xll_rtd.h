@@ -20,6 +20,10 @@ extern class RtdServer* g_rtdServer;
 
 void ProcessRtdUpdate(const protocol::RtdUpdate* update);
 
+// Displays an interim rtd-once progress value (MSG_RTD_PROGRESS) without
+// storing it as the topic's one-shot result. See xll_rtd.cpp.
+void ProcessRtdProgress(const protocol::RtdUpdate* update);
+
 // Caches a guest->host one-shot grid result (MSG_RTD_ONCE_GRID) into
 // RtdOnceGridRegistry. `buf`/`len` is the full serialized
 // protocol::RtdOnceGridResult buffer; see xll_rtd.cpp for the byte contract
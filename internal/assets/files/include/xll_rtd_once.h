@@ -165,7 +165,13 @@ public:
     // governed by the once/memoize lifecycle (Clear), not by disconnect.
     void UnregisterTopic(long topicID) {
         std::lock_guard<std::mutex> lock(m_mutex);
-        m_topicToKey.erase(topicID);
+        auto it = m_topicToKey.find(topicID);
+        if (it == m_topicToKey.end()) return;
+        std::wstring key = it->second;
+        m_topicToKey.erase(it);
+        // Progress is only meaningful while a handler is running for a
+        // connected topic; once the last topic for the key is gone, drop it.
+        if (!KeyHasLiveTopic(key)) m_progress.erase(key);
     }
 
     // Looks up the key for a topicID. Returns true and fills `key` if the topic
@@ -201,6 +207,8 @@ public:
     // promotes the entry back to normal retention.
     void StoreResult(const std::wstring& key, const VARIANT& value, bool transient = false) {
         std::lock_guard<std::mutex> lock(m_mutex);
+        // The final value supersedes any interim progress text for the key.
+        m_progress.erase(key);
         auto it = m_results.find(key);
         if (it == m_results.end()) {
             Entry e;
@@ -217,6 +225,31 @@ public:
         }
     }
 
+    // Records interim progress text for a key (MSG_RTD_PROGRESS, see
+    // ProcessRtdProgress). It lives in its own map, NEVER in m_results: a
+    // progress value is not a one-shot result, and storing it there would make
+    // the wrapper's TryGetResult HIT on it, drop the xlfRtd reference and
+    // memoize "Running 45%" as the answer. Ignored, and false returned, once a
+    // result is stored (a progress message that raced the final push) or when
+    // no topic is live; the caller must then not push the text to Excel either.
+    bool StoreProgress(const std::wstring& key, const std::wstring& text) {
+        std::lock_guard<std::mutex> lock(m_mutex);
+        if (m_results.count(key) != 0 || !KeyHasLiveTopic(key)) return false;
+        m_progress[key] = text;
+        return true;
+    }
+
+    // Returns true and fills `text` with the latest progress for a key that has
+    // no result yet. The wrapper calls it on a cache MISS, after xlfRtd, to
+    // paint progress instead of the loading placeholder.
+    bool TryGetProgress(const std::wstring& key, std::wstring& text) const {
+        std::lock_guard<std::mutex> lock(m_mutex);
+        auto it = m_progress.find(key);
+        if (it == m_progress.end()) return false;
+        text = it->second;
+        return true;
+    }
+
     // Returns true and copies the stored value into `out` if present and not
     // expired. memoize_ttl expiry is evaluated HERE (read time): if the entry's
     // function declares a TTL, the key has NO live topic, and the entry's age
@@ -288,6 +321,9 @@ public:
         std::lock_guard<std::mutex> lock(m_mutex);
         std::set<std::wstring> liveKeys;
         for (const auto& kv : m_topicToKey) liveKeys.insert(kv.second);
+        for (auto it = m_progress.begin(); it != m_progress.end();) {
+            it = liveKeys.count(it->first) != 0 ? std::next(it) : m_progress.erase(it);
+        }
         ULONGLONG now = GetTickCount64();
         for (auto it = m_results.begin(); it != m_results.end();) {
             std::wstring fn = FuncNameOfKey(it->first);
@@ -372,6 +408,8 @@ private:
     std::map<std::wstring, unsigned long long> m_ttlNames; // name -> ttl ms (>0)
     std::map<long, std::wstring> m_topicToKey;
     std::map<std::wstring, Entry> m_results;
+    // Interim progress text per key (display-only; see StoreProgress).
+    std::map<std::wstring, std::wstring> m_progress;
 };
 
 } // namespace xll
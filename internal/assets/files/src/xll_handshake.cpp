@@ -0,0 +1,152 @@
+#include "xll_handshake.h"
+#include "xll_ipc.h"
+#include "xll_log.h"
+#include "types/protocol_generated.h"
+#include "types/utility.h"
+
+#include <atomic>
+#include <map>
+#include <mutex>
+#include <vector>
+
+namespace {
+
+enum HandshakeState { kPending = 0, kOk = 1, kRefused = 2 };
+
+std::atomic<int> g_handshakeState{kPending};
+std::mutex g_handshakeMutex;   // serializes the send; guards the fields below
+std::string g_hsVersion;
+std::string g_hsSchemaHash;
+uint32_t g_hsUserStart = 0;
+uint32_t g_hsUserEnd = 0;
+std::string g_hsReason;        // set once, before kRefused is published
+
+flatbuffers::Offset<protocol::Scalar> StrCell(flatbuffers::FlatBufferBuilder& b, const std::string& s) {
+    auto str = protocol::CreateStr(b, b.CreateString(s));
+    return protocol::CreateScalar(b, protocol::ScalarValue::Str, str.Union());
+}
+
+// Parses a verified key/value grid; false if it is not one.
+bool ParseKeyValues(const protocol::Grid* g, std::map<std::string, std::string>& out) {
+    if (!g || !g->data() || g->cols() != 2 || (int64_t)g->rows() * 2 != (int64_t)g->data()->size()) {
+        return false;
+    }
+    for (flatbuffers::uoffset_t i = 0; i + 1 < g->data()->size(); i += 2) {
+        auto k = g->data()->Get(i);
+        auto v = g->data()->Get(i + 1);
+        if (!k || !k->val_as_Str() || !k->val_as_Str()->val()) return false;
+        std::string value;
+        if (v && v->val_as_Str() && v->val_as_Str()->val()) value = v->val_as_Str()->val()->str();
+        out[k->val_as_Str()->val()->str()] = value;
+    }
+    return true;
+}
+
+} // namespace
+
+namespace xll {
+
+void InitHandshake(const std::string& version, const std::string& schemaHash,
+                   uint32_t userStart, uint32_t userEnd) {
+    std::lock_guard<std::mutex> lock(g_handshakeMutex);
+    g_hsVersion = version;
+    g_hsSchemaHash = schemaHash;
+    g_hsUserStart = userStart;
+    g_hsUserEnd = userEnd;
+    g_hsReason.clear();
+    g_handshakeState.store(kPending, std::memory_order_release);
+}
+
+// Sends the handshake and records the outcome. Called with g_handshakeMutex
+// held and the state still kPending. A transport failure (server not connected
+// yet, timeout) leaves it kPending.
+static void AttemptHandshake(uint32_t timeoutMs) {
+    if (g_phost == nullptr) return;
+
+    flatbuffers::FlatBufferBuilder builder(512);
+    const std::string pairs[] = {
+        "version", g_hsVersion,
+        "schema_hash", g_hsSchemaHash,
+        "msg_user_start", std::to_string(g_hsUserStart),
+        "msg_user_end", std::to_string(g_hsUserEnd),
+    };
+    std::vector<flatbuffers::Offset<protocol::Scalar>> cells;
+    for (const auto& s : pairs) cells.push_back(StrCell(builder, s));
+    builder.Finish(protocol::CreateGrid(builder, (int)(cells.size() / 2), 2, builder.CreateVector(cells)));
+
+    std::vector<uint8_t> respBuf;
+    auto res = g_host.Send(builder.GetBufferPointer(), (int)builder.GetSize(),
+                           (shm::MsgType)MSG_HANDSHAKE, respBuf, timeoutMs);
+    if (res.HasError()) {
+        // Not connected yet, or busy: stay pending. Function calls are refused
+        // until an attempt gets through; the server would refuse them too.
+        LogDebug("Handshake not completed (" + SHMErrorToString(res.GetError()) + "); will retry");
+        return;
+    }
+
+    std::map<std::string, std::string> kv;
+    flatbuffers::Verifier verifier(respBuf.data(), respBuf.size());
+    bool parsed = verifier.VerifyBuffer<protocol::Grid>(nullptr) &&
+                  ParseKeyValues(flatbuffers::GetRoot<protocol::Grid>(respBuf.data()), kv) &&
+                  !kv["version"].empty();
+
+    std::string reason;
+    if (!parsed) {
+        reason = "the server predates the connect handshake";
+    } else if (kv["status"] != "ok") {
+        reason = kv["error"].empty() ? "the server refused the handshake" : kv["error"];
+    } else if (kv["version"] != g_hsVersion || kv["schema_hash"] != g_hsSchemaHash ||
+               kv["msg_user_start"] != std::to_string(g_hsUserStart) ||
+               kv["msg_user_end"] != std::to_string(g_hsUserEnd)) {
+        reason = "server generated by xll-gen " + kv["version"] + " with function table " + kv["schema_hash"] +
+                 ", XLL by " + g_hsVersion + " with " + g_hsSchemaHash;
+    }
+
+    if (reason.empty()) {
+        LogInfo("Handshake ok: xll-gen " + g_hsVersion + ", function table " + g_hsSchemaHash);
+        g_handshakeState.store(kOk, std::memory_order_release);
+        return;
+    }
+    g_hsReason = reason;
+    LogError("Handshake failed; refusing all function calls: " + reason +
+             ". Regenerate and rebuild both the XLL and the server (and delete a stale server in temp_dir).");
+    g_handshakeState.store(kRefused, std::memory_order_release);
+}
+
+bool HandshakePending() {
+    return g_handshakeState.load(std::memory_order_acquire) == kPending;
+}
+
+void HandshakeOnConnect(uint32_t timeoutMs) {
+    if (!HandshakePending()) return;
+    // Never wait behind a calc thread's attempt: the worker must get back to
+    // its park inside the teardown reap budget.
+    std::unique_lock<std::mutex> lock(g_handshakeMutex, std::try_to_lock);
+    if (!lock.owns_lock() || !HandshakePending()) return;
+    AttemptHandshake(timeoutMs);
+}
+
+bool EnsureHandshake() {
+    int state = g_handshakeState.load(std::memory_order_acquire);
+    if (state != kPending) return state == kOk;
+
+    std::unique_lock<std::mutex> lock(g_handshakeMutex, std::try_to_lock);
+    if (!lock.owns_lock()) {
+        // Another thread is attempting it: share its outcome rather than
+        // queueing one attempt per recalculating cell behind it.
+        lock.lock();
+        return g_handshakeState.load(std::memory_order_acquire) == kOk;
+    }
+    if (HandshakePending()) AttemptHandshake(kHandshakeCallTimeoutMs);
+    return g_handshakeState.load(std::memory_order_acquire) == kOk;
+}
+
+std::wstring HandshakeErrorText() {
+    std::lock_guard<std::mutex> lock(g_handshakeMutex);
+    if (g_handshakeState.load(std::memory_order_acquire) == kPending) {
+        return L"#XLL-GEN: server not connected (handshake pending)";
+    }
+    return StringToWString("#XLL-GEN MISMATCH: " + g_hsReason + " (regenerate and rebuild both sides)");
+}
+
+} // namespace xll
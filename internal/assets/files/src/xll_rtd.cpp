@@ -220,6 +220,49 @@ void ProcessRtdUpdate(const protocol::RtdUpdate* update) {
     VariantClear(&v);
 }
 
+// ProcessRtdProgress handles MSG_RTD_PROGRESS: interim text pushed by
+// rtd.Progress from inside a running rtd-once handler. It is DISPLAY-ONLY.
+//
+// The text goes into RtdOnceRegistry's separate progress map, never through
+// StoreResult: a stored result is a wrapper HIT, which drops the xlfRtd
+// reference, disconnects the topic and (under memoize) retains "Running 45%"
+// as the answer. Instead the wrapper keeps MISSING, keeps the topic alive via
+// xlfRtd, and paints TryGetProgress in place of the loading placeholder. The
+// UpdateTopic + SignalRtdUpdate below exist only to make Excel recalc the cell
+// so that repaint happens; RefreshData hands Excel the same text, which the
+// wrapper discards like any other miss.
+//
+// Grid-once topics are not handled: a spilled result cannot share its anchor
+// cell with a text value, so their cells keep the placeholder.
+void ProcessRtdProgress(const protocol::RtdUpdate* update) {
+    if (!update) return;
+    long topicID = update->topic_id();
+    auto anyVal = update->val();
+    if (!anyVal || anyVal->val_type() != protocol::AnyValue::Str) return;
+
+    std::wstring onceKey;
+    if (!xll::RtdOnceRegistry::Instance().KeyForTopic(topicID, onceKey)) {
+        xll::LogDebug("RTD: progress for non rtd-once TopicID " + std::to_string(topicID) + " ignored");
+        return;
+    }
+    std::wstring text = StringToWString(anyVal->val_as_Str()->val()->str());
+    if (!xll::RtdOnceRegistry::Instance().StoreProgress(onceKey, text)) {
+        // The result is already stored (or the topic is gone): pushing the text
+        // now would make RefreshData hand Excel progress over the final value.
+        xll::LogDebug("RTD: late progress for TopicID " + std::to_string(topicID) + " dropped");
+        return;
+    }
+
+    if (g_rtdServer) {
+        VARIANT v; VariantInit(&v);
+        v.vt = VT_BSTR;
+        v.bstrVal = SysAllocString(text.c_str());
+        g_rtdServer->UpdateTopic(topicID, v);
+        VariantClear(&v);
+        xll::SignalRtdUpdate();
+    }
+}
+
 // ProcessRtdOnceGrid caches a one-shot grid/numgrid result delivered guest->host
 // for a grid-returning rtd-once function. Called from the worker dispatch
 // (xll_worker.cpp) for MSG_RTD_ONCE_GRID, on either the single-slot or the
@@ -5,6 +5,7 @@
 #include "xll_log.h"
 #include "xll_lifecycle.h"
 #include "xll_async.h"
+#include "xll_handshake.h"
 #include <windows.h>
 #include <vector>
 #include <string>
@@ -13,11 +14,16 @@
 #include <chrono>
 #include <thread>
 #include <cstring>  // std::memcpy in HandleChunk
+#ifdef XLL_CHUNK_COMPRESSION
+#include <zstd.h>   // DecompressChunkPayload (server.chunk.compress_threshold)
+#endif
 
 #ifdef XLL_RTD_ENABLED
 #include "rtd/rtd.h" // Needed for IRTDUpdateEvent
 // External declarations
 void ProcessRtdUpdate(const protocol::RtdUpdate* update);
+// Display-only rtd-once progress (MSG_RTD_PROGRESS); never stored as a result.
+void ProcessRtdProgress(const protocol::RtdUpdate* update);
 // Guest->host one-shot grid delivery: caches the result bytes in
 // RtdOnceGridRegistry. `buf`/`len` is the full serialized
 // protocol::RtdOnceGridResult buffer (see xll_rtd.cpp for the byte contract).
@@ -114,6 +120,56 @@ static std::atomic<bool> g_workerExited{true};
 ChunkRegistry g_chunkRegistry;
 std::mutex g_partialMessagesMutex;
 
+// DecompressChunkPayload inflates a reassembled transfer that carried
+// CHUNK_COMPRESSED_FLAG into `out`. The frame's declared content size is
+// checked against maxSize BEFORE anything is allocated — the reassembly cap
+// admitted only the COMPRESSED total, and without this check a small transfer
+// could inflate to any size it likes. Mirrors pkg/chunk.Decompress, including
+// the refusals of a frame with no declared size and of an empty result (the
+// RefusedZeroTotal reasoning: GetRoot<> on zero bytes is an access violation).
+//
+// Built without XLL_CHUNK_COMPRESSION (xll.yaml sets no
+// server.chunk.compress_threshold, so zstd is not linked), every compressed
+// transfer is refused: the generated server never sets the flag then, and
+// dispatching zstd bytes as a FlatBuffer would be far worse than an error.
+static bool DecompressChunkPayload(const std::vector<uint8_t>& in, uint64_t maxSize,
+                                   std::vector<uint8_t>& out, std::string& why) {
+#ifdef XLL_CHUNK_COMPRESSION
+    const unsigned long long declared = ZSTD_getFrameContentSize(in.data(), in.size());
+    if (declared == ZSTD_CONTENTSIZE_ERROR) {
+        why = "malformed zstd frame";
+        return false;
+    }
+    if (declared == ZSTD_CONTENTSIZE_UNKNOWN) {
+        why = "zstd frame does not declare its content size";
+        return false;
+    }
+    if (declared == 0) {
+        why = "zstd frame declares an empty payload";
+        return false;
+    }
+    if (declared > maxSize) {
+        why = "decompressed size " + std::to_string(declared) + " exceeds the cap " + std::to_string(maxSize);
+        return false;
+    }
+    out.resize(static_cast<size_t>(declared));
+    const size_t n = ZSTD_decompress(out.data(), out.size(), in.data(), in.size());
+    if (ZSTD_isError(n)) {
+        why = ZSTD_getErrorName(n);
+        return false;
+    }
+    if (n != out.size()) {
+        why = "zstd frame inflated to " + std::to_string(n) + " bytes, declared " + std::to_string(declared);
+        return false;
+    }
+    return true;
+#else
+    (void)in; (void)maxSize; (void)out;
+    why = "this XLL was built without chunk compression (server.chunk.compress_threshold)";
+    return false;
+#endif
+}
+
 // HandleChunk reassembles one inbound chunk.
 //
 // Returns false when the chunk is REFUSED (protocol violation, resource bound,
@@ -268,6 +324,24 @@ bool HandleChunk(const protocol::Chunk* chunk) {
         // Process the full message
         int32_t type = pm.finalMsgType;
         const uint8_t* data = pm.buffer.data();
+        size_t size = pm.totalSize;
+
+        // A compressed transfer reassembled the zstd stream; inflate it under
+        // the same per-transfer cap its declared total was admitted against.
+        // A frame that will not inflate is a protocol violation like any
+        // other, so the id is poisoned rather than merely completed.
+        std::vector<uint8_t> inflated;
+        if (static_cast<uint32_t>(type) & CHUNK_COMPRESSED_FLAG) {
+            std::string why;
+            if (!DecompressChunkPayload(pm.buffer, g_chunkRegistry.maxTotalSize(), inflated, why)) {
+                if (!g_isUnloading) LogWarn("Refusing compressed chunk transfer (id " + std::to_string(msgId) + "): " + why);
+                g_chunkRegistry.Poison(msgId, now);
+                return false;
+            }
+            type = static_cast<int32_t>(static_cast<uint32_t>(type) & ~CHUNK_COMPRESSED_FLAG);
+            data = inflated.data();
+            size = inflated.size();
+        }
 
         // Dispatch based on type
         if (type == (int32_t)MSG_BATCH_ASYNC_RESPONSE) {
@@ -279,11 +353,14 @@ bool HandleChunk(const protocol::Chunk* chunk) {
         } else if (type == (int32_t)MSG_RTD_UPDATE) {
              auto update = flatbuffers::GetRoot<protocol::RtdUpdate>(data);
              ProcessRtdUpdate(update);
+        } else if (type == (int32_t)MSG_RTD_PROGRESS) {
+             auto update = flatbuffers::GetRoot<protocol::RtdUpdate>(data);
+             ProcessRtdProgress(update);
         } else if (type == (int32_t)MSG_RTD_ONCE_GRID) {
              // One-shot grid result (possibly chunk-reassembled, since a Grid
              // can be large). Hand the full RtdOnceGridResult buffer to the
              // registry; ProcessRtdOnceGrid owns the parse + Store.
-             ProcessRtdOnceGrid(data, pm.totalSize);
+             ProcessRtdOnceGrid(data, size);
 #endif
         }
 
@@ -404,6 +481,10 @@ void WorkerLoop() {
                 auto update = flatbuffers::GetRoot<protocol::RtdUpdate>(reqBuf);
                 ProcessRtdUpdate(update);
                 return 1;
+            } else if (msgType == (shm::MsgType)MSG_RTD_PROGRESS) {
+                auto update = flatbuffers::GetRoot<protocol::RtdUpdate>(reqBuf);
+                ProcessRtdProgress(update);
+                return 1;
             } else if (msgType == (shm::MsgType)MSG_RTD_ONCE_GRID) {
                 // One-shot grid result delivered in a single slot (not chunked).
                 ProcessRtdOnceGrid(reqBuf, (size_t)reqSize);
@@ -428,6 +509,16 @@ void WorkerLoop() {
             LogDebug("Call return guest call receive complete");
         }
 
+        // Connect handshake (xll_handshake.h): attempt it from here while it is
+        // pending, so it completes as soon as the server connects instead of on
+        // the first function call. The attempt is bounded by kHandshakeAttemptMs
+        // and never waits behind a calc thread's, so park + attempt still fits
+        // the teardown reap budget like kWorkerParkMs alone does.
+        if (HandshakePending() && !g_isUnloading && !g_isQuiescing) {
+            constexpr uint32_t kHandshakeAttemptMs = 100;
+            HandshakeOnConnect(kHandshakeAttemptMs);
+        }
+
         // Periodic cleanup
         auto now = std::chrono::steady_clock::now();
         if (now - lastCleanup > std::chrono::seconds(10)) {
@@ -0,0 +1,103 @@
+package assets
+
+import (
+	"strings"
+	"testing"
+)
+
+// The connect handshake (xll_handshake.cpp, pkg/server/handshake.go) is what
+// stops a stale server from receiving another xll.yaml's MSG_USER_START + i.
+// Its two failure modes end differently: a transport error leaves it pending
+// (the server is merely not up yet, so the worker retries) and any answered
+// reply that does not match refuses for good. Neither lets a call through.
+
+func handshakeSource(t *testing.T) string {
+	t.Helper()
+	m, err := Assets()
+	if err != nil {
+		t.Fatalf("Assets(): %v", err)
+	}
+	s, ok := m["src/xll_handshake.cpp"]
+	if !ok {
+		t.Fatal("embedded asset src/xll_handshake.cpp not found")
+	}
+	return stripCppCommentsAsset(s)
+}
+
+// TestHandshakeTransportErrorStaysPending: a Send error publishes no outcome,
+// so the next attempt retries, and EnsureHandshake reports only kOk as success,
+// so the call that hit it is refused rather than sent unchecked.
+func TestHandshakeTransportErrorStaysPending(t *testing.T) {
+	t.Parallel()
+	src := handshakeSource(t)
+
+	i := strings.Index(src, "if (res.HasError()) {")
+	if i < 0 {
+		t.Fatal("AttemptHandshake must check the Send result")
+	}
+	block := src[i:]
+	if end := strings.Index(block, "}"); end >= 0 {
+		block = block[:end]
+	}
+	if strings.Contains(block, "return true;") || !strings.Contains(block, "return;") {
+		t.Error("a transport error must end the attempt without letting the call through")
+	}
+	if strings.Contains(block, "g_handshakeState.store") {
+		t.Error("a transport error must leave the handshake pending")
+	}
+
+	j := strings.Index(src, "bool EnsureHandshake() {")
+	if j < 0 {
+		t.Fatal("EnsureHandshake not found")
+	}
+	body := src[j:]
+	if end := strings.Index(body, "\n}"); end >= 0 {
+		body = body[:end]
+	}
+	if strings.Contains(body, "return true;") {
+		t.Error("EnsureHandshake must not pass a call while the handshake is pending")
+	}
+}
+
+// TestHandshakeRunsAtConnect: the worker loop drives the handshake while it is
+// pending, so it does not wait for the first function call, and never blocks
+// behind a calc thread's attempt.
+func TestHandshakeRunsAtConnect(t *testing.T) {
+	t.Parallel()
+	m, err := Assets()
+	if err != nil {
+		t.Fatalf("Assets(): %v", err)
+	}
+	worker := stripCppCommentsAsset(m["src/xll_worker.cpp"])
+	loop := worker[strings.Index(worker, "while (g_workerRunning) {"):]
+	if !strings.Contains(loop, "HandshakeOnConnect(") {
+		t.Error("the worker loop must attempt the handshake while it is pending")
+	}
+	src := handshakeSource(t)
+	k := strings.Index(src, "void HandshakeOnConnect(")
+	if k < 0 || !strings.Contains(src[k:], "std::try_to_lock") {
+		t.Error("HandshakeOnConnect must not wait on the handshake mutex")
+	}
+}
+
+// TestHandshakeVerifiesTheReply: the reply is wire input from whatever binary
+// sits in temp_dir (an older server answers 141 as its first function), so it
+// is verified before it is read, and every field is compared.
+func TestHandshakeVerifiesTheReply(t *testing.T) {
+	t.Parallel()
+	src := handshakeSource(t)
+
+	verify := strings.Index(src, "VerifyBuffer<protocol::Grid>")
+	read := strings.Index(src, "GetRoot<protocol::Grid>")
+	if verify < 0 || read < 0 || verify > read {
+		t.Error("the handshake reply must be verified as a protocol::Grid before GetRoot reads it")
+	}
+	for _, key := range []string{`kv["status"]`, `kv["version"]`, `kv["schema_hash"]`, `kv["msg_user_start"]`, `kv["msg_user_end"]`} {
+		if !strings.Contains(src, key) {
+			t.Errorf("EnsureHandshake must check %s", key)
+		}
+	}
+	if !strings.Contains(src, "(shm::MsgType)MSG_HANDSHAKE") {
+		t.Error("the handshake must be sent as MSG_HANDSHAKE")
+	}
+}
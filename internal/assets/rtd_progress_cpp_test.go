@@ -0,0 +1,100 @@
+package assets
+
+import (
+	"strings"
+	"testing"
+)
+
+// rtd.Progress (pkg/rtd/progress.go) pushes interim text for a running
+// rtd-once handler as MSG_RTD_PROGRESS. The host side is display-only: the text
+// must never become a one-shot RESULT, because a stored result is a wrapper HIT
+// (topic released, and under memoize "Running 45%" retained as the answer).
+
+func rtdProgressSources(t *testing.T) (rtd, worker, once string) {
+	t.Helper()
+	m, err := Assets()
+	if err != nil {
+		t.Fatalf("Assets(): %v", err)
+	}
+	get := func(name string) string {
+		s, ok := m[name]
+		if !ok {
+			t.Fatalf("embedded asset %s not found", name)
+		}
+		return stripCppCommentsAsset(s)
+	}
+	return get("src/xll_rtd.cpp"), get("src/xll_worker.cpp"), get("include/xll_rtd_once.h")
+}
+
+// TestRtdProgressNeverStoresAResult pins the display-only contract of
+// ProcessRtdProgress: it writes the separate progress map and never
+// StoreResult.
+func TestRtdProgressNeverStoresAResult(t *testing.T) {
+	t.Parallel()
+	rtd, _, _ := rtdProgressSources(t)
+
+	start := strings.Index(rtd, "void ProcessRtdProgress(const protocol::RtdUpdate* update) {")
+	if start < 0 {
+		t.Fatal("xll_rtd.cpp must define ProcessRtdProgress(const protocol::RtdUpdate*)")
+	}
+	body := rtd[start:]
+	if end := strings.Index(body, "\n}\n"); end >= 0 {
+		body = body[:end]
+	}
+	if !strings.Contains(body, "StoreProgress(") {
+		t.Error("ProcessRtdProgress must record the text via RtdOnceRegistry::StoreProgress")
+	}
+	if strings.Contains(body, "StoreResult(") {
+		t.Error("ProcessRtdProgress must NEVER call StoreResult: progress would become the memoized answer")
+	}
+}
+
+// TestRtdProgressDispatchedOnBothWorkerPaths: a progress frame can arrive in a
+// single slot or (in principle) chunk-reassembled, like MSG_RTD_UPDATE.
+func TestRtdProgressDispatchedOnBothWorkerPaths(t *testing.T) {
+	t.Parallel()
+	_, worker, _ := rtdProgressSources(t)
+
+	for _, want := range []string{
+		"type == (int32_t)MSG_RTD_PROGRESS",
+		"msgType == (shm::MsgType)MSG_RTD_PROGRESS",
+	} {
+		if !strings.Contains(worker, want) {
+			t.Errorf("xll_worker.cpp must dispatch %q to ProcessRtdProgress", want)
+		}
+	}
+	if n := strings.Count(worker, "ProcessRtdProgress(update);"); n != 2 {
+		t.Errorf("ProcessRtdProgress called %d times in xll_worker.cpp, want 2 (chunk + direct)", n)
+	}
+}
+
+// TestRtdProgressYieldsToTheResult: StoreResult drops the key's progress, and
+// StoreProgress is ignored once a result exists, so a progress frame that raced
+// the final push cannot repaint over it. ProcessRtdProgress then skips the
+// UpdateTopic too, or RefreshData would still hand Excel the late text.
+func TestRtdProgressYieldsToTheResult(t *testing.T) {
+	t.Parallel()
+	_, _, once := rtdProgressSources(t)
+
+	if !strings.Contains(once, "if (m_results.count(key) != 0 || !KeyHasLiveTopic(key)) return false;") {
+		t.Error("StoreProgress must ignore, and report, keys that already have a result or no live topic")
+	}
+	i := strings.Index(once, "void StoreResult(")
+	if i < 0 {
+		t.Fatal("xll_rtd_once.h must define StoreResult")
+	}
+	if j := strings.Index(once[i:], "m_progress.erase(key);"); j < 0 || j > 300 {
+		t.Error("StoreResult must erase the key's progress text before storing the result")
+	}
+	rtd, _, _ := rtdProgressSources(t)
+	start := strings.Index(rtd, "void ProcessRtdProgress(const protocol::RtdUpdate* update) {")
+	if start < 0 {
+		t.Fatal("xll_rtd.cpp must define ProcessRtdProgress(const protocol::RtdUpdate*)")
+	}
+	body := rtd[start:]
+	store := strings.Index(body, "if (!xll::RtdOnceRegistry::Instance().StoreProgress(")
+	update := strings.Index(body, "UpdateTopic(")
+	if store < 0 || update < 0 || store > update {
+		t.Error("ProcessRtdProgress must skip UpdateTopic when StoreProgress rejects the text")
+	}
+}
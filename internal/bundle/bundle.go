@@ -0,0 +1,259 @@
+// Package bundle assembles the distribution archive of a built project: the
+// XLL and whatever must ship beside it, a README for desktop support, an
+// optional per-user install script, and a manifest.json with the SHA-256 of
+// every file. It backs `xll-gen package`.
+//
+// The archive is reproducible: entries are sorted, carry a fixed timestamp
+// and mode, and the manifest records nothing about the machine or the time of
+// packaging, so packaging the same build twice gives byte-identical zips.
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/docs"
+	"github.com/xll-gen/xll-gen/internal/templates"
+	"github.com/xll-gen/xll-gen/internal/versions"
+	"github.com/xll-gen/xll-gen/version"
+)
+
+// ManifestFile is the name of the manifest at the root of the archive.
+const ManifestFile = "manifest.json"
+
+// InstallScript is the name of the optional install script.
+const InstallScript = "install.ps1"
+
+// Epoch is the timestamp of every archive entry unless the caller passes
+// another (e.g. from SOURCE_DATE_EPOCH): the earliest a zip can record.
+var Epoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Options selects the optional contents of the bundle.
+type Options struct {
+	// InstallScript adds install.ps1, which installs the add-in for the
+	// current user.
+	InstallScript bool
+}
+
+// Source is one file of the bundle: its path inside the archive root and its
+// content.
+type Source struct {
+	Name string
+	Data []byte
+}
+
+// Manifest describes the bundle. Its fields are all derived from xll.yaml,
+// xll-gen itself and the bundled bytes.
+type Manifest struct {
+	Project   string            `json:"project"`
+	Version   string            `json:"version"`
+	XllGen    string            `json:"xll_gen"`
+	Deps      map[string]string `json:"deps"`
+	Functions []Function        `json:"functions"`
+	Commands  []string          `json:"commands,omitempty"`
+	Rtd       *COMClass         `json:"rtd,omitempty"`
+	Ribbon    *COMClass         `json:"ribbon,omitempty"`
+	Files     []File            `json:"files"`
+}
+
+// Function is one worksheet function the XLL registers.
+type Function struct {
+	Name   string `json:"name"`
+	ID     int    `json:"id"`
+	Mode   string `json:"mode"`
+	Return string `json:"return"`
+}
+
+// COMClass identifies a COM class the XLL registers under HKCU when it loads.
+type COMClass struct {
+	ProgID string `json:"prog_id"`
+	CLSID  string `json:"clsid"`
+}
+
+// File is one bundled file; Path is relative to the archive root.
+type File struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Name returns the archive's base name, and the name of its root directory:
+// "<project>-<version>", or the project alone when it has no version.
+func Name(cfg *config.Config) string {
+	if cfg.Project.Version == "" {
+		return cfg.Project.Name
+	}
+	return cfg.Project.Name + "-" + unsafeName.ReplaceAllString(cfg.Project.Version, "_")
+}
+
+// Collect gathers the bundle of cfg, whose build output is in buildDir:
+// <project>.xll, the server executable unless the XLL embeds it
+// (build.singlefile: xll), the IntelliSense descriptor when the build wrote
+// one, reference.html, README.txt and, if asked, install.ps1. Ribbon images
+// are compiled into the XLL and need no file. The result is sorted by name.
+func Collect(cfg *config.Config, buildDir string, opts Options) ([]Source, error) {
+	name := cfg.Project.Name
+	required := []string{name + ".xll"}
+	if cfg.Build.Singlefile != "xll" {
+		required = append(required, name+".exe")
+	}
+	var files []Source
+	for _, f := range required {
+		data, err := os.ReadFile(filepath.Join(buildDir, f))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s not found in %s; run 'xll-gen build' first", f, buildDir)
+		} else if err != nil {
+			return nil, err
+		}
+		files = append(files, Source{Name: f, Data: data})
+	}
+	tips := name + ".intellisense.xml"
+	if data, err := os.ReadFile(filepath.Join(buildDir, tips)); err == nil {
+		files = append(files, Source{Name: tips, Data: data})
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	ref, err := docs.HTML(cfg)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, Source{Name: "reference.html", Data: ref})
+
+	data := struct {
+		Project        string
+		ProjectVersion string
+		Version        string
+		Xll            string
+		Files          []string
+		InstallScript  bool
+		Functions      int
+		Rtd            bool
+	}{
+		Project:        name,
+		ProjectVersion: cfg.Project.Version,
+		Version:        version.Version,
+		Xll:            name + ".xll",
+		InstallScript:  opts.InstallScript,
+		Functions:      len(cfg.Functions),
+		Rtd:            cfg.Rtd.Enabled,
+	}
+	if opts.InstallScript {
+		script, err := render("install.ps1.tmpl", data)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, Source{Name: InstallScript, Data: script})
+	}
+	for _, f := range files {
+		data.Files = append(data.Files, f.Name)
+	}
+	data.Files = append(data.Files, ManifestFile, "README.txt")
+	sort.Strings(data.Files)
+	readme, err := render("package_readme.txt.tmpl", data)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, Source{Name: "README.txt", Data: readme})
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// render executes an embedded template. The output is for Windows users, so
+// lines end in CRLF.
+func render(name string, data any) ([]byte, error) {
+	src, err := templates.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New(name).Funcs(template.FuncMap{"psQuote": psQuote}).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return bytes.ReplaceAll(buf.Bytes(), []byte("\n"), []byte("\r\n")), nil
+}
+
+// psQuote returns s as a single-quoted PowerShell string literal.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// NewManifest returns the manifest of cfg's bundle of files.
+func NewManifest(cfg *config.Config, files []Source) *Manifest {
+	m := &Manifest{
+		Project: cfg.Project.Name,
+		Version: cfg.Project.Version,
+		XllGen:  version.Version,
+		Deps: map[string]string{
+			"flatbuffers": versions.FlatBuffers,
+			"shm":         versions.SHM,
+			"types":       versions.Types,
+			"phmap":       versions.PHMAP,
+			"zstd":        versions.Zstd,
+		},
+	}
+	for i, fn := range cfg.Functions {
+		m.Functions = append(m.Functions, Function{Name: fn.Name, ID: fn.MsgOffset(i), Mode: fn.Mode, Return: fn.Return})
+	}
+	for _, c := range cfg.Commands {
+		m.Commands = append(m.Commands, c.Name)
+	}
+	if cfg.Rtd.Enabled {
+		m.Rtd = &COMClass{ProgID: cfg.Rtd.ProgID, CLSID: cfg.Rtd.Clsid}
+	}
+	if cfg.Ribbon.Enabled() {
+		m.Ribbon = &COMClass{ProgID: cfg.Ribbon.ProgID, CLSID: cfg.Ribbon.Clsid}
+	}
+	for _, f := range files {
+		sum := sha256.Sum256(f.Data)
+		m.Files = append(m.Files, File{Path: f.Name, Size: len(f.Data), SHA256: hex.EncodeToString(sum[:])})
+	}
+	return m
+}
+
+// Write writes the zip of files and their manifest m to w, all under the
+// directory root, with every entry stamped modified.
+func Write(w io.Writer, root string, m *Manifest, files []Source, modified time.Time) error {
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	entries := append([]Source{{Name: ManifestFile, Data: append(manifest, '\n')}}, files...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: root + "/" + e.Name, Method: zip.Deflate, Modified: modified.UTC()}
+		h.SetMode(0644)
+		fw, err := zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(e.Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,140 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+func testConfig(t *testing.T, singlefile string) *config.Config {
+	t.Helper()
+	cfg := &config.Config{
+		Project: config.ProjectConfig{Name: "Quotes", Version: "1.2.0 beta"},
+		Build:   config.BuildConfig{Singlefile: singlefile},
+		Rtd:     config.RtdConfig{Enabled: true, ProgID: "Quotes.RTD"},
+		Functions: []config.Function{
+			{Name: "Quote", Args: []config.Arg{{Name: "ticker", Type: "string"}}, Return: "float"},
+			{Name: "Feed", Mode: "rtd", Args: []config.Arg{{Name: "ticker", Type: "string"}}, Return: "any"},
+		},
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func writeBuild(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, n := range names {
+		if err := os.WriteFile(filepath.Join(dir, n), []byte("binary "+n), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func names(files []Source) string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Name)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestCollect(t *testing.T) {
+	cfg := testConfig(t, "")
+	dir := writeBuild(t, "Quotes.xll", "Quotes.exe", "Quotes.intellisense.xml", "go_server.exe")
+	files, err := Collect(cfg, dir, Options{InstallScript: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Quotes.exe,Quotes.intellisense.xml,Quotes.xll,README.txt,install.ps1,reference.html"
+	if got := names(files); got != want {
+		t.Errorf("files = %s, want %s", got, want)
+	}
+	for _, f := range files {
+		if f.Name == "install.ps1" && !bytes.Contains(f.Data, []byte("$project = 'Quotes'\r\n")) {
+			t.Errorf("install.ps1 does not name the project:\n%s", f.Data)
+		}
+		if f.Name == "README.txt" && !bytes.Contains(f.Data, []byte("install.ps1")) {
+			t.Errorf("README.txt does not mention install.ps1:\n%s", f.Data)
+		}
+	}
+
+	// The server is embedded in a singlefile XLL, and the script is opt-in.
+	files, err = Collect(testConfig(t, "xll"), writeBuild(t, "Quotes.xll"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(files); got != "Quotes.xll,README.txt,reference.html" {
+		t.Errorf("singlefile files = %s", got)
+	}
+
+	if _, err := Collect(cfg, writeBuild(t, "Quotes.xll"), Options{}); err == nil || !strings.Contains(err.Error(), "Quotes.exe") {
+		t.Errorf("a missing server executable must fail, got %v", err)
+	}
+}
+
+func TestWriteReproducible(t *testing.T) {
+	cfg := testConfig(t, "")
+	files, err := Collect(cfg, writeBuild(t, "Quotes.xll", "Quotes.exe"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a, b bytes.Buffer
+	if err := Write(&a, Name(cfg), NewManifest(cfg, files), files, Epoch); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(&b, Name(cfg), NewManifest(cfg, files), files, Epoch); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Fatal("packaging the same files twice gave different archives")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(a.Bytes()), int64(a.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Name(cfg) != "Quotes-1.2.0_beta" {
+		t.Errorf("Name = %q", Name(cfg))
+	}
+	var m Manifest
+	contents := map[string][]byte{}
+	for _, f := range zr.File {
+		if !strings.HasPrefix(f.Name, "Quotes-1.2.0_beta/") || !f.Modified.Equal(Epoch) {
+			t.Errorf("entry %s modified %v", f.Name, f.Modified)
+		}
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		contents[strings.TrimPrefix(f.Name, "Quotes-1.2.0_beta/")] = data
+	}
+	if err := json.Unmarshal(contents[ManifestFile], &m); err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	if m.Project != "Quotes" || m.XllGen == "" || m.Deps["shm"] == "" || len(m.Functions) != 2 ||
+		m.Functions[1] != (Function{Name: "Feed", ID: 1, Mode: "rtd", Return: "any"}) ||
+		m.Rtd == nil || m.Rtd.ProgID != "Quotes.RTD" || m.Rtd.CLSID == "" || m.Ribbon != nil {
+		t.Errorf("manifest = %+v", m)
+	}
+	if len(m.Files) != len(files) {
+		t.Fatalf("manifest lists %d files, archive has %d", len(m.Files), len(files))
+	}
+	for _, f := range m.Files {
+		sum := sha256.Sum256(contents[f.Path])
+		if hex.EncodeToString(sum[:]) != f.SHA256 || len(contents[f.Path]) != f.Size {
+			t.Errorf("%s: manifest checksum does not match the archived bytes", f.Path)
+		}
+	}
+}
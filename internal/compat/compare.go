@@ -0,0 +1,337 @@
+package compat
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Change is one difference between a baseline and the new schema.
+type Change struct {
+	// Breaking is true when a peer built from the baseline misreads data from,
+	// or sends data misread by, a peer built from the new schema.
+	Breaking bool
+	// Subject names what changed: a function, a qualified table or field, an
+	// enum or union, or a message ID.
+	Subject string
+	// Detail says how, in baseline -> new terms.
+	Detail string
+}
+
+// FunctionNamespace is the namespace of the generated per-function tables;
+// its "<Name>Request" tables, in declaration order, are the function list.
+const FunctionNamespace = "ipc"
+
+// Functions returns the project's functions in declaration order, read from
+// the Request tables of the generated schema.
+func (s *Schema) Functions() []string {
+	var out []string
+	prefix := FunctionNamespace + "."
+	for _, name := range s.Order {
+		if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, "Request") && !s.Tables[name].Struct {
+			out = append(out, strings.TrimSuffix(strings.TrimPrefix(name, prefix), "Request"))
+		}
+	}
+	return out
+}
+
+// FunctionIDs maps each function to its ID (its message ID less
+// MsgUserStart): the function manifest when the schema carries one, otherwise
+// its position, which is what every function had before IDs could be pinned.
+func (s *Schema) FunctionIDs() map[string]int {
+	ids := map[string]int{}
+	for i, name := range s.Functions() {
+		id, ok := s.FuncIDs[name]
+		if !ok {
+			id = i
+		}
+		ids[name] = id
+	}
+	return ids
+}
+
+// Compare classifies every difference between base and next. Changes are
+// returned sorted by subject. Message IDs are compared only when both schemas
+// carry the msgid manifest.
+func Compare(base, next *Schema) []Change {
+	var out []Change
+	add := func(breaking bool, subject, format string, args ...any) {
+		out = append(out, Change{Breaking: breaking, Subject: subject, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	// Functions: the ID is the message ID.
+	baseIDs, nextIDs := base.FunctionIDs(), next.FunctionIDs()
+	removedFn := map[string]bool{}
+	freed := map[int]string{}
+	for _, name := range sortedKeys(baseIDs) {
+		i := baseIDs[name]
+		j, ok := nextIDs[name]
+		switch {
+		case !ok:
+			removedFn[name] = true
+			freed[i] = name
+			add(true, "function "+name, "removed (was MsgUserStart+%d)", i)
+		case i != j:
+			freed[i] = name
+			add(true, "function "+name, "moved from MsgUserStart+%d to MsgUserStart+%d", i, j)
+		}
+	}
+	addedFn := map[string]bool{}
+	for _, name := range sortedKeys(nextIDs) {
+		if _, ok := baseIDs[name]; ok {
+			continue
+		}
+		j := nextIDs[name]
+		addedFn[name] = true
+		if old, ok := freed[j]; ok {
+			add(true, "function "+name, "added at MsgUserStart+%d, the baseline's ID for %s", j, old)
+		} else {
+			add(false, "function "+name, "added at MsgUserStart+%d", j)
+		}
+	}
+	// A removed or added function's own tables are reported once, as the
+	// function.
+	ownedBy := func(table string, fns map[string]bool) bool {
+		name, ok := strings.CutPrefix(table, FunctionNamespace+".")
+		if !ok {
+			return false
+		}
+		for _, suffix := range []string{"Request", "Response"} {
+			if fn, ok := strings.CutSuffix(name, suffix); ok && fns[fn] {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Tables and structs.
+	for _, name := range sortedKeys(base.Tables) {
+		bt := base.Tables[name]
+		nt, ok := next.Tables[name]
+		if !ok {
+			if !ownedBy(name, removedFn) {
+				add(true, name, "removed")
+			}
+			continue
+		}
+		if bt.Struct != nt.Struct {
+			add(true, name, "changed from %s to %s", kind(bt), kind(nt))
+			continue
+		}
+		if bt.Struct {
+			compareStruct(bt, nt, add)
+		} else {
+			compareTable(bt, nt, add)
+		}
+	}
+	for _, name := range sortedKeys(next.Tables) {
+		if _, ok := base.Tables[name]; !ok && !ownedBy(name, addedFn) {
+			add(false, name, "%s added", kind(next.Tables[name]))
+		}
+	}
+
+	// Enums.
+	for _, name := range sortedKeys(base.Enums) {
+		be := base.Enums[name]
+		ne, ok := next.Enums[name]
+		if !ok {
+			add(true, name, "enum removed")
+			continue
+		}
+		if be.Underlying != ne.Underlying {
+			add(true, name, "underlying type %s -> %s", be.Underlying, ne.Underlying)
+		}
+		compareValues(name, be.Values, ne.Values, "value", add)
+	}
+	for _, name := range sortedKeys(next.Enums) {
+		if _, ok := base.Enums[name]; !ok {
+			add(false, name, "enum added")
+		}
+	}
+
+	// Unions.
+	for _, name := range sortedKeys(base.Unions) {
+		bu := base.Unions[name]
+		nu, ok := next.Unions[name]
+		if !ok {
+			add(true, name, "union removed")
+			continue
+		}
+		compareValues(name, bu.Members, nu.Members, "member", add)
+	}
+	for _, name := range sortedKeys(next.Unions) {
+		if _, ok := base.Unions[name]; !ok {
+			add(false, name, "union added")
+		}
+	}
+
+	// Message IDs.
+	if base.MsgIDs != nil && next.MsgIDs != nil {
+		for _, name := range sortedKeys(base.MsgIDs) {
+			v, ok := next.MsgIDs[name]
+			switch {
+			case !ok:
+				add(true, "msgid "+name, "removed (was %d)", base.MsgIDs[name])
+			case v != base.MsgIDs[name]:
+				add(true, "msgid "+name, "%d -> %d", base.MsgIDs[name], v)
+			}
+		}
+		for _, name := range sortedKeys(next.MsgIDs) {
+			if _, ok := base.MsgIDs[name]; !ok {
+				add(false, "msgid "+name, "added = %d", next.MsgIDs[name])
+			}
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Subject < out[j].Subject })
+	return out
+}
+
+// compareTable applies the table rules: a field is its slot.
+func compareTable(bt, nt *Table, add func(bool, string, string, ...any)) {
+	nextByName := map[string]*Field{}
+	nextBySlot := map[int]*Field{}
+	for i := range nt.Fields {
+		nextByName[nt.Fields[i].Name] = &nt.Fields[i]
+		nextBySlot[nt.Fields[i].Slot] = &nt.Fields[i]
+	}
+	baseNames := map[string]bool{}
+	maxSlot := -1
+	for _, f := range bt.Fields {
+		baseNames[f.Name] = true
+		maxSlot = max(maxSlot, f.Slot)
+	}
+	renamed := map[string]bool{}
+	for _, bf := range bt.Fields {
+		subject := bt.Name + "." + bf.Name
+		nf, ok := nextByName[bf.Name]
+		if !ok {
+			if r := nextBySlot[bf.Slot]; r != nil && !baseNames[r.Name] && r.Type == bf.Type {
+				renamed[r.Name] = true
+				add(false, subject, "renamed to %s (same slot and type; source using the old name breaks)", r.Name)
+				continue
+			}
+			add(true, subject, "removed (slot %d); mark it deprecated instead", bf.Slot)
+			continue
+		}
+		if nf.Slot != bf.Slot {
+			add(true, subject, "slot %d -> %d (field reordered)", bf.Slot, nf.Slot)
+		}
+		if nf.Type != bf.Type {
+			add(true, subject, "type %s -> %s", bf.Type, nf.Type)
+		}
+		if nf.Default != bf.Default {
+			add(true, subject, "default %s -> %s (an absent field reads differently)", orNone(bf.Default), orNone(nf.Default))
+		}
+		if nf.Required && !bf.Required {
+			add(true, subject, "now required (a baseline writer may omit it)")
+		}
+		if nf.Deprecated && !bf.Deprecated {
+			add(false, subject, "deprecated")
+		}
+	}
+	for _, nf := range nt.Fields {
+		if baseNames[nf.Name] || renamed[nf.Name] {
+			continue
+		}
+		if nf.Slot > maxSlot {
+			add(false, nt.Name+"."+nf.Name, "added at slot %d", nf.Slot)
+		} else {
+			add(true, nt.Name+"."+nf.Name, "added at slot %d, inside the baseline's slots", nf.Slot)
+		}
+	}
+}
+
+// compareStruct applies the struct rule: the layout is fixed, so any field
+// difference is breaking.
+func compareStruct(bs, ns *Table, add func(bool, string, string, ...any)) {
+	for i := 0; i < max(len(bs.Fields), len(ns.Fields)); i++ {
+		switch {
+		case i >= len(ns.Fields):
+			add(true, bs.Name+"."+bs.Fields[i].Name, "removed from struct")
+		case i >= len(bs.Fields):
+			add(true, ns.Name+"."+ns.Fields[i].Name, "added to struct (changes its size)")
+		case bs.Fields[i].Name != ns.Fields[i].Name || bs.Fields[i].Type != ns.Fields[i].Type:
+			add(true, bs.Name+"."+bs.Fields[i].Name, "struct field %d %s:%s -> %s:%s", i,
+				bs.Fields[i].Name, bs.Fields[i].Type, ns.Fields[i].Name, ns.Fields[i].Type)
+		}
+	}
+}
+
+// compareValues applies the enum/union rule: the value is the wire tag.
+func compareValues(owner string, base, next []Value, what string, add func(bool, string, string, ...any)) {
+	nextByName := map[string]int64{}
+	for _, v := range next {
+		nextByName[v.Name] = v.Value
+	}
+	baseByName := map[string]bool{}
+	for _, v := range base {
+		baseByName[v.Name] = true
+		nv, ok := nextByName[v.Name]
+		switch {
+		case !ok:
+			add(true, owner+"."+v.Name, "%s removed (was %d)", what, v.Value)
+		case nv != v.Value:
+			add(true, owner+"."+v.Name, "%s %d -> %d", what, v.Value, nv)
+		}
+	}
+	for _, v := range next {
+		if !baseByName[v.Name] {
+			add(false, owner+"."+v.Name, "%s added = %d", what, v.Value)
+		}
+	}
+}
+
+// Breaking reports whether any change is breaking.
+func Breaking(changes []Change) bool {
+	for _, c := range changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTable prints changes one per row, breaking ones first.
+func WriteTable(w io.Writer, changes []Change) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tSUBJECT\tCHANGE")
+	for _, breaking := range []bool{true, false} {
+		for _, c := range changes {
+			if c.Breaking != breaking {
+				continue
+			}
+			status := "safe"
+			if c.Breaking {
+				status = "BREAKING"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", status, c.Subject, c.Detail)
+		}
+	}
+	return tw.Flush()
+}
+
+func kind(t *Table) string {
+	if t.Struct {
+		return "struct"
+	}
+	return "table"
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,166 @@
+package compat
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, src string) *Schema {
+	t.Helper()
+	s, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+const baseSchema = `
+// msgid MsgHandshake = 141
+// msgid MsgUserStart = 142
+namespace ipc;
+table AddRequest { a:int; b:int; }
+table AddResponse { result:int; error:string; }
+table GreetRequest { name:string; }
+table GreetResponse { result:string; error:string; }
+enum Mode : byte { Fast, Slow }
+union Payload { AddRequest, GreetRequest }
+struct Pt { x:int; y:int; }
+`
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		next     string
+		want     []string // "B subject: detail-substring" or "S ..."
+		breaking bool
+	}{
+		{name: "identical", next: baseSchema},
+		{
+			name: "field appended and function appended",
+			next: strings.Replace(baseSchema, "table GreetRequest { name:string; }", "table GreetRequest { name:string; loud:bool; }", 1) +
+				"table ByeRequest { } table ByeResponse { error:string; }",
+			want: []string{"S ipc.GreetRequest.loud: added at slot 1", "S function Bye: added at MsgUserStart+2"},
+		},
+		{
+			name: "functions reordered",
+			next: strings.Replace(strings.Replace(baseSchema, "table AddRequest { a:int; b:int; }\n", "", 1),
+				"table GreetResponse", "table AddRequest { a:int; b:int; }\ntable GreetResponse", 1),
+			want:     []string{"B function Add: moved from MsgUserStart+0 to MsgUserStart+1", "B function Greet: moved from MsgUserStart+1 to MsgUserStart+0"},
+			breaking: true,
+		},
+		{
+			name:     "fields reordered",
+			next:     strings.Replace(baseSchema, "{ a:int; b:int; }", "{ b:int; a:int; }", 1),
+			want:     []string{"B ipc.AddRequest.a: slot 0 -> 1", "B ipc.AddRequest.b: slot 1 -> 0"},
+			breaking: true,
+		},
+		{
+			name:     "type changed",
+			next:     strings.Replace(baseSchema, "{ a:int; b:int; }", "{ a:int; b:double; }", 1),
+			want:     []string{"B ipc.AddRequest.b: type int -> double"},
+			breaking: true,
+		},
+		{
+			name:     "field removed",
+			next:     strings.Replace(baseSchema, "{ a:int; b:int; }", "{ a:int; }", 1),
+			want:     []string{"B ipc.AddRequest.b: removed"},
+			breaking: true,
+		},
+		{
+			name: "field renamed and deprecated",
+			next: strings.Replace(baseSchema, "{ a:int; b:int; }", "{ a:int (deprecated); c:int; }", 1),
+			want: []string{"S ipc.AddRequest.a: deprecated", "S ipc.AddRequest.b: renamed to c"},
+		},
+		{
+			name:     "function removed",
+			next:     strings.Replace(baseSchema, "table GreetRequest { name:string; }\ntable GreetResponse { result:string; error:string; }\n", "", 1),
+			want:     []string{"B function Greet: removed", "B ipc.Payload.ipc.GreetRequest: member removed"},
+			breaking: true,
+		},
+		{
+			name:     "enum and union tags",
+			next:     strings.Replace(strings.Replace(baseSchema, "{ Fast, Slow }", "{ Slow, Fast, Warp }", 1), "{ AddRequest, GreetRequest }", "{ GreetRequest, AddRequest }", 1),
+			want:     []string{"B ipc.Mode.Fast: value 0 -> 1", "S ipc.Mode.Warp: value added = 2", "B ipc.Payload.ipc.AddRequest: member 1 -> 2"},
+			breaking: true,
+		},
+		{
+			name:     "struct field",
+			next:     strings.Replace(baseSchema, "{ x:int; y:int; }", "{ x:int; y:int; z:int; }", 1),
+			want:     []string{"B ipc.Pt.z: added to struct"},
+			breaking: true,
+		},
+		{
+			name:     "msgid moved",
+			next:     strings.Replace(strings.Replace(baseSchema, "MsgUserStart = 142", "MsgUserStart = 143", 1), "// msgid MsgHandshake = 141", "// msgid MsgHandshake = 141\n// msgid MsgNew = 142", 1),
+			want:     []string{"B msgid MsgUserStart: 142 -> 143", "S msgid MsgNew: added = 142"},
+			breaking: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			changes := Compare(mustParse(t, baseSchema), mustParse(t, tc.next))
+			var got []string
+			for _, c := range changes {
+				tag := "S"
+				if c.Breaking {
+					tag = "B"
+				}
+				got = append(got, tag+" "+c.Subject+": "+c.Detail)
+			}
+			for _, w := range tc.want {
+				found := false
+				for _, g := range got {
+					found = found || strings.HasPrefix(g, w)
+				}
+				if !found {
+					t.Errorf("missing %q in\n%s", w, strings.Join(got, "\n"))
+				}
+			}
+			if len(tc.want) == 0 && len(got) != 0 {
+				t.Errorf("want no changes, got\n%s", strings.Join(got, "\n"))
+			}
+			if Breaking(changes) != tc.breaking {
+				t.Errorf("Breaking = %v, want %v:\n%s", !tc.breaking, tc.breaking, strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+// TestCompareWithoutManifest: a baseline generated before the msgid manifest
+// existed is compared on its tables alone.
+func TestCompareWithoutManifest(t *testing.T) {
+	old := mustParse(t, "namespace ipc; table AddRequest { a:int; }")
+	if changes := Compare(old, mustParse(t, baseSchema)); Breaking(changes) {
+		t.Errorf("no manifest on one side must not report msgid changes: %+v", changes)
+	}
+}
+
+// TestCompareFunctionIDs: with the function manifest, IDs pinned by id: or
+// xll.lock decide what moved, not the declaration order.
+func TestCompareFunctionIDs(t *testing.T) {
+	const tables = "namespace ipc; table AddRequest { } table GreetRequest { } table ByeRequest { }"
+	base := mustParse(t, "// function Add = 0\n// function Greet = 1\n// function Bye = 2\n"+tables)
+
+	reordered := mustParse(t, "// function Bye = 2\n// function Greet = 1\n// function Add = 0\n"+
+		"namespace ipc; table ByeRequest { } table GreetRequest { } table AddRequest { }")
+	if changes := Compare(base, reordered); len(changes) != 0 {
+		t.Errorf("reordering pinned functions must change nothing, got %+v", changes)
+	}
+
+	// Greet deleted, New appended: safe only while New stays off Greet's ID.
+	fresh := mustParse(t, "// function Add = 0\n// function Bye = 2\n// function New = 3\n"+
+		"namespace ipc; table AddRequest { } table ByeRequest { } table NewRequest { }")
+	for _, c := range Compare(base, fresh) {
+		if c.Subject == "function New" && c.Breaking {
+			t.Errorf("New on a never-used ID must be safe: %+v", c)
+		}
+	}
+	reused := mustParse(t, "// function Add = 0\n// function Bye = 2\n// function New = 1\n"+
+		"namespace ipc; table AddRequest { } table ByeRequest { } table NewRequest { }")
+	found := false
+	for _, c := range Compare(base, reused) {
+		found = found || (c.Subject == "function New" && c.Breaking && strings.Contains(c.Detail, "Greet"))
+	}
+	if !found {
+		t.Errorf("New on Greet's old ID must be breaking: %+v", Compare(base, reused))
+	}
+}
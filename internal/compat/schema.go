@@ -0,0 +1,463 @@
+// Package compat compares two versions of a project's wire schema — the
+// generated schema.fbs, the shipped protocol.fbs and the message IDs — and
+// classifies every difference as breaking or safe for a peer built from the
+// other version. It backs `xll-gen compat`.
+//
+// The rules are FlatBuffers' own: a table field is identified by its slot
+// (explicit id or declaration order), so appending fields is safe while
+// reordering, retyping or removing them is not; struct layouts are fixed;
+// enum and union values are the wire tags. On top of that, a function travels
+// as MsgUserStart + its ID, so a function whose ID changes — its position,
+// when neither id: nor xll.lock pins it — is re-routed.
+package compat
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Schema is the parsed, namespace-qualified content of one or more .fbs files.
+type Schema struct {
+	// Tables holds tables and structs by qualified name.
+	Tables map[string]*Table
+	// Enums holds enums by qualified name.
+	Enums map[string]*Enum
+	// Unions holds unions by qualified name.
+	Unions map[string]*Union
+	// Order lists the qualified table and struct names in declaration order.
+	Order []string
+	// MsgIDs is the "// msgid Name = N" manifest of a generated schema.fbs,
+	// nil when the source carries none.
+	MsgIDs map[string]int
+	// FuncIDs is the "// function Name = ID" manifest of a generated
+	// schema.fbs, nil when the source carries none.
+	FuncIDs map[string]int
+}
+
+// Table is a table or struct.
+type Table struct {
+	Name   string
+	Struct bool
+	Fields []Field
+}
+
+// Field is one table or struct field.
+type Field struct {
+	Name       string
+	Type       string
+	Default    string
+	Slot       int
+	Deprecated bool
+	Required   bool
+}
+
+// Enum is an enum with its underlying type.
+type Enum struct {
+	Name       string
+	Underlying string
+	Values     []Value
+}
+
+// Union is a union; member values are the wire type tags.
+type Union struct {
+	Name    string
+	Members []Value
+}
+
+// Value is an enum value or union member.
+type Value struct {
+	Name  string
+	Value int64
+}
+
+var (
+	msgIDRe  = regexp.MustCompile(`(?m)^//\s*msgid\s+(\w+)\s*=\s*(\d+)\s*$`)
+	funcIDRe = regexp.MustCompile(`(?m)^//\s*function\s+(\w+)\s*=\s*(\d+)\s*$`)
+)
+
+// scalarAliases maps FlatBuffers' sized scalar spellings to the short ones, so
+// `int` and `int32` compare equal.
+var scalarAliases = map[string]string{
+	"int8": "byte", "uint8": "ubyte", "int16": "short", "uint16": "ushort",
+	"int32": "int", "uint32": "uint", "int64": "long", "uint64": "ulong",
+	"float32": "float", "float64": "double",
+}
+
+var builtinTypes = map[string]bool{
+	"bool": true, "byte": true, "ubyte": true, "short": true, "ushort": true,
+	"int": true, "uint": true, "long": true, "ulong": true, "float": true,
+	"double": true, "string": true,
+}
+
+// Parse parses the given .fbs sources into one Schema. include statements are
+// not followed: pass every file that should be compared.
+func Parse(sources ...string) (*Schema, error) {
+	s := &Schema{Tables: map[string]*Table{}, Enums: map[string]*Enum{}, Unions: map[string]*Union{}}
+	var refs []*Field
+	var refNS []string
+	for _, src := range sources {
+		for _, m := range msgIDRe.FindAllStringSubmatch(src, -1) {
+			if s.MsgIDs == nil {
+				s.MsgIDs = map[string]int{}
+			}
+			v, _ := strconv.Atoi(m[2])
+			s.MsgIDs[m[1]] = v
+		}
+		for _, m := range funcIDRe.FindAllStringSubmatch(src, -1) {
+			if s.FuncIDs == nil {
+				s.FuncIDs = map[string]int{}
+			}
+			v, _ := strconv.Atoi(m[2])
+			s.FuncIDs[m[1]] = v
+		}
+		p := &parser{toks: tokenize(src)}
+		if err := p.file(s, &refs, &refNS); err != nil {
+			return nil, err
+		}
+	}
+	// Qualify field types now that every definition is known.
+	for i, f := range refs {
+		f.Type = s.qualify(f.Type, refNS[i])
+	}
+	for _, u := range s.Unions {
+		ns := u.Name[:max(strings.LastIndex(u.Name, "."), 0)]
+		for i := range u.Members {
+			u.Members[i].Name = s.qualify(u.Members[i].Name, ns)
+		}
+	}
+	return s, nil
+}
+
+// qualify resolves a type reference the way flatc does: the current namespace
+// first, then its parents, then as written.
+func (s *Schema) qualify(typ, ns string) string {
+	inner, wrap := typ, "%s"
+	if strings.HasPrefix(typ, "[") {
+		inner = strings.TrimSuffix(strings.TrimPrefix(typ, "["), "]")
+		wrap = "[%s]"
+		if i := strings.Index(inner, ":"); i >= 0 {
+			wrap = "[%s" + inner[i:] + "]"
+			inner = inner[:i]
+		}
+	}
+	if a, ok := scalarAliases[inner]; ok {
+		inner = a
+	}
+	if !builtinTypes[inner] {
+		for n := ns; ; {
+			cand := inner
+			if n != "" {
+				cand = n + "." + inner
+			}
+			if s.defined(cand) {
+				inner = cand
+				break
+			}
+			if n == "" {
+				break
+			}
+			n = n[:max(strings.LastIndex(n, "."), 0)]
+		}
+	}
+	return fmt.Sprintf(wrap, inner)
+}
+
+func (s *Schema) defined(name string) bool {
+	return s.Tables[name] != nil || s.Enums[name] != nil || s.Unions[name] != nil
+}
+
+type token struct {
+	text string
+	line int
+	str  bool
+}
+
+func tokenize(src string) []token {
+	var toks []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			toks = append(toks, token{text: src[i+1 : min(j, len(src))], line: line, str: true})
+			i = j + 1
+		case strings.ContainsRune("{}()[]:;,=", rune(c)):
+			toks = append(toks, token{text: string(c), line: line})
+			i++
+		default:
+			j := i
+			for j < len(src) && !unicode.IsSpace(rune(src[j])) && !strings.ContainsRune("{}()[]:;,=\"", rune(src[j])) {
+				j++
+			}
+			if j == i {
+				j++
+			}
+			toks = append(toks, token{text: src[i:j], line: line})
+			i = j
+		}
+	}
+	return toks
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	ns   string
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos].text
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	line := 0
+	if p.pos < len(p.toks) {
+		line = p.toks[p.pos].line
+	} else if len(p.toks) > 0 {
+		line = p.toks[len(p.toks)-1].line
+	}
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(want string) error {
+	if got := p.next(); got != want {
+		p.pos--
+		return p.errorf("expected %q, got %q", want, got)
+	}
+	return nil
+}
+
+func (p *parser) qualified(name string) string {
+	if p.ns == "" {
+		return name
+	}
+	return p.ns + "." + name
+}
+
+func (p *parser) file(s *Schema, refs *[]*Field, refNS *[]string) error {
+	for p.pos < len(p.toks) {
+		switch kw := p.next(); kw {
+		case "namespace":
+			p.ns = p.next()
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+		case "include", "attribute", "root_type", "file_identifier", "file_extension":
+			p.next()
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+		case "table", "struct":
+			t := &Table{Name: p.qualified(p.next()), Struct: kw == "struct"}
+			p.attrs()
+			if err := p.fields(t); err != nil {
+				return err
+			}
+			for i := range t.Fields {
+				*refs = append(*refs, &t.Fields[i])
+				*refNS = append(*refNS, p.ns)
+			}
+			s.Tables[t.Name] = t
+			s.Order = append(s.Order, t.Name)
+		case "enum":
+			e := &Enum{Name: p.qualified(p.next())}
+			if err := p.expect(":"); err != nil {
+				return err
+			}
+			e.Underlying = p.next()
+			if a, ok := scalarAliases[e.Underlying]; ok {
+				e.Underlying = a
+			}
+			p.attrs()
+			vals, err := p.values(0)
+			if err != nil {
+				return err
+			}
+			e.Values = vals
+			s.Enums[e.Name] = e
+		case "union":
+			u := &Union{Name: p.qualified(p.next())}
+			p.attrs()
+			vals, err := p.values(1)
+			if err != nil {
+				return err
+			}
+			u.Members = vals
+			s.Unions[u.Name] = u
+		case "rpc_service":
+			p.next()
+			if err := p.skipBlock(); err != nil {
+				return err
+			}
+		case ";":
+		default:
+			p.pos--
+			return p.errorf("unexpected %q", kw)
+		}
+	}
+	return nil
+}
+
+// attrs consumes an optional "(...)" attribute list and returns it as
+// name -> value ("" for a bare attribute).
+func (p *parser) attrs() map[string]string {
+	out := map[string]string{}
+	if p.peek() != "(" {
+		return out
+	}
+	p.next()
+	for p.pos < len(p.toks) && p.peek() != ")" {
+		name := p.next()
+		if name == "," {
+			continue
+		}
+		val := ""
+		if p.peek() == ":" {
+			p.next()
+			val = p.next()
+		}
+		out[name] = val
+	}
+	p.next()
+	return out
+}
+
+func (p *parser) fields(t *Table) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for slot := 0; p.peek() != "}"; {
+		if p.pos >= len(p.toks) {
+			return p.errorf("unterminated %s", t.Name)
+		}
+		f := Field{Name: p.next()}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if p.peek() == "[" {
+			p.next()
+			f.Type = "[" + p.next()
+			if p.peek() == ":" {
+				p.next()
+				f.Type += ":" + p.next()
+			}
+			if err := p.expect("]"); err != nil {
+				return err
+			}
+			f.Type += "]"
+		} else {
+			f.Type = p.next()
+		}
+		if p.peek() == "=" {
+			p.next()
+			f.Default = p.next()
+		}
+		a := p.attrs()
+		if err := p.expect(";"); err != nil {
+			return err
+		}
+		_, f.Deprecated = a["deprecated"]
+		_, f.Required = a["required"]
+		f.Slot = slot
+		if id, ok := a["id"]; ok {
+			n, err := strconv.Atoi(id)
+			if err != nil {
+				return p.errorf("%s.%s: bad id %q", t.Name, f.Name, id)
+			}
+			f.Slot = n
+		}
+		slot++
+		t.Fields = append(t.Fields, f)
+	}
+	p.next()
+	return nil
+}
+
+// values parses an enum or union body; implicit values count up from first.
+func (p *parser) values(first int64) ([]Value, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var out []Value
+	next := first
+	for p.peek() != "}" {
+		if p.pos >= len(p.toks) {
+			return nil, p.errorf("unterminated enum or union")
+		}
+		name := p.next()
+		if name == "," {
+			continue
+		}
+		if p.peek() == ":" { // union alias: Alias: Type
+			p.next()
+			name = p.next()
+		}
+		if p.peek() == "=" {
+			p.next()
+			lit := p.next()
+			v, err := strconv.ParseInt(lit, 0, 64)
+			if err != nil {
+				return nil, p.errorf("bad value %q for %s", lit, name)
+			}
+			next = v
+		}
+		out = append(out, Value{Name: name, Value: next})
+		next++
+		p.attrs()
+	}
+	p.next()
+	return out, nil
+}
+
+func (p *parser) skipBlock() error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for depth := 1; depth > 0; {
+		if p.pos >= len(p.toks) {
+			return p.errorf("unterminated block")
+		}
+		switch p.next() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package compat
+
+import (
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/templates"
+)
+
+// TestParseShippedProtocol parses the protocol.fbs every project ships, which
+// exercises enums, unions, structs and cross-namespace references.
+func TestParseShippedProtocol(t *testing.T) {
+	src, err := templates.Get("protocol.fbs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Parse(string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := s.Enums["protocol.XlError"]; e == nil || e.Underlying != "short" || e.Values[0] != (Value{"Null", 2000}) {
+		t.Errorf("protocol.XlError = %+v", e)
+	}
+	u := s.Unions["protocol.ScalarValue"]
+	if u == nil || u.Members[0] != (Value{"protocol.Bool", 1}) {
+		t.Errorf("protocol.ScalarValue = %+v", u)
+	}
+	if r := s.Tables["protocol.Rect"]; r == nil || !r.Struct || len(r.Fields) != 4 {
+		t.Errorf("protocol.Rect = %+v", r)
+	}
+	if g := s.Tables["protocol.Grid"]; g == nil || g.Fields[2].Type != "[protocol.Scalar]" {
+		t.Errorf("protocol.Grid = %+v", g)
+	}
+	if s.MsgIDs != nil {
+		t.Errorf("protocol.fbs carries no msgid manifest, got %v", s.MsgIDs)
+	}
+}
+
+func TestParseSlotsAndManifest(t *testing.T) {
+	s, err := Parse(`
+include "protocol.fbs";
+// msgid MsgUserStart = 142
+/* a block
+   comment */
+namespace ipc;
+table BRequest { x:int32 (id: 1); y:string (id: 0); old:bool (deprecated); }
+table ARequest { v:double = 1.5; tags:[ubyte:4]; }
+enum Color : uint8 { Red = 2, Green, Blue = 7 }
+union Shape { Sq: ARequest, BRequest }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Functions(); len(got) != 2 || got[0] != "B" || got[1] != "A" {
+		t.Errorf("Functions() = %v, want declaration order [B A]", got)
+	}
+	b := s.Tables["ipc.BRequest"]
+	if b.Fields[0].Slot != 1 || b.Fields[0].Type != "int" || b.Fields[1].Slot != 0 || !b.Fields[2].Deprecated || b.Fields[2].Slot != 2 {
+		t.Errorf("ipc.BRequest = %+v", b.Fields)
+	}
+	if a := s.Tables["ipc.ARequest"]; a.Fields[0].Default != "1.5" || a.Fields[1].Type != "[ubyte:4]" {
+		t.Errorf("ipc.ARequest = %+v", a.Fields)
+	}
+	if e := s.Enums["ipc.Color"]; e.Underlying != "ubyte" || e.Values[1] != (Value{"Green", 3}) {
+		t.Errorf("ipc.Color = %+v", e)
+	}
+	if u := s.Unions["ipc.Shape"]; u.Members[0] != (Value{"ipc.ARequest", 1}) || u.Members[1] != (Value{"ipc.BRequest", 2}) {
+		t.Errorf("ipc.Shape = %+v", u)
+	}
+	if s.MsgIDs["MsgUserStart"] != 142 {
+		t.Errorf("MsgIDs = %v", s.MsgIDs)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	if _, err := Parse("table T { x int; }"); err == nil {
+		t.Error("a field without ':' must be rejected")
+	}
+}
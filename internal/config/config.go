@@ -10,6 +10,7 @@ import (
 	"unicode"
 
 	"github.com/google/uuid"
+	"github.com/xll-gen/xll-gen/pkg/retry"
 )
 
 // clsidPattern matches a registry-form GUID: braces around 8-4-4-4-12 hex
@@ -76,8 +77,32 @@ type RtdConfig struct {
 	// inherent to Excel's RTD and is not overridden, since the streaming wrapper
 	// must return live values verbatim.
 	LoadingPlaceholder string `yaml:"loading_placeholder"`
+	// Snapshot opts into persisting the last value Published per RTD key to
+	// <logging.dir>/<project>_rtd_snapshot.json. After a server restart a
+	// re-subscribed topic is sent its snapshot value straight away instead of
+	// sitting on the loading placeholder until the feed ticks again.
+	Snapshot bool `yaml:"snapshot"`
+	// SnapshotMarker is appended to a replayed snapshot value (which is shown
+	// as text) so a stale value is visibly flagged until the first live value
+	// arrives. Defaults to DefaultRtdSnapshotMarker when rtd.snapshot is on.
+	SnapshotMarker string `yaml:"snapshot_marker"`
+	// MemoizeDir is where functions declared memoize_store: "disk" keep their
+	// results across Excel sessions. The ${XLL_DIR}, ${BIN_DIR} and ${VAR}
+	// placeholders expand as in logging.dir; empty means
+	// <logging.dir>/<project>_memo.
+	MemoizeDir string `yaml:"memoize_dir"`
+	// MemoizeMaxBytes caps the disk store; least-recently-used results are
+	// evicted past it. Defaults to DefaultRtdMemoizeMaxBytes when any function
+	// uses the disk store.
+	MemoizeMaxBytes int64 `yaml:"memoize_max_bytes"`
 }
 
+// DefaultRtdSnapshotMarker is the rtd.snapshot_marker used when none is set.
+const DefaultRtdSnapshotMarker = " (snapshot)"
+
+// DefaultRtdMemoizeMaxBytes is the rtd.memoize_max_bytes used when none is set.
+const DefaultRtdMemoizeMaxBytes = 256 << 20
+
 // RtdPlaceholderKind classifies a resolved rtd-once loading placeholder.
 type RtdPlaceholderKind int
 
@@ -175,6 +200,13 @@ type ServerConfig struct {
 	// its sub-fields leaves the corresponding ChunkManager defaults in
 	// effect (see pkg/server/manager.go: Default* constants).
 	Chunk *ChunkConfig `yaml:"chunk"`
+	// RecordDir, when set, makes the server record every IPC request and
+	// response to <dir>/<project>_<time>_<pid>.xllrec for `xll-gen replay`
+	// (see pkg/record). Placeholders ${XLL_DIR}, ${BIN_DIR} and ${VAR} are
+	// expanded as for logging.dir. Empty (the default) records nothing unless
+	// XLLGEN_RECORD_DIR is set in the server's environment, which also wins
+	// over this field.
+	RecordDir string `yaml:"record_dir"`
 }
 
 // ChunkConfig is the YAML-facing knob for runtime chunked-message handling.
@@ -196,6 +228,13 @@ type ChunkConfig struct {
 	// MaxBufferBytes only caps ONE transfer). Zero means
 	// pkg/server.DefaultMaxConcurrentTransfers (1024).
 	MaxConcurrentTransfers int `yaml:"max_concurrent_transfers"`
+	// CompressThreshold, when positive, zstd-compresses every chunked
+	// guest->host transfer (server to XLL: async batches, rtd-once grids) whose
+	// payload is at least this many bytes (pkg/chunk.CompressedFlag) and builds
+	// the XLL with the matching decoder, whose 256 MiB cap then bounds the
+	// DECOMPRESSED size. The XLL never chunks its requests, so nothing is
+	// compressed host->guest. Zero (the default) disables compression.
+	CompressThreshold int64 `yaml:"compress_threshold"`
 }
 
 // LaunchConfig controls the automatic process launching behavior.
@@ -245,6 +284,17 @@ type GoConfig struct {
 	// (FlatBuffers code as "<module>/<package>/ipc"). Must be a valid Go
 	// identifier and not a reserved word (validated in Validate).
 	Package string `yaml:"package"`
+	// Fuzz, if true, also emits <package>/fuzz_test.go: a native Go fuzz test
+	// per sync/async function that mutates a well-formed request and checks
+	// the generated dispatch answers every variant with a well-formed reply.
+	// rtd and rtd-once functions take topic strings, not a request, and get
+	// none.
+	Fuzz bool `yaml:"fuzz"`
+	// Client, if true, also emits <package>/client.go: a typed Client that
+	// calls the sync and async functions through the generated dispatch in
+	// memory. It imports pkg/xllhost, so it is off by default to keep a
+	// server that does not use it from linking the host side.
+	Client bool `yaml:"client"`
 }
 
 // DefaultGoPackage is the generated Go package (and directory) name used when
@@ -266,6 +316,12 @@ func (c *Config) GoPackage() string {
 type Function struct {
 	// Name is the name of the function as it will appear in Excel.
 	Name string `yaml:"name"`
+	// ID pins the function's message ID to MsgUserStart + ID, so that
+	// reordering or deleting other functions never re-routes this one.
+	// Optional: a function without one keeps the ID recorded in xll.lock, or
+	// is given the next ID never used before (see LockFile). IDs must be
+	// unique and may not reuse one retired in xll.lock.
+	ID *int `yaml:"id"`
 	// Description is the help text for the function.
 	Description string `yaml:"description"`
 	// Args is the list of arguments for the function.
@@ -284,6 +340,9 @@ type Function struct {
 	Shortcut string `yaml:"shortcut"`
 	// HelpTopic is the help topic string.
 	HelpTopic string `yaml:"help_topic"`
+	// Example is a sample formula calling the function, e.g. "=Scale(A1, 2)",
+	// shown by `xll-gen docs`. Documentation only.
+	Example string `yaml:"example"`
 	// Timeout is the execution timeout for this specific function.
 	Timeout string `yaml:"timeout"`
 	// Caller indicates if the function requires information about the calling
@@ -319,6 +378,12 @@ type Function struct {
 	// call recomputes fresh. Mutually exclusive with Memoize (the TTL IS the
 	// intermediate option). Must parse to a positive duration.
 	MemoizeTTL string `yaml:"memoize_ttl"`
+	// MemoizeStore selects where a memoize / memoize_ttl result is kept:
+	// "memory" (the default, the XLL's RtdOnceRegistry, gone when Excel
+	// closes) or "disk", which additionally persists it under rtd.memoize_dir so
+	// a reopened workbook does not recompute. Disk results are salted with
+	// project.version: bump it to invalidate them.
+	MemoizeStore string `yaml:"memoize_store"`
 	// LoadingPlaceholder is valid ONLY with an RTD-backed mode (rtd, rtd-once).
 	// It overrides the project-wide rtd.loading_placeholder for this one
 	// function, controlling what the cell shows on its first paint before the
@@ -327,6 +392,27 @@ type Function struct {
 	LoadingPlaceholder string `yaml:"loading_placeholder"`
 	// Cache configures caching for this specific function.
 	Cache *FunctionCacheConfig `yaml:"cache"`
+	// Retry re-runs a failing handler before its error reaches the cell. Valid
+	// ONLY with mode:"async" or mode:"rtd-once", where the result is delivered
+	// after the call returns; see pkg/retry.
+	Retry *RetryConfig `yaml:"retry"`
+}
+
+// RetryConfig is a function's retry policy. Validation (and the defaults for
+// the omitted fields) is pkg/retry.ParsePolicy, the same call the generated
+// server makes at init.
+type RetryConfig struct {
+	// Attempts is the total number of calls, including the first (1..10).
+	Attempts int `yaml:"attempts"`
+	// Backoff is the wait before the first retry (Go duration, default 100ms);
+	// it doubles per retry.
+	Backoff string `yaml:"backoff"`
+	// MaxBackoff caps the doubled wait (Go duration, default 5s).
+	MaxBackoff string `yaml:"max_backoff"`
+	// RetryOn lists what is retried: "timeout", "transient", "any", or a Go
+	// error type name as printed by %T (e.g. "*net.OpError"). Defaults to
+	// [timeout, transient].
+	RetryOn []string `yaml:"retry_on"`
 }
 
 // FunctionCacheConfig configures caching for a specific function.
@@ -533,7 +619,7 @@ func IsRtdLike(mode string) bool {
 
 // AnyNonRtdLike reports whether the project declares at least one function that
 // is NOT rtd/rtd-once — i.e. at least one function that gets a generated
-// sync/async handler body in server.go AND a `case MsgUserStart+i` in the Go
+// sync/async handler body in server.go AND a `case MsgUserStart+ID` in the Go
 // dispatch.
 //
 // Same SSOT argument as IsRtdLike: two consumers ask this question about the
@@ -654,6 +740,9 @@ func Validate(config *Config) error {
 	if err := validateFunctionModes(config); err != nil {
 		return err
 	}
+	if err := validateFunctionIDs(config); err != nil {
+		return err
+	}
 	if err := validateServerTimeouts(config); err != nil {
 		return err
 	}
@@ -667,6 +756,9 @@ func Validate(config *Config) error {
 	if err != nil {
 		return err
 	}
+	if err := validateServiceMethods(config); err != nil {
+		return err
+	}
 	if err := validateRibbon(config, cmdNames); err != nil {
 		return err
 	}
@@ -928,6 +1020,20 @@ func validateFunctionModes(config *Config) error {
 				return fmt.Errorf("function '%s': memoize_ttl must be a positive duration, got %s", fn.Name, fn.MemoizeTTL)
 			}
 		}
+		// memoize_store only chooses WHERE a retained result lives, so it needs
+		// something to retain.
+		if fn.MemoizeStore != "" && !strings.EqualFold(fn.Mode, "rtd-once") {
+			return fmt.Errorf("function '%s': memoize_store is only valid with mode:\"rtd-once\"", fn.Name)
+		}
+		switch strings.ToLower(fn.MemoizeStore) {
+		case "", "memory":
+		case "disk":
+			if !fn.Memoize && fn.MemoizeTTL == "" {
+				return fmt.Errorf("function '%s': memoize_store: \"disk\" requires memoize: true or memoize_ttl (a plain once result is never retained)", fn.Name)
+			}
+		default:
+			return fmt.Errorf("function '%s': invalid memoize_store '%s' (allowed: memory, disk)", fn.Name, fn.MemoizeStore)
+		}
 		// loading_placeholder sets the RTD first-paint glyph, so it is meaningful
 		// only for the RTD-backed modes (rtd, rtd-once). The global
 		// rtd.loading_placeholder is a harmless no-op for projects with no
@@ -963,6 +1069,18 @@ func validateFunctionModes(config *Config) error {
 				return fmt.Errorf("function '%s': shortcut must be a single letter (Excel binds it as Ctrl+Shift+<letter>), got %q", fn.Name, fn.Shortcut)
 			}
 		}
+		// retry only makes sense where the result is delivered after the call
+		// returns: a sync call would retry inside Excel's calc thread, and a
+		// plain rtd handler owns its topic for its whole life.
+		if fn.Retry != nil {
+			async := strings.EqualFold(fn.Mode, "async") || (fn.Mode == "" && fn.Async)
+			if !async && !strings.EqualFold(fn.Mode, "rtd-once") {
+				return fmt.Errorf("function '%s': retry is only valid with mode:\"async\" or mode:\"rtd-once\" (a sync retry would stall Excel's calc thread)", fn.Name)
+			}
+			if _, err := retry.ParsePolicy(fn.Retry.Attempts, fn.Retry.Backoff, fn.Retry.MaxBackoff, fn.Retry.RetryOn); err != nil {
+				return fmt.Errorf("function '%s': retry: %w", fn.Name, err)
+			}
+		}
 		if fn.Timeout != "" {
 			// The RTD modes have no per-call timeout: the wrapper routes through
 			// xlfRtd and the handler runs off the calc thread on a topic connect,
@@ -998,7 +1116,8 @@ func validateServerTimeouts(config *Config) error {
 	return nil
 }
 
-// validateRtd checks rtd.prog_id presence and rtd.throttle_interval bounds.
+// validateRtd checks rtd.prog_id presence, rtd.throttle_interval bounds and
+// the rtd.snapshot options.
 func validateRtd(config *Config) error {
 	if config.Rtd.Enabled && config.Rtd.ProgID == "" {
 		return fmt.Errorf("rtd.prog_id is required when rtd.enabled is true")
@@ -1030,9 +1149,44 @@ func validateRtd(config *Config) error {
 			return fmt.Errorf("rtd.throttle_interval must be between 0 and %dms, got %s", math.MaxInt32, config.Rtd.ThrottleInterval)
 		}
 	}
+	if config.Rtd.Snapshot && !config.Rtd.Enabled {
+		return fmt.Errorf("rtd.snapshot requires rtd.enabled: true")
+	}
+	if config.Rtd.SnapshotMarker != "" {
+		if !config.Rtd.Snapshot {
+			return fmt.Errorf("rtd.snapshot_marker requires rtd.snapshot: true")
+		}
+		// Emitted into a generated Go string literal via %q, so any text is
+		// safe there; a control character would just garble the cell.
+		if strings.ContainsFunc(config.Rtd.SnapshotMarker, unicode.IsControl) {
+			return fmt.Errorf("rtd.snapshot_marker must not contain control characters")
+		}
+	}
+	if config.Rtd.MemoizeDir != "" || config.Rtd.MemoizeMaxBytes != 0 {
+		if !config.Rtd.Enabled {
+			return fmt.Errorf("rtd.memoize_dir / rtd.memoize_max_bytes require rtd.enabled: true")
+		}
+		if strings.ContainsFunc(config.Rtd.MemoizeDir, unicode.IsControl) {
+			return fmt.Errorf("rtd.memoize_dir must not contain control characters")
+		}
+		if config.Rtd.MemoizeMaxBytes < 0 {
+			return fmt.Errorf("rtd.memoize_max_bytes must not be negative, got %d", config.Rtd.MemoizeMaxBytes)
+		}
+	}
 	return nil
 }
 
+// AnyDiskMemoize reports whether any function keeps its results in the
+// rtd-once disk store (memoize_store: "disk").
+func AnyDiskMemoize(fns []Function) bool {
+	for _, fn := range fns {
+		if strings.EqualFold(fn.MemoizeStore, "disk") {
+			return true
+		}
+	}
+	return false
+}
+
 // validateServerChunk checks the server.chunk tuning block.
 func validateServerChunk(config *Config) error {
 	if c := config.Server.Chunk; c != nil {
@@ -1052,6 +1206,9 @@ func validateServerChunk(config *Config) error {
 		if c.MaxConcurrentTransfers < 0 {
 			return fmt.Errorf("server.chunk.max_concurrent_transfers must be non-negative, got %d", c.MaxConcurrentTransfers)
 		}
+		if c.CompressThreshold < 0 {
+			return fmt.Errorf("server.chunk.compress_threshold must be non-negative, got %d", c.CompressThreshold)
+		}
 	}
 	return nil
 }
@@ -1105,6 +1262,92 @@ func validateCommands(config *Config) (map[string]bool, error) {
 	return cmdNames, nil
 }
 
+// fakeServiceMembers are the methods and fields the generated FakeXllService
+// declares next to the XllService methods. An XllService method with one of
+// these names would be declared twice on the fake.
+var fakeServiceMembers = map[string]bool{
+	"Calls": true, "CallsTo": true, "Reset": true, "record": true, "mu": true, "calls": true,
+}
+
+// validateServiceMethods checks the XllService method set the generated
+// interface.go declares: function methods (Name, or Name_RTD for rtd mode),
+// event and command handlers, and the built-in lifecycle hooks. Each method
+// also becomes a <Method>Func field on FakeXllService, so a method may not be
+// named after another method plus "Func" (a function X next to XFunc), after a
+// fake member, or twice.
+func validateServiceMethods(config *Config) error {
+	methods := make(map[string]string)
+	var order []string
+	add := func(name, what string) error {
+		if name == "" {
+			return nil
+		}
+		if fakeServiceMembers[name] {
+			return fmt.Errorf("%s: Go method name '%s' is reserved by the generated FakeXllService", what, name)
+		}
+		if prev, ok := methods[name]; ok {
+			return fmt.Errorf("%s: Go method name '%s' is already used by %s", what, name, prev)
+		}
+		methods[name] = what
+		order = append(order, name)
+		return nil
+	}
+	for _, fn := range config.Functions {
+		name := fn.Name
+		if strings.EqualFold(fn.Mode, "rtd") {
+			name += "_RTD"
+		}
+		if err := add(name, fmt.Sprintf("function '%s'", fn.Name)); err != nil {
+			return err
+		}
+	}
+	hasEvent := make(map[string]bool)
+	for _, evt := range config.Events {
+		hasEvent[evt.Type] = true
+		handler := evt.Handler
+		if handler == "" {
+			handler = "On" + evt.Type
+		}
+		if err := add(handler, fmt.Sprintf("event '%s' handler", evt.Type)); err != nil {
+			return err
+		}
+	}
+	for _, cmd := range config.Commands {
+		handler := cmd.Handler
+		if handler == "" {
+			handler = cmd.Name
+		}
+		if err := add(handler, fmt.Sprintf("command '%s' handler", cmd.Name)); err != nil {
+			return err
+		}
+	}
+	// The lifecycle hooks the interface declares even when xll.yaml does not.
+	hooks := []string{}
+	for _, t := range []string{"CalculationEnded", "CalculationCanceled"} {
+		if !hasEvent[t] {
+			hooks = append(hooks, "On"+t)
+		}
+	}
+	if config.Rtd.Enabled {
+		hooks = append(hooks, "OnRtdConnect", "OnRtdDisconnect")
+	}
+	for _, h := range hooks {
+		if err := add(h, "built-in hook "+h); err != nil {
+			return err
+		}
+	}
+	for _, name := range order {
+		base, ok := strings.CutSuffix(name, "Func")
+		if !ok {
+			continue
+		}
+		if prev, ok := methods[base]; ok {
+			return fmt.Errorf("%s: Go method name '%s' clashes with the %sFunc field FakeXllService declares for %s", methods[name], name, base, prev)
+		}
+	}
+	return nil
+}
+
 // validateRibbon checks ribbon mode (structured vs raw-XML), that buttons
 // reference known commands, and image/size validity.
 func validateRibbon(config *Config, cmdNames map[string]bool) error {
@@ -1237,6 +1480,7 @@ func ApplyDefaults(config *Config) {
 		// Validate() accepts mode case-insensitively; consumers (templates,
 		// Async sync below) compare exact lowercase, so normalize here.
 		fn.Mode = strings.ToLower(fn.Mode)
+		fn.MemoizeStore = strings.ToLower(fn.MemoizeStore)
 		if fn.Mode == "" {
 			if fn.Async {
 				fn.Mode = "async"
@@ -1252,6 +1496,7 @@ func ApplyDefaults(config *Config) {
 			}
 		}
 	}
+	assignFunctionIDs(config.Functions)
 
 	if config.Build.TempDir == "" {
 		config.Build.TempDir = "${TEMP}"
@@ -1283,6 +1528,12 @@ func ApplyDefaults(config *Config) {
 			u := uuid.NewSHA1(uuid.NameSpaceDNS, []byte(config.Rtd.ProgID))
 			config.Rtd.Clsid = "{" + u.String() + "}"
 		}
+		if config.Rtd.Snapshot && config.Rtd.SnapshotMarker == "" {
+			config.Rtd.SnapshotMarker = DefaultRtdSnapshotMarker
+		}
+		if AnyDiskMemoize(config.Functions) && config.Rtd.MemoizeMaxBytes == 0 {
+			config.Rtd.MemoizeMaxBytes = DefaultRtdMemoizeMaxBytes
+		}
 	}
 
 	for i := range config.Commands {
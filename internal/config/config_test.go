@@ -919,6 +919,135 @@ func TestValidate_RtdThrottleInterval(t *testing.T) {
 	}
 }
 
+// TestValidate_RtdSnapshot pins rtd.snapshot / rtd.snapshot_marker: both need
+// their parent switch, and ApplyDefaults fills in the default marker.
+func TestValidate_RtdSnapshot(t *testing.T) {
+	mk := func(enabled, snapshot bool, marker string) *Config {
+		cfg := &Config{Project: ProjectConfig{Name: "TestProject"}}
+		cfg.Rtd = RtdConfig{Enabled: enabled, ProgID: "P.Rtd", Snapshot: snapshot, SnapshotMarker: marker}
+		return cfg
+	}
+
+	if err := Validate(mk(true, true, " [stale]")); err != nil {
+		t.Errorf("valid snapshot config rejected: %v", err)
+	}
+	if err := Validate(mk(false, true, "")); err == nil || !strings.Contains(err.Error(), "requires rtd.enabled") {
+		t.Errorf("snapshot without rtd.enabled must be rejected, got %v", err)
+	}
+	if err := Validate(mk(true, false, "*")); err == nil || !strings.Contains(err.Error(), "requires rtd.snapshot") {
+		t.Errorf("marker without rtd.snapshot must be rejected, got %v", err)
+	}
+	if err := Validate(mk(true, true, "a\nb")); err == nil {
+		t.Error("marker with a control character must be rejected")
+	}
+
+	cfg := mk(true, true, "")
+	ApplyDefaults(cfg)
+	if cfg.Rtd.SnapshotMarker != DefaultRtdSnapshotMarker {
+		t.Errorf("default marker = %q, want %q", cfg.Rtd.SnapshotMarker, DefaultRtdSnapshotMarker)
+	}
+	off := mk(true, false, "")
+	ApplyDefaults(off)
+	if off.Rtd.SnapshotMarker != "" {
+		t.Errorf("marker must stay empty with the snapshot off, got %q", off.Rtd.SnapshotMarker)
+	}
+}
+
+// TestValidate_Retry pins the per-function retry: policy: allowed only where
+// the result is delivered after the call returns (async, rtd-once), and
+// checked with the same retry.ParsePolicy the generated server runs at init.
+func TestValidate_Retry(t *testing.T) {
+	mk := func(mode string, async bool, r *RetryConfig) *Config {
+		return &Config{
+			Project:   ProjectConfig{Name: "TestProject"},
+			Rtd:       RtdConfig{Enabled: true, ProgID: "P.Rtd"},
+			Functions: []Function{{Name: "Fetch", Mode: mode, Async: async, Return: "float", Retry: r}},
+		}
+	}
+	ok := &RetryConfig{Attempts: 3, Backoff: "200ms", MaxBackoff: "2s", RetryOn: []string{"timeout", "*net.OpError"}}
+
+	for _, c := range []struct {
+		mode  string
+		async bool
+	}{{"async", false}, {"rtd-once", false}, {"", true}} {
+		if err := Validate(mk(c.mode, c.async, ok)); err != nil {
+			t.Errorf("retry with mode %q (async=%v) rejected: %v", c.mode, c.async, err)
+		}
+	}
+	for _, mode := range []string{"sync", "rtd", ""} {
+		if err := Validate(mk(mode, false, ok)); err == nil || !strings.Contains(err.Error(), "retry is only valid") {
+			t.Errorf("retry with mode %q must be rejected, got %v", mode, err)
+		}
+	}
+	for _, bad := range []*RetryConfig{
+		{Attempts: 0},
+		{Attempts: 2, Backoff: "soon"},
+		{Attempts: 2, Backoff: "2s", MaxBackoff: "1s"},
+		{Attempts: 2, RetryOn: []string{"sometimes"}},
+	} {
+		if err := Validate(mk("async", false, bad)); err == nil || !strings.Contains(err.Error(), "retry:") {
+			t.Errorf("invalid retry %+v must be rejected, got %v", bad, err)
+		}
+	}
+}
+
+// TestValidate_MemoizeStore pins memoize_store and the rtd.memoize_* knobs:
+// "disk" needs a retained result, and ApplyDefaults sizes the store.
+func TestValidate_MemoizeStore(t *testing.T) {
+	mk := func(fn Function) *Config {
+		fn.Name, fn.Return = "Calib", "float"
+		return &Config{
+			Project:   ProjectConfig{Name: "TestProject", Version: "1.0.0"},
+			Rtd:       RtdConfig{Enabled: true, ProgID: "P.Rtd"},
+			Functions: []Function{fn},
+		}
+	}
+
+	for _, fn := range []Function{
+		{Mode: "rtd-once", Memoize: true, MemoizeStore: "disk"},
+		{Mode: "rtd-once", MemoizeTTL: "1h", MemoizeStore: "Disk"},
+		{Mode: "rtd-once", MemoizeStore: "memory"},
+	} {
+		if err := Validate(mk(fn)); err != nil {
+			t.Errorf("%+v rejected: %v", fn, err)
+		}
+	}
+	for _, c := range []struct {
+		fn   Function
+		want string
+	}{
+		{Function{Mode: "rtd-once", MemoizeStore: "disk"}, "requires memoize"},
+		{Function{Mode: "rtd-once", Memoize: true, MemoizeStore: "redis"}, "invalid memoize_store"},
+		{Function{Mode: "async", MemoizeStore: "memory"}, "only valid with mode"},
+	} {
+		if err := Validate(mk(c.fn)); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%+v: want error containing %q, got %v", c.fn, c.want, err)
+		}
+	}
+
+	neg := mk(Function{Mode: "rtd-once", Memoize: true, MemoizeStore: "disk"})
+	neg.Rtd.MemoizeMaxBytes = -1
+	if err := Validate(neg); err == nil {
+		t.Error("negative rtd.memoize_max_bytes must be rejected")
+	}
+	off := mk(Function{Mode: "rtd-once"})
+	off.Rtd.Enabled = false
+	off.Functions = nil
+	off.Rtd.MemoizeDir = "memo"
+	if err := Validate(off); err == nil || !strings.Contains(err.Error(), "require rtd.enabled") {
+		t.Errorf("memoize_dir without rtd.enabled must be rejected, got %v", err)
+	}
+
+	cfg := mk(Function{Mode: "rtd-once", Memoize: true, MemoizeStore: "DISK"})
+	ApplyDefaults(cfg)
+	if cfg.Functions[0].MemoizeStore != "disk" {
+		t.Errorf("memoize_store not normalized: %q", cfg.Functions[0].MemoizeStore)
+	}
+	if cfg.Rtd.MemoizeMaxBytes != DefaultRtdMemoizeMaxBytes {
+		t.Errorf("memoize_max_bytes default = %d, want %d", cfg.Rtd.MemoizeMaxBytes, DefaultRtdMemoizeMaxBytes)
+	}
+}
+
 // TestValidate_RtdOnce pins the mode:"rtd-once" rules:
 //   - accepted with scalar/any return + scalar OR composite args (rtd.enabled required)
 //   - composite args accepted (content-hash payload path)
@@ -1369,3 +1498,49 @@ func TestValidate_Identifiers(t *testing.T) {
 		t.Errorf("event handler with a leading digit must be rejected")
 	}
 }
+
+// TestValidate_ServiceMethodNames: every XllService method is also a
+// <Method>Func field on the generated FakeXllService, next to its Calls,
+// CallsTo and Reset methods, so names that would collide there are rejected.
+func TestValidate_ServiceMethodNames(t *testing.T) {
+	cfg := func(fns []Function, events []Event, cmds []Command) *Config {
+		return &Config{
+			Project:   ProjectConfig{Name: "TestProject"},
+			Functions: fns,
+			Events:    events,
+			Commands:  cmds,
+		}
+	}
+	fn := func(name string) Function { return Function{Name: name, Return: "int"} }
+
+	for _, tc := range []struct {
+		name string
+		cfg  *Config
+		want string
+	}{
+		{"function Reset", cfg([]Function{fn("Reset")}, nil, nil), "reserved by the generated FakeXllService"},
+		{"function Calls", cfg([]Function{fn("Calls")}, nil, nil), "reserved by the generated FakeXllService"},
+		{"command handler CallsTo", cfg(nil, nil, []Command{{Name: "Sync", Handler: "CallsTo"}}), "reserved by the generated FakeXllService"},
+		{"X next to XFunc", cfg([]Function{fn("Spot"), fn("SpotFunc")}, nil, nil), "clashes with the SpotFunc field"},
+		{"XFunc before X", cfg([]Function{fn("SpotFunc"), fn("Spot")}, nil, nil), "clashes with the SpotFunc field"},
+		{"command next to its function's Func", cfg([]Function{fn("Load")}, nil, []Command{{Name: "LoadFunc"}}), "clashes with the LoadFunc field"},
+		{"function named after a hook", cfg([]Function{fn("OnCalculationEnded")}, nil, nil), "already used by function 'OnCalculationEnded'"},
+		{"event handler reused by a command", cfg(nil, []Event{{Type: "CalculationEnded", Handler: "Refresh"}}, []Command{{Name: "Refresh"}}), "already used by event 'CalculationEnded' handler"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := Validate(tc.cfg); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Validate = %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+
+	// An rtd function's method is Name_RTD, so its Func field cannot clash
+	// with a plain function called Name; and a name merely ending in Func is
+	// fine on its own.
+	ok := cfg([]Function{fn("Quote"), fn("MyFunc")}, nil, nil)
+	ok.Functions = append(ok.Functions, Function{Name: "QuoteFunc", Return: "float", Mode: "rtd"})
+	ok.Rtd = RtdConfig{Enabled: true, ProgID: "P.Rtd"}
+	if err := Validate(ok); err != nil {
+		t.Errorf("Validate = %v, want no error", err)
+	}
+}
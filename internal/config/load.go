@@ -9,7 +9,9 @@ import (
 )
 
 // Load reads and parses an xll.yaml file at path. It is the single strict
-// parse path shared by `xll-gen generate` and `xll-gen init`.
+// parse path shared by `xll-gen generate` and `xll-gen init`. When an xll.lock
+// sits next to it, the function IDs it pins are applied, so every command
+// routes a function to the message ID generate gave it.
 //
 // The returned Config is NOT defaulted or validated — callers run
 // ApplyDefaults + Validate as before.
@@ -18,13 +20,36 @@ func Load(path string) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read xll.yaml: %w", err)
 	}
-	return Parse(data)
+	return ParseWithLock(data, LockPath(path))
+}
+
+// ParseWithLock is Load for xll.yaml content already in memory, such as an
+// edit not yet written back: it parses data and applies the xll.lock at
+// lockPath, if there is one. An empty lockPath applies no lock, as Parse.
+func ParseWithLock(data []byte, lockPath string) (*Config, error) {
+	cfg, err := Parse(data)
+	if err != nil || lockPath == "" {
+		return cfg, err
+	}
+	lock, err := ReadLock(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	if lock != nil {
+		if err := applyLock(cfg, lock); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
 }
 
 // Parse decodes xll.yaml bytes into a Config with strict unknown-key detection
 // (yaml.Decoder.KnownFields). A misspelled or unsupported key (e.g. `retrun:`)
 // fails here with the yaml.v3 error — which includes line information — instead
 // of being silently ignored, so configuration typos surface immediately.
+//
+// Parse does not read xll.lock, so a function without an explicit id gets
+// its position as its ID. Use ParseWithLock for a project's own xll.yaml.
 func Parse(data []byte) (*Config, error) {
 	var cfg Config
 	dec := yaml.NewDecoder(bytes.NewReader(data))
@@ -118,6 +118,7 @@ server:
     cleanup_interval: "15s"
     buffer_ttl: "45s"
     max_concurrent_transfers: 512
+    compress_threshold: 65536
 functions:
   - name: "Add"
     args:
@@ -133,7 +134,7 @@ functions:
 		if c == nil {
 			t.Fatal("Server.Chunk not decoded")
 		}
-		if c.MaxBufferBytes != 134217728 || c.CleanupInterval != "15s" || c.BufferTTL != "45s" || c.MaxConcurrentTransfers != 512 {
+		if c.MaxBufferBytes != 134217728 || c.CleanupInterval != "15s" || c.BufferTTL != "45s" || c.MaxConcurrentTransfers != 512 || c.CompressThreshold != 65536 {
 			t.Fatalf("Server.Chunk decoded wrong: %+v", c)
 		}
 		ApplyDefaults(cfg)
@@ -170,6 +171,23 @@ functions:
 		}
 	})
 
+	t.Run("NegativeCompressThresholdRejected", func(t *testing.T) {
+		cfg, err := Parse([]byte(`
+project:
+  name: "demo"
+server:
+  chunk:
+    compress_threshold: -1
+`))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		ApplyDefaults(cfg)
+		if err := Validate(cfg); err == nil || !strings.Contains(err.Error(), "compress_threshold") {
+			t.Fatalf("want a compress_threshold error, got %v", err)
+		}
+	})
+
 	t.Run("MisspelledChunkKeyRejected", func(t *testing.T) {
 		const yaml = `
 project:
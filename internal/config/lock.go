@@ -0,0 +1,227 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LockFile is the file, next to xll.yaml, that pins each function's message
+// ID across regenerations. `xll-gen generate` writes it; commit it.
+const LockFile = "xll.lock"
+
+// MaxFunctionID bounds Function.ID, keeping MsgUserStart + ID far from the
+// top of the uint32 message-ID space.
+const MaxFunctionID = 65535
+
+// lockHeader opens every xll.lock written by WriteLock.
+const lockHeader = `# Code generated by xll-gen generate. Commit this file.
+#
+# Pins each function's message ID (MsgUserStart + id) so that reordering or
+# deleting functions in xll.yaml does not re-route the others. Retired IDs
+# belonged to deleted or re-numbered functions and are never assigned again.
+`
+
+// Lock is the content of xll.lock.
+type Lock struct {
+	// Functions maps a function name to its ID.
+	Functions map[string]int `yaml:"functions"`
+	// Retired lists IDs no function may take again, with the function that
+	// last held each.
+	Retired []RetiredID `yaml:"retired,omitempty"`
+}
+
+// RetiredID is an ID whose function was deleted or given another ID.
+type RetiredID struct {
+	ID   int    `yaml:"id"`
+	Name string `yaml:"name"`
+}
+
+// LockPath returns the xll.lock that belongs to the xll.yaml at configPath.
+func LockPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), LockFile)
+}
+
+// MsgOffset returns the function's message ID relative to MsgUserStart: its
+// ID once assigned (ApplyDefaults assigns one to every function), otherwise
+// index, its position in functions:, which is what a Config that has not been
+// defaulted would be given.
+func (f Function) MsgOffset(index int) int {
+	if f.ID != nil {
+		return *f.ID
+	}
+	return index
+}
+
+// FunctionIDEnd returns one past the highest function ID, so user-function
+// message IDs lie in [MsgUserStart, MsgUserStart + FunctionIDEnd(fns)).
+func FunctionIDEnd(fns []Function) int {
+	end := 0
+	for i, fn := range fns {
+		end = max(end, fn.MsgOffset(i)+1)
+	}
+	return end
+}
+
+// ReadLock reads an xll.lock. A missing file is not an error: it returns nil,
+// and every function without an explicit id keeps its position as its ID.
+func ReadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l Lock
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&l); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &l, nil
+}
+
+// applyLock assigns the IDs pinned in l to the functions without an explicit
+// id, and gives each function new to the lock an ID above every ID the lock
+// has ever handed out. Functions with an explicit id are checked against the
+// lock: taking a retired ID, or the locked ID of another function that is
+// still declared, is an error. Taking the ID of a function that is no longer
+// declared is how a rename keeps its ID.
+func applyLock(cfg *Config, l *Lock) error {
+	retired := map[int]string{}
+	next := 0
+	for _, r := range l.Retired {
+		retired[r.ID] = r.Name
+		next = max(next, r.ID+1)
+	}
+	owner := map[int]string{}
+	for name, id := range l.Functions {
+		owner[id] = name
+		next = max(next, id+1)
+	}
+	declared := map[string]bool{}
+	for _, fn := range cfg.Functions {
+		declared[fn.Name] = true
+	}
+
+	taken := map[int]bool{}
+	for _, fn := range cfg.Functions {
+		if fn.ID == nil {
+			continue
+		}
+		id := *fn.ID
+		if name, ok := retired[id]; ok {
+			return fmt.Errorf("function '%s': id %d is retired in %s (it was %s's); IDs are never reused, so a server or XLL built before would route it to the wrong function", fn.Name, id, LockFile, name)
+		}
+		if name, ok := owner[id]; ok && name != fn.Name && declared[name] {
+			return fmt.Errorf("function '%s': id %d is locked to function '%s' in %s", fn.Name, id, name, LockFile)
+		}
+		taken[id] = true
+		next = max(next, id+1)
+	}
+	for i := range cfg.Functions {
+		fn := &cfg.Functions[i]
+		if fn.ID != nil {
+			continue
+		}
+		if id, ok := l.Functions[fn.Name]; ok && !taken[id] {
+			fn.ID = &id
+			taken[id] = true
+		}
+	}
+	for i := range cfg.Functions {
+		fn := &cfg.Functions[i]
+		if fn.ID != nil {
+			continue
+		}
+		id := next
+		next++
+		fn.ID = &id
+	}
+	return nil
+}
+
+// assignFunctionIDs gives every function without an ID the lowest unused one.
+// With no explicit ids and no xll.lock that is its position, the numbering
+// projects had before IDs could be pinned.
+func assignFunctionIDs(fns []Function) {
+	taken := map[int]bool{}
+	for _, fn := range fns {
+		if fn.ID != nil {
+			taken[*fn.ID] = true
+		}
+	}
+	next := 0
+	for i := range fns {
+		if fns[i].ID != nil {
+			continue
+		}
+		for taken[next] {
+			next++
+		}
+		id := next
+		fns[i].ID = &id
+		taken[id] = true
+	}
+}
+
+// NewLock returns the lock for cfg's assigned IDs. Every ID in prev that no
+// function holds any more is retired: appended, in ID order, after prev's
+// Retired.
+func NewLock(cfg *Config, prev *Lock) *Lock {
+	l := &Lock{Functions: make(map[string]int, len(cfg.Functions))}
+	held := map[int]bool{}
+	for i, fn := range cfg.Functions {
+		id := fn.MsgOffset(i)
+		l.Functions[fn.Name] = id
+		held[id] = true
+	}
+	if prev == nil {
+		return l
+	}
+	var gone []RetiredID
+	for name, id := range prev.Functions {
+		if !held[id] {
+			gone = append(gone, RetiredID{ID: id, Name: name})
+		}
+	}
+	sort.Slice(gone, func(i, j int) bool { return gone[i].ID < gone[j].ID })
+	l.Retired = append(append(l.Retired, prev.Retired...), gone...)
+	return l
+}
+
+// WriteLock writes l to path.
+func WriteLock(path string, l *Lock) error {
+	var buf bytes.Buffer
+	buf.WriteString(lockHeader)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(l); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// validateFunctionIDs rejects IDs out of range and two functions sharing one.
+func validateFunctionIDs(config *Config) error {
+	seen := map[int]string{}
+	for i, fn := range config.Functions {
+		id := fn.MsgOffset(i)
+		if id < 0 || id > MaxFunctionID {
+			return fmt.Errorf("function '%s': id %d must be between 0 and %d", fn.Name, id, MaxFunctionID)
+		}
+		if other, ok := seen[id]; ok {
+			return fmt.Errorf("functions '%s' and '%s' both have id %d; each function needs its own message ID", other, fn.Name, id)
+		}
+		seen[id] = fn.Name
+	}
+	return nil
+}
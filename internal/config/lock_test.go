@@ -0,0 +1,192 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lockProject writes xll.yaml declaring fns (each "Name" or "Name:id") into
+// dir and returns its path.
+func lockProject(t *testing.T, dir string, fns ...string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("project:\n  name: \"demo\"\n  version: \"0.1.0\"\nfunctions:\n")
+	for _, fn := range fns {
+		name, id, pinned := strings.Cut(fn, ":")
+		b.WriteString("  - name: \"" + name + "\"\n    return: \"int\"\n")
+		if pinned {
+			b.WriteString("    id: " + id + "\n")
+		}
+	}
+	path := filepath.Join(dir, "xll.yaml")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// generateIDs is what `xll-gen generate` does with IDs: load (applying
+// xll.lock), default, validate, then rewrite xll.lock.
+func generateIDs(t *testing.T, path string) (map[string]int, error) {
+	t.Helper()
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	ApplyDefaults(cfg)
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	prev, err := ReadLock(LockPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteLock(LockPath(path), NewLock(cfg, prev)); err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]int{}
+	for i, fn := range cfg.Functions {
+		ids[fn.Name] = fn.MsgOffset(i)
+	}
+	return ids, nil
+}
+
+func wantIDs(t *testing.T, got map[string]int, want map[string]int) {
+	t.Helper()
+	for name, id := range want {
+		if got[name] != id {
+			t.Errorf("%s: id %d, want %d (all: %v)", name, got[name], id, got)
+		}
+	}
+}
+
+// TestLockPinsIDs walks a project through reorder, delete, add and rename.
+func TestLockPinsIDs(t *testing.T) {
+	dir := t.TempDir()
+
+	// No lock yet: IDs are positions, as before IDs could be pinned.
+	ids, err := generateIDs(t, lockProject(t, dir, "Add", "Greet", "Scale"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIDs(t, ids, map[string]int{"Add": 0, "Greet": 1, "Scale": 2})
+
+	// Reordered: every function keeps its ID.
+	ids, err = generateIDs(t, lockProject(t, dir, "Scale", "Add", "Greet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIDs(t, ids, map[string]int{"Add": 0, "Greet": 1, "Scale": 2})
+
+	// Greet deleted: its ID is retired, and the next function skips it.
+	ids, err = generateIDs(t, lockProject(t, dir, "Scale", "Add"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIDs(t, ids, map[string]int{"Add": 0, "Scale": 2})
+	ids, err = generateIDs(t, lockProject(t, dir, "Scale", "Add", "Mul"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIDs(t, ids, map[string]int{"Add": 0, "Scale": 2, "Mul": 3})
+
+	lock, err := ReadLock(filepath.Join(dir, LockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Retired) != 1 || lock.Retired[0] != (RetiredID{ID: 1, Name: "Greet"}) {
+		t.Errorf("Retired = %+v, want Greet's 1", lock.Retired)
+	}
+
+	// Rename keeping the ID: take the old name's ID in the same generate.
+	ids, err = generateIDs(t, lockProject(t, dir, "Scale", "Plus:0", "Mul"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIDs(t, ids, map[string]int{"Plus": 0, "Scale": 2, "Mul": 3})
+}
+
+// TestParseWithLock: in-memory content gets the IDs the lock pins, as Load
+// gives the same content on disk; Parse alone keeps positions.
+func TestParseWithLock(t *testing.T) {
+	dir := t.TempDir()
+	path := lockProject(t, dir, "Add", "Greet", "Scale")
+	if _, err := generateIDs(t, path); err != nil {
+		t.Fatal(err)
+	}
+	lockProject(t, dir, "Scale", "Add", "Greet")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := func(cfg *Config) map[string]int {
+		out := map[string]int{}
+		for i, fn := range cfg.Functions {
+			out[fn.Name] = fn.MsgOffset(i)
+		}
+		return out
+	}
+
+	cfg, err := ParseWithLock(data, LockPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIDs(t, ids(cfg), map[string]int{"Add": 0, "Greet": 1, "Scale": 2})
+	if cfg, err = Parse(data); err != nil {
+		t.Fatal(err)
+	}
+	wantIDs(t, ids(cfg), map[string]int{"Scale": 0, "Add": 1, "Greet": 2})
+
+	// The lock still rejects what Load rejects.
+	lockProject(t, dir, "Add", "Greet", "Scale", "Mul:1")
+	if data, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseWithLock(data, LockPath(path)); err == nil || !strings.Contains(err.Error(), "locked to function 'Greet'") {
+		t.Errorf("err = %v, want Greet's ID refused", err)
+	}
+}
+
+func TestLockRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fns  []string
+		want string
+	}{
+		{"duplicate explicit", []string{"Add:4", "Greet:4", "Scale"}, "both have id 4"},
+		{"retired", []string{"Add", "Scale", "Mul:1"}, "retired"},
+		{"held by another", []string{"Add", "Scale", "Mul:2"}, "locked to function 'Scale'"},
+		{"negative", []string{"Add", "Scale", "Mul:-1"}, "between 0 and"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := generateIDs(t, lockProject(t, dir, "Add", "Greet", "Scale")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := generateIDs(t, lockProject(t, dir, "Add", "Scale")); err != nil {
+				t.Fatal(err)
+			}
+			_, err := generateIDs(t, lockProject(t, dir, tc.fns...))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// TestExplicitIDsWithoutLock: with no xll.lock, unpinned functions fill the
+// lowest free IDs around the pinned ones.
+func TestExplicitIDsWithoutLock(t *testing.T) {
+	id := 0
+	cfg := &Config{Functions: []Function{{Name: "A"}, {Name: "B", ID: &id}, {Name: "C"}}}
+	ApplyDefaults(cfg)
+	got := []int{*cfg.Functions[0].ID, *cfg.Functions[1].ID, *cfg.Functions[2].ID}
+	if got[0] != 1 || got[1] != 0 || got[2] != 2 {
+		t.Errorf("IDs = %v, want [1 0 2]", got)
+	}
+	if end := FunctionIDEnd(cfg.Functions); end != 3 {
+		t.Errorf("FunctionIDEnd = %d, want 3", end)
+	}
+}
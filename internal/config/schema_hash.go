@@ -0,0 +1,52 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SchemaHash fingerprints the parts of the function table that decide the
+// wire: each function's message ID (its MsgUserStart offset), name, mode,
+// return type, async/caller flags and argument names and types — everything
+// the generated ipc schema and both dispatch tables are derived from.
+// Descriptions, categories, timeouts and other registration-only fields are
+// left out, so editing help text does not make a rebuilt XLL refuse an
+// unchanged server. Functions are hashed in ID order, so reordering
+// functions whose IDs are pinned (id: or xll.lock) keeps the hash.
+//
+// The XLL and the server embed the same value at generation time and compare
+// it in the connect handshake (MsgHandshake); the template funcmap exposes it
+// as schemaHash.
+func SchemaHash(fns []Function) string {
+	type line struct {
+		id   int
+		text string
+	}
+	lines := make([]line, 0, len(fns))
+	for i, fn := range fns {
+		var b strings.Builder
+		mode := fn.Mode
+		if mode == "" {
+			mode = "sync"
+			if fn.Async {
+				mode = "async"
+			}
+		}
+		fmt.Fprintf(&b, "%d\t%s\t%s\t%s\t%t\t%t", fn.MsgOffset(i), fn.Name, mode, fn.Return, fn.Async || mode == "async", fn.Caller)
+		for _, a := range fn.Args {
+			fmt.Fprintf(&b, "\t%s:%s", a.Name, a.Type)
+		}
+		b.WriteByte('\n')
+		lines = append(lines, line{fn.MsgOffset(i), b.String()})
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].id < lines[j].id })
+	h := sha256.New()
+	for _, l := range lines {
+		h.Write([]byte(l.text))
+	}
+	sum := h.Sum(nil)
+	return hex.EncodeToString(sum[:8])
+}
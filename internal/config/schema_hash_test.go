@@ -0,0 +1,68 @@
+package config
+
+import "testing"
+
+// TestSchemaHash checks that the handshake fingerprint moves with every field
+// the wire depends on and ignores registration-only metadata.
+func TestSchemaHash(t *testing.T) {
+	base := func() []Function {
+		return []Function{
+			{Name: "Add", Mode: "sync", Return: "int", Args: []Arg{{Name: "a", Type: "int"}, {Name: "b", Type: "int"}}},
+			{Name: "Greet", Mode: "async", Async: true, Return: "string", Args: []Arg{{Name: "name", Type: "string"}}},
+		}
+	}
+	want := SchemaHash(base())
+	if len(want) != 16 {
+		t.Fatalf("SchemaHash = %q, want 16 hex digits", want)
+	}
+
+	same := base()
+	same[0].Description = "Adds two numbers"
+	same[0].Category = "Math"
+	same[0].Timeout = "5s"
+	same[1].Args[0].Description = "who"
+	if got := SchemaHash(same); got != want {
+		t.Errorf("registration-only fields changed the hash: %s != %s", got, want)
+	}
+
+	// A raw config with an empty Mode hashes like its normalized form.
+	raw := base()
+	raw[0].Mode = ""
+	raw[1].Mode = ""
+	if got := SchemaHash(raw); got != want {
+		t.Errorf("un-normalized modes changed the hash: %s != %s", got, want)
+	}
+
+	for name, mutate := range map[string]func([]Function) []Function{
+		"reorder":    func(f []Function) []Function { return []Function{f[1], f[0]} },
+		"rename":     func(f []Function) []Function { f[0].Name = "Sum"; return f },
+		"mode":       func(f []Function) []Function { f[0].Mode = "async"; return f },
+		"return":     func(f []Function) []Function { f[0].Return = "float"; return f },
+		"caller":     func(f []Function) []Function { f[0].Caller = true; return f },
+		"arg type":   func(f []Function) []Function { f[0].Args[1].Type = "float"; return f },
+		"arg name":   func(f []Function) []Function { f[0].Args[1].Name = "c"; return f },
+		"arg added":  func(f []Function) []Function { f[1].Args = append(f[1].Args, Arg{Name: "n", Type: "int"}); return f },
+		"fn removed": func(f []Function) []Function { return f[:1] },
+		"id":         func(f []Function) []Function { id := 7; f[1].ID = &id; return f },
+	} {
+		if got := SchemaHash(mutate(base())); got == want {
+			t.Errorf("%s: hash unchanged", name)
+		}
+	}
+
+	// With pinned IDs the declaration order no longer reaches the wire.
+	pinned := func(f []Function) []Function {
+		for i := range f {
+			id := i
+			f[i].ID = &id
+		}
+		return f
+	}
+	p := pinned(base())
+	if got := SchemaHash(p); got != want {
+		t.Errorf("pinning the positional IDs changed the hash: %s != %s", got, want)
+	}
+	if got := SchemaHash([]Function{p[1], p[0]}); got != want {
+		t.Errorf("reordering functions with pinned IDs changed the hash: %s != %s", got, want)
+	}
+}
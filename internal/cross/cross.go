@@ -0,0 +1,119 @@
+// Package cross locates a mingw-w64 cross toolchain and writes the CMake
+// toolchain file that builds the XLL for Windows x64 from a Linux (or other
+// non-Windows) host. It backs `xll-gen build --target windows-amd64
+// --toolchain mingw` and the matching `doctor` check.
+package cross
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/xll-gen/xll-gen/internal/templates"
+	"github.com/xll-gen/xll-gen/version"
+)
+
+// Target is the only cross target: 64-bit Windows, the one architecture
+// xll-gen builds (see the architecture lock in CMakeLists.txt.tmpl).
+const Target = "windows-amd64"
+
+// Mingw is the only cross toolchain.
+const Mingw = "mingw"
+
+// Prefix is the mingw-w64 tool prefix for Target.
+const Prefix = "x86_64-w64-mingw32-"
+
+// ToolchainFile is where `xll-gen build` writes the toolchain file, relative
+// to the project root; the generated Taskfile reads it from there.
+var ToolchainFile = filepath.Join("build", "toolchain-"+Target+"-"+Mingw+".cmake")
+
+// Toolchain is a located mingw-w64 installation.
+type Toolchain struct {
+	CC  string
+	CXX string
+	RC  string
+	// ThreadModel is what `CXX -v` reports: "posix", "mcf" or "win32".
+	ThreadModel string
+}
+
+// ErrNotFound reports a missing mingw-w64 tool.
+var ErrNotFound = errors.New("mingw-w64 cross toolchain not found")
+
+// Install is how to install mingw-w64 on the common distributions.
+const Install = "Debian/Ubuntu: apt install g++-mingw-w64-x86-64; Fedora: dnf install mingw64-gcc-c++; Arch: pacman -S mingw-w64-gcc"
+
+// Win32ThreadsHint explains a win32 thread model compiler.
+const Win32ThreadsHint = "this g++ uses the win32 thread model; before GCC 13 it lacks std::thread and std::mutex, which the XLL needs. Install the posix variant (x86_64-w64-mingw32-g++-posix)"
+
+// Find locates the mingw-w64 compilers and resource compiler on PATH,
+// preferring the -posix variants that Debian and Ubuntu install next to the
+// default win32 thread model ones: the XLL uses std::thread and std::mutex,
+// which older GCCs only provide with posix threads.
+func Find() (*Toolchain, error) {
+	return find(exec.LookPath, threadModel)
+}
+
+func find(lookPath func(string) (string, error), model func(string) string) (*Toolchain, error) {
+	tool := func(names ...string) (string, error) {
+		for _, n := range names {
+			if p, err := lookPath(Prefix + n); err == nil {
+				return p, nil
+			}
+		}
+		return "", fmt.Errorf("%w: no %s%s on PATH (%s)", ErrNotFound, Prefix, names[len(names)-1], Install)
+	}
+	tc := &Toolchain{}
+	var err error
+	if tc.CXX, err = tool("g++-posix", "g++"); err != nil {
+		return nil, err
+	}
+	if tc.CC, err = tool("gcc-posix", "gcc"); err != nil {
+		return nil, err
+	}
+	if tc.RC, err = tool("windres"); err != nil {
+		return nil, err
+	}
+	tc.ThreadModel = model(tc.CXX)
+	return tc, nil
+}
+
+// threadModel returns the "Thread model:" line of `cxx -v`, or "".
+func threadModel(cxx string) string {
+	out, _ := exec.Command(cxx, "-v").CombinedOutput()
+	for _, line := range strings.Split(string(out), "\n") {
+		if m, ok := strings.CutPrefix(strings.TrimSpace(line), "Thread model:"); ok {
+			return strings.TrimSpace(m)
+		}
+	}
+	return ""
+}
+
+// WriteToolchainFile writes the CMake toolchain file for tc to path.
+func WriteToolchainFile(path string, tc *Toolchain) error {
+	src, err := templates.Get("toolchain-mingw.cmake.tmpl")
+	if err != nil {
+		return err
+	}
+	t, err := template.New("toolchain").Parse(src)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		*Toolchain
+		Version string
+		Sysroot string
+	}{tc, version.Version, "/usr/" + strings.TrimSuffix(Prefix, "-")}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,92 @@
+package cross
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/templates"
+)
+
+func fakePath(tools ...string) func(string) (string, error) {
+	return func(name string) (string, error) {
+		for _, t := range tools {
+			if t == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", errors.New("not found")
+	}
+}
+
+func TestFind(t *testing.T) {
+	model := func(string) string { return "posix" }
+
+	tc, err := find(fakePath(Prefix+"g++", Prefix+"g++-posix", Prefix+"gcc", Prefix+"gcc-posix", Prefix+"windres"), model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.CXX != "/usr/bin/"+Prefix+"g++-posix" || tc.CC != "/usr/bin/"+Prefix+"gcc-posix" ||
+		tc.RC != "/usr/bin/"+Prefix+"windres" || tc.ThreadModel != "posix" {
+		t.Errorf("the -posix variants must win: %+v", tc)
+	}
+
+	tc, err = find(fakePath(Prefix+"g++", Prefix+"gcc", Prefix+"windres"), model)
+	if err != nil || tc.CXX != "/usr/bin/"+Prefix+"g++" {
+		t.Errorf("plain g++ = %+v, %v", tc, err)
+	}
+
+	_, err = find(fakePath(Prefix+"g++", Prefix+"gcc"), model)
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "windres") {
+		t.Errorf("missing windres: %v", err)
+	}
+}
+
+func TestWriteToolchainFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ToolchainFile)
+	tc := &Toolchain{CC: "/usr/bin/cc-x", CXX: "/usr/bin/cxx-x", RC: "/usr/bin/rc-x"}
+	if err := WriteToolchainFile(path, tc); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"set(CMAKE_SYSTEM_NAME Windows)",
+		`set(CMAKE_CXX_COMPILER "/usr/bin/cxx-x")`,
+		`set(CMAKE_RC_COMPILER "/usr/bin/rc-x")`,
+		`set(CMAKE_FIND_ROOT_PATH "/usr/x86_64-w64-mingw32")`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("toolchain file lacks %q:\n%s", want, b)
+		}
+	}
+}
+
+// TestTaskfileReadsToolchainFile: the cross tasks pass CMake the file build
+// writes, and build for the target.
+func TestTaskfileReadsToolchainFile(t *testing.T) {
+	tmpl, err := templates.Get("Taskfile.yml.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range []string{"build-" + Target + ":", "build-" + Target + "-debug:"} {
+		i := strings.Index(tmpl, task)
+		if i < 0 {
+			t.Fatalf("Taskfile.yml.tmpl has no %s task", task)
+		}
+		block := tmpl[i:]
+		if j := strings.Index(block[len(task):], "\n  build-"); j >= 0 {
+			block = block[:len(task)+j]
+		}
+		if !strings.Contains(block, "GOOS: windows") || !strings.Contains(block, "GOARCH: amd64") {
+			t.Errorf("%s does not build the server for Windows", task)
+		}
+		if !strings.Contains(block, "-DCMAKE_TOOLCHAIN_FILE={{\"{{\"}}.ROOT_DIR{{\"}}\"}}/"+filepath.ToSlash(ToolchainFile)) {
+			t.Errorf("%s does not configure with %s", task, ToolchainFile)
+		}
+	}
+}
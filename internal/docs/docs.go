@@ -0,0 +1,368 @@
+// Package docs renders the reference documentation of a project — every
+// function, command, event and ribbon button in xll.yaml — as Markdown and as
+// a standalone HTML page. It backs `xll-gen docs`.
+package docs
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/templates"
+)
+
+// Catalog is what the templates render: a defaulted, validated Config
+// flattened into display text.
+type Catalog struct {
+	Project    string
+	Version    string
+	Functions  int
+	Categories []Category
+	Commands   []Command
+	Events     []Event
+	// Ribbon is nil when the project declares none.
+	Ribbon *Ribbon
+}
+
+// Category groups functions by their function wizard category.
+type Category struct {
+	Name      string
+	Anchor    string
+	Functions []Function
+}
+
+// Function is one worksheet function.
+type Function struct {
+	Name        string
+	Anchor      string
+	Description string
+	Args        []Arg
+	Return      string
+	Mode        string
+	// ModeText explains what the mode means to someone using the function.
+	ModeText string
+	// Flags lists registration traits, e.g. "volatile".
+	Flags   []string
+	Timeout string
+	Caching string
+	Retry   string
+	// HelpTopic is the help_topic as written; HelpURL is its link, empty
+	// unless it is a web address.
+	HelpTopic string
+	HelpURL   string
+	Example   string
+}
+
+// Arg is one function argument.
+type Arg struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// Command is one macro command.
+type Command struct {
+	Name        string
+	Anchor      string
+	Description string
+	Shortcut    string
+	Handler     string
+	// Buttons are the ribbon buttons that run it, as "Group › Label".
+	Buttons []string
+}
+
+// Event is one Excel event subscription.
+type Event struct {
+	Type    string
+	Handler string
+	Text    string
+}
+
+// Ribbon is the add-in's ribbon tab.
+type Ribbon struct {
+	Tab string
+	// XML is the raw customUI file, when the ribbon is not structured.
+	XML    string
+	Groups []RibbonGroup
+}
+
+// RibbonGroup is one group of buttons.
+type RibbonGroup struct {
+	Label   string
+	Buttons []RibbonButton
+}
+
+// RibbonButton is one button and the command it runs.
+type RibbonButton struct {
+	Label         string
+	Command       string
+	CommandAnchor string
+}
+
+// typeText describes each xll.yaml type as a worksheet user sees it.
+var typeText = map[string]string{
+	"int":     "integer",
+	"float":   "number",
+	"string":  "text",
+	"bool":    "TRUE or FALSE",
+	"range":   "cell reference",
+	"grid":    "range or array",
+	"numgrid": "numeric range or array",
+	"date":    "date",
+	"any":     "any value",
+}
+
+// retTypeText overrides typeText for returns.
+var retTypeText = map[string]string{
+	"grid":    "array, spills",
+	"numgrid": "numeric array, spills",
+}
+
+// exampleArg is the sample argument a generated example formula passes for
+// each type.
+var exampleArg = map[string]string{
+	"int":     "1",
+	"float":   "1.5",
+	"string":  `"text"`,
+	"bool":    "TRUE",
+	"range":   "A1",
+	"grid":    "A1:B2",
+	"numgrid": "A1:B2",
+	"date":    "TODAY()",
+	"any":     "A1",
+}
+
+var eventText = map[string]string{
+	"CalculationEnded":    "Runs after every recalculation, including one the user cancels.",
+	"CalculationCanceled": "Runs when the user interrupts a recalculation (Esc), just before CalculationEnded.",
+}
+
+// NewCatalog builds the catalog of cfg, which must be defaulted and
+// validated. Categories and the functions in each are sorted by name, with
+// uncategorized functions last under "Other".
+func NewCatalog(cfg *config.Config) *Catalog {
+	c := &Catalog{Project: cfg.Project.Name, Version: cfg.Project.Version, Functions: len(cfg.Functions)}
+
+	byCategory := map[string][]Function{}
+	for _, fn := range cfg.Functions {
+		byCategory[fn.Category] = append(byCategory[fn.Category], newFunction(cfg, fn))
+	}
+	var names []string
+	for name := range byCategory {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := byCategory[""]; ok {
+		names = append(names, "")
+	}
+	for _, name := range names {
+		fns := byCategory[name]
+		sort.Slice(fns, func(i, j int) bool { return fns[i].Name < fns[j].Name })
+		label := name
+		if label == "" {
+			label = "Other"
+		}
+		c.Categories = append(c.Categories, Category{Name: label, Anchor: anchor("cat", label), Functions: fns})
+	}
+
+	buttons := map[string][]string{}
+	if cfg.Ribbon.Enabled() {
+		c.Ribbon = &Ribbon{Tab: cfg.Ribbon.Tab, XML: cfg.Ribbon.XML}
+		for _, g := range cfg.Ribbon.Groups {
+			rg := RibbonGroup{Label: g.Label}
+			for _, b := range g.Buttons {
+				rg.Buttons = append(rg.Buttons, RibbonButton{Label: b.Label, Command: b.Command, CommandAnchor: anchor("cmd", b.Command)})
+				buttons[b.Command] = append(buttons[b.Command], g.Label+" › "+b.Label)
+			}
+			c.Ribbon.Groups = append(c.Ribbon.Groups, rg)
+		}
+	}
+	for _, cmd := range cfg.Commands {
+		sc := ""
+		if cmd.Shortcut != "" {
+			sc = "Ctrl+Shift+" + strings.ToUpper(cmd.Shortcut)
+		}
+		c.Commands = append(c.Commands, Command{
+			Name:        cmd.Name,
+			Anchor:      anchor("cmd", cmd.Name),
+			Description: cmd.Description,
+			Shortcut:    sc,
+			Handler:     cmd.Handler,
+			Buttons:     buttons[cmd.Name],
+		})
+	}
+	for _, e := range cfg.Events {
+		c.Events = append(c.Events, Event{Type: e.Type, Handler: e.Handler, Text: eventText[e.Type]})
+	}
+	return c
+}
+
+func newFunction(cfg *config.Config, fn config.Function) Function {
+	f := Function{
+		Name:        fn.Name,
+		Anchor:      anchor("fn", fn.Name),
+		Description: fn.Description,
+		Return:      describeType(fn.Return, true),
+		Mode:        fn.Mode,
+		ModeText:    modeText(fn),
+		HelpTopic:   fn.HelpTopic,
+		Example:     fn.Example,
+	}
+	var samples []string
+	for _, a := range fn.Args {
+		f.Args = append(f.Args, Arg{Name: a.Name, Type: describeType(a.Type, false), Description: a.Description})
+		samples = append(samples, exampleArg[a.Type])
+	}
+	if f.Example == "" {
+		f.Example = "=" + fn.Name + "(" + strings.Join(samples, ", ") + ")"
+	}
+	if strings.HasPrefix(fn.HelpTopic, "http://") || strings.HasPrefix(fn.HelpTopic, "https://") {
+		// Excel's help_topic is "<url>!<context id>"; the id is not part of
+		// the address.
+		f.HelpURL = helpContextID.ReplaceAllString(fn.HelpTopic, "")
+	}
+
+	for _, flag := range []struct {
+		on   bool
+		text string
+	}{
+		{fn.Volatile, "volatile"},
+		{fn.Resizable, "resizable"},
+		{fn.Caller, "receives the calling cell"},
+		{fn.Macro, "macro-sheet equivalent (not thread-safe)"},
+	} {
+		if flag.on {
+			f.Flags = append(f.Flags, flag.text)
+		}
+	}
+
+	if !config.IsRtdLike(fn.Mode) {
+		f.Timeout = fn.Timeout
+		if f.Timeout == "" {
+			f.Timeout = cfg.Server.Timeout
+		}
+	}
+
+	switch {
+	case fn.Memoize:
+		f.Caching = "memoized until the add-in unloads"
+	case fn.MemoizeTTL != "":
+		f.Caching = "memoized for " + fn.MemoizeTTL
+	default:
+		enabled, ttl := cfg.Cache.Enabled, cfg.Cache.TTL
+		if fn.Cache != nil {
+			if fn.Cache.Enabled != nil {
+				enabled = *fn.Cache.Enabled
+			}
+			if fn.Cache.TTL != "" {
+				ttl = fn.Cache.TTL
+			}
+		}
+		if enabled {
+			f.Caching = "cached"
+			if ttl != "" {
+				f.Caching += " for " + ttl
+			}
+		}
+	}
+	if (fn.Memoize || fn.MemoizeTTL != "") && fn.MemoizeStore == "disk" {
+		f.Caching += ", kept on disk across Excel sessions"
+	}
+
+	if fn.Retry != nil {
+		f.Retry = "retried on failure"
+		if fn.Retry.Attempts > 0 {
+			f.Retry = "up to " + strconv.Itoa(fn.Retry.Attempts) + " attempts"
+		}
+		if len(fn.Retry.RetryOn) > 0 {
+			f.Retry += " (" + strings.Join(fn.Retry.RetryOn, ", ") + ")"
+		}
+	}
+	return f
+}
+
+var helpContextID = regexp.MustCompile(`!\d+$`)
+
+// modeText explains fn's execution mode.
+func modeText(fn config.Function) string {
+	switch fn.Mode {
+	case "async":
+		return "Computed in the background while Excel keeps calculating; the cell fills in when the result arrives."
+	case "rtd":
+		return "Streams through RTD: the cell updates whenever a new value is pushed, for as long as the formula stays."
+	case "rtd-once":
+		s := "Computed once in the background through RTD; the cell shows a placeholder until the result arrives."
+		if !fn.Memoize && fn.MemoizeTTL == "" {
+			s += " A recalculation (F9) computes it again."
+		}
+		return s
+	}
+	return "Computed during recalculation; Excel waits for the result."
+}
+
+func describeType(t string, ret bool) string {
+	text := typeText[t]
+	if r, ok := retTypeText[t]; ok && ret {
+		text = r
+	}
+	if text == "" || text == t {
+		return t
+	}
+	return t + " (" + text + ")"
+}
+
+var nonAnchor = regexp.MustCompile(`[^a-z0-9]+`)
+
+// anchor returns the fragment id of name in its kind's namespace, e.g.
+// "fn-getprice".
+func anchor(kind, name string) string {
+	return kind + "-" + strings.Trim(nonAnchor.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// mdCell makes s safe inside a Markdown table cell: pipes are escaped, angle
+// brackets kept from reading as HTML, and line breaks collapsed.
+func mdCell(s string) string {
+	s = strings.NewReplacer("|", `\|`, "<", "&lt;", ">", "&gt;").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Markdown renders cfg's reference as Markdown.
+func Markdown(cfg *config.Config) ([]byte, error) {
+	src, err := templates.Get("docs.md.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New("docs.md").Funcs(template.FuncMap{"cell": mdCell, "join": strings.Join}).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, NewCatalog(cfg)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// HTML renders cfg's reference as a standalone HTML page.
+func HTML(cfg *config.Config) ([]byte, error) {
+	src, err := templates.Get("docs.html.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	t, err := htmltemplate.New("docs.html").Funcs(htmltemplate.FuncMap{"join": strings.Join}).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, NewCatalog(cfg)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,160 @@
+package docs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+const docsYAML = `project:
+  name: "quotes"
+  version: "1.2.0"
+cache:
+  enabled: true
+  ttl: "1m"
+rtd:
+  enabled: true
+  prog_id: "Quotes.RTD"
+functions:
+  - name: "GetPrice"
+    description: "Last price of a ticker | exchange"
+    category: "Market"
+    args:
+      - name: "ticker"
+        type: "string"
+        description: "Symbol, e.g. MSFT"
+    return: "float"
+    help_topic: "https://example.com/help/getprice!0"
+    example: '=GetPrice("MSFT")'
+  - name: "Eye"
+    category: "Math"
+    args:
+      - name: "n"
+        type: "int"
+    return: "numgrid"
+    volatile: true
+    cache:
+      enabled: false
+  - name: "Slow"
+    args:
+      - name: "when"
+        type: "date"
+    return: "string"
+    mode: "rtd-once"
+    memoize_ttl: "5m"
+    memoize_store: "disk"
+commands:
+  - name: "Refresh"
+    description: "Reload prices"
+    shortcut: "r"
+events:
+  - type: "CalculationEnded"
+    handler: "OnCalcEnded"
+ribbon:
+  tab: "Quotes"
+  groups:
+    - label: "Data"
+      buttons:
+        - label: "Refresh <all>"
+          command: "Refresh"
+`
+
+func loadConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.Parse([]byte(docsYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestNewCatalog(t *testing.T) {
+	c := NewCatalog(loadConfig(t))
+	var cats []string
+	for _, cat := range c.Categories {
+		cats = append(cats, cat.Name)
+	}
+	if strings.Join(cats, ",") != "Market,Math,Other" {
+		t.Fatalf("categories = %v, want Market, Math, then Other", cats)
+	}
+
+	price := c.Categories[0].Functions[0]
+	if price.HelpURL != "https://example.com/help/getprice" || price.Caching != "cached for 1m" ||
+		price.Example != `=GetPrice("MSFT")` || price.Args[0].Type != "string (text)" {
+		t.Errorf("GetPrice = %+v", price)
+	}
+	eye := c.Categories[1].Functions[0]
+	if eye.Caching != "" || eye.Return != "numgrid (numeric array, spills)" ||
+		eye.Example != "=Eye(1)" || len(eye.Flags) != 1 || eye.Flags[0] != "volatile" {
+		t.Errorf("Eye = %+v", eye)
+	}
+	slow := c.Categories[2].Functions[0]
+	if slow.Caching != "memoized for 5m, kept on disk across Excel sessions" || slow.Timeout != "" ||
+		strings.Contains(slow.ModeText, "F9") {
+		t.Errorf("Slow = %+v", slow)
+	}
+
+	if len(c.Commands) != 1 || c.Commands[0].Shortcut != "Ctrl+Shift+R" ||
+		len(c.Commands[0].Buttons) != 1 || c.Commands[0].Buttons[0] != "Data › Refresh <all>" {
+		t.Errorf("Commands = %+v", c.Commands)
+	}
+	if len(c.Events) != 1 || c.Events[0].Text == "" {
+		t.Errorf("Events = %+v", c.Events)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	out, err := Markdown(loadConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(out)
+	for _, want := range []string{
+		"# quotes reference",
+		"- [Market](#cat-market): [GetPrice](#fn-getprice)",
+		`<a id="fn-getprice"></a>`,
+		"| `ticker` | string (text) | Symbol, e.g. MSFT |",
+		"Last price of a ticker | exchange",
+		"- **Help:** <https://example.com/help/getprice>",
+		"- **Shortcut:** Ctrl+Shift+R",
+		"| CalculationEnded | `OnCalcEnded` |",
+		"| Refresh &lt;all&gt; | [Refresh](#cmd-refresh) |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown lacks %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	out, err := HTML(loadConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(out)
+	for _, want := range []string{
+		`<section class="fn" id="fn-getprice" data-name="GetPrice">`,
+		`<a href="https://example.com/help/getprice">`,
+		`<pre>=GetPrice(&#34;MSFT&#34;)</pre>`,
+		`<td>Refresh &lt;all&gt;</td>`,
+		`id="filter"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("HTML lacks %q", want)
+		}
+	}
+	if strings.Contains(page, "<link") || strings.Contains(page, "src=") {
+		t.Error("HTML must be standalone")
+	}
+}
+
+func TestMdCell(t *testing.T) {
+	if got := mdCell("a | <b>\n  c"); got != `a \| &lt;b&gt; c` {
+		t.Errorf("mdCell = %q", got)
+	}
+}
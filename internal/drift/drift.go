@@ -0,0 +1,267 @@
+// Package drift compares a fresh `xll-gen generate` output tree with the
+// files a project has checked in, to catch an xll.yaml edited without
+// regenerating and a generated file edited by hand. It backs
+// `xll-gen generate --check`.
+package drift
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Status is how a project file differs from the generated one.
+type Status string
+
+const (
+	// Modified: the project file's content differs.
+	Modified Status = "modified"
+	// Missing: generate writes the file, the project lacks it.
+	Missing Status = "missing"
+	// Stale: the project has the file in a path generate owns, and generate
+	// would delete it.
+	Stale Status = "stale"
+)
+
+// File is one differing file.
+type File struct {
+	// Path is relative to the project root, slash-separated.
+	Path   string
+	Status Status
+	// Added and Removed count the lines generate would add and remove.
+	Added, Removed int
+	// Diff is the unified diff from the project file to the generated one;
+	// empty unless Modified.
+	Diff string
+}
+
+// maxLCS bounds the line-pair table of one diff; past it the differing
+// middle of the file is shown as a single replacement.
+const maxLCS = 4 << 20
+
+// Compare returns the files under generated (a generate output root) whose
+// counterparts under project differ, and the project files under the owned
+// paths that generated lacks, sorted by path. Line endings are ignored, so a
+// CRLF checkout compares equal.
+func Compare(generated, project string, owned []string) ([]File, error) {
+	var out []File
+	seen := map[string]bool{}
+	err := filepath.WalkDir(generated, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(generated, path)
+		if err != nil {
+			return err
+		}
+		seen[rel] = true
+		want, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		have, err := os.ReadFile(filepath.Join(project, rel))
+		if os.IsNotExist(err) {
+			out = append(out, File{Path: filepath.ToSlash(rel), Status: Missing, Added: countLines(want)})
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !bytes.Equal(normalize(have), normalize(want)) {
+			f := File{Path: filepath.ToSlash(rel), Status: Modified}
+			f.Diff, f.Added, f.Removed = Unified(f.Path, have, want)
+			out = append(out, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range owned {
+		root := filepath.Join(project, o)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(project, path)
+			if err != nil || seen[rel] {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			out = append(out, File{Path: filepath.ToSlash(rel), Status: Stale, Removed: countLines(data)})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, nil
+}
+
+func normalize(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+}
+
+func countLines(b []byte) int {
+	return len(splitLines(b))
+}
+
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(normalize(b)), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Unified returns the unified diff, with three lines of context, from old to
+// new for path, and the number of lines added and removed.
+func Unified(path string, old, new []byte) (diff string, added, removed int) {
+	a, b := splitLines(old), splitLines(new)
+	ops := diffLines(a, b)
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- a/%s\n+++ b/%s\n", path, path)
+	const context = 3
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// A hunk runs from context lines before this change to context lines
+		// after the last change that is within 2*context of the next.
+		start := max(0, i-context)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*context {
+				break
+			}
+		}
+		end = min(len(ops), end+context)
+
+		aStart, bStart := ops[start].a, ops[start].b
+		var aLen, bLen int
+		var body strings.Builder
+		for _, op := range ops[start:end] {
+			line := op.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			body.WriteByte(op.kind)
+			body.WriteString(line)
+			switch op.kind {
+			case ' ':
+				aLen++
+				bLen++
+			case '-':
+				aLen++
+				removed++
+			case '+':
+				bLen++
+				added++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		buf.WriteString(body.String())
+		i = end
+	}
+	return buf.String(), added, removed
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// op is one line of an edit script; a and b are the 0-based line numbers in
+// the old and new file where it applies.
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+	a, b int
+}
+
+// diffLines returns an edit script from a to b: the common prefix and suffix
+// are kept, and the middle is diffed by longest common subsequence, or
+// replaced wholesale when it is too large for that.
+func diffLines(a, b []string) []op {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var ops []op
+	for i := 0; i < pre; i++ {
+		ops = append(ops, op{' ', a[i], i, i})
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(ma)*len(mb) > maxLCS {
+		for i, l := range ma {
+			ops = append(ops, op{'-', l, pre + i, pre})
+		}
+		for j, l := range mb {
+			ops = append(ops, op{'+', l, pre + len(ma), pre + j})
+		}
+	} else {
+		ops = append(ops, lcsOps(ma, mb, pre)...)
+	}
+	for k := 0; k < suf; k++ {
+		i, j := len(a)-suf+k, len(b)-suf+k
+		ops = append(ops, op{' ', a[i], i, j})
+	}
+	return ops
+}
+
+// lcsOps diffs a and b, whose first lines are line off of both files.
+func lcsOps(a, b []string, off int) []op {
+	n, m := len(a), len(b)
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i], off + i, off + j})
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i], off + i, off + j})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j], off + i, off + j})
+			j++
+		}
+	}
+	return ops
+}
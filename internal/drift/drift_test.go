@@ -0,0 +1,100 @@
+package drift
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestCompare: edited, missing and stale files are reported; a CRLF copy
+// and files outside the owned paths are not.
+func TestCompare(t *testing.T) {
+	gen, project := t.TempDir(), t.TempDir()
+	writeFiles(t, gen, map[string]string{
+		"Taskfile.yml":              "version: 3\n",
+		"generated/interface.go":    "package generated\n\nfunc A() {}\n",
+		"generated/server.go":       "package generated\n",
+		"generated/cpp/src/a.cpp":   "int a;\n",
+		"generated/cpp/include/x.h": "#pragma once\nint x;\n",
+	})
+	writeFiles(t, project, map[string]string{
+		"Taskfile.yml":              "version: 3\r\n",
+		"generated/interface.go":    "package generated\n\nfunc B() {}\n",
+		"generated/cpp/src/a.cpp":   "int a;\n",
+		"generated/cpp/src/old.cpp": "int old;\n",
+		"generated/cpp/include/x.h": "#pragma once\nint x;\n",
+		"generated/testdata/corpus": "kept\n",
+		"main.go":                   "package main\n",
+	})
+	files, err := Compare(gen, project, []string{"generated/cpp/src", "generated/cpp/tools"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []File{
+		{Path: "generated/cpp/src/old.cpp", Status: Stale, Removed: 1},
+		{Path: "generated/interface.go", Status: Modified, Added: 1, Removed: 1},
+		{Path: "generated/server.go", Status: Missing, Added: 1},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %+v", files)
+	}
+	for i, w := range want {
+		f := files[i]
+		if f.Path != w.Path || f.Status != w.Status || f.Added != w.Added || f.Removed != w.Removed {
+			t.Errorf("file %d = %+v, want %+v", i, f, w)
+		}
+	}
+	if !strings.Contains(files[1].Diff, "-func B() {}\n+func A() {}\n") {
+		t.Errorf("diff:\n%s", files[1].Diff)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	var old, new []string
+	for i := 1; i <= 20; i++ {
+		old = append(old, "line"+string(rune('a'+i)))
+	}
+	new = append(new, old...)
+	new[2] = "changed"
+	new = append(new[:15], append([]string{"inserted"}, new[15:]...)...)
+	diff, added, removed := Unified("f.txt", []byte(strings.Join(old, "\n")+"\n"), []byte(strings.Join(new, "\n")+"\n"))
+	if added != 2 || removed != 1 {
+		t.Errorf("added %d, removed %d; want 2, 1", added, removed)
+	}
+	want := `--- a/f.txt
++++ b/f.txt
+@@ -1,6 +1,6 @@
+ lineb
+ linec
+-lined
++changed
+ linee
+ linef
+ lineg
+@@ -13,6 +13,7 @@
+ linen
+ lineo
+ linep
++inserted
+ lineq
+ liner
+ lines
+`
+	if diff != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", diff, want)
+	}
+}
@@ -2,12 +2,14 @@ package generator
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
 	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/pkg/msgid"
 	"github.com/xll-gen/xll-gen/pkg/server"
 )
 
@@ -184,6 +186,21 @@ func failUnhandledType(site, typ, name string) (string, error) {
 		"LPXLOPER12 miscasts of newly-added scalar types", site, typ, name)
 }
 
+// recordDir returns server.record_dir from the server template data, or ""
+// when the data has no RecordDir field. The template tests each mirror only
+// the part of generateServer's data struct they render, and recording is off
+// with an empty dir, so a mirror that does not exercise it can leave it out.
+func recordDir(data any) string {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	if f := v.FieldByName("RecordDir"); f.IsValid() && f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
+
 // GetCommonFuncMap returns a map of common template functions used across different generators.
 // This centralization ensures consistency and avoids code duplication.
 func GetCommonFuncMap() template.FuncMap {
@@ -193,6 +210,7 @@ func GetCommonFuncMap() template.FuncMap {
 		"anyDateType":       anyDateType,
 		"anyNonRtdLike":     anyNonRtdLike,
 		"getEventHandler":   getEventHandler,
+		"recordDir":         recordDir,
 		"escapeCppString":   escapeCppString,
 		"derefBool": func(b *bool) bool {
 			if b == nil {
@@ -216,6 +234,9 @@ func GetCommonFuncMap() template.FuncMap {
 		"lookupRetGoType": func(t string) string {
 			return LookupRetGoType(t)
 		},
+		"lookupClientGoType": func(t string) string {
+			return LookupClientGoType(t)
+		},
 		"lookupCppType": func(t string) string {
 			return LookupCppType(t)
 		},
@@ -313,12 +334,31 @@ func GetCommonFuncMap() template.FuncMap {
 		"MsgUserStart": func() int {
 			return server.MsgUserStart
 		},
+		"MsgHandshake": func() int {
+			return server.MsgHandshake
+		},
+		// msgID is the message ID of function i: MsgUserStart plus its ID
+		// (id: in xll.yaml, xll.lock, or its position). Every template that
+		// sends or dispatches a function call uses it, never the index.
+		"msgID": func(i int, fn config.Function) int {
+			return server.MsgUserStart + fn.MsgOffset(i)
+		},
+		// functionIDEnd is one past the highest function ID.
+		"functionIDEnd": config.FunctionIDEnd,
+		// msgIDs lists the system message IDs for the schema.fbs manifest.
+		"msgIDs": func() []msgid.ID {
+			return msgid.All
+		},
+		// schemaHash is the function-table fingerprint both sides of the
+		// connect handshake embed; see config.SchemaHash.
+		"schemaHash": config.SchemaHash,
 		// isRtdLike reports whether a mode routes through the RTD topic
 		// lifecycle (xlfRtd wrapper, RTD push results). Both "rtd" and
 		// "rtd-once" share the C++ wrapper shape and the server-side skip of
 		// the sync/async handler glue. Delegates to config.IsRtdLike, the SSOT
 		// shared with internal/regtest's funcmap and with anyNonRtdLike.
-		"isRtdLike": config.IsRtdLike,
+		"isRtdLike":      config.IsRtdLike,
+		"anyDiskMemoize": config.AnyDiskMemoize,
 		// anyRtdOnce reports whether the project declares at least one
 		// rtd-once function. Used to gate emission of the C++ RtdOnceResults
 		// machinery and the once-set initializer.
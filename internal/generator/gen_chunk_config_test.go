@@ -1,6 +1,8 @@
 package generator
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -11,18 +13,19 @@ import (
 // render server.go.tmpl's ChunkManager construction. Only the fields the
 // template actually reads for that block need to be meaningful.
 type srvChunkData struct {
-	Package       string
-	ModName       string
-	ProjectName   string
-	Functions     []config.Function
-	Events        []config.Event
-	Commands      []config.Command
-	ServerTimeout string
-	ServerWorkers int
-	Version       string
-	Logging       config.LoggingConfig
-	Rtd           config.RtdConfig
-	Chunk         *config.ChunkConfig
+	Package        string
+	ModName        string
+	ProjectName    string
+	ProjectVersion string
+	Functions      []config.Function
+	Events         []config.Event
+	Commands       []config.Command
+	ServerTimeout  string
+	ServerWorkers  int
+	Version        string
+	Logging        config.LoggingConfig
+	Rtd            config.RtdConfig
+	Chunk          *config.ChunkConfig
 }
 
 func newSrvChunkData(chunk *config.ChunkConfig) srvChunkData {
@@ -85,3 +88,76 @@ func TestServerTmpl_ChunkConfigWiring(t *testing.T) {
 		}
 	})
 }
+
+// TestChunkCompressionWiring pins server.chunk.compress_threshold on both
+// halves of a project: the server sets the process-wide threshold (and imports
+// pkg/chunk only then), and CMake links zstd and defines XLL_CHUNK_COMPRESSION
+// so HandleChunk can inflate what the server sends.
+func TestChunkCompressionWiring(t *testing.T) {
+	on := renderTemplate(t, "server.go.tmpl", newSrvChunkData(&config.ChunkConfig{CompressThreshold: 65536}))
+	assertParses(t, "server.go", on)
+	if !strings.Contains(on, "chunk.SetCompressThreshold(65536)") {
+		t.Errorf("rendered server.go must set the compress threshold\n---\n%s", on)
+	}
+	for _, c := range []*config.ChunkConfig{nil, {MaxBufferBytes: 1 << 20}} {
+		off := renderTemplate(t, "server.go.tmpl", newSrvChunkData(c))
+		assertParses(t, "server.go", off)
+		if strings.Contains(off, "pkg/chunk") || strings.Contains(off, "SetCompressThreshold") {
+			t.Errorf("compression must not be wired without compress_threshold (chunk=%+v)", c)
+		}
+	}
+
+	cmakeFor := func(chunk *config.ChunkConfig) string {
+		cfg := &config.Config{Project: config.ProjectConfig{Name: "Proj"}}
+		cfg.Server.Chunk = chunk
+		dir := t.TempDir()
+		if err := generateCMake(cfg, dir); err != nil {
+			t.Fatalf("generateCMake: %v", err)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, "CMakeLists.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	with := cmakeFor(&config.ChunkConfig{CompressThreshold: 65536})
+	for _, want := range []string{
+		"FetchContent_MakeAvailable(zstd)",
+		"target_link_libraries(${PROJECT_NAME} PRIVATE libzstd_static)",
+		"target_compile_definitions(${PROJECT_NAME} PRIVATE XLL_CHUNK_COMPRESSION)",
+	} {
+		if !strings.Contains(with, want) {
+			t.Errorf("CMake with compress_threshold missing %q", want)
+		}
+	}
+	if strings.Contains(with, "EMBED_GO_SERVER") || strings.Contains(with, "add_executable(compressor") {
+		t.Error("compress_threshold must not pull in the singlefile embedding")
+	}
+	if without := cmakeFor(nil); strings.Contains(without, "zstd") || strings.Contains(without, "XLL_CHUNK_COMPRESSION") {
+		t.Error("without compress_threshold (and singlefile) the XLL must not fetch or link zstd")
+	}
+}
+
+// TestServerTmpl_RtdSnapshotWiring pins rtd.snapshot -> EnableSnapshot: the
+// call is emitted only when the snapshot is on, with the configured marker and
+// the logging.dir-relative path.
+func TestServerTmpl_RtdSnapshotWiring(t *testing.T) {
+	data := newSrvChunkData(nil)
+	data.Rtd = config.RtdConfig{Enabled: true, ProgID: "P.Rtd", Snapshot: true, SnapshotMarker: " (stale)"}
+	data.Logging = config.LoggingConfig{Dir: "${TEMP}/logs"}
+	out := renderTemplate(t, "server.go.tmpl", data)
+	assertParses(t, "server.go", out)
+
+	want := `rtd.GlobalRtd.EnableSnapshot(server.RtdSnapshotPath("${TEMP}/logs", "chunkcfg"), " (stale)")`
+	if !strings.Contains(out, want) {
+		t.Fatalf("rendered server.go missing %q\n---\n%s", want, out)
+	}
+	if strings.Index(out, "EnableSnapshot(") > strings.Index(out, "rtd.GlobalRtd.SetClient(client)") {
+		t.Error("EnableSnapshot must run before SetClient, so no replay can race the load")
+	}
+
+	data.Rtd.Snapshot = false
+	if out := renderTemplate(t, "server.go.tmpl", data); strings.Contains(out, "EnableSnapshot") {
+		t.Error("EnableSnapshot emitted with rtd.snapshot off")
+	}
+}
@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+// clientData mirrors the anonymous struct built in generateClient.
+func clientData(fns []config.Function) interface{} {
+	return struct {
+		Package   string
+		ModName   string
+		Functions []config.Function
+		Version   string
+	}{
+		Package:   "generated",
+		ModName:   "testmod",
+		Functions: fns,
+		Version:   "test",
+	}
+}
+
+// TestClientTemplate renders client.go over the golden fixture, which has
+// every argument and return type in every mode, and checks the request each
+// kind of method builds. Compiling it needs the flatc-generated ipc package;
+// the fixture only proves the shapes.
+func TestClientTemplate(t *testing.T) {
+	src := renderTemplate(t, "client.go.tmpl", clientData(goldenConfig().Functions))
+	assertParses(t, "client.go", src)
+
+	for _, want := range []string{
+		"func (c *Client) SyncMulti(ctx context.Context, a0 string, a1 int32, a2 float64, a3 bool, a4 [][]any) (res string, err error)",
+		"off0 := fb.CreateString(a0)",
+		"ipc.SyncMultiRequestAddI(fb, a1)",
+		"off4, err := server.BuildGridFromGo(fb, a4)",
+		"ipc.SyncDateRequestAddD(fb, xldate.ToSerial(a0))",
+		"func (c *Client) SyncRange(ctx context.Context, a0 *protocol.RangeT) (res int32, err error)",
+		"ipc.CallerMacroRangeRequestAddCaller(fb, callerOff)",
+		"ipc.AsyncIntRequestAddAsyncHandle(fb, handleOff)",
+		`c.host.SendAsync(ctx, "AsyncInt", shm.MsgType(155), fb.FinishedBytes(), handle)`,
+		"return xllhost.GridValue(r.Result(nil)), nil",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("client.go lacks %q", want)
+		}
+	}
+	for _, name := range []string{"RtdScalars", "OnceScalar"} {
+		if strings.Contains(src, "func (c *Client) "+name+"(") {
+			t.Errorf("client.go has a method for rtd-like function %s", name)
+		}
+	}
+}
+
+// TestClientTemplate_NoRequests covers a project without a sync or async
+// function: there is no ipc request to build, so the ipc import must go too.
+func TestClientTemplate_NoRequests(t *testing.T) {
+	for _, fns := range [][]config.Function{
+		nil,
+		{{Name: "Tick", Mode: "rtd", Return: "any", Args: []config.Arg{{Name: "n", Type: "int"}}}},
+	} {
+		src := renderTemplate(t, "client.go.tmpl", clientData(fns))
+		assertParses(t, "client.go", src)
+		if strings.Contains(src, "/ipc\"") {
+			t.Errorf("client.go for %d rtd-only functions imports ipc", len(fns))
+		}
+	}
+}
+
+// TestGenerateClient_OptIn: client.go is written only with gen.go.client, and
+// turning the option off removes it, so a server does not keep importing
+// pkg/xllhost through a stale file.
+func TestGenerateClient_OptIn(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Project:   config.ProjectConfig{Name: "ClientProj", Version: "0.1.0"},
+		Functions: []config.Function{{Name: "Add", Args: []config.Arg{{Name: "a", Type: "int"}}, Return: "int"}},
+	}
+	config.ApplyDefaults(cfg)
+	path := filepath.Join(dir, "client.go")
+
+	if wrote, err := generateClient(cfg, dir, "mymod"); err != nil || wrote {
+		t.Fatalf("generateClient by default = (%v, %v), want nothing written", wrote, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("client.go written without gen.go.client (stat: %v)", err)
+	}
+
+	cfg.Gen.Go.Client = true
+	if wrote, err := generateClient(cfg, dir, "mymod"); err != nil || !wrote {
+		t.Fatalf("generateClient with client on = (%v, %v)", wrote, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Gen.Go.Client = false
+	if _, err := generateClient(cfg, dir, "mymod"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("client.go survived turning gen.go.client off (stat: %v)", err)
+	}
+}
@@ -115,7 +115,10 @@ func generateCMake(cfg *config.Config, dir string) error {
 		Rtd         config.RtdConfig
 		Ribbon      config.RibbonConfig
 		Commands    []config.Command
-		Deps        struct {
+		// ChunkCompression links zstd and defines XLL_CHUNK_COMPRESSION so
+		// HandleChunk can inflate transfers the server compresses.
+		ChunkCompression bool
+		Deps             struct {
 			FlatBuffers string
 			SHM         string
 			Types       string
@@ -123,12 +126,13 @@ func generateCMake(cfg *config.Config, dir string) error {
 			Zstd        string
 		}
 	}{
-		ProjectName: cfg.Project.Name,
-		Build:       cfg.Build,
-		Version:     version.Version,
-		Rtd:         cfg.Rtd,
-		Ribbon:      cfg.Ribbon,
-		Commands:    cfg.Commands,
+		ProjectName:      cfg.Project.Name,
+		Build:            cfg.Build,
+		Version:          version.Version,
+		Rtd:              cfg.Rtd,
+		Ribbon:           cfg.Ribbon,
+		Commands:         cfg.Commands,
+		ChunkCompression: cfg.Server.Chunk != nil && cfg.Server.Chunk.CompressThreshold > 0,
 		Deps: struct {
 			FlatBuffers string
 			SHM         string
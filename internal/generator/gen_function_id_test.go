@@ -0,0 +1,68 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+// TestPinnedFunctionIDs: a function's message ID is MsgUserStart plus its ID,
+// in every file that sends or dispatches it, whatever its position — the XLL,
+// the Go dispatch, the handshake range and the schema manifest must agree.
+func TestPinnedFunctionIDs(t *testing.T) {
+	five, zero := 5, 0
+	cfg := &config.Config{
+		Project: config.ProjectConfig{Name: "IDProj", Version: "0.1"},
+		Gen:     config.GenConfig{Go: config.GoConfig{Client: true}},
+		Functions: []config.Function{
+			{Name: "Later", ID: &five, Return: "int", Args: []config.Arg{{Name: "a", Type: "int"}}},
+			{Name: "First", ID: &zero, Return: "int", Args: []config.Arg{{Name: "a", Type: "int"}}},
+			{Name: "Free", Return: "int", Args: []config.Arg{{Name: "a", Type: "int"}}},
+		},
+	}
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := generateServer(cfg, dir, "mymod"); err != nil {
+		t.Fatalf("generateServer: %v", err)
+	}
+	if err := generateCppMain(cfg, dir, false); err != nil {
+		t.Fatalf("generateCppMain: %v", err)
+	}
+	if _, err := generateClient(cfg, dir, "mymod"); err != nil {
+		t.Fatalf("generateClient: %v", err)
+	}
+	if err := generateSchema(cfg, filepath.Join(dir, "schema.fbs")); err != nil {
+		t.Fatalf("generateSchema: %v", err)
+	}
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		return string(b)
+	}
+
+	for file, wants := range map[string][]string{
+		"server.go": {"case 147: // Later", "case 142: // First", "case 143: // Free", "UserEnd:    148,"},
+		"xll_main.cpp": {
+			"(shm::MsgType)147,", "(shm::MsgType)142,", "(shm::MsgType)143,",
+			"MSG_USER_START, MSG_USER_START + 6);",
+		},
+		"client.go":  {`"Later", shm.MsgType(147)`, `"First", shm.MsgType(142)`, `"Free", shm.MsgType(143)`},
+		"schema.fbs": {"// function Later = 5\n", "// function First = 0\n", "// function Free = 1\n"},
+	} {
+		src := read(file)
+		for _, want := range wants {
+			if !strings.Contains(src, want) {
+				t.Errorf("%s lacks %q", file, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+// TestGenerateFuzzTests checks gen.go.fuzz emits a parseable fuzz_test.go
+// with a target for each sync/async function and none for an rtd one, and
+// that turning the option off removes the file again.
+func TestGenerateFuzzTests(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Project: config.ProjectConfig{Name: "FuzzProj", Version: "0.1.0"},
+		Gen:     config.GenConfig{Go: config.GoConfig{Fuzz: true}},
+		Functions: []config.Function{
+			{Name: "Add", Args: []config.Arg{{Name: "a", Type: "int"}, {Name: "b", Type: "int"}}, Return: "int"},
+			{Name: "When", Args: []config.Arg{{Name: "d", Type: "date"}, {Name: "g", Type: "grid"}}, Return: "grid", Caller: true},
+			{Name: "Half", Mode: "async", Async: true, Args: []config.Arg{{Name: "x", Type: "float"}}, Return: "float"},
+			{Name: "Ticker", Mode: "rtd", Args: []config.Arg{{Name: "sym", Type: "string"}}, Return: "float"},
+		},
+	}
+	config.ApplyDefaults(cfg)
+
+	wrote, err := generateFuzzTests(cfg, dir)
+	if err != nil || !wrote {
+		t.Fatalf("generateFuzzTests = (%v, %v), want the file written", wrote, err)
+	}
+	path := filepath.Join(dir, "fuzz_test.go")
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		t.Fatalf("generated fuzz_test.go does not parse: %v", err)
+	}
+	funcs := map[string]bool{}
+	for name, obj := range file.Scope.Objects {
+		if obj.Kind.String() == "func" {
+			funcs[name] = true
+		}
+	}
+	for _, want := range []string{"FuzzAdd", "FuzzWhen", "FuzzHalf"} {
+		if !funcs[want] {
+			t.Errorf("no %s in the generated fuzz tests", want)
+		}
+	}
+	if funcs["FuzzTicker"] {
+		t.Error("an rtd function got a fuzz test; it has no request to fuzz")
+	}
+
+	cfg.Gen.Go.Fuzz = false
+	if wrote, err := generateFuzzTests(cfg, dir); err != nil || wrote {
+		t.Fatalf("generateFuzzTests with fuzz off = (%v, %v)", wrote, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("fuzz_test.go survived turning gen.go.fuzz off (stat: %v)", err)
+	}
+}
+
+// TestGenServer_AsyncDecodesBeforeAck: an async request is decoded on the
+// guarded dispatch, with a malformed one answered SYSTEM_ERROR, before the job
+// is submitted and the ACK sent. Decoded in the job, a bad frame was ACKed
+// and its cell never got a result.
+func TestGenServer_AsyncDecodesBeforeAck(t *testing.T) {
+	cfg := &config.Config{
+		Project: config.ProjectConfig{Name: "FuzzProj", Version: "0.1.0"},
+		Functions: []config.Function{
+			{Name: "Half", Mode: "async", Async: true, Args: []config.Arg{{Name: "x", Type: "float"}, {Name: "v", Type: "any"}}, Return: "float"},
+		},
+	}
+	config.ApplyDefaults(cfg)
+	srv := renderTemplate(t, "server.go.tmpl", serverDataFor(cfg))
+	assertParses(t, "server.go", srv)
+
+	decode := strings.Index(srv, `server.DecodeSafely("Half request", func() {`)
+	refuse := strings.Index(srv, "return 0, shm.MsgTypeSystemError")
+	submit := strings.Index(srv, "jobPool.Submit(func() {\n                    defer cancel()\n                    run(ctx, handler)")
+	ack := strings.Index(srv, `log.Debug("Sending ACK", "func", "Half")`)
+	if decode < 0 || refuse < 0 || submit < 0 || ack < 0 {
+		t.Fatalf("async dispatch case not found (decode %d, refuse %d, submit %d, ack %d):\n%s", decode, refuse, submit, ack, srv)
+	}
+	if !(decode < refuse && refuse < submit && submit < ack) {
+		t.Errorf("async dispatch must decode, refuse a bad frame, then submit and ACK; got offsets %d, %d, %d, %d", decode, refuse, submit, ack)
+	}
+
+	// The job gets the decoded call only; it must not decode the request.
+	fn := srv[strings.Index(srv, "func decodeHalf("):]
+	body := fn[strings.Index(fn, "return func(ctx context.Context, handler XllService) {"):]
+	if strings.Contains(body, "GetRootAsHalfRequest") || strings.Contains(body, "refCache.Get") {
+		t.Error("the async job decodes the request; the decode must happen before the ACK")
+	}
+}
@@ -1,6 +1,9 @@
 package generator
 
 import (
+	"errors"
+	"io/fs"
+	"os"
 	"path/filepath"
 
 	"github.com/xll-gen/xll-gen/internal/config"
@@ -43,6 +46,44 @@ func generateInterface(cfg *config.Config, dir string, modName string) error {
 	return executeTemplate("interface.go.tmpl", filepath.Join(dir, "interface.go"), data, GetCommonFuncMap())
 }
 
+// generateClient generates the typed in-process client (client.go): one
+// method per sync and async function, which builds the ipc request, runs it
+// through the generated dispatch and decodes the reply. It is written only
+// with gen.go.client set; otherwise a previous run's file is removed, since
+// it would pull pkg/xllhost into every server built from the package.
+//
+// Parameters:
+//   - cfg: The project configuration.
+//   - dir: The directory where the file should be generated.
+//   - modName: The Go module name of the project.
+//
+// Returns:
+//   - bool: Whether the file was written.
+//   - error: An error if generation fails.
+func generateClient(cfg *config.Config, dir string, modName string) (bool, error) {
+	path := filepath.Join(dir, "client.go")
+	if !cfg.Gen.Go.Client {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	data := struct {
+		Package   string
+		ModName   string
+		Functions []config.Function
+		Version   string
+	}{
+		Package:   cfg.GoPackage(),
+		ModName:   modName,
+		Functions: cfg.Functions,
+		Version:   version.Version,
+	}
+
+	return true, executeTemplate("client.go.tmpl", path, data, GetCommonFuncMap())
+}
+
 // generateServer generates the Go server implementation (server.go).
 // It includes the main loop, IPC handling, and dispatching to the user's handler.
 //
@@ -58,32 +99,71 @@ func generateServer(cfg *config.Config, dir string, modName string) error {
 	pkg := cfg.GoPackage()
 
 	data := struct {
-		Package       string
-		ModName       string
-		ProjectName   string
-		Functions     []config.Function
-		Events        []config.Event
-		Commands      []config.Command
-		ServerTimeout string
-		ServerWorkers int
-		Version       string
-		Logging       config.LoggingConfig
-		Rtd           config.RtdConfig
-		Chunk         *config.ChunkConfig
+		Package        string
+		ModName        string
+		ProjectName    string
+		ProjectVersion string
+		Functions      []config.Function
+		Events         []config.Event
+		Commands       []config.Command
+		ServerTimeout  string
+		ServerWorkers  int
+		Version        string
+		Logging        config.LoggingConfig
+		Rtd            config.RtdConfig
+		Chunk          *config.ChunkConfig
+		RecordDir      string
 	}{
-		Package:       pkg,
-		ModName:       modName,
-		ProjectName:   cfg.Project.Name,
-		Functions:     cfg.Functions,
-		Events:        cfg.Events,
-		Commands:      cfg.Commands,
-		ServerTimeout: cfg.Server.Timeout,
-		ServerWorkers: cfg.Server.Workers,
-		Version:       version.Version,
-		Logging:       cfg.Logging,
-		Rtd:           cfg.Rtd,
-		Chunk:         cfg.Server.Chunk,
+		Package:        pkg,
+		ModName:        modName,
+		ProjectName:    cfg.Project.Name,
+		ProjectVersion: cfg.Project.Version,
+		Functions:      cfg.Functions,
+		Events:         cfg.Events,
+		Commands:       cfg.Commands,
+		ServerTimeout:  cfg.Server.Timeout,
+		ServerWorkers:  cfg.Server.Workers,
+		Version:        version.Version,
+		Logging:        cfg.Logging,
+		Rtd:            cfg.Rtd,
+		Chunk:          cfg.Server.Chunk,
+		RecordDir:      cfg.Server.RecordDir,
 	}
 
 	return executeTemplate("server.go.tmpl", filepath.Join(dir, "server.go"), data, GetCommonFuncMap())
 }
+
+// generateFuzzTests generates fuzz_test.go, a fuzz test per sync/async
+// function, when gen.go.fuzz is set. Otherwise it removes the file a previous
+// run left, so turning the option off does not leave tests against a stale
+// function list behind. A project whose functions are all rtd-like has no
+// request to fuzz and gets no file either.
+//
+// Parameters:
+//   - cfg: The project configuration.
+//   - dir: The directory where the file should be generated.
+//
+// Returns:
+//   - bool: Whether the file was written.
+//   - error: An error if generation fails.
+func generateFuzzTests(cfg *config.Config, dir string) (bool, error) {
+	path := filepath.Join(dir, "fuzz_test.go")
+	if !cfg.Gen.Go.Fuzz || !config.AnyNonRtdLike(cfg.Functions) {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	data := struct {
+		Package   string
+		Functions []config.Function
+		Version   string
+	}{
+		Package:   cfg.GoPackage(),
+		Functions: cfg.Functions,
+		Version:   version.Version,
+	}
+
+	return true, executeTemplate("fuzz_test.go.tmpl", path, data, GetCommonFuncMap())
+}
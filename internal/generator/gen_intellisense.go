@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+// IntelliSenseNamespace is the Excel-DNA IntelliSense descriptor schema.
+const IntelliSenseNamespace = "http://schemas.excel-dna.net/intellisense/1.0"
+
+// IntelliSenseFile is the descriptor generate writes to <package>/cpp. The
+// C++ build copies it next to the XLL as <project>.intellisense.xml, the name
+// the Excel-DNA IntelliSense add-in looks for beside every loaded XLL.
+const IntelliSenseFile = "intellisense.xml"
+
+type intelliSense struct {
+	XMLName   xml.Name               `xml:"IntelliSense"`
+	Xmlns     string                 `xml:"xmlns,attr"`
+	Functions []intelliSenseFunction `xml:"FunctionInfo>Function"`
+}
+
+type intelliSenseFunction struct {
+	Name        string                 `xml:"Name,attr"`
+	Description string                 `xml:"Description,attr,omitempty"`
+	HelpTopic   string                 `xml:"HelpTopic,attr,omitempty"`
+	Args        []intelliSenseArgument `xml:"Argument"`
+}
+
+type intelliSenseArgument struct {
+	Name        string `xml:"Name,attr"`
+	Description string `xml:"Description,attr,omitempty"`
+}
+
+// generateIntelliSense writes the Excel-DNA IntelliSense descriptor: for each
+// worksheet function, the same description, help topic and argument help the
+// XLL passes to xlfRegister, which Excel only shows in the function wizard.
+// With ExcelDna.IntelliSense loaded, they appear as in-cell tooltips while the
+// formula is typed.
+func generateIntelliSense(cfg *config.Config, dir string) error {
+	doc := intelliSense{Xmlns: IntelliSenseNamespace}
+	for _, fn := range cfg.Functions {
+		f := intelliSenseFunction{Name: fn.Name, Description: fn.Description, HelpTopic: fn.HelpTopic}
+		for _, a := range fn.Args {
+			f.Args = append(f.Args, intelliSenseArgument{Name: a.Name, Description: a.Description})
+		}
+		doc.Functions = append(doc.Functions, f)
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	content := xml.Header + "<!-- Code generated by xll-gen. DO NOT EDIT. -->\n" + string(out) + "\n"
+	return os.WriteFile(filepath.Join(dir, IntelliSenseFile), []byte(content), 0644)
+}
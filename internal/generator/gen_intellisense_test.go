@@ -0,0 +1,61 @@
+package generator
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/templates"
+)
+
+// TestGenerateIntelliSense checks the descriptor carries every function with
+// its description, help topic and argument help, escaped, in the Excel-DNA
+// schema, and that the CMake build installs it next to the XLL.
+func TestGenerateIntelliSense(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Project: config.ProjectConfig{Name: "TipProj", Version: "0.1.0"},
+		Functions: []config.Function{
+			{Name: "Scale", Description: `Multiplies x by k ("<fast>" & exact)`, HelpTopic: "https://example.com/scale!0",
+				Args: []config.Arg{{Name: "x", Type: "float", Description: "Value"}, {Name: "k", Type: "float"}}, Return: "float"},
+			{Name: "Now2", Return: "date"},
+		},
+	}
+	config.ApplyDefaults(cfg)
+
+	if err := generateIntelliSense(cfg, dir); err != nil {
+		t.Fatalf("generateIntelliSense: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, IntelliSenseFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc intelliSense
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("descriptor does not parse: %v\n%s", err, data)
+	}
+	if doc.XMLName.Space != IntelliSenseNamespace || len(doc.Functions) != 2 {
+		t.Fatalf("descriptor = %+v", doc)
+	}
+	scale := doc.Functions[0]
+	if scale.Name != "Scale" || scale.Description != cfg.Functions[0].Description ||
+		scale.HelpTopic != "https://example.com/scale!0" || len(scale.Args) != 2 ||
+		scale.Args[0] != (intelliSenseArgument{Name: "x", Description: "Value"}) || scale.Args[1].Name != "k" {
+		t.Errorf("Scale = %+v", scale)
+	}
+	if now := doc.Functions[1]; now.Name != "Now2" || len(now.Args) != 0 {
+		t.Errorf("Now2 = %+v", now)
+	}
+
+	cmake, err := templates.Get("CMakeLists.txt.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cmake, `${CMAKE_CURRENT_SOURCE_DIR}/`+IntelliSenseFile) ||
+		!strings.Contains(cmake, "${PROJECT_NAME}.intellisense.xml") {
+		t.Error("CMakeLists.txt.tmpl does not copy the descriptor next to the XLL")
+	}
+}
@@ -0,0 +1,47 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+// TestServerTmpl_DiskMemoizeWiring pins memoize_store: "disk": the store is
+// opened once with the project.version salt, and only the disk functions'
+// handlers are wrapped — keyed by the same \x1f-joined once-key the C++
+// wrapper uses, with memoize_ttl carried as the max age.
+func TestServerTmpl_DiskMemoizeWiring(t *testing.T) {
+	data := newSrvChunkData(nil)
+	data.ProjectVersion = "2.1.0"
+	data.Logging = config.LoggingConfig{Dir: "${TEMP}/logs"}
+	data.Rtd = config.RtdConfig{Enabled: true, ProgID: "P.Rtd", MemoizeMaxBytes: 1 << 20}
+	data.Functions = []config.Function{
+		{Name: "Calib", Mode: "rtd-once", Return: "float", Memoize: true, MemoizeStore: "disk", Args: []config.Arg{{Name: "x", Type: "float"}}},
+		{Name: "Surface", Mode: "rtd-once", Return: "grid", MemoizeTTL: "1h", MemoizeStore: "disk", Args: []config.Arg{{Name: "x", Type: "float"}}, Retry: &config.RetryConfig{Attempts: 2}},
+		{Name: "Quick", Mode: "rtd-once", Return: "float", Memoize: true, Args: []config.Arg{{Name: "x", Type: "float"}}},
+	}
+	out := renderTemplate(t, "server.go.tmpl", data)
+	assertParses(t, "server.go", out)
+
+	for _, want := range []string{
+		"var memoStore *rtd.DiskMemo",
+		`rtd.OpenDiskMemo(server.RtdMemoizeDir("${TEMP}/logs", "", "chunkcfg"), "2.1.0", 1048576)`,
+		`return rtd.RunOnce(ctx, rtd.GlobalRtd, topicID, memoStore.WrapValue(strings.Join(args, "\x1f"), time.Duration(0), func(ctx context.Context) (interface{}, error) {`,
+		`return rtd.RunOnceGrid(ctx, rtd.GlobalRtd, topicID, onceKey, memoStore.WrapGrid(onceKey, time.Duration(3600000000000), func(ctx context.Context) ([]byte, error) {`,
+		`return rtd.RunOnce(ctx, rtd.GlobalRtd, topicID, func(ctx context.Context) (interface{}, error) {`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered server.go missing %q", want)
+		}
+	}
+	if strings.Count(out, "memoStore.Wrap") != 2 {
+		t.Errorf("want exactly the two disk functions wrapped, got %d", strings.Count(out, "memoStore.Wrap"))
+	}
+
+	data.Functions[0].MemoizeStore = ""
+	data.Functions[1].MemoizeStore = ""
+	if out := renderTemplate(t, "server.go.tmpl", data); strings.Contains(out, "memoStore") {
+		t.Error("memoStore emitted with no disk functions")
+	}
+}
@@ -0,0 +1,26 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestServerTmpl_RecordDirWiring pins server.record_dir reaching record.Start
+// in the generated Serve. It is the one server template test that sets
+// RecordDir; every other mirror leaves the field out and renders the empty
+// dir, which records only when XLLGEN_RECORD_DIR is set.
+func TestServerTmpl_RecordDirWiring(t *testing.T) {
+	data := struct {
+		srvChunkData
+		RecordDir string
+	}{newSrvChunkData(nil), "${XLL_DIR}/rec"}
+	out := renderTemplate(t, "server.go.tmpl", data)
+	if want := `record.Start(server.RecordDir("${XLL_DIR}/rec"), "chunkcfg")`; !strings.Contains(out, want) {
+		t.Errorf("server.go does not start recording in record_dir; want %q", want)
+	}
+
+	out = renderTemplate(t, "server.go.tmpl", newSrvChunkData(nil))
+	if want := `record.Start(server.RecordDir(""), "chunkcfg")`; !strings.Contains(out, want) {
+		t.Errorf("data without RecordDir must render the empty dir; want %q", want)
+	}
+}
@@ -0,0 +1,43 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+// TestServerTmpl_RetryWiring pins the per-function retry: block. Each covered
+// path (async dispatch, rtd-once scalar via RunOnce, rtd-once grid via
+// RunOnceGrid) must wrap ONLY the handler call, so the async batcher /
+// SendErrorUpdate / BuildRtdOnceGridResult still see exactly one outcome: the
+// first success or the final failure.
+func TestServerTmpl_RetryWiring(t *testing.T) {
+	r := &config.RetryConfig{Attempts: 3, Backoff: "200ms", RetryOn: []string{"timeout", "*net.OpError"}}
+	data := newSrvChunkData(nil)
+	data.Rtd = config.RtdConfig{Enabled: true, ProgID: "P.Rtd"}
+	data.Functions = []config.Function{
+		{Name: "Quote", Mode: "async", Async: true, Return: "float", Args: []config.Arg{{Name: "sym", Type: "string"}}, Retry: r},
+		{Name: "Price", Mode: "rtd-once", Return: "float", Args: []config.Arg{{Name: "sym", Type: "string"}}, Retry: &config.RetryConfig{Attempts: 2}},
+		{Name: "Curve", Mode: "rtd-once", Return: "grid", Args: []config.Arg{{Name: "sym", Type: "string"}}, Retry: r},
+		{Name: "Plain", Mode: "async", Async: true, Return: "float", Args: []config.Arg{{Name: "sym", Type: "string"}}},
+	}
+	out := renderTemplate(t, "server.go.tmpl", data)
+	assertParses(t, "server.go", out)
+
+	for _, want := range []string{
+		`var retryPolicy_Quote = retry.MustParsePolicy(3, "200ms", "", []string{ "timeout", "*net.OpError" })`,
+		`var retryPolicy_Price = retry.MustParsePolicy(2, "", "", nil)`,
+		`res, err := retry.Do(ctx, "Quote", retryPolicy_Quote, func(ctx context.Context) (float64, error) { return handler.Quote(ctx, arg_sym) })`,
+		`return rtd.RunOnce(ctx, rtd.GlobalRtd, topicID, retry.Wrap("Price", retryPolicy_Price, func(ctx context.Context) (interface{}, error) {`,
+		`v, err := retry.Do(ctx, "Curve", retryPolicy_Curve, func(ctx context.Context) ([][]any, error) { return handler.Curve(ctx , args[1]) })`,
+		`res, err := handler.Plain(ctx, arg_sym)`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered server.go missing %q", want)
+		}
+	}
+	if strings.Contains(out, "retryPolicy_Plain") {
+		t.Error("a function without retry: must not get a policy")
+	}
+}
@@ -20,6 +20,13 @@ func generateSchema(cfg *config.Config, path string) error {
 	return executeTemplate("schema.fbs.tmpl", path, cfg, GetCommonFuncMap())
 }
 
+// RenderSchema returns the schema.fbs that generate would write for cfg, for
+// tools that compare it without touching the project (xll-gen compat).
+func RenderSchema(cfg *config.Config) (string, error) {
+	out, err := expandTemplate("schema.fbs.tmpl", cfg, GetCommonFuncMap())
+	return string(out), err
+}
+
 // generateProtocol writes the static protocol.fbs file.
 // This file contains standard Excel type definitions and system messages.
 //
@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+// TestInterfaceServiceDoubles checks that interface.go carries an
+// UnimplementedXllService and a FakeXllService method for every XllService
+// method, including the lifecycle hooks a project that declares no events
+// still has to implement. The full set (rtd, events, commands, caller) is
+// compiled through the interface golden.
+func TestInterfaceServiceDoubles(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cmds    []config.Command
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "no events, no commands",
+			want: []string{
+				"func (UnimplementedXllService) Sum(context.Context, int32) (res int32, err error)",
+				`return res, fmt.Errorf("Sum: %w", ErrNotImplemented)`,
+				"func (UnimplementedXllService) OnCalculationEnded(context.Context) error {\n\treturn fmt.Errorf(\"OnCalculationEnded: %w\", ErrNotImplemented)\n}",
+				"func (UnimplementedXllService) OnCalculationCanceled(context.Context) error {\n\treturn fmt.Errorf(\"OnCalculationCanceled: %w\", ErrNotImplemented)\n}",
+				"SumFunc func(ctx context.Context, a int32) (int32, error)",
+				"func (f *FakeXllService) Sum(ctx context.Context, a0 int32) (res int32, err error)",
+				`f.record("Sum", a0)`,
+				"func (f *FakeXllService) OnCalculationEnded(ctx context.Context) error",
+				"func (f *FakeXllService) OnCalculationCanceled(ctx context.Context) error",
+			},
+			notWant: []string{"OnRtdConnect", "server.CommandContext"},
+		},
+		{
+			name: "command",
+			cmds: []config.Command{{Name: "Refresh", Handler: "OnRefresh"}},
+			want: []string{
+				"func (UnimplementedXllService) OnRefresh(context.Context, server.CommandContext) error {\n\treturn fmt.Errorf(\"OnRefresh: %w\", ErrNotImplemented)\n}",
+				"OnRefreshFunc func(ctx context.Context, cmd server.CommandContext) error",
+				`f.record("OnRefresh", cmd)`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := renderTemplate(t, "interface.go.tmpl", interfaceData(tc.cmds))
+			assertParses(t, "interface.go", src)
+			for _, w := range tc.want {
+				if !strings.Contains(src, w) {
+					t.Errorf("interface.go lacks %q", w)
+				}
+			}
+			for _, w := range tc.notWant {
+				if strings.Contains(src, w) {
+					t.Errorf("interface.go unexpectedly contains %q", w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/version"
+)
+
+// SumFile is the manifest Generate writes into the generated package: the
+// SHA-256 of every file it rendered, so `xll-gen upgrade` can tell a file
+// edited by hand from one a newer template changes.
+const SumFile = "xll-gen.sum"
+
+// sumFiles are the rendered files outside the owned C++ subtrees, relative to
+// the generated package. flatc's ipc/ output is left out: generate never
+// prunes it, so a project keeps the tables of removed functions, and nobody
+// edits it by hand.
+var sumFiles = []string{
+	"protocol.fbs",
+	"schema.fbs",
+	"interface.go",
+	"server.go",
+	"client.go",
+	"fuzz_test.go",
+	filepath.Join("cpp", "xll_main.cpp"),
+	filepath.Join("cpp", "CMakeLists.txt"),
+	filepath.Join("cpp", IntelliSenseFile),
+}
+
+// sumPaths returns the files of the last Generate under root, relative to
+// root and sorted: Taskfile.yml, sumFiles that exist, and everything in the
+// owned C++ subtrees, which each run prunes and rewrites.
+func sumPaths(cfg *config.Config, root string) ([]string, error) {
+	paths := []string{"Taskfile.yml"}
+	for _, f := range sumFiles {
+		p := filepath.Join(cfg.GoPackage(), f)
+		if _, err := os.Stat(filepath.Join(root, p)); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	for _, sub := range generatedCppSubdirs {
+		dir := filepath.Join(root, cfg.GoPackage(), "cpp", sub)
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if os.IsNotExist(err) && path == dir {
+				return nil
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			paths = append(paths, rel)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// fileSum hashes a file with its line endings normalized, so a CRLF checkout
+// of an untouched file still matches.
+func fileSum(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")))
+	return hex.EncodeToString(h[:]), nil
+}
+
+// generateSum writes SumFile for the files Generate just wrote under root.
+func generateSum(cfg *config.Config, root string) error {
+	paths, err := sumPaths(cfg, root)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Code generated by xll-gen %s. DO NOT EDIT.\n", version.Version)
+	for _, p := range paths {
+		sum, err := fileSum(filepath.Join(root, p))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s  %s\n", sum, filepath.ToSlash(p))
+	}
+	return os.WriteFile(filepath.Join(root, cfg.GoPackage(), SumFile), []byte(b.String()), 0644)
+}
+
+// ReadSum returns the hashes SumFile under root records, keyed by
+// slash-separated path. It returns nil, nil when there is no SumFile: the
+// project was last generated by an xll-gen that did not write one.
+func ReadSum(cfg *config.Config, root string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(root, cfg.GoPackage(), SumFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sums := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, path, ok := strings.Cut(line, "  ")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: malformed line", SumFile, n)
+		}
+		sums[path] = sum
+	}
+	return sums, sc.Err()
+}
+
+// Edited returns the files SumFile under root records whose content has
+// changed since, sorted. A recorded file that is gone is not reported: the
+// next generate writes it again. sums is what ReadSum returned.
+func Edited(root string, sums map[string]string) ([]string, error) {
+	var edited []string
+	for p, want := range sums {
+		got, err := fileSum(filepath.Join(root, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if got != want {
+			edited = append(edited, p)
+		}
+	}
+	sort.Strings(edited)
+	return edited, nil
+}
@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+)
+
+// TestGenerateSum: the sum records the rendered files, not flatc's ipc/
+// output, and Edited reports exactly the files changed since, ignoring a
+// CRLF conversion and a deleted file.
+func TestGenerateSum(t *testing.T) {
+	root := t.TempDir()
+	cfg := &config.Config{Project: config.ProjectConfig{Name: "SumProj"}}
+	config.ApplyDefaults(cfg)
+	write := func(rel, content string) {
+		t.Helper()
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("Taskfile.yml", "version: '3'\n")
+	write("generated/server.go", "package generated\n")
+	write("generated/client.go", "package generated\n")
+	write("generated/cpp/CMakeLists.txt", "project(x)\n")
+	write("generated/cpp/src/xll_log.cpp", "int log;\n")
+	write("generated/ipc/Scale.go", "package ipc\n")
+
+	if err := generateSum(cfg, root); err != nil {
+		t.Fatalf("generateSum: %v", err)
+	}
+	sums, err := ReadSum(cfg, root)
+	if err != nil {
+		t.Fatalf("ReadSum: %v", err)
+	}
+	var got []string
+	for p := range sums {
+		got = append(got, p)
+	}
+	want := []string{"Taskfile.yml", "generated/client.go", "generated/cpp/CMakeLists.txt", "generated/cpp/src/xll_log.cpp", "generated/server.go"}
+	if len(got) != len(want) {
+		t.Fatalf("sum records %v, want %v", got, want)
+	}
+	for _, p := range want {
+		if sums[p] == "" {
+			t.Errorf("sum lacks %s", p)
+		}
+	}
+
+	write("generated/server.go", "package generated\n\n// edited\n")
+	write("generated/cpp/CMakeLists.txt", "project(x)\r\n")
+	if err := os.Remove(filepath.Join(root, "generated", "client.go")); err != nil {
+		t.Fatal(err)
+	}
+	edited, err := Edited(root, sums)
+	if err != nil {
+		t.Fatalf("Edited: %v", err)
+	}
+	if !reflect.DeepEqual(edited, []string{"generated/server.go"}) {
+		t.Errorf("Edited = %v, want [generated/server.go]", edited)
+	}
+
+	if err := os.Remove(filepath.Join(root, "generated", SumFile)); err != nil {
+		t.Fatal(err)
+	}
+	if sums, err := ReadSum(cfg, root); sums != nil || err != nil {
+		t.Errorf("no sum file: got %v, %v; want nil, nil", sums, err)
+	}
+}
@@ -24,6 +24,12 @@ type Options struct {
 
 	// FlatcPath overrides the flatc executable path.
 	FlatcPath string
+
+	// OutputDir, if set, receives everything Generate writes in place of
+	// baseDir, which is then only read (ribbon XML and images). The dependency
+	// update is skipped, since it edits baseDir's go.mod. `generate --check`
+	// renders into a temporary OutputDir and compares.
+	OutputDir string
 }
 
 // Generate orchestrates the entire code generation process.
@@ -47,11 +53,17 @@ func Generate(cfg *config.Config, baseDir string, modName string, opts Options)
 		return fmt.Errorf("failed to resolve absolute path for baseDir: %w", err)
 	}
 	baseDir = absBaseDir
+	outDir := baseDir
+	if opts.OutputDir != "" {
+		if outDir, err = filepath.Abs(opts.OutputDir); err != nil {
+			return fmt.Errorf("failed to resolve absolute path for OutputDir: %w", err)
+		}
+	}
 
 	// gen.go.package names BOTH the generated Go package and its directory /
 	// import-path segment (default "generated"; validated in config.Validate).
 	goPkg := cfg.GoPackage()
-	genDir := filepath.Join(baseDir, goPkg)
+	genDir := filepath.Join(outDir, goPkg)
 	cppDir := filepath.Join(genDir, "cpp")
 	if err := os.MkdirAll(cppDir, 0755); err != nil {
 		return err
@@ -174,12 +186,33 @@ func Generate(cfg *config.Config, baseDir string, modName string, opts Options)
 	}
 	ui.PrintSuccess("Generated", "server.go")
 
+	wroteClient, err := generateClient(cfg, genDir, modName)
+	if err != nil {
+		return err
+	}
+	if wroteClient {
+		ui.PrintSuccess("Generated", "client.go")
+	}
+
+	wroteFuzz, err := generateFuzzTests(cfg, genDir)
+	if err != nil {
+		return err
+	}
+	if wroteFuzz {
+		ui.PrintSuccess("Generated", "fuzz_test.go")
+	}
+
 	shouldAppendPid := !cfg.Gen.DisablePidSuffix && !opts.DisablePidSuffix
 	if err := generateCppMain(cfg, cppDir, shouldAppendPid); err != nil {
 		return err
 	}
 	ui.PrintSuccess("Generated", "xll_main.cpp")
 
+	if err := generateIntelliSense(cfg, cppDir); err != nil {
+		return err
+	}
+	ui.PrintSuccess("Generated", IntelliSenseFile)
+
 	if err := generateRibbonHeaders(cfg, includeDir, baseDir); err != nil {
 		return err
 	}
@@ -193,11 +226,19 @@ func Generate(cfg *config.Config, baseDir string, modName string, opts Options)
 	}
 	ui.PrintSuccess("Generated", "CMakeLists.txt")
 
-	if err := generateTaskfile(cfg, baseDir); err != nil {
+	if err := generateTaskfile(cfg, outDir); err != nil {
 		return err
 	}
 	ui.PrintSuccess("Generated", "Taskfile.yml")
 
+	if err := generateSum(cfg, outDir); err != nil {
+		return err
+	}
+
+	if opts.OutputDir != "" {
+		return nil
+	}
+
 	// Dependencies update
 	if err := updateDependencies(baseDir, opts); err != nil {
 		return err
@@ -212,6 +253,16 @@ func Generate(cfg *config.Config, baseDir string, modName string, opts Options)
 // (conditional) ribbon headers.
 var generatedCppSubdirs = []string{"src", "include", "tools"}
 
+// OwnedPaths returns the files and directories, relative to the project root,
+// that Generate owns wholesale: whatever in them it does not write is deleted.
+func OwnedPaths(cfg *config.Config) []string {
+	var paths []string
+	for _, sub := range generatedCppSubdirs {
+		paths = append(paths, filepath.Join(cfg.GoPackage(), "cpp", sub))
+	}
+	return append(paths, filepath.Join(cfg.GoPackage(), "fuzz_test.go"))
+}
+
 // pruneGeneratedCpp deletes the generated C++ subtrees before they are
 // rewritten, so a file that USED to be emitted does not survive into the build.
 //
@@ -1,5 +1,7 @@
 package generator
 
+import "sort"
+
 // TypeInfo holds the code generation properties for a given type.
 type TypeInfo struct {
 	SchemaType string
@@ -10,11 +12,15 @@ type TypeInfo struct {
 	// a handler, so e.g. "any" is received as *protocol.Any but returned as a
 	// plain Go any that the generated code serializes (see fbany.MapGo).
 	// Empty means "same as GoType".
-	RetGoType  string
-	CppType    string
-	ArgCppType string
-	XllType    string
-	ArgXllType string
+	RetGoType string
+	// ClientGoType is the Go type the generated Client takes for an argument
+	// of this xll.yaml type when it differs from GoType: a caller builds a
+	// plain Go value, and the Client serializes it into the request.
+	ClientGoType string
+	CppType      string
+	ArgCppType   string
+	XllType      string
+	ArgXllType   string
 }
 
 // typeRegistry serves as the central source of truth for type properties.
@@ -55,6 +61,7 @@ var typeRegistry = map[string]TypeInfo{
 	"range": {
 		SchemaType:      "protocol.Range",
 		GoType:          "*protocol.Range",
+		ClientGoType:    "*protocol.RangeT",
 		CppType:         "LPXLOPER12",
 		ArgCppType:      "LPXLOPER12",
 		XllType:         "Q",
@@ -66,6 +73,7 @@ var typeRegistry = map[string]TypeInfo{
 		SchemaType:      "protocol.Grid",
 		GoType:          "*protocol.Grid",
 		RetGoType:       "[][]any",
+		ClientGoType:    "[][]any",
 		CppType:         "LPXLOPER12",
 		ArgCppType:      "LPXLOPER12",
 		XllType:         "Q",
@@ -77,6 +85,7 @@ var typeRegistry = map[string]TypeInfo{
 		SchemaType:      "protocol.NumGrid",
 		GoType:          "*protocol.NumGrid",
 		RetGoType:       "[][]float64",
+		ClientGoType:    "[][]float64",
 		CppType:         "FP12*",
 		ArgCppType:      "FP12*",
 		XllType:         "K%",
@@ -100,6 +109,7 @@ var typeRegistry = map[string]TypeInfo{
 		SchemaType:      "protocol.Any",
 		GoType:          "*protocol.Any",
 		RetGoType:       "any",
+		ClientGoType:    "any",
 		CppType:         "LPXLOPER12",
 		ArgCppType:      "LPXLOPER12",
 		XllType:         "Q",
@@ -132,6 +142,15 @@ func LookupRetGoType(t string) string {
 	return LookupGoType(t)
 }
 
+// LookupClientGoType returns the Go type the generated Client takes for an
+// argument of the given xll.yaml type. Falls back to LookupGoType.
+func LookupClientGoType(t string) string {
+	if info, ok := typeRegistry[t]; ok && info.ClientGoType != "" {
+		return info.ClientGoType
+	}
+	return LookupGoType(t)
+}
+
 // LookupCppType returns the C++ type for the given xll.yaml type (used for returns).
 func LookupCppType(t string) string {
 	if info, ok := typeRegistry[t]; ok && info.CppType != "" {
@@ -164,3 +183,37 @@ func LookupArgXllType(t string) string {
 	return t
 }
 
+
+// TypeForGoArg is the inverse of LookupGoType: it returns the xll.yaml type
+// whose handler argument has Go type goType (e.g. "*protocol.Grid" -> "grid"),
+// and false when no xll.yaml type maps to it.
+func TypeForGoArg(goType string) (string, bool) {
+	for _, t := range registeredTypes() {
+		if LookupGoType(t) == goType {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// TypeForGoReturn is the inverse of LookupRetGoType: it returns the xll.yaml
+// type a handler returning Go type goType declares (e.g. "[][]any" -> "grid").
+func TypeForGoReturn(goType string) (string, bool) {
+	for _, t := range registeredTypes() {
+		if LookupRetGoType(t) == goType {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// registeredTypes returns the xll.yaml type names in sorted order, so the
+// inverse lookups do not depend on map iteration.
+func registeredTypes() []string {
+	names := make([]string, 0, len(typeRegistry))
+	for t := range typeRegistry {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,18 @@
+package generator
+
+import "testing"
+
+// TestTypeForGo: the inverse lookups round-trip every registered type.
+func TestTypeForGo(t *testing.T) {
+	for _, typ := range registeredTypes() {
+		if got, ok := TypeForGoArg(LookupGoType(typ)); !ok || got != typ {
+			t.Errorf("TypeForGoArg(%q) = %q, %v; want %q", LookupGoType(typ), got, ok, typ)
+		}
+		if got, ok := TypeForGoReturn(LookupRetGoType(typ)); !ok || got != typ {
+			t.Errorf("TypeForGoReturn(%q) = %q, %v; want %q", LookupRetGoType(typ), got, ok, typ)
+		}
+	}
+	if _, ok := TypeForGoArg("uint8"); ok {
+		t.Error("uint8 must not map to an xll.yaml type")
+	}
+}
@@ -21,9 +21,23 @@ import (
 //
 // Output bytes are unchanged; only the failure mode is.
 func executeTemplate(tmplName string, destPath string, data interface{}, funcMap template.FuncMap) error {
+	out, err := expandTemplate(tmplName, data, funcMap)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(destPath, out, 0644); err != nil {
+		return fmt.Errorf("failed to create file %s: %w", destPath, err)
+	}
+
+	return nil
+}
+
+// expandTemplate renders a template from the templates package into memory.
+func expandTemplate(tmplName string, data interface{}, funcMap template.FuncMap) ([]byte, error) {
 	tmplContent, err := templates.Get(tmplName)
 	if err != nil {
-		return fmt.Errorf("failed to get template %s: %w", tmplName, err)
+		return nil, fmt.Errorf("failed to get template %s: %w", tmplName, err)
 	}
 
 	tmpl := template.New(tmplName)
@@ -33,17 +47,12 @@ func executeTemplate(tmplName string, destPath string, data interface{}, funcMap
 
 	parsedTmpl, err := tmpl.Parse(string(tmplContent))
 	if err != nil {
-		return fmt.Errorf("failed to parse template %s: %w", tmplName, err)
+		return nil, fmt.Errorf("failed to parse template %s: %w", tmplName, err)
 	}
 
 	var buf bytes.Buffer
 	if err := parsedTmpl.Execute(&buf, data); err != nil {
-		return fmt.Errorf("failed to execute template %s: %w", tmplName, err)
+		return nil, fmt.Errorf("failed to execute template %s: %w", tmplName, err)
 	}
-
-	if err := os.WriteFile(destPath, buf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to create file %s: %w", destPath, err)
-	}
-
-	return nil
+	return buf.Bytes(), nil
 }
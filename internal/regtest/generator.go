@@ -26,10 +26,13 @@ func generateSimMain(cfg *config.Config, dir string) error {
 		// template had to write a number, and the number it wrote (11) was both
 		// wrong and transport-reserved.
 		"MsgUserStart": func() int { return msgid.MsgUserStart },
+		// msgID mirrors internal/generator's msgID: a function's message ID
+		// is MsgUserStart plus its ID (id:, xll.lock, or its position).
+		"msgID": func(i int, fn config.Function) int { return msgid.MsgUserStart + fn.MsgOffset(i) },
 		// isRtdLike gates the per-function probe block. It MUST answer the same
 		// way internal/generator's funcmap does, because the probe is only
 		// meaningful for a function the generated Go dispatch has a
-		// `case MsgUserStart+i` for — hence the shared config.IsRtdLike SSOT
+		// `case <msgID>` for — hence the shared config.IsRtdLike SSOT
 		// rather than a second copy of the predicate here.
 		"isRtdLike": config.IsRtdLike,
 		// anyNonRtdLike answers "does this project have ANY function this host
@@ -0,0 +1,107 @@
+package regtest
+
+import (
+	"bufio"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/internal/assets"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	userStartDefineRe = regexp.MustCompile(`(?m)^#define\s+MSG_USER_START\s+(\d+)\s*$`)
+	mockBuilderRe     = regexp.MustCompile(`\bipc::(\w+)RequestBuilder\b`)
+	mockSendIDRe      = regexp.MustCompile(`\(shm::MsgType\)\s*(\d+)|\badd_msg_type\(\s*(\d+)\s*\)`)
+	mockCommentIDRe   = regexp.MustCompile(`//.*?\b(\w+)(?: request)? \(ID (\d+)\)`)
+)
+
+// TestMockHostSendsFunctionIDs pins every user-function message ID the
+// hand-written regtest fixture (testdata/mock_host.cpp) puts on the wire.
+//
+// The fixture hardcodes its IDs, and TestGenerateSimMainSendsMsgUserStartIDs
+// does not look at it. When MSG_USER_START moved to 142 the literals were
+// shifted only up to 149, so ScheduleMultiCmd went out on ScheduleFormatCmd's
+// 151 and the ErrEmpty* cases each ran the function before them. TestRegression
+// stayed green because the cross-wired handlers happened to answer what the
+// assertions expected.
+//
+// Nothing here is a literal: MSG_USER_START is read from the xll_ipc.h that
+// ships into the generated XLL and each function's offset from the fixture's
+// own xll.yaml. Each user-range ID the fixture sends (or names as a chunk's
+// dispatch target) must belong to the request it built last, and every
+// "<Function> (ID n)" comment must agree with the wire.
+func TestMockHostSendsFunctionIDs(t *testing.T) {
+	files, err := assets.Assets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := userStartDefineRe.FindStringSubmatch(files["include/xll_ipc.h"])
+	if m == nil {
+		t.Fatal("include/xll_ipc.h has no #define MSG_USER_START")
+	}
+	userStart, _ := strconv.Atoi(m[1])
+
+	// Only the function list matters here, so decode leniently: the fixture's
+	// unrelated keys are TestRegression's business, not this gate's.
+	var cfg config.Config
+	if err := yaml.Unmarshal([]byte(XllYaml), &cfg); err != nil {
+		t.Fatalf("parse testdata/xll.yaml: %v", err)
+	}
+	ids := make(map[string]int, len(cfg.Functions))
+	names := make(map[int]string, len(cfg.Functions))
+	for i, fn := range cfg.Functions {
+		id := userStart + fn.MsgOffset(i)
+		ids[fn.Name] = id
+		names[id] = fn.Name
+	}
+
+	sent := make(map[string]bool)
+	last := ""
+	sc := bufio.NewScanner(strings.NewReader(MockHostCpp))
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if c := mockCommentIDRe.FindStringSubmatch(text); c != nil {
+			if want, ok := ids[c[1]]; ok {
+				if got, _ := strconv.Atoi(c[2]); got != want {
+					t.Errorf("mock_host.cpp:%d: comment says %s is ID %d, but MSG_USER_START (%d) + its xll.yaml index is %d",
+						line, c[1], got, userStart, want)
+				}
+			}
+		}
+		if b := mockBuilderRe.FindStringSubmatch(text); b != nil {
+			last = b[1]
+		}
+		for _, s := range mockSendIDRe.FindAllStringSubmatch(text, -1) {
+			got, _ := strconv.Atoi(s[1] + s[2])
+			if got < userStart {
+				continue
+			}
+			want, ok := ids[last]
+			switch {
+			case last == "":
+				t.Errorf("mock_host.cpp:%d: sends user message ID %d (%s) before building any request", line, got, names[got])
+			case !ok:
+				t.Errorf("mock_host.cpp:%d: built %sRequest, which is not a function in testdata/xll.yaml", line, last)
+			case got != want:
+				t.Errorf("mock_host.cpp:%d: sends %sRequest on ID %d, which is %q; %s is MSG_USER_START (%d) + %d = %d",
+					line, last, got, names[got], last, userStart, want-userStart, want)
+			default:
+				sent[last] = true
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fn := range cfg.Functions {
+		if !sent[fn.Name] {
+			t.Errorf("mock_host.cpp never sends %s on its ID %d; either the call shape drifted away from what this gate can read or the case was dropped",
+				fn.Name, ids[fn.Name])
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/xll-gen/xll-gen/internal/config"
 	"github.com/xll-gen/xll-gen/internal/platform"
+	"github.com/xll-gen/xll-gen/pkg/server"
 )
 
 // Run orchestrates the regression testing process.
@@ -118,6 +119,8 @@ func runSimulation(cfg *config.Config, simDir, serverPath string) error {
 	// Start Go Server
 	fmt.Println("[6/6] Starting Go Server...")
 	serverCmd := exec.Command(serverPath, "-xll-shm="+cfg.Project.Name)
+	// The mock host calls functions without the XLL's connect handshake.
+	serverCmd.Env = append(os.Environ(), server.HandshakeEnvVar+"=optional")
 	serverCmd.Stdout = os.Stdout
 	serverCmd.Stderr = os.Stderr
 	if err := serverCmd.Start(); err != nil {
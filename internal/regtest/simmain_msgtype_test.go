@@ -25,7 +25,7 @@ var simSendRe = regexp.MustCompile(`slot\.Send\([^;]*?\(shm::MsgType\)\s*\(?\s*(
 // Why this test exists at all (2026-08-03): the simulation host emitted
 // `(shm::MsgType)(11 + i)` while the product — the generated XLL
 // (`xll_main.cpp.tmpl`) and the generated Go dispatch switch
-// (`server.go.tmpl`) — has used `MsgUserStart + i` = 140 + i since
+// (`server.go.tmpl`) — has used `MsgUserStart + i` (142 + i today) since
 // MSG_USER_START moved. The simulator and the product therefore disagreed
 // about the protocol, and 11/13/14 are additionally TRANSPORT-RESERVED
 // (`shm::MsgType::GUEST_CALL` / `STREAM_START` / `STREAM_CHUNK`, all below
@@ -34,8 +34,9 @@ var simSendRe = regexp.MustCompile(`slot\.Send\([^;]*?\(shm::MsgType\)\s*\(?\s*(
 // Nothing noticed, because NOTHING RENDERS THIS TEMPLATE in the test suite:
 // cmd/regression_test.go::TestRegression writes the hand-written fixture
 // `internal/regtest/testdata/mock_host.cpp` (embedded as regtest.MockHostCpp)
-// as the simulation main.cpp, and that fixture hardcodes 140, 141, 142 …
-// (AGENTS.md §18.5). `regtest_main.cpp.tmpl` is reachable only through
+// as the simulation main.cpp, and that fixture hardcodes 142, 143, 144 …
+// (AGENTS.md §18.5; TestMockHostSendsFunctionIDs checks those literals).
+// `regtest_main.cpp.tmpl` is reachable only through
 // `regtest.Run()`, i.e. the `xll-gen regtest` subcommand, which is behind
 // `//go:build regtest` and is built by nothing in the suite. TestRegression is
 // green no matter what this template says — it is not a gate on it.
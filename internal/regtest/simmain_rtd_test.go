@@ -78,7 +78,7 @@ func testSimMainMixed(t *testing.T) {
 	if len(matches) != 2 {
 		t.Fatalf("want 2 probes (Alpha, Omega), got %d:\n%s", len(matches), content)
 	}
-	wantIDs := []string{"140", "143"}
+	wantIDs := []string{"142", "145"}
 	for i, m := range matches {
 		if m[1] != wantIDs[i] {
 			t.Errorf("probe %d sends msgType %s, want %s (index must stay the position in the FULL function list)", i, m[1], wantIDs[i])
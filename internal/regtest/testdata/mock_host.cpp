@@ -50,7 +50,7 @@ int main(int argc, char* argv[]) {
 
     flatbuffers::FlatBufferBuilder builder(1024);
 
-    // 1. EchoInt (ID 140)
+    // 1. EchoInt (ID 142)
     vector<int32_t> intCases = {0, 1, -1, 2147483647, (int32_t)-2147483648LL};
     for (size_t i = 0; i < intCases.size(); ++i) {
         auto val = intCases[i];
@@ -67,7 +67,7 @@ int main(int argc, char* argv[]) {
              auto startWait = chrono::steady_clock::now();
              int spin = 0;
              while(chrono::steady_clock::now() - startWait < chrono::seconds(30)) {
-                sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)140, respBuf).ValueOr(-1);
+                sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)142, respBuf).ValueOr(-1);
                 if (sz >= 0) break;
                 if (spin < 1000) {
                     this_thread::yield();
@@ -78,7 +78,7 @@ int main(int argc, char* argv[]) {
                 }
              }
         } else {
-             sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)140, respBuf).ValueOr(-1);
+             sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)142, respBuf).ValueOr(-1);
         }
 
         if (sz < 0) { cerr << "Send failed for EchoInt " << val << endl; return 1; }
@@ -88,7 +88,7 @@ int main(int argc, char* argv[]) {
         ASSERT_EQ(val, resp->result(), "EchoInt");
     }
 
-    // 2. EchoFloat (ID 141)
+    // 2. EchoFloat (ID 143)
     vector<double> floatCases = {0.0, 1.5, -999.99};
     for (auto val : floatCases) {
         builder.Reset();
@@ -97,13 +97,13 @@ int main(int argc, char* argv[]) {
         builder.Finish(req.Finish());
 
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)141, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)143, respBuf).ValueOr(-1);
         if (sz < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::EchoFloatResponse>(respBuf.data());
         if (std::abs(val - resp->result()) > 0.0001) { cerr << "Float mismatch" << endl; return 1; }
     }
 
-    // 3. EchoString (ID 142)
+    // 3. EchoString (ID 144)
     vector<string> strCases = {"test", "", "Hello World"};
     for (auto val : strCases) {
         builder.Reset();
@@ -113,13 +113,13 @@ int main(int argc, char* argv[]) {
         builder.Finish(req.Finish());
 
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)142, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)144, respBuf).ValueOr(-1);
         if (sz < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::EchoStringResponse>(respBuf.data());
         ASSERT_STREQ(val, resp->result()->str(), "EchoString");
     }
 
-    // 4. EchoBool (ID 143)
+    // 4. EchoBool (ID 145)
     vector<bool> boolCases = {true, false};
     for (auto val : boolCases) {
         builder.Reset();
@@ -128,13 +128,13 @@ int main(int argc, char* argv[]) {
         builder.Finish(req.Finish());
 
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)143, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)145, respBuf).ValueOr(-1);
         if (sz < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::EchoBoolResponse>(respBuf.data());
         ASSERT_EQ(val, resp->result(), "EchoBool");
     }
 
-    // 5. CheckAny (ID 144)
+    // 5. CheckAny (ID 146)
     // Int
     {
         builder.Reset();
@@ -144,7 +144,7 @@ int main(int argc, char* argv[]) {
         req.add_val(any);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)144, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)146, respBuf).ValueOr(-1);
         if (sz < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::CheckAnyResponse>(respBuf.data());
         ASSERT_STREQ("Int:10", resp->result()->str(), "CheckAny Int");
@@ -159,7 +159,7 @@ int main(int argc, char* argv[]) {
         req.add_val(any);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)144, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)146, respBuf).ValueOr(-1);
         if (sz < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::CheckAnyResponse>(respBuf.data());
         ASSERT_STREQ("Str:hello", resp->result()->str(), "CheckAny Str");
@@ -173,7 +173,7 @@ int main(int argc, char* argv[]) {
         req.add_val(any);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)144, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)146, respBuf).ValueOr(-1);
         if (sz < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::CheckAnyResponse>(respBuf.data());
         ASSERT_STREQ("Num:1.5", resp->result()->str(), "CheckAny Num");
@@ -190,7 +190,7 @@ int main(int argc, char* argv[]) {
         req.add_val(any);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)144, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)146, respBuf).ValueOr(-1);
         if (sz < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::CheckAnyResponse>(respBuf.data());
         ASSERT_STREQ("NumGrid:1x2", resp->result()->str(), "CheckAny NumGrid");
@@ -213,13 +213,13 @@ int main(int argc, char* argv[]) {
         req.add_val(any);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)144, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)146, respBuf).ValueOr(-1);
         if (sz < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::CheckAnyResponse>(respBuf.data());
         ASSERT_STREQ("Grid:1x2", resp->result()->str(), "CheckAny Grid");
     }
 
-    // 6. CheckRange (ID 145)
+    // 6. CheckRange (ID 147)
     {
         builder.Reset();
         auto sOff = builder.CreateString("Sheet1");
@@ -230,12 +230,12 @@ int main(int argc, char* argv[]) {
         req.add_val(rangeVal);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)145, respBuf);
+        host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)147, respBuf);
         auto resp = flatbuffers::GetRoot<ipc::CheckRangeResponse>(respBuf.data());
         ASSERT_STREQ("Range:Sheet1!1:1:1:1", resp->result()->str(), "CheckRange");
     }
 
-    // 7. TimeoutFunc (ID 146)
+    // 7. TimeoutFunc (ID 148)
     {
         builder.Reset();
         ipc::TimeoutFuncRequestBuilder req(builder);
@@ -243,14 +243,14 @@ int main(int argc, char* argv[]) {
         builder.Finish(req.Finish());
 
         vector<uint8_t> respBuf;
-        host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)146, respBuf);
+        host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)148, respBuf);
         auto resp = flatbuffers::GetRoot<ipc::TimeoutFuncResponse>(respBuf.data());
 
         // Timeout now returns -1 instead of error
         ASSERT_EQ(-1, resp->result(), "TimeoutFunc");
     }
 
-    // 8. AsyncEchoInt (ID 147)
+    // 8. AsyncEchoInt (ID 149)
     // Async requests have a different flow:
     // 1. Send Request -> Receive ACK (immediately)
     // 2. Poll for BatchAsyncResponse (MSG_ID 128)
@@ -271,7 +271,7 @@ int main(int argc, char* argv[]) {
         vector<uint8_t> respBuf;
 
         // 1. Send Request -> Expect ACK
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)147, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)149, respBuf).ValueOr(-1);
         if (sz < 0) return 1;
         auto ack = flatbuffers::GetRoot<protocol::Ack>(respBuf.data());
         if (!ack->ok()) { cerr << "AsyncEchoInt Ack failed" << endl; return 1; }
@@ -328,14 +328,14 @@ int main(int argc, char* argv[]) {
         if (!received) { cerr << "AsyncEchoInt timed out" << endl; return 1; }
     }
 
-    // 9. CalculationEnded Commands - Set (ID 148)
+    // 9. CalculationEnded Commands - Set (ID 150)
     {
-        // 1. Call ScheduleCmd (ID 148)
+        // 1. Call ScheduleCmd (ID 150)
         builder.Reset();
         ipc::ScheduleCmdRequestBuilder req(builder);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)148, respBuf).ValueOr(-1) < 0) return 1;
+        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)150, respBuf).ValueOr(-1) < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::ScheduleCmdResponse>(respBuf.data());
         if (resp->error() && resp->error()->size() > 0) { cerr << "ScheduleCmd Error: " << resp->error()->str() << endl; }
         cerr << "ScheduleCmd Result: " << resp->result() << endl;
@@ -365,14 +365,14 @@ int main(int argc, char* argv[]) {
         ASSERT_EQ(100, val->val_as_Int()->val(), "SetCommand Val");
     }
 
-    // 10. CalculationEnded Commands - Format (ID 149)
+    // 10. CalculationEnded Commands - Format (ID 151)
     {
-        // 1. Call ScheduleFormatCmd (ID 149)
+        // 1. Call ScheduleFormatCmd (ID 151)
         builder.Reset();
         ipc::ScheduleFormatCmdRequestBuilder req(builder);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)149, respBuf).ValueOr(-1) < 0) return 1;
+        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)151, respBuf).ValueOr(-1) < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::ScheduleFormatCmdResponse>(respBuf.data());
         ASSERT_EQ(1, resp->result(), "ScheduleFormatCmd");
 
@@ -394,14 +394,14 @@ int main(int argc, char* argv[]) {
         ASSERT_STREQ("General", fmtCmd->format()->str(), "FormatCommand Format");
     }
 
-    // 11. CalculationEnded Commands - Multi (ID 150)
+    // 11. CalculationEnded Commands - Multi (ID 152)
     {
-        // 1. Call ScheduleMultiCmd (ID 150)
+        // 1. Call ScheduleMultiCmd (ID 152)
         builder.Reset();
         ipc::ScheduleMultiCmdRequestBuilder req(builder);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)150, respBuf).ValueOr(-1) < 0) return 1;
+        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)152, respBuf).ValueOr(-1) < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::ScheduleMultiCmdResponse>(respBuf.data());
         ASSERT_EQ(2, resp->result(), "ScheduleMultiCmd");
 
@@ -430,14 +430,14 @@ int main(int argc, char* argv[]) {
         }
     }
 
-    // 11. ScheduleMassive (ID 151)
+    // 11. ScheduleMassive (ID 153)
     {
         // 1. Call ScheduleMassive
         builder.Reset();
         ipc::ScheduleMassiveRequestBuilder req(builder);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)151, respBuf).ValueOr(-1) < 0) return 1;
+        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)153, respBuf).ValueOr(-1) < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::ScheduleMassiveResponse>(respBuf.data());
         ASSERT_EQ(100, resp->result(), "ScheduleMassive");
 
@@ -471,14 +471,14 @@ int main(int argc, char* argv[]) {
         ASSERT_EQ(2, count200, "Count 200 commands");
     }
 
-    // 12. ScheduleGridCmd (ID 152)
+    // 12. ScheduleGridCmd (ID 154)
     {
         // 1. Call ScheduleGridCmd
         builder.Reset();
         ipc::ScheduleGridCmdRequestBuilder req(builder);
         builder.Finish(req.Finish());
         vector<uint8_t> respBuf;
-        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)152, respBuf).ValueOr(-1) < 0) return 1;
+        if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)154, respBuf).ValueOr(-1) < 0) return 1;
         auto resp = flatbuffers::GetRoot<ipc::ScheduleGridCmdResponse>(respBuf.data());
         ASSERT_EQ(1, resp->result(), "ScheduleGridCmd");
 
@@ -519,7 +519,7 @@ int main(int argc, char* argv[]) {
         ASSERT_EQ(4, s3->val_as_Int()->val(), "S3 val");
     }
 
-    // 13. CalculationCanceled is a pure NOTIFICATION (ID 130, 132, 131, 144, 148)
+    // 13. CalculationCanceled is a pure NOTIFICATION (ID 130, 132, 131, 146, 150)
     //
     // Measured contract (AGENTS.md §19.4): Excel fires CalculationCanceled and
     // then CalculationEnded 2-6 ms later on the same cycle, so the CANCELED
@@ -553,7 +553,7 @@ int main(int argc, char* argv[]) {
             ipc::CheckAnyRequestBuilder caReq(builder);
             caReq.add_val(anyOff);
             builder.Finish(caReq.Finish());
-            if (host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)144, respBuf).ValueOr(-1) < 0) return string();
+            if (host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)146, respBuf).ValueOr(-1) < 0) return string();
             auto caResp = flatbuffers::GetRoot<ipc::CheckAnyResponse>(respBuf.data());
             return caResp->result()->str();
         };
@@ -592,12 +592,12 @@ int main(int argc, char* argv[]) {
         // OnCalculationCanceled handler) must still be emitted by the Ended
         // flush that arrives a few milliseconds later.
         {
-            // 1. Schedule a Set command (ID 148 -> Sheet1!0:0:0:0 = Int 100).
+            // 1. Schedule a Set command (ID 150 -> Sheet1!0:0:0:0 = Int 100).
             builder.Reset();
             ipc::ScheduleCmdRequestBuilder req(builder);
             builder.Finish(req.Finish());
             vector<uint8_t> schedBuf;
-            if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)148, schedBuf).ValueOr(-1) < 0) return 1;
+            if(host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)150, schedBuf).ValueOr(-1) < 0) return 1;
             auto schedResp = flatbuffers::GetRoot<ipc::ScheduleCmdResponse>(schedBuf.data());
             ASSERT_EQ(1, schedResp->result(), "ScheduleCmd (cancel case)");
 
@@ -713,7 +713,7 @@ int main(int argc, char* argv[]) {
     // 16. Chunked host->guest delivery (MSG_CHUNK = 129) — reassembly contract.
     //
     // This is the end-to-end counterpart to pkg/server/manager_test.go: the
-    // mock host plays the XLL, splitting an EchoString request (ID 142) into
+    // mock host plays the XLL, splitting an EchoString request (ID 144) into
     // protocol::Chunk frames the Go guest's HandleChunk must reassemble before
     // dispatching. It replaces the long-deferred "regtest duplicate-chunk case"
     // (AGENTS.md §23.3 / IMPROVEMENT_BACKLOG R8 residue) and extends it to the
@@ -753,7 +753,7 @@ int main(int argc, char* argv[]) {
             cb.add_total_size(total);
             cb.add_offset(offset);
             cb.add_data(dataOff);
-            cb.add_msg_type(142); // dispatch target once reassembled: EchoString
+            cb.add_msg_type(144); // dispatch target once reassembled: EchoString
             // "XCHN" mirrors pkg/chunk.BuildFrame's file identifier.
             chunkBuilder.Finish(cb.Finish(), "XCHN");
             respBuf.clear();
@@ -917,13 +917,13 @@ int main(int argc, char* argv[]) {
     //
     // FAIL-before: without the normalization error()->size() is 0 here.
     {
-        // 19a. string return (ID 153) — the crash half.
+        // 19a. string return (ID 155) — the crash half.
         builder.Reset();
         ipc::ErrEmptyStringRequestBuilder req(builder);
         builder.Finish(req.Finish());
 
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)153, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)155, respBuf).ValueOr(-1);
         if (sz < 0) { cerr << "FAIL: 19a send failed" << endl; return 1; }
         auto resp = flatbuffers::GetRoot<ipc::ErrEmptyStringResponse>(respBuf.data());
         if (!resp->error()) {
@@ -942,7 +942,7 @@ int main(int argc, char* argv[]) {
         }
     }
     {
-        // 19b. int return (ID 154) — the silent-wrong-answer half. A scalar
+        // 19b. int return (ID 156) — the silent-wrong-answer half. A scalar
         // result cannot be checked for absence (an absent int32 reads back as 0,
         // which is exactly the bug), so the assertion is on the error field: it
         // must be non-empty, which is what keeps the wrapper on the error path.
@@ -951,7 +951,7 @@ int main(int argc, char* argv[]) {
         builder.Finish(req.Finish());
 
         vector<uint8_t> respBuf;
-        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)154, respBuf).ValueOr(-1);
+        int sz = host.Send(builder.GetBufferPointer(), builder.GetSize(), (shm::MsgType)156, respBuf).ValueOr(-1);
         if (sz < 0) { cerr << "FAIL: 19b send failed" << endl; return 1; }
         auto resp = flatbuffers::GetRoot<ipc::ErrEmptyIntResponse>(respBuf.data());
         if (!resp->error() || resp->error()->size() == 0) {
@@ -0,0 +1,596 @@
+// Package scan reads xll-gen functions declared in Go rather than in
+// xll.yaml: the methods of a type marked //xll:service whose doc comment
+// carries an //xll:function directive. Each signature is mapped back to
+// xll.yaml types — the inverse of the XllService interface the generator
+// writes — so the result can be merged into xll.yaml. It backs `xll-gen scan`.
+//
+//	//xll:service
+//	type Service struct{}
+//
+//	// Scale multiplies x by k.
+//	//xll:function mode=async category=Math
+//	func (s *Service) Scale(ctx context.Context, x, k float64) (float64, error)
+//
+// The doc comment becomes the description. A method named <Name>_RTD is the
+// mode:"rtd" function <Name>; a last parameter `caller *protocol.Range` sets
+// caller: true.
+package scan
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/internal/generator"
+)
+
+const (
+	// ServiceDirective marks the type whose methods are scanned.
+	ServiceDirective = "//xll:service"
+	// FunctionDirective marks a method as a worksheet function and carries
+	// its key=value settings.
+	FunctionDirective = "//xll:function"
+
+	protocolPath = "github.com/xll-gen/types/go/protocol"
+)
+
+// directiveKeys are the xll.yaml function keys an //xll:function directive
+// may set, with the kind of their value. name, args and caller come from the
+// signature, and so does return except for a _RTD method (default "any").
+var directiveKeys = map[string]string{
+	"id":                  "int",
+	"description":         "string",
+	"category":            "string",
+	"mode":                "string",
+	"return":              "string",
+	"shortcut":            "string",
+	"help_topic":          "string",
+	"example":             "string",
+	"timeout":             "string",
+	"memoize_ttl":         "string",
+	"memoize_store":       "string",
+	"loading_placeholder": "string",
+	"volatile":            "bool",
+	"resizable":           "bool",
+	"macro":               "bool",
+	"memoize":             "bool",
+}
+
+// Directive is one key=value setting of an //xll:function line. A bare key
+// is a bool set to "true".
+type Directive struct {
+	Key   string
+	Value string
+	// Kind is "string", "bool" or "int".
+	Kind string
+}
+
+// Function is a scanned function.
+type Function struct {
+	config.Function
+	// Directives are the settings of its //xll:function line, in order.
+	Directives []Directive
+	Pos        token.Position
+}
+
+// Problem is a declaration that cannot be mapped to xll.yaml.
+type Problem struct {
+	Pos token.Position
+	Msg string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.Pos.Filename, p.Pos.Line, p.Msg)
+}
+
+// Result is what Scan found.
+type Result struct {
+	// Service is the marked type, as package-directory.Type.
+	Service   string
+	Functions []Function
+	Problems  []Problem
+}
+
+// Dirs expands package patterns to the directories holding Go files: a
+// directory, or dir/... for it and every directory below it except testdata,
+// vendor and those starting with "." or "_".
+func Dirs(patterns []string) ([]string, error) {
+	seen := map[string]bool{}
+	var dirs []string
+	add := func(dir string) {
+		if !seen[dir] && hasGoFiles(dir) {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, p := range patterns {
+		root, recursive := strings.CutSuffix(filepath.ToSlash(p), "/...")
+		if p == "..." {
+			root, recursive = ".", true
+		}
+		root = filepath.Clean(filepath.FromSlash(root))
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", p)
+		}
+		if !recursive {
+			add(root)
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+			name := d.Name()
+			if path != root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			add(path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+func hasGoFiles(dir string) bool {
+	names, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, n := range names {
+		if !strings.HasSuffix(n, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan finds the one type marked //xll:service in dirs and returns its
+// //xll:function methods in declaration order.
+func Scan(dirs []string) (*Result, error) {
+	fset := token.NewFileSet()
+	var res *Result
+	for _, dir := range dirs {
+		files, err := parseDir(fset, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			spec := serviceSpec(f)
+			if spec == nil {
+				continue
+			}
+			if res != nil {
+				return nil, fmt.Errorf("%s: %s is marked %s too; only one service type is scanned",
+					position(fset, spec.Pos()), spec.Name.Name, ServiceDirective)
+			}
+			res = scanService(fset, dir, files, spec.Name.Name)
+		}
+	}
+	if res == nil {
+		return nil, fmt.Errorf("no type marked %s found", ServiceDirective)
+	}
+	return res, nil
+}
+
+// parseDir parses the non-test files of the package in dir.
+func parseDir(fset *token.FileSet, dir string) ([]*ast.File, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// serviceSpec returns the type in f marked //xll:service, if any.
+func serviceSpec(f *ast.File) *ast.TypeSpec {
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			doc := ts.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			if directive(doc, ServiceDirective) != nil {
+				return ts
+			}
+		}
+	}
+	return nil
+}
+
+// directive returns the comment of doc that is the directive name, or nil.
+func directive(doc *ast.CommentGroup, name string) *ast.Comment {
+	if doc == nil {
+		return nil
+	}
+	for _, c := range doc.List {
+		if rest, ok := strings.CutPrefix(c.Text, name); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			return c
+		}
+	}
+	return nil
+}
+
+// scanService type-checks the package in dir and maps the marked methods of
+// service. Imports that do not type-check, such as a generated package not
+// written yet, leave their types unresolved; those are read from the syntax.
+func scanService(fset *token.FileSet, dir string, files []*ast.File, service string) *Result {
+	info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	conf.Check(files[0].Name.Name, fset, files, info)
+
+	res := &Result{Service: filepath.Base(absDir(dir)) + "." + service}
+	for _, f := range files {
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Recv == nil || receiverName(fd) != service {
+				continue
+			}
+			c := directive(fd.Doc, FunctionDirective)
+			if c == nil {
+				continue
+			}
+			s := &scanner{fset: fset, info: info, imports: importNames(f), res: res}
+			if fn, ok := s.function(fd, c); ok {
+				res.Functions = append(res.Functions, fn)
+			}
+		}
+	}
+	return res
+}
+
+func absDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+func receiverName(fd *ast.FuncDecl) string {
+	if len(fd.Recv.List) == 0 {
+		return ""
+	}
+	t := fd.Recv.List[0].Type
+	if s, ok := t.(*ast.StarExpr); ok {
+		t = s.X
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// importNames maps the names f refers to its imports by to their paths.
+func importNames(f *ast.File) map[string]string {
+	m := map[string]string{}
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		m[name] = p
+	}
+	return m
+}
+
+type scanner struct {
+	fset    *token.FileSet
+	info    *types.Info
+	imports map[string]string
+	res     *Result
+	failed  bool
+}
+
+func (s *scanner) problem(pos token.Pos, format string, args ...any) {
+	s.res.Problems = append(s.res.Problems, Problem{Pos: position(s.fset, pos), Msg: fmt.Sprintf(format, args...)})
+	s.failed = true
+}
+
+type param struct {
+	name string
+	typ  string
+	pos  token.Pos
+}
+
+// function maps the method fd, whose //xll:function comment is c.
+func (s *scanner) function(fd *ast.FuncDecl, c *ast.Comment) (Function, bool) {
+	name := fd.Name.Name
+	fn := Function{Pos: position(s.fset, fd.Pos())}
+	fn.Name = name
+	fn.Description = strings.Join(strings.Fields(fd.Doc.Text()), " ")
+
+	directives, err := parseDirective(strings.TrimPrefix(c.Text, FunctionDirective))
+	if err != nil {
+		s.problem(c.Pos(), "%s: %v", name, err)
+		return Function{}, false
+	}
+	for _, d := range directives {
+		if err := apply(&fn.Function, d); err != nil {
+			s.problem(c.Pos(), "%s: %v", name, err)
+		}
+	}
+	fn.Directives = directives
+	fn.Mode = strings.ToLower(fn.Mode)
+
+	var params []param
+	for _, field := range fd.Type.Params.List {
+		t := s.typeOf(field.Type)
+		if len(field.Names) == 0 {
+			params = append(params, param{"", t, field.Pos()})
+		}
+		for _, n := range field.Names {
+			params = append(params, param{n.Name, t, n.Pos()})
+		}
+	}
+	var results []string
+	if fd.Type.Results != nil {
+		for _, field := range fd.Type.Results.List {
+			for range max(1, len(field.Names)) {
+				results = append(results, s.typeOf(field.Type))
+			}
+		}
+	}
+
+	if len(params) == 0 || params[0].typ != "context.Context" {
+		s.problem(fd.Type.Pos(), "%s: the first parameter must be ctx context.Context", name)
+		return Function{}, false
+	}
+	params = params[1:]
+
+	if base, ok := strings.CutSuffix(name, "_RTD"); ok {
+		if fn.Mode != "" && fn.Mode != "rtd" {
+			s.problem(fd.Name.Pos(), "%s: a _RTD method is mode=rtd, not mode=%s", name, fn.Mode)
+		}
+		fn.Name, fn.Mode = base, "rtd"
+		if fn.Return == "" {
+			fn.Return = "any"
+		}
+		if len(params) == 0 || params[0].typ != "int32" {
+			s.problem(fd.Type.Pos(), "%s: the second parameter of a _RTD method must be topicID int32", name)
+			return Function{}, false
+		}
+		params = params[1:]
+		if len(results) != 1 || results[0] != "error" {
+			s.problem(fd.Type.Pos(), "%s: a _RTD method returns only error", name)
+		}
+	} else {
+		if fn.Mode == "rtd" {
+			s.problem(fd.Name.Pos(), "%s: a mode=rtd handler is named %s_RTD(ctx, topicID int32, ...) error", name, name)
+		}
+		if fn.Return != "" {
+			s.problem(c.Pos(), "%s: return comes from the signature; only a _RTD method sets it", name)
+		}
+		if len(results) != 2 || results[1] != "error" {
+			s.problem(fd.Type.Pos(), "%s: must return (value, error)", name)
+		} else if t, ok := generator.TypeForGoReturn(results[0]); ok {
+			fn.Return = t
+		} else {
+			s.problem(fd.Type.Results.Pos(), "%s: unsupported return type %s", name, results[0])
+		}
+		if n := len(params); n > 0 && params[n-1].name == "caller" && params[n-1].typ == "*protocol.Range" {
+			fn.Caller = true
+			params = params[:n-1]
+		}
+	}
+
+	for _, p := range params {
+		if p.name == "" || p.name == "_" {
+			s.problem(p.pos, "%s: every argument needs a name; xll.yaml declares it", name)
+			continue
+		}
+		t, ok := generator.TypeForGoArg(p.typ)
+		if !ok {
+			s.problem(p.pos, "%s: argument %s: unsupported type %s", name, p.name, p.typ)
+			continue
+		}
+		fn.Args = append(fn.Args, config.Arg{Name: p.name, Type: t})
+	}
+	if s.failed {
+		return Function{}, false
+	}
+	return fn, true
+}
+
+// parseDirective splits key=value settings; a value may be a Go string
+// literal to hold spaces.
+func parseDirective(text string) ([]Directive, error) {
+	var out []Directive
+	for text = strings.TrimSpace(text); text != ""; text = strings.TrimSpace(text) {
+		end := strings.IndexAny(text, " \t=")
+		if end < 0 {
+			end = len(text)
+		}
+		key := text[:end]
+		text = text[end:]
+		kind, ok := directiveKeys[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown %s key %q", FunctionDirective, key)
+		}
+		value := "true"
+		if rest, ok := strings.CutPrefix(text, "="); ok {
+			if strings.HasPrefix(rest, `"`) {
+				q, err := strconv.QuotedPrefix(rest)
+				if err != nil {
+					return nil, fmt.Errorf("%s: bad quoted value", key)
+				}
+				value, _ = strconv.Unquote(q)
+				text = rest[len(q):]
+			} else {
+				end := strings.IndexAny(rest, " \t")
+				if end < 0 {
+					end = len(rest)
+				}
+				value, text = rest[:end], rest[end:]
+			}
+		} else if kind != "bool" {
+			return nil, fmt.Errorf("%s needs a value (%s=...)", key, key)
+		}
+		out = append(out, Directive{Key: key, Value: value, Kind: kind})
+	}
+	return out, nil
+}
+
+// apply sets the field of fn that d names.
+func apply(fn *config.Function, d Directive) error {
+	switch d.Kind {
+	case "bool":
+		v, err := strconv.ParseBool(d.Value)
+		if err != nil {
+			return fmt.Errorf("%s=%s: want true or false", d.Key, d.Value)
+		}
+		switch d.Key {
+		case "volatile":
+			fn.Volatile = v
+		case "resizable":
+			fn.Resizable = v
+		case "macro":
+			fn.Macro = v
+		case "memoize":
+			fn.Memoize = v
+		}
+	case "int":
+		v, err := strconv.Atoi(d.Value)
+		if err != nil {
+			return fmt.Errorf("%s=%s: want an integer", d.Key, d.Value)
+		}
+		fn.ID = &v
+	default:
+		switch d.Key {
+		case "description":
+			fn.Description = d.Value
+		case "category":
+			fn.Category = d.Value
+		case "mode":
+			fn.Mode = d.Value
+		case "return":
+			fn.Return = d.Value
+		case "shortcut":
+			fn.Shortcut = d.Value
+		case "help_topic":
+			fn.HelpTopic = d.Value
+		case "example":
+			fn.Example = d.Value
+		case "timeout":
+			fn.Timeout = d.Value
+		case "memoize_ttl":
+			fn.MemoizeTTL = d.Value
+		case "memoize_store":
+			fn.MemoizeStore = d.Value
+		case "loading_placeholder":
+			fn.LoadingPlaceholder = d.Value
+		}
+	}
+	return nil
+}
+
+// typeOf renders the type of e as the generated XllService spells it, e.g.
+// "*protocol.Grid". The type checker's answer is used when it has one, so
+// aliases resolve; otherwise the expression is read as written.
+func (s *scanner) typeOf(e ast.Expr) string {
+	if tv, ok := s.info.Types[e]; ok && tv.Type != nil {
+		t := types.TypeString(unalias(tv.Type), qualifier)
+		if !strings.Contains(t, "invalid type") {
+			return strings.ReplaceAll(t, "interface{}", "any")
+		}
+	}
+	return s.exprType(e)
+}
+
+// unalias resolves aliases in t and in the pointer and slice types it is
+// built from, which is all an xll-gen type is.
+func unalias(t types.Type) types.Type {
+	switch x := types.Unalias(t).(type) {
+	case *types.Pointer:
+		return types.NewPointer(unalias(x.Elem()))
+	case *types.Slice:
+		return types.NewSlice(unalias(x.Elem()))
+	default:
+		return x
+	}
+}
+
+func qualifier(p *types.Package) string {
+	return qualify(p.Path())
+}
+
+// qualify returns the name the generated code imports path under: protocol
+// for the xll-gen types package, and path itself otherwise, which also names
+// time and context.
+func qualify(path string) string {
+	if path == protocolPath {
+		return "protocol"
+	}
+	return path
+}
+
+func (s *scanner) exprType(e ast.Expr) string {
+	switch x := e.(type) {
+	case *ast.StarExpr:
+		return "*" + s.exprType(x.X)
+	case *ast.ArrayType:
+		if x.Len == nil {
+			return "[]" + s.exprType(x.Elt)
+		}
+	case *ast.ParenExpr:
+		return s.exprType(x.X)
+	case *ast.InterfaceType:
+		if len(x.Methods.List) == 0 {
+			return "any"
+		}
+	case *ast.SelectorExpr:
+		if id, ok := x.X.(*ast.Ident); ok {
+			if p, ok := s.imports[id.Name]; ok {
+				return qualify(p) + "." + x.Sel.Name
+			}
+		}
+	}
+	return types.ExprString(e)
+}
+
+// position returns the position of pos with its file name relative to the
+// working directory when that is shorter.
+func position(fset *token.FileSet, pos token.Pos) token.Position {
+	p := fset.Position(pos)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, p.Filename); err == nil && !strings.HasPrefix(rel, "..") {
+			p.Filename = rel
+		}
+	}
+	return p
+}
@@ -0,0 +1,192 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const serviceSrc = `package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/xll-gen/types/go/protocol"
+)
+
+// Matrix is resolved through the alias by the type checker.
+type Matrix = [][]float64
+
+//xll:service
+type Service struct{}
+
+// Scale multiplies x
+// by k.
+//xll:function mode=async category=Math volatile
+func (s *Service) Scale(ctx context.Context, x, k float64) (float64, error) {
+	return x * k, nil
+}
+
+//xll:function description="Identity matrix" id=7
+func (s *Service) Eye(ctx context.Context, n int32, caller *protocol.Range) (Matrix, error) {
+	return nil, nil
+}
+
+//xll:function
+func (s *Service) Quote_RTD(ctx context.Context, topicID int32, symbol string, asOf time.Time) error {
+	return nil
+}
+
+// Helper is not marked, so it is skipped.
+func (s *Service) Helper(ctx context.Context) error { return nil }
+`
+
+const badSrc = `package main
+
+import "context"
+
+//xll:service
+type Service struct{}
+
+//xll:function
+func (s *Service) Small(ctx context.Context, b byte) (int32, error) { return 0, nil }
+
+//xll:function colour=red
+func (s *Service) Odd(ctx context.Context) (int32, error) { return 0, nil }
+
+//xll:function
+func (s *Service) NoCtx(x int32) (int32, error) { return 0, nil }
+
+//xll:function
+func (s *Service) Good(ctx context.Context, x int32) (int32, error) { return 0, nil }
+`
+
+func writeService(t *testing.T, src string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module demo\n\ngo 1.24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "service.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// TestScan: signatures map back to xll.yaml types, directives to keys, the
+// doc comment to the description.
+func TestScan(t *testing.T) {
+	dir := writeService(t, serviceSrc)
+	res, err := Scan([]string{dir})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(res.Problems) != 0 {
+		t.Fatalf("unexpected problems: %v", res.Problems)
+	}
+	if !strings.HasSuffix(res.Service, ".Service") {
+		t.Errorf("Service = %q", res.Service)
+	}
+	if len(res.Functions) != 3 {
+		t.Fatalf("want Scale, Eye, Quote; got %+v", res.Functions)
+	}
+
+	scale := res.Functions[0]
+	if scale.Name != "Scale" || scale.Mode != "async" || scale.Category != "Math" || !scale.Volatile ||
+		scale.Return != "float" || scale.Description != "Scale multiplies x by k." {
+		t.Errorf("Scale = %+v", scale.Function)
+	}
+	if len(scale.Args) != 2 || scale.Args[0].Name != "x" || scale.Args[1].Type != "float" {
+		t.Errorf("Scale args = %+v", scale.Args)
+	}
+	if len(scale.Directives) != 3 || scale.Directives[2] != (Directive{Key: "volatile", Value: "true", Kind: "bool"}) {
+		t.Errorf("Scale directives = %+v", scale.Directives)
+	}
+
+	eye := res.Functions[1]
+	if eye.Return != "numgrid" || !eye.Caller || len(eye.Args) != 1 || eye.Args[0].Type != "int" ||
+		eye.Description != "Identity matrix" || eye.ID == nil || *eye.ID != 7 {
+		t.Errorf("Eye = %+v", eye.Function)
+	}
+
+	quote := res.Functions[2]
+	if quote.Name != "Quote" || quote.Mode != "rtd" || quote.Return != "any" ||
+		len(quote.Args) != 2 || quote.Args[0].Type != "string" || quote.Args[1].Type != "date" {
+		t.Errorf("Quote = %+v", quote.Function)
+	}
+}
+
+// TestScanProblems: every unmappable method is reported at its line, and the
+// rest are still returned.
+func TestScanProblems(t *testing.T) {
+	dir := writeService(t, badSrc)
+	res, err := Scan([]string{dir})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(res.Functions) != 1 || res.Functions[0].Name != "Good" {
+		t.Errorf("want only Good, got %+v", res.Functions)
+	}
+	want := map[int]string{
+		9:  "argument b: unsupported type byte",
+		11: `unknown //xll:function key "colour"`,
+		15: "first parameter must be ctx context.Context",
+	}
+	if len(res.Problems) != len(want) {
+		t.Fatalf("want %d problems, got %v", len(want), res.Problems)
+	}
+	for _, p := range res.Problems {
+		if !strings.Contains(p.Msg, want[p.Pos.Line]) || want[p.Pos.Line] == "" {
+			t.Errorf("line %d: got %q, want %q", p.Pos.Line, p.Msg, want[p.Pos.Line])
+		}
+		if filepath.Base(p.Pos.Filename) != "service.go" {
+			t.Errorf("problem in %q, want service.go", p.Pos.Filename)
+		}
+	}
+}
+
+func TestDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a", "a/b", "testdata", ".hidden", "empty"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if d != "empty" {
+			os.WriteFile(filepath.Join(root, d, "x.go"), []byte("package x\n"), 0644)
+		}
+	}
+	dirs, err := Dirs([]string{root + "/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "a"), filepath.Join(root, "a", "b")}
+	if strings.Join(dirs, ",") != strings.Join(want, ",") {
+		t.Errorf("Dirs = %v, want %v", dirs, want)
+	}
+}
+
+func TestParseDirective(t *testing.T) {
+	ds, err := parseDirective(` mode=rtd-once  timeout=5s description="A, B and C" memoize`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Directive{
+		{"mode", "rtd-once", "string"},
+		{"timeout", "5s", "string"},
+		{"description", "A, B and C", "string"},
+		{"memoize", "true", "bool"},
+	}
+	if len(ds) != len(want) {
+		t.Fatalf("got %+v", ds)
+	}
+	for i := range want {
+		if ds[i] != want[i] {
+			t.Errorf("directive %d = %+v, want %+v", i, ds[i], want[i])
+		}
+	}
+	if _, err := parseDirective("category"); err == nil {
+		t.Error("a string key without a value must fail")
+	}
+}
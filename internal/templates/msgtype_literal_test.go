@@ -14,20 +14,23 @@ import (
 
 // msgTypeCastRe finds every `(shm::MsgType)` cast in a template and captures
 // the BASE operand — the first token after the cast, looking through an
-// optional `(` and an optional `{{add …}}` / `{{sub …}}` action.
+// optional `(` and an optional `{{add …}}` / `{{sub …}}` action. Any other
+// action is captured by its name, e.g. msgID, the funcmap helper user
+// function IDs are written with.
 //
 // It deliberately captures the base rather than the whole expression: user
-// function IDs are always written as base+index, and it is the base that
+// function IDs are always written as base+ID, and it is the base that
 // decides whether the whole range lands in application space.
 //
 //	(shm::MsgType)140                  -> "140"
 //	(shm::MsgType)({{add 11 $i}})      -> "11"
 //	(shm::MsgType){{add MsgUserStart $i}} -> "MsgUserStart"
+//	(shm::MsgType){{msgID $i .}}       -> "msgID"
 //
 // A declaration like `shm::MsgType msgId` is not a cast and does not match:
 // the parentheses around the type name are required.
 var msgTypeCastRe = regexp.MustCompile(
-	`\(shm::MsgType\)\s*\(?\s*(?:\{\{-?\s*(?:add|sub)\s+\(?\s*)?([A-Za-z_][A-Za-z0-9_]*|\d+)`)
+	`\(shm::MsgType\)\s*\(?\s*(?:\{\{-?\s*(?:(?:add|sub)\s+\(?\s*)?)?([A-Za-z_][A-Za-z0-9_]*|\d+)`)
 
 // reservedShmMsgTypes names every value shm's transport enum claims below
 // APP_START (shm/include/shm/IPCUtils.h), so the failure message can say WHICH
@@ -71,7 +74,7 @@ func templateNames(t *testing.T) []string {
 // caught `(shm::MsgType)({{add 11 $i}})` in regtest_main.cpp.tmpl (found
 // 2026-08-03): a user-function message ID based at 11, i.e. squarely inside
 // shm's transport-reserved range (GUEST_CALL 11, STREAM_START 13, STREAM_CHUNK
-// 14), while the product bases the same IDs at MsgUserStart = 140.
+// 14), while the product bases the same IDs at MsgUserStart (142).
 //
 // The existing mirror gate, internal/assets/msgid_mirror_test.go, cannot see
 // this. It reads the CONSTANTS — pkg/msgid/msgid.go and the MSG_* #defines in
@@ -0,0 +1,158 @@
+// Package upgrade holds what `xll-gen upgrade` knows about releases: which
+// one last generated a project, and the behavior-relevant changes a project
+// picks up when it moves from one release to another.
+package upgrade
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Module is the module path a project requires to build its server.
+const Module = "github.com/xll-gen/xll-gen"
+
+// Note is one behavior-relevant change of a release.
+type Note struct {
+	// Version is the release that made the change.
+	Version string
+	Title   string
+	// Detail says what changes for a project and what to do about it.
+	Detail string
+}
+
+// Notes lists the changes an upgrading project must know about, oldest
+// first. Features a project has to opt into are not listed.
+var Notes = []Note{
+	{
+		Version: "v0.8.56",
+		Title:   "The XLL and the server check each other at connect",
+		Detail: "As soon as the server connects each side sends its xll-gen version and a hash of the function table; " +
+			"until that matches, both refuse every call instead of routing it to the wrong handler. " +
+			"Rebuild and deploy the XLL and the server together, and delete stale servers under <temp_dir>\\<ProjectName>\\. " +
+			"To keep serving an XLL generated before this release, start the server with XLLGEN_HANDSHAKE=optional.",
+	},
+	{
+		Version: "v0.8.56",
+		Title:   "Function message IDs are pinned in xll.lock",
+		Detail: "generate writes xll.lock next to xll.yaml with the IDs it assigned, which keep the current order, " +
+			"so reordering functions: no longer re-routes calls. Commit xll.lock.",
+	},
+	{
+		Version: "v0.8.56",
+		Title:   "server.command is replaced by server.launch.command",
+		Detail: "The top-level server.command still works, but server.launch.command wins when both are set. " +
+			"upgrade moves the value.",
+	},
+	{
+		Version: "v0.8.56",
+		Title:   "The build writes <name>.intellisense.xml next to the XLL",
+		Detail: "With the Excel-DNA IntelliSense add-in loaded, Excel shows function and argument help while typing. " +
+			"Ship the file with the XLL; package includes it.",
+	},
+	{
+		Version: "v0.8.56",
+		Title:   "generate records the files it writes in <package>/xll-gen.sum",
+		Detail: "upgrade uses it to find generated files edited by hand. " +
+			"Commit it with the generated package if you commit that.",
+	},
+}
+
+// Changelog returns the notes of the releases after from up to and including
+// to. An unknown from (empty or not a version) returns every note up to to.
+func Changelog(from, to string) []Note {
+	var out []Note
+	for _, n := range Notes {
+		if Compare(n.Version, to) > 0 {
+			continue
+		}
+		if parseVersion(from) != nil && Compare(n.Version, from) <= 0 {
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// Compare returns -1, 0 or 1 comparing two "vX.Y.Z" versions component-wise;
+// a pre-release or build suffix is ignored and a string that is not a version
+// sorts first.
+func Compare(a, b string) int {
+	x, y := parseVersion(a), parseVersion(b)
+	for i := 0; i < len(x) || i < len(y); i++ {
+		var p, q int
+		if i < len(x) {
+			p = x[i]
+		}
+		if i < len(y) {
+			q = y[i]
+		}
+		if p != q {
+			if p < q {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersion returns the numbers of "vX.Y.Z[-pre][+build]", or nil.
+func parseVersion(s string) []int {
+	s, ok := strings.CutPrefix(s, "v")
+	if !ok {
+		return nil
+	}
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	var nums []int
+	for _, p := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil
+		}
+		nums = append(nums, n)
+	}
+	return nums
+}
+
+// IsVersion reports whether s is a release version such as "v0.8.55".
+func IsVersion(s string) bool {
+	return parseVersion(s) != nil
+}
+
+var headerRe = regexp.MustCompile(`Code generated by xll-gen (v\S+)\. DO NOT EDIT\.`)
+
+// ProjectVersion returns the xll-gen release that last generated the project
+// in dir, from the header of its Taskfile.yml, else the xll-gen requirement
+// in its go.mod. It returns "" when neither says.
+func ProjectVersion(dir string) string {
+	if data, err := os.ReadFile(filepath.Join(dir, "Taskfile.yml")); err == nil {
+		if m := headerRe.FindSubmatch(data); m != nil {
+			return string(m[1])
+		}
+	}
+	return Required(dir)
+}
+
+// Required returns the version of Module that the go.mod in dir requires,
+// or "".
+func Required(dir string) string {
+	f, err := os.Open(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(sc.Text()), "require "))
+		if len(fields) >= 2 && fields[0] == Module {
+			return fields[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package upgrade
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xll-gen/xll-gen/version"
+)
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"v0.8.55", "v0.8.55", 0},
+		{"v0.8.9", "v0.8.10", -1},
+		{"v0.10.0", "v0.9.9", 1},
+		{"v1.0.0-rc1", "v1.0.0", 0},
+		{"main", "v0.1.0", -1},
+	} {
+		if got := Compare(tc.a, tc.b); got != tc.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestChangelog(t *testing.T) {
+	saved := Notes
+	defer func() { Notes = saved }()
+	Notes = []Note{{Version: "v0.2.0", Title: "a"}, {Version: "v0.3.0", Title: "b"}, {Version: "v0.4.0", Title: "c"}}
+
+	titles := func(ns []Note) (s string) {
+		for _, n := range ns {
+			s += n.Title
+		}
+		return s
+	}
+	for _, tc := range []struct{ from, to, want string }{
+		{"v0.2.0", "v0.3.0", "b"},
+		{"v0.1.0", "v0.4.0", "abc"},
+		{"v0.3.0", "v0.3.0", ""},
+		{"", "v0.3.0", "ab"},
+		{"main", "v0.2.0", "a"},
+	} {
+		if got := titles(Changelog(tc.from, tc.to)); got != tc.want {
+			t.Errorf("Changelog(%q, %q) = %q, want %q", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+// TestChangelogFromPrevious: a project generated by v0.8.55, the release
+// before the notes were written, sees every one of them on upgrade.
+func TestChangelogFromPrevious(t *testing.T) {
+	const previous = "v0.8.55"
+	if Compare(previous, version.Version) >= 0 {
+		t.Fatalf("version.Version = %s is not after %s", version.Version, previous)
+	}
+	if got := Changelog(previous, version.Version); len(got) == 0 || len(got) != len(Notes) {
+		t.Errorf("Changelog(%s, %s) = %d notes, want all %d", previous, version.Version, len(got), len(Notes))
+	}
+}
+
+// TestProjectVersion: the Taskfile header wins over go.mod, which is the
+// fallback.
+func TestProjectVersion(t *testing.T) {
+	dir := t.TempDir()
+	gomod := "module demo\n\ngo 1.24\n\nrequire (\n\tgithub.com/xll-gen/shm v0.9.1\n\t" + Module + " v0.8.40\n)\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ProjectVersion(dir); got != "v0.8.40" {
+		t.Errorf("from go.mod: %q, want v0.8.40", got)
+	}
+	taskfile := "# Code generated by xll-gen v0.8.50. DO NOT EDIT.\nversion: '3'\n"
+	if err := os.WriteFile(filepath.Join(dir, "Taskfile.yml"), []byte(taskfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ProjectVersion(dir); got != "v0.8.50" {
+		t.Errorf("from Taskfile.yml: %q, want v0.8.50", got)
+	}
+	if got := ProjectVersion(t.TempDir()); got != "" {
+		t.Errorf("empty project: %q", got)
+	}
+}
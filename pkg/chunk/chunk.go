@@ -14,11 +14,14 @@
 // (formerly DefaultChunkSize in pkg/server AND a hand-copied onceGridChunkSize
 // in pkg/rtd).
 //
-// pkg/chunk is a leaf: it imports only the flatbuffers runtime, the generated
-// types/protocol package, and pkg/transferid. That lets BOTH pkg/server and
-// pkg/rtd depend on it despite the server->rtd import cycle (pkg/server imports
-// pkg/rtd via NewSystemHandler), exactly as pkg/msgid and pkg/transferid already
-// do. See AGENTS.md §18.4 (chunking co-change cluster) and §23.3.
+// pkg/chunk is a leaf: outside the standard library it imports only the
+// flatbuffers runtime, the generated types/protocol package, and the zstd
+// codec that compress.go uses.
+//
+// Being a leaf lets BOTH pkg/server and pkg/rtd depend on it despite the
+// server->rtd import cycle (pkg/server imports pkg/rtd via NewSystemHandler),
+// exactly as pkg/msgid and pkg/transferid already do. See AGENTS.md §18.4
+// (chunking co-change cluster) and §23.3.
 package chunk
 
 import (
@@ -297,6 +300,11 @@ type Sender struct {
 	// leave it zero, because the real bound is a property of the receiver, not
 	// of the call site.
 	MaxTotalBytes int
+	// CompressThreshold is the payload size (bytes) at or above which Send
+	// zstd-compresses the transfer and sets CompressedFlag on its msg_type.
+	// Zero means the process-wide SetCompressThreshold value; negative
+	// disables compression for this Sender. See compress.go.
+	CompressThreshold int64
 }
 
 // chunkSize returns the effective per-chunk budget.
@@ -315,6 +323,17 @@ func (s *Sender) maxTotalBytes() int {
 	return MaxTransferBytes
 }
 
+// compressThreshold returns the effective threshold, or 0 for "never".
+func (s *Sender) compressThreshold() int64 {
+	if s.CompressThreshold != 0 {
+		if s.CompressThreshold < 0 {
+			return 0
+		}
+		return s.CompressThreshold
+	}
+	return CompressThreshold()
+}
+
 // Send splits payload into protocol.Chunk frames of at most ChunkSize bytes each
 // and delivers them in ascending offset order via send, applying policy's retry
 // wrapper to each chunk. Every frame carries the shared transferID, the full
@@ -337,6 +356,11 @@ func (s *Sender) maxTotalBytes() int {
 // payload waits forever. Splitting cannot fix a single payload that is over the
 // cap — the cap is on ONE transfer's total_size, not on one frame — so the
 // caller must convert this error into a visible failure.
+//
+// When the payload is at least the effective CompressThreshold, it is sent as
+// one zstd frame with CompressedFlag set on every chunk's msg_type — unless
+// compression does not actually shrink it, in which case it goes out verbatim.
+// The cap above is checked against the UNCOMPRESSED size (see compress.go).
 func (s *Sender) Send(payload []byte, transferID uint64, msgType uint32, send SendFunc, policy RetryPolicy) error {
 	if len(payload) == 0 {
 		return nil
@@ -344,6 +368,15 @@ func (s *Sender) Send(payload []byte, transferID uint64, msgType uint32, send Se
 	if max := s.maxTotalBytes(); len(payload) > max {
 		return fmt.Errorf("%w: %d bytes > %d (id %#x)", ErrTransferTooLarge, len(payload), max, transferID)
 	}
+	if t := s.compressThreshold(); t > 0 && int64(len(payload)) >= t {
+		// A Compress error (a payload under minCompressBytes, or the encoder
+		// could not be built) is not fatal: the uncompressed transfer is just
+		// as valid, only bigger.
+		if packed, err := Compress(payload); err == nil && len(packed) < len(payload) {
+			payload = packed
+			msgType |= CompressedFlag
+		}
+	}
 	if s.Builder == nil {
 		s.Builder = flatbuffers.NewBuilder(1024)
 	}
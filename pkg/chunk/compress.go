@@ -0,0 +1,173 @@
+package chunk
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Optional zstd compression of a chunked transfer.
+//
+// WHY A msg_type BIT AND NOT A Chunk FIELD. protocol.Chunk is defined by the
+// pinned xll-gen/types schema (internal/templates/protocol.fbs is a byte-exact
+// copy, gated by TestProtocolFbsMatchesPinnedTypes), so it cannot grow a
+// `compression` field from this repo. msg_type, however, carries a small
+// message ID (< 256, see pkg/msgid), which leaves the high bit free.
+// CompressedFlag set on a frame's msg_type means "the reassembled payload is
+// ONE zstd frame; decompress it, then dispatch on msg_type &^ CompressedFlag".
+// Every frame of a transfer carries the same msg_type, so the choice is made —
+// and visible to the receiver — per transfer, and a receiver never has to
+// guess from the bytes.
+//
+// DIRECTION. Compression is guest->host only: the Go server's chunked sends
+// (Sender.Send, used by the async batch and rtd-once grid paths) to the XLL,
+// whose HandleChunk inflates them. Host->guest has nothing to compress — the
+// C++ host builds each request directly in the slot and never chunks — so
+// pkg/server's HandleChunk refuses a flagged frame outright instead of
+// carrying a decoder no sender exercises.
+//
+// WHAT THE SIZES MEAN ON A COMPRESSED TRANSFER. total_size and offset describe
+// the COMPRESSED byte stream: that is what gets split, claimed and
+// bounds-checked, so the segment-coverage rules (ClaimChunkSegment) are
+// unchanged. The XLL's reassembly cap (kMaxChunkTotalSize) is applied TWICE:
+// once to the declared total at admission, as before, and once to the
+// DECOMPRESSED size before a single output byte is allocated
+// (DecompressChunkPayload in xll_worker.cpp; Decompress here for pkg/xllhost).
+// The second check is the one that matters — without it a 1 MiB zstd bomb
+// would reassemble under the cap and then inflate to whatever it declares.
+//
+// Symmetrically, the SENDER's per-transfer cap (MaxTotalBytes) is checked
+// against the UNCOMPRESSED payload: the receiver will hold that many bytes once
+// it inflates the transfer, so a payload it would refuse must still be refused
+// before any frame goes out, compressible or not.
+//
+// Compression is opt-in (xll.yaml server.chunk.compress_threshold, applied by
+// the generated server through SetCompressThreshold) and the generated XLL only
+// links zstd when that knob is set, so the two ends of one project always
+// agree. The flag is still self-describing: an XLL built without zstd refuses a
+// compressed transfer with SYSTEM_ERROR instead of dispatching compressed bytes
+// as a FlatBuffer.
+const CompressedFlag uint32 = 1 << 31
+
+// ErrDecompressedTooLarge is returned by Decompress when a compressed payload
+// declares (or actually inflates to) more than the receiver's per-transfer cap.
+var ErrDecompressedTooLarge = errors.New("chunk: decompressed transfer exceeds the per-transfer cap")
+
+// compressThreshold is the process-wide default for Sender.CompressThreshold;
+// zero disables compression. Set once at startup by the generated server.
+var compressThreshold atomic.Int64
+
+// SetCompressThreshold sets the payload size (bytes) at or above which every
+// Sender compresses a transfer, unless the Sender carries its own
+// CompressThreshold. n <= 0 disables compression. The generated server calls it
+// from main when xll.yaml sets server.chunk.compress_threshold.
+func SetCompressThreshold(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	compressThreshold.Store(n)
+}
+
+// CompressThreshold reports the process-wide threshold set by
+// SetCompressThreshold (0 = compression disabled).
+func CompressThreshold() int64 {
+	return compressThreshold.Load()
+}
+
+var (
+	encoderOnce sync.Once
+	encoder     *zstd.Encoder
+	encoderErr  error
+)
+
+// sharedEncoder returns the process-wide zstd encoder. EncodeAll is safe for
+// concurrent use, so one encoder serves every Sender. SpeedFastest because the
+// transfer sits on the recalc path: the point is to move fewer bytes through
+// the slot, not to win a ratio contest. Concurrency 1 keeps EncodeAll from
+// spinning up per-call goroutines for what is at most a few hundred MiB.
+func sharedEncoder() (*zstd.Encoder, error) {
+	encoderOnce.Do(func() {
+		encoder, encoderErr = zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(zstd.SpeedFastest),
+			zstd.WithEncoderConcurrency(1))
+	})
+	return encoder, encoderErr
+}
+
+// minCompressBytes is the smallest payload Compress accepts. Below 256 bytes
+// klauspost's EncodeAll writes a frame header WITHOUT Frame_Content_Size (the
+// field is optional in the zstd format and the encoder saves its byte), and
+// both decoders — Decompress here, DecompressChunkPayload in xll_worker.cpp —
+// refuse a frame whose size they cannot bound before inflating. So a small
+// payload behind a low compress_threshold was flagged, sent, and then refused
+// on arrival: an async batch or rtd-once grid silently lost. A payload this
+// small saves nothing worth a zstd frame anyway.
+const minCompressBytes = 256
+
+// errCompressTooSmall is Compress's refusal of a payload under
+// minCompressBytes; Sender.Send sends such a payload verbatim.
+var errCompressTooSmall = fmt.Errorf("chunk: payloads under %d bytes are not compressed", minCompressBytes)
+
+// Compress returns payload as a single zstd frame whose header records the
+// uncompressed size (the C++ decoder relies on it to bound the allocation
+// before inflating). A payload under minCompressBytes is refused, because its
+// frame would not record that size.
+func Compress(payload []byte) ([]byte, error) {
+	if len(payload) < minCompressBytes {
+		return nil, errCompressTooSmall
+	}
+	enc, err := sharedEncoder()
+	if err != nil {
+		return nil, fmt.Errorf("chunk: zstd encoder: %w", err)
+	}
+	return enc.EncodeAll(payload, make([]byte, 0, len(payload)/2)), nil
+}
+
+// Decompress inflates a reassembled compressed transfer, refusing with
+// ErrDecompressedTooLarge — before allocating the output — when the frame
+// declares more than maxBytes, and again if the actual output exceeds it.
+// maxBytes <= 0 means MaxTransferBytes.
+func Decompress(data []byte, maxBytes int64) ([]byte, error) {
+	if maxBytes <= 0 {
+		maxBytes = MaxTransferBytes
+	}
+	var hdr zstd.Header
+	if err := hdr.Decode(data); err != nil {
+		return nil, fmt.Errorf("chunk: malformed zstd frame: %w", err)
+	}
+	if !hdr.HasFCS {
+		// Every frame Compress produces records its size; one that does not
+		// cannot be bounded up front, so it is not ours.
+		return nil, errors.New("chunk: zstd frame does not declare its content size")
+	}
+	if hdr.FrameContentSize == 0 {
+		// Compress never produces one (Sender.Send sends nothing for an empty
+		// payload), and dispatching zero bytes as a FlatBuffer is the
+		// zero-total hazard the reassembler refuses at admission.
+		return nil, errors.New("chunk: zstd frame declares an empty payload")
+	}
+	if hdr.FrameContentSize > uint64(maxBytes) {
+		return nil, fmt.Errorf("%w: declares %d bytes > %d", ErrDecompressedTooLarge, hdr.FrameContentSize, maxBytes)
+	}
+	dec, err := zstd.NewReader(nil,
+		zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderMaxMemory(uint64(maxBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("chunk: zstd decoder: %w", err)
+	}
+	defer dec.Close()
+	out, err := dec.DecodeAll(data, make([]byte, 0, hdr.FrameContentSize))
+	if err != nil {
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+			return nil, fmt.Errorf("%w: %v", ErrDecompressedTooLarge, err)
+		}
+		return nil, fmt.Errorf("chunk: zstd decode: %w", err)
+	}
+	if uint64(len(out)) != hdr.FrameContentSize {
+		return nil, fmt.Errorf("chunk: zstd frame inflated to %d bytes, declared %d", len(out), hdr.FrameContentSize)
+	}
+	return out, nil
+}
@@ -0,0 +1,149 @@
+package chunk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/xll-gen/types/go/protocol"
+)
+
+// sendCollect runs s.Send and reassembles the delivered frames by offset,
+// returning the reassembled bytes and the msg_type every frame carried.
+func sendCollect(t *testing.T, s *Sender, payload []byte, msgType uint32) ([]byte, uint32) {
+	t.Helper()
+	var out []byte
+	var mt uint32
+	send := func(frame []byte) error {
+		c := protocol.GetRootAsChunk(append([]byte(nil), frame...), 0)
+		if out == nil {
+			out = make([]byte, c.TotalSize())
+			mt = c.MsgType()
+		} else if c.MsgType() != mt {
+			t.Fatalf("msg_type changed mid-transfer: %#x then %#x", mt, c.MsgType())
+		}
+		copy(out[c.Offset():], c.DataBytes())
+		return nil
+	}
+	if err := s.Send(payload, 7, msgType, send, NoRetry); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	return out, mt
+}
+
+// TestSender_CompressesAtThreshold: a compressible payload at the threshold is
+// sent as one zstd frame flagged on every chunk, and inflates back verbatim.
+func TestSender_CompressesAtThreshold(t *testing.T) {
+	payload := bytes.Repeat([]byte("xll-gen grid cell "), 4096)
+	s := &Sender{ChunkSize: 100, CompressThreshold: int64(len(payload))}
+
+	wire, mt := sendCollect(t, s, payload, 138)
+	if mt != 138|CompressedFlag {
+		t.Fatalf("msg_type = %#x, want 138|CompressedFlag", mt)
+	}
+	if len(wire) >= len(payload) {
+		t.Fatalf("compressed transfer is %d bytes, payload %d", len(wire), len(payload))
+	}
+	got, err := Decompress(wire, 0)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("Decompress = (%d bytes, %v), want the original %d bytes", len(got), err, len(payload))
+	}
+}
+
+// TestSender_CompressionIsOptIn covers the cases that must go out verbatim:
+// below the threshold, compression disabled, and a payload zstd cannot shrink.
+func TestSender_CompressionIsOptIn(t *testing.T) {
+	small := bytes.Repeat([]byte{'a'}, 999)
+	noise := make([]byte, 4096)
+	if _, err := rand.Read(noise); err != nil {
+		t.Fatal(err)
+	}
+	for name, tc := range map[string]struct {
+		s       *Sender
+		payload []byte
+	}{
+		"BelowThreshold":  {&Sender{CompressThreshold: 1000}, small},
+		"Disabled":        {&Sender{CompressThreshold: -1}, small},
+		"DefaultIsOff":    {&Sender{}, small},
+		"Incompressible":  {&Sender{CompressThreshold: 1}, noise},
+		"UnderFrameFloor": {&Sender{CompressThreshold: 1}, small[:minCompressBytes-1]},
+	} {
+		t.Run(name, func(t *testing.T) {
+			wire, mt := sendCollect(t, tc.s, tc.payload, 128)
+			if mt != 128 || !bytes.Equal(wire, tc.payload) {
+				t.Fatalf("got msg_type %#x / %d bytes, want the payload verbatim under 128", mt, len(wire))
+			}
+		})
+	}
+}
+
+// TestCompress_RecordsContentSize: every frame Compress produces must declare
+// its size, or the receivers refuse it; the smallest accepted payload is the
+// case the encoder would otherwise leave undeclared.
+func TestCompress_RecordsContentSize(t *testing.T) {
+	for _, n := range []int{minCompressBytes, 4096} {
+		payload := bytes.Repeat([]byte{'a'}, n)
+		packed, err := Compress(payload)
+		if err != nil {
+			t.Fatalf("Compress(%d bytes): %v", n, err)
+		}
+		if got, err := Decompress(packed, 0); err != nil || !bytes.Equal(got, payload) {
+			t.Fatalf("Decompress(Compress(%d bytes)) = (%d bytes, %v)", n, len(got), err)
+		}
+	}
+	if _, err := Compress(bytes.Repeat([]byte{'a'}, minCompressBytes-1)); err == nil {
+		t.Fatal("Compress accepted a payload whose frame would not declare its size")
+	}
+}
+
+// TestSetCompressThreshold_IsTheSenderDefault: the generated server configures
+// compression once, process-wide; a Sender's own field still wins.
+func TestSetCompressThreshold_IsTheSenderDefault(t *testing.T) {
+	defer SetCompressThreshold(0)
+	SetCompressThreshold(10)
+	payload := bytes.Repeat([]byte{'z'}, 1000)
+
+	if _, mt := sendCollect(t, &Sender{}, payload, 128); mt&CompressedFlag == 0 {
+		t.Error("the process-wide threshold was not applied")
+	}
+	if _, mt := sendCollect(t, &Sender{CompressThreshold: -1}, payload, 128); mt&CompressedFlag != 0 {
+		t.Error("a Sender that disables compression was overridden")
+	}
+}
+
+// TestSender_CapAppliesToUncompressedSize: the receiver holds the inflated
+// bytes, so the per-transfer cap must refuse on them even when zstd would
+// squeeze the payload under it.
+func TestSender_CapAppliesToUncompressedSize(t *testing.T) {
+	s := &Sender{MaxTotalBytes: 1000, CompressThreshold: 1}
+	err := s.Send(make([]byte, 1001), 1, 128, func([]byte) error {
+		t.Fatal("no frame may be sent for an over-cap payload")
+		return nil
+	}, NoRetry)
+	if !errors.Is(err, ErrTransferTooLarge) {
+		t.Fatalf("err = %v, want ErrTransferTooLarge", err)
+	}
+}
+
+// TestDecompress_Refusals: the decompressed-size cap is enforced from the
+// frame header (a zstd bomb never gets its output allocated), and bytes that
+// are not one of our frames are refused rather than dispatched.
+func TestDecompress_Refusals(t *testing.T) {
+	bomb, err := Compress(make([]byte, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bomb) > 1024 {
+		t.Fatalf("1 MiB of zeros compressed to %d bytes; the test needs a bomb", len(bomb))
+	}
+	if _, err := Decompress(bomb, 64<<10); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("bomb: err = %v, want ErrDecompressedTooLarge", err)
+	}
+	if got, err := Decompress(bomb, 1<<20); err != nil || len(got) != 1<<20 {
+		t.Errorf("at the cap: (%d bytes, %v), want the full payload", len(got), err)
+	}
+	if _, err := Decompress([]byte("not zstd at all"), 0); err == nil {
+		t.Error("garbage was accepted as a zstd frame")
+	}
+}
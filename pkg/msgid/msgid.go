@@ -54,11 +54,11 @@ const (
 	// MsgRtdOnceGrid delivers a one-shot grid/numgrid result for a grid-once
 	// rtd function guest->host, to be cached in RtdOnceGridRegistry (mirrors
 	// MSG_RTD_ONCE_GRID). It occupies the free slot between MsgCommandInvoke
-	// (137) and MsgUserStart (140).
+	// (137) and MsgAck (139).
 	MsgRtdOnceGrid = 138
 
-	// MsgAck is the acknowledgement message (mirrors MSG_ACK). It occupies the
-	// last free slot below MsgUserStart (140).
+	// MsgAck is the acknowledgement message (mirrors MSG_ACK). It occupied the
+	// last free slot below the old MsgUserStart (140).
 	//
 	// It was 2 until 2026-08-03, which is shm's MsgType::HEARTBEAT_RESP: the
 	// ACK responses that pkg/server's HandleChunk / HandleSetRefCache hand back
@@ -68,7 +68,57 @@ const (
 	// an application-layer ID and SHM_VERSION describes the transport bytes.
 	MsgAck = 139
 
+	// MsgRtdProgress pushes an INTERIM progress value to an rtd-once topic
+	// guest->host (mirrors MSG_RTD_PROGRESS). The payload is an RtdUpdate, but
+	// the host only displays it: it is never stored as the one-shot result, so
+	// memoize / memoize_ttl cannot retain it. A separate ID rather than an
+	// RtdUpdate flag because the schema is owned by the types module.
+	//
+	// It took 140 from MsgUserStart, which moved to 141. User-function IDs are
+	// generated into the XLL and the server from the same xll-gen version, so
+	// the renumber needs no wire migration.
+	MsgRtdProgress = 140
+
+	// MsgHandshake is the first message the XLL sends after connecting
+	// (mirrors MSG_HANDSHAKE). It carries the xll-gen version, a hash of the
+	// generated function table and the user msgid range, so a server and an
+	// XLL generated from different xll.yaml files or xll-gen versions refuse
+	// each other instead of routing a function ID to the wrong function.
+	//
+	// It took 141 from MsgUserStart, which moved to 142 — the same move
+	// MsgRtdProgress made. A stale peer built against 141 therefore sends its
+	// first function as a malformed handshake, which is refused.
+	MsgHandshake = 141
+
 	// MsgUserStart is the first message ID allocated to user functions
-	// (mirrors MSG_USER_START). User function i gets MsgUserStart + i.
-	MsgUserStart = 140
+	// (mirrors MSG_USER_START). A user function gets MsgUserStart + its ID:
+	// its position in functions:, unless id: or xll.lock pins it.
+	MsgUserStart = 142
 )
+
+// ID is one named message ID.
+type ID struct {
+	Name  string
+	Value int
+}
+
+// All lists every constant above in value order, for tools that report on the
+// wire: the generated schema.fbs records it so `xll-gen compat` can tell when a
+// baseline was generated against different IDs.
+var All = []ID{
+	{"MsgBatchAsyncResponse", MsgBatchAsyncResponse},
+	{"MsgChunk", MsgChunk},
+	{"MsgSetRefCache", MsgSetRefCache},
+	{"MsgCalculationEnded", MsgCalculationEnded},
+	{"MsgCalculationCanceled", MsgCalculationCanceled},
+	{"MsgRtdConnect", MsgRtdConnect},
+	{"MsgRtdDisconnect", MsgRtdDisconnect},
+	{"MsgRtdUpdate", MsgRtdUpdate},
+	{"MsgRtdHeartbeat", MsgRtdHeartbeat},
+	{"MsgCommandInvoke", MsgCommandInvoke},
+	{"MsgRtdOnceGrid", MsgRtdOnceGrid},
+	{"MsgAck", MsgAck},
+	{"MsgRtdProgress", MsgRtdProgress},
+	{"MsgHandshake", MsgHandshake},
+	{"MsgUserStart", MsgUserStart},
+}
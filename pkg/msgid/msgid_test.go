@@ -1,6 +1,11 @@
 package msgid
 
-import "testing"
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
 
 // TestMessageIDValues pins the numeric message-ID values to the authoritative
 // C++ mirror in internal/assets/files/include/xll_ipc.h (the MSG_* #defines).
@@ -25,7 +30,9 @@ func TestMessageIDValues(t *testing.T) {
 		{"MsgCommandInvoke", MsgCommandInvoke, 137},
 		{"MsgRtdOnceGrid", MsgRtdOnceGrid, 138},
 		{"MsgAck", MsgAck, 139},
-		{"MsgUserStart", MsgUserStart, 140},
+		{"MsgRtdProgress", MsgRtdProgress, 140},
+		{"MsgHandshake", MsgHandshake, 141},
+		{"MsgUserStart", MsgUserStart, 142},
 	}
 	for _, c := range cases {
 		if c.got != c.want {
@@ -33,3 +40,35 @@ func TestMessageIDValues(t *testing.T) {
 		}
 	}
 }
+
+// TestAllListsEveryConstant keeps All total: it is hand-written, so a new
+// constant nobody added to it would silently drop out of the schema manifest.
+func TestAllListsEveryConstant(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "msgid.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]int, len(All))
+	for i, id := range All {
+		listed[id.Name] = id.Value
+		if i > 0 && id.Value <= All[i-1].Value {
+			t.Errorf("All is not in value order at %s", id.Name)
+		}
+	}
+	n := 0
+	for _, decl := range f.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.CONST {
+			for _, spec := range gd.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					n++
+					if _, ok := listed[name.Name]; !ok {
+						t.Errorf("%s is missing from All", name.Name)
+					}
+				}
+			}
+		}
+	}
+	if n != len(All) {
+		t.Errorf("All has %d entries, msgid.go declares %d constants", len(All), n)
+	}
+}
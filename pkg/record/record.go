@@ -0,0 +1,356 @@
+// Package record captures the IPC traffic of a generated server so a bug seen
+// in Excel can be reproduced without it: an opt-in Recorder wraps the generated
+// dispatch and writes every request it handles and every response it returns
+// to a compact framed file, and Replay feeds such a file back through a
+// locally built server (`xll-gen replay`) and diffs the responses.
+//
+// Recording is off unless server.record_dir is set in xll.yaml or
+// XLLGEN_RECORD_DIR is set in the server's environment; each run then writes
+// <dir>/<project>_<time>_<pid>.xllrec. Requests are recorded as the dispatch
+// handles them, which means a chunked request appears once, reassembled — the
+// MSG_CHUNK and MSG_ACK frames that carried it are transport and are not
+// recorded. Guest->host traffic (async results, RTD pushes) does not pass
+// through the dispatch and is not recorded either.
+//
+// A recording holds whatever the workbook sent: cell values, references,
+// strings. A Redactor sees every payload before it is written and returns what
+// to store instead.
+//
+// The file is Magic followed by frames, each
+//
+//	kind u8 | msgType u32 | seq u64 | unixNano i64 | len u32 | data [len]
+//
+// in little-endian. A request and its response share seq. Frames are written
+// with one Write each, so a server that dies mid-run leaves a file whose only
+// possible damage is a truncated last frame.
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/xll-gen/pkg/log"
+	"github.com/xll-gen/xll-gen/pkg/msgid"
+	"github.com/xll-gen/xll-gen/pkg/server"
+)
+
+// Magic starts every recording; its last byte is the format version.
+const Magic = "XLLREC\x00\x01"
+
+// EnvDir is the environment variable that turns recording on (or redirects
+// it) regardless of server.record_dir.
+const EnvDir = "XLLGEN_RECORD_DIR"
+
+// Ext is the extension of recording files.
+const Ext = ".xllrec"
+
+// headerSize is the fixed part of a frame.
+const headerSize = 1 + 4 + 8 + 8 + 4
+
+// maxFrameBytes bounds one frame's data on read, so a corrupt length field
+// fails the read instead of allocating gigabytes. It is well above the
+// largest reassembled request the ChunkManager accepts by default.
+const maxFrameBytes = 1 << 30
+
+// Kind says which way a frame went.
+type Kind uint8
+
+const (
+	// KindRequest is a host->guest request the dispatch handled.
+	KindRequest Kind = 1
+	// KindResponse is the dispatch's reply to the request with the same Seq.
+	KindResponse Kind = 2
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindRequest:
+		return "request"
+	case KindResponse:
+		return "response"
+	}
+	return fmt.Sprintf("kind(%d)", uint8(k))
+}
+
+// Frame is one recorded message.
+type Frame struct {
+	Kind    Kind
+	MsgType uint32
+	Seq     uint64
+	Time    time.Time
+	Data    []byte
+}
+
+// Redactor rewrites a payload before it is recorded and returns the bytes to
+// store. data is the live request or response buffer: a Redactor must never
+// modify it in place, only return a new slice (or data itself to keep it).
+// Returning nil stores an empty payload, which Replay then skips for a
+// request and cannot match for a response.
+type Redactor func(kind Kind, msgType uint32, data []byte) []byte
+
+// Recorder writes frames to a recording. Its methods are safe for concurrent
+// use; the dispatch runs on several shm workers at once.
+type Recorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	failed bool
+	seq    atomic.Uint64
+	redact atomic.Pointer[Redactor]
+	path   string
+}
+
+// New starts a recording on w, writing Magic first.
+func New(w io.Writer) (*Recorder, error) {
+	if _, err := io.WriteString(w, Magic); err != nil {
+		return nil, err
+	}
+	return &Recorder{w: w}, nil
+}
+
+// Create starts a recording in a new file at path.
+func Create(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r, err := New(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	r.path = path
+	return r, nil
+}
+
+// Start opens this run's recording when one is asked for: in the directory
+// named by EnvDir if it is set, else in dir (server.record_dir, already
+// resolved by the caller). Both empty means recording is off, and Start
+// returns nil, nil.
+func Start(dir string, projectName string) (*Recorder, error) {
+	if env := os.Getenv(EnvDir); env != "" {
+		dir = env
+	}
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s_%s_%d%s", projectName, time.Now().Format("20060102-150405"), os.Getpid(), Ext)
+	return Create(filepath.Join(dir, name))
+}
+
+// Path returns the file a Recorder made by Create or Start writes to.
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// SetRedactor installs fn for every frame recorded from now on; nil removes
+// it.
+func (r *Recorder) SetRedactor(fn Redactor) {
+	if fn == nil {
+		r.redact.Store(nil)
+		return
+	}
+	r.redact.Store(&fn)
+}
+
+// Wrap returns dispatch with every request and response recorded. Chunk and
+// ACK frames are passed through unrecorded: the reassembled request reaches
+// the wrapped dispatch again through HandleChunk, as long as the generated
+// code hands HandleChunk the wrapped function.
+func (r *Recorder) Wrap(dispatch server.Dispatcher) server.Dispatcher {
+	return func(data []byte, respBuf []byte, mType shm.MsgType) (int32, shm.MsgType) {
+		if mType == msgid.MsgChunk || mType == msgid.MsgAck {
+			return dispatch(data, respBuf, mType)
+		}
+		seq := r.seq.Add(1)
+		r.Record(KindRequest, uint32(mType), seq, data)
+		n, respType := dispatch(data, respBuf, mType)
+		var resp []byte
+		if n > 0 && int(n) <= len(respBuf) {
+			resp = respBuf[:n]
+		}
+		r.Record(KindResponse, uint32(respType), seq, resp)
+		return n, respType
+	}
+}
+
+// Record writes one frame. A write error is logged once and ends the
+// recording; it never reaches the dispatch, which must not fail a call
+// because a diagnostic file could not be written.
+func (r *Recorder) Record(kind Kind, msgType uint32, seq uint64, data []byte) {
+	if p := r.redact.Load(); p != nil {
+		data = (*p)(kind, msgType, data)
+	}
+	frame := make([]byte, headerSize+len(data))
+	frame[0] = byte(kind)
+	binary.LittleEndian.PutUint32(frame[1:], msgType)
+	binary.LittleEndian.PutUint64(frame[5:], seq)
+	binary.LittleEndian.PutUint64(frame[13:], uint64(time.Now().UnixNano()))
+	binary.LittleEndian.PutUint32(frame[21:], uint32(len(data)))
+	copy(frame[headerSize:], data)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed {
+		return
+	}
+	if _, err := r.w.Write(frame); err != nil {
+		r.failed = true
+		log.Error("IPC recording stopped: write failed", "path", r.path, "error", err)
+	}
+}
+
+// Close ends the recording and closes its file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = true
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// ErrNotRecording is returned by NewReader for input that does not start with
+// Magic.
+var ErrNotRecording = errors.New("record: not an xll-gen IPC recording")
+
+// Reader reads frames from a recording.
+type Reader struct {
+	r   io.Reader
+	hdr [headerSize]byte
+}
+
+// NewReader checks Magic and returns a Reader positioned at the first frame.
+func NewReader(r io.Reader) (*Reader, error) {
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrNotRecording
+		}
+		return nil, err
+	}
+	if !bytes.Equal(magic[:len(Magic)-1], []byte(Magic[:len(Magic)-1])) {
+		return nil, ErrNotRecording
+	}
+	if magic[len(Magic)-1] != Magic[len(Magic)-1] {
+		return nil, fmt.Errorf("record: recording format version %d is not supported (want %d)", magic[len(Magic)-1], Magic[len(Magic)-1])
+	}
+	return &Reader{r: r}, nil
+}
+
+// Next returns the next frame, io.EOF after the last, and
+// io.ErrUnexpectedEOF for a frame cut short (the server died writing it).
+func (rd *Reader) Next() (Frame, error) {
+	if _, err := io.ReadFull(rd.r, rd.hdr[:]); err != nil {
+		return Frame{}, err
+	}
+	n := binary.LittleEndian.Uint32(rd.hdr[21:])
+	if n > maxFrameBytes {
+		return Frame{}, fmt.Errorf("record: frame of %d bytes is larger than the %d-byte limit; the file is corrupt", n, maxFrameBytes)
+	}
+	f := Frame{
+		Kind:    Kind(rd.hdr[0]),
+		MsgType: binary.LittleEndian.Uint32(rd.hdr[1:]),
+		Seq:     binary.LittleEndian.Uint64(rd.hdr[5:]),
+		Time:    time.Unix(0, int64(binary.LittleEndian.Uint64(rd.hdr[13:]))),
+	}
+	if f.Kind != KindRequest && f.Kind != KindResponse {
+		return Frame{}, fmt.Errorf("record: frame %d has unknown %v; the file is corrupt", f.Seq, f.Kind)
+	}
+	if n > 0 {
+		f.Data = make([]byte, n)
+		if _, err := io.ReadFull(rd.r, f.Data); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return Frame{}, err
+		}
+	}
+	return f, nil
+}
+
+// ReadFile reads every frame of the recording at path. A truncated last
+// frame is dropped and reported as an error wrapping io.ErrUnexpectedEOF
+// alongside the frames before it, which are still usable.
+func ReadFile(path string) ([]Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rd, err := NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var frames []Frame
+	for {
+		fr, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			return frames, nil
+		}
+		if err != nil {
+			return frames, fmt.Errorf("%s: after %d frames: %w", path, len(frames), err)
+		}
+		frames = append(frames, fr)
+	}
+}
+
+// Exchange is a recorded request with the response the dispatch gave it.
+// HasResponse is false for a request whose response was never written (the
+// server died handling it).
+type Exchange struct {
+	Seq          uint64
+	MsgType      uint32
+	Request      []byte
+	RespType     uint32
+	Response     []byte
+	HasResponse  bool
+	RequestTime  time.Time
+	ResponseTime time.Time
+}
+
+// Pair matches frames into exchanges, ordered by Seq — the order the
+// requests reached the dispatch. A response with no request is dropped.
+func Pair(frames []Frame) []Exchange {
+	var out []Exchange
+	index := make(map[uint64]int)
+	for _, f := range frames {
+		switch f.Kind {
+		case KindRequest:
+			index[f.Seq] = len(out)
+			out = append(out, Exchange{Seq: f.Seq, MsgType: f.MsgType, Request: f.Data, RequestTime: f.Time})
+		case KindResponse:
+			i, ok := index[f.Seq]
+			if !ok {
+				continue
+			}
+			out[i].RespType = f.MsgType
+			out[i].Response = f.Data
+			out[i].HasResponse = true
+			out[i].ResponseTime = f.Time
+		}
+	}
+	// Requests are written before their dispatch runs, so file order is
+	// already Seq order except where two workers raced between taking a seq
+	// and writing the frame.
+	for i := 1; i < len(out); i++ {
+		for j := i; j > 0 && out[j].Seq < out[j-1].Seq; j-- {
+			out[j], out[j-1] = out[j-1], out[j]
+		}
+	}
+	return out
+}
@@ -0,0 +1,194 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/xll-gen/pkg/msgid"
+)
+
+// newDispatch builds a dispatch shaped like the generated one: a variable
+// holding a closure whose MsgChunk case re-enters the variable with the
+// reassembled payload (here: the chunk's own bytes), and whose every other
+// message type echoes its request upper-cased.
+func newDispatch(rec *Recorder) func([]byte, []byte, shm.MsgType) (int32, shm.MsgType) {
+	var dispatch func(data []byte, respBuf []byte, mType shm.MsgType) (int32, shm.MsgType)
+	dispatch = func(data []byte, respBuf []byte, mType shm.MsgType) (int32, shm.MsgType) {
+		if mType == msgid.MsgChunk {
+			return dispatch(data, respBuf, msgid.MsgUserStart+1)
+		}
+		return int32(copy(respBuf, bytes.ToUpper(data))), mType
+	}
+	if rec != nil {
+		dispatch = rec.Wrap(dispatch)
+	}
+	return dispatch
+}
+
+func readAll(t *testing.T, b []byte) []Frame {
+	t.Helper()
+	rd, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames []Frame
+	for {
+		f, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			return frames
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, f)
+	}
+}
+
+// TestWrap_RecordsReassembledRequests: the chunk frame itself is transport
+// and is skipped; the reassembled request it re-dispatches is recorded once,
+// with its response under the same seq.
+func TestWrap_RecordsReassembledRequests(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := New(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatch := newDispatch(rec)
+	resp := make([]byte, 64)
+	dispatch([]byte("abc"), resp, msgid.MsgUserStart)
+	dispatch([]byte("chunked"), resp, msgid.MsgChunk)
+	dispatch([]byte("x"), resp, msgid.MsgAck)
+
+	ex := Pair(readAll(t, buf.Bytes()))
+	if len(ex) != 2 {
+		t.Fatalf("got %d exchanges, want 2: %+v", len(ex), ex)
+	}
+	if ex[0].MsgType != msgid.MsgUserStart || string(ex[0].Request) != "abc" || string(ex[0].Response) != "ABC" {
+		t.Errorf("first exchange = %+v", ex[0])
+	}
+	if ex[1].MsgType != msgid.MsgUserStart+1 || string(ex[1].Request) != "chunked" || string(ex[1].Response) != "CHUNKED" {
+		t.Errorf("reassembled exchange = %+v", ex[1])
+	}
+	if !ex[1].HasResponse || ex[1].RespType != msgid.MsgUserStart+1 {
+		t.Errorf("reassembled exchange response type = %d (has %v)", ex[1].RespType, ex[1].HasResponse)
+	}
+}
+
+// TestRedactor: the redactor's bytes are what is stored, and the live buffer
+// it was handed is untouched.
+func TestRedactor(t *testing.T) {
+	var buf bytes.Buffer
+	rec, _ := New(&buf)
+	rec.SetRedactor(func(kind Kind, msgType uint32, data []byte) []byte {
+		if kind == KindRequest {
+			return bytes.Repeat([]byte("*"), len(data))
+		}
+		return data
+	})
+	req := []byte("secret")
+	newDispatch(rec)(req, make([]byte, 64), msgid.MsgUserStart)
+	if string(req) != "secret" {
+		t.Fatalf("the request buffer was modified: %q", req)
+	}
+	ex := Pair(readAll(t, buf.Bytes()))
+	if string(ex[0].Request) != "******" || string(ex[0].Response) != "SECRET" {
+		t.Errorf("exchange = %q -> %q", ex[0].Request, ex[0].Response)
+	}
+}
+
+// TestReadFile_Truncated: a server that died mid-frame leaves a file whose
+// complete frames are still returned.
+func TestReadFile_Truncated(t *testing.T) {
+	var buf bytes.Buffer
+	rec, _ := New(&buf)
+	rec.Record(KindRequest, msgid.MsgUserStart, 1, []byte("one"))
+	rec.Record(KindResponse, msgid.MsgUserStart, 1, []byte("ONE"))
+	path := filepath.Join(t.TempDir(), "cut"+Ext)
+	if err := os.WriteFile(path, buf.Bytes()[:buf.Len()-2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	frames, err := ReadFile(path)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("err = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if len(frames) != 1 || string(frames[0].Data) != "one" {
+		t.Errorf("frames = %+v", frames)
+	}
+
+	if _, err := NewReader(strings.NewReader("not a recording")); !errors.Is(err, ErrNotRecording) {
+		t.Errorf("NewReader on junk: err = %v", err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	t.Setenv(EnvDir, "")
+	if rec, err := Start("", "Proj"); rec != nil || err != nil {
+		t.Fatalf("Start with no directory = (%v, %v), want off", rec, err)
+	}
+	dir := filepath.Join(t.TempDir(), "rec")
+	t.Setenv(EnvDir, dir)
+	rec, err := Start(filepath.Join(t.TempDir(), "ignored"), "Proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+	if filepath.Dir(rec.Path()) != dir || !strings.HasPrefix(filepath.Base(rec.Path()), "Proj_") || filepath.Ext(rec.Path()) != Ext {
+		t.Errorf("recording path %s; want Proj_*%s in the %s directory", rec.Path(), Ext, EnvDir)
+	}
+}
+
+// fakeSender answers like newDispatch, except that "changed" now gets a
+// different reply and "fail" is a SYSTEM_ERROR.
+type fakeSender struct{}
+
+func (fakeSender) Send(_ context.Context, msgType shm.MsgType, req []byte) ([]byte, shm.MsgType, error) {
+	switch string(req) {
+	case "changed":
+		return []byte("CHANGES"), msgType, nil
+	case "fail":
+		return nil, shm.MsgTypeSystemError, errors.New("system error")
+	}
+	return bytes.ToUpper(req), msgType, nil
+}
+
+func TestReplay(t *testing.T) {
+	const fn = msgid.MsgUserStart
+	exchanges := []Exchange{
+		{Seq: 1, MsgType: fn, Request: []byte("same"), RespType: fn, Response: []byte("SAME"), HasResponse: true},
+		{Seq: 2, MsgType: fn, Request: []byte("changed"), RespType: fn, Response: []byte("CHANGED"), HasResponse: true},
+		{Seq: 3, MsgType: fn, Request: []byte("fail"), RespType: fn, Response: []byte("FAIL"), HasResponse: true},
+		{Seq: 4, MsgType: fn, Request: []byte("lost")},
+		{Seq: 5, MsgType: fn},
+	}
+	results := Replay(context.Background(), fakeSender{}, exchanges)
+	want := []Status{StatusMatch, StatusDiff, StatusDiff, StatusNoRecord, StatusSkipped}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Errorf("seq %d: status %s (%s), want %s", r.Seq, r.Status, r.Message, want[i])
+		}
+	}
+	if msg := results[1].Message; !strings.Contains(msg, "offset 6") {
+		t.Errorf("diff message %q does not locate the difference", msg)
+	}
+	if msg := results[2].Message; !strings.Contains(msg, "response type 127") {
+		t.Errorf("type diff message %q", msg)
+	}
+	if n := Failed(results); n != 3 {
+		t.Errorf("Failed = %d, want 3", n)
+	}
+
+	var table bytes.Buffer
+	if err := WriteTable(&table, results, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(table.String(), "unrecorded") {
+		t.Errorf("table:\n%s", table.String())
+	}
+}
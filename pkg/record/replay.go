@@ -0,0 +1,182 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/xll-gen/shm/go"
+)
+
+// Environment variables through which `xll-gen replay` hands the recording
+// and the results file to the go test it generates.
+const (
+	EnvReplayFile    = "XLLGEN_REPLAY_FILE"
+	EnvReplayResults = "XLLGEN_REPLAY_RESULTS"
+)
+
+// replayTimeout bounds one replayed request, so a handler that now hangs is
+// reported instead of stalling the run.
+const replayTimeout = 10 * time.Second
+
+// Sender delivers one request through a served dispatch and returns its
+// reply; *xllhost.Host is one. An error that leaves respType set (a
+// SYSTEM_ERROR reply) is a reply, not a failure.
+type Sender interface {
+	Send(ctx context.Context, msgType shm.MsgType, req []byte) ([]byte, shm.MsgType, error)
+}
+
+// Status is the outcome of one replayed exchange.
+type Status string
+
+const (
+	// StatusMatch is a response identical to the recorded one.
+	StatusMatch Status = "match"
+	// StatusDiff is a response that differs from the recorded one.
+	StatusDiff Status = "diff"
+	// StatusNoRecord is a request the recording has no response for; the
+	// replayed response is reported but cannot be compared.
+	StatusNoRecord Status = "unrecorded"
+	// StatusSkipped is a request whose payload was redacted away.
+	StatusSkipped Status = "skipped"
+	// StatusError is a request the replay could not deliver.
+	StatusError Status = "error"
+)
+
+// Result is the replay of one Exchange.
+type Result struct {
+	Seq      uint64 `json:"seq"`
+	MsgType  uint32 `json:"msg_type"`
+	Status   Status `json:"status"`
+	WantType uint32 `json:"want_type"`
+	GotType  uint32 `json:"got_type"`
+	WantLen  int    `json:"want_len"`
+	GotLen   int    `json:"got_len"`
+	// Message says what differed, or why the request was not compared.
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Replay sends each exchange's request through s in Seq order and compares
+// the reply with the recorded response byte for byte. The generated dispatch
+// builds its FlatBuffers deterministically, so any difference is a change in
+// what a handler returned — or a value that legitimately varies between runs
+// (a timestamp, a random ID), which the Message makes easy to tell apart.
+func Replay(ctx context.Context, s Sender, exchanges []Exchange) []Result {
+	results := make([]Result, 0, len(exchanges))
+	for _, ex := range exchanges {
+		start := time.Now()
+		r := replayOne(ctx, s, ex)
+		r.Duration = time.Since(start)
+		results = append(results, r)
+	}
+	return results
+}
+
+func replayOne(ctx context.Context, s Sender, ex Exchange) Result {
+	r := Result{Seq: ex.Seq, MsgType: ex.MsgType, WantType: ex.RespType, WantLen: len(ex.Response)}
+	if len(ex.Request) == 0 {
+		r.Status = StatusSkipped
+		r.Message = "request payload is empty (redacted)"
+		return r
+	}
+	ctx, cancel := context.WithTimeout(ctx, replayTimeout)
+	defer cancel()
+	got, gotType, err := s.Send(ctx, shm.MsgType(ex.MsgType), ex.Request)
+	if err != nil && gotType == 0 {
+		r.Status = StatusError
+		r.Message = err.Error()
+		return r
+	}
+	r.GotType, r.GotLen = uint32(gotType), len(got)
+	switch {
+	case !ex.HasResponse:
+		r.Status = StatusNoRecord
+		r.Message = fmt.Sprintf("no recorded response; replay answered type %d, %d bytes", r.GotType, r.GotLen)
+	case r.GotType != r.WantType:
+		r.Status = StatusDiff
+		r.Message = fmt.Sprintf("response type %d, recorded %d", r.GotType, r.WantType)
+	case !bytes.Equal(got, ex.Response):
+		r.Status = StatusDiff
+		r.Message = diffMessage(ex.Response, got)
+	default:
+		r.Status = StatusMatch
+	}
+	return r
+}
+
+// diffMessage describes where got first departs from want.
+func diffMessage(want, got []byte) string {
+	i := 0
+	for i < len(want) && i < len(got) && want[i] == got[i] {
+		i++
+	}
+	msg := fmt.Sprintf("%d bytes, recorded %d; first difference at offset %d", len(got), len(want), i)
+	return msg + fmt.Sprintf(": recorded % x, got % x", window(want, i), window(got, i))
+}
+
+// window returns up to 8 bytes of b starting at i.
+func window(b []byte, i int) []byte {
+	if i >= len(b) {
+		return nil
+	}
+	return b[i:min(i+8, len(b))]
+}
+
+// Failed counts the results that are neither a match nor skipped.
+func Failed(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if r.Status != StatusMatch && r.Status != StatusSkipped {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteResults saves results as JSON, for the process that launched the
+// replay to read back.
+func WriteResults(path string, results []Result) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ReadResults loads results saved by WriteResults.
+func ReadResults(path string) ([]Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("malformed replay results %s: %w", path, err)
+	}
+	if results == nil {
+		return nil, errors.New("replay results are empty")
+	}
+	return results, nil
+}
+
+// WriteTable prints one row per result: sequence number, message name (from
+// name, which may be nil), status and what differed.
+func WriteTable(w io.Writer, results []Result, name func(msgType uint32) string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEQ\tMESSAGE\tSTATUS\tDETAIL")
+	for _, r := range results {
+		label := fmt.Sprint(r.MsgType)
+		if name != nil {
+			label = name(r.MsgType)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", r.Seq, label, r.Status, r.Message)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,258 @@
+// Package retry implements the per-function `retry:` policy from xll.yaml for
+// the handler paths whose failure is pushed to a cell AFTER the fact: async
+// (the result arrives via the async batcher) and rtd-once (via
+// rtd.RunOnce/RunOnceGrid's SendErrorUpdate). A sync call has nowhere to hide
+// a retry but inside Excel's calc thread, so the generator never wires it there.
+//
+// The generated server builds one Policy per function at init with
+// MustParsePolicy (config.Validate has already run the same ParsePolicy, so it
+// cannot panic on a generated tree) and wraps the handler call in Do. Only the
+// final failure leaves Do; every failed attempt before it is logged with the
+// attempt count, so a flaky upstream is visible in the log without the user
+// ever seeing its intermediate errors in a cell.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/xll-gen/xll-gen/pkg/log"
+)
+
+// Classes accepted in retry_on besides a Go error type name.
+const (
+	// OnTimeout retries an error that is (or wraps) context.DeadlineExceeded, or
+	// that reports Timeout() == true (net.Error, os.ErrDeadlineExceeded, ...).
+	OnTimeout = "timeout"
+	// OnTransient retries an error marked with Transient, or one that reports
+	// Temporary() == true.
+	OnTransient = "transient"
+	// OnAny retries every error.
+	OnAny = "any"
+)
+
+// MaxAttempts caps attempts so a typo (attempts: 1000) cannot keep a topic or
+// async handle open for hours.
+const MaxAttempts = 10
+
+const (
+	// DefaultBackoff is the wait before the first retry when backoff is unset.
+	DefaultBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff caps the doubling backoff when max_backoff is unset.
+	DefaultMaxBackoff = 5 * time.Second
+)
+
+// DefaultRetryOn applies when retry_on is omitted: only failures that say they
+// may succeed next time. Retrying EVERY error would re-run handlers whose input
+// is simply invalid, so that takes an explicit `retry_on: [any]`.
+var DefaultRetryOn = []string{OnTimeout, OnTransient}
+
+// errorTypePattern is what %T prints for a named error type: an optional
+// pointer star, a package name and a type name ("*net.OpError",
+// "mypkg.RateLimitError").
+var errorTypePattern = regexp.MustCompile(`^\*?[A-Za-z_][A-Za-z0-9_]*\.[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Policy is a parsed retry policy. The zero value (Attempts 0) never retries.
+type Policy struct {
+	// Attempts is the total number of calls, including the first.
+	Attempts int
+	// Backoff is the wait before the first retry; it doubles per retry.
+	Backoff time.Duration
+	// MaxBackoff caps the doubled wait.
+	MaxBackoff time.Duration
+	// RetryOn lists the error classes (OnTimeout, OnTransient, OnAny) or Go
+	// error type names that are retried. Anything else fails immediately.
+	RetryOn []string
+}
+
+// ParsePolicy validates and builds a Policy from its xll.yaml fields. Empty
+// backoff / max_backoff / retry_on take the defaults above.
+func ParsePolicy(attempts int, backoff, maxBackoff string, retryOn []string) (Policy, error) {
+	p := Policy{Attempts: attempts, Backoff: DefaultBackoff, MaxBackoff: DefaultMaxBackoff}
+	if attempts < 1 || attempts > MaxAttempts {
+		return Policy{}, fmt.Errorf("attempts must be between 1 and %d, got %d", MaxAttempts, attempts)
+	}
+	if backoff != "" {
+		d, err := time.ParseDuration(backoff)
+		if err != nil {
+			return Policy{}, fmt.Errorf("backoff: %w", err)
+		}
+		if d < 0 {
+			return Policy{}, fmt.Errorf("backoff must not be negative, got %s", backoff)
+		}
+		p.Backoff = d
+	}
+	if maxBackoff != "" {
+		d, err := time.ParseDuration(maxBackoff)
+		if err != nil {
+			return Policy{}, fmt.Errorf("max_backoff: %w", err)
+		}
+		if d < p.Backoff {
+			return Policy{}, fmt.Errorf("max_backoff (%s) must not be less than backoff (%s)", maxBackoff, p.Backoff)
+		}
+		p.MaxBackoff = d
+	} else if p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = p.Backoff
+	}
+	if len(retryOn) == 0 {
+		retryOn = DefaultRetryOn
+	}
+	for _, c := range retryOn {
+		switch c {
+		case OnTimeout, OnTransient, OnAny:
+		default:
+			if !errorTypePattern.MatchString(c) {
+				return Policy{}, fmt.Errorf("retry_on: %q is neither %q, %q, %q nor a Go error type name as printed by %%T (e.g. \"*net.OpError\")", c, OnTimeout, OnTransient, OnAny)
+			}
+		}
+	}
+	p.RetryOn = append([]string(nil), retryOn...)
+	return p, nil
+}
+
+// MustParsePolicy is ParsePolicy for generated code, which only ever passes
+// values config.Validate accepted. It panics on an invalid policy.
+func MustParsePolicy(attempts int, backoff, maxBackoff string, retryOn []string) Policy {
+	p, err := ParsePolicy(attempts, backoff, maxBackoff, retryOn)
+	if err != nil {
+		panic("retry: " + err.Error())
+	}
+	return p
+}
+
+// transientError marks an error as retryable under OnTransient.
+type transientError struct{ err error }
+
+func (e transientError) Error() string { return e.err.Error() }
+func (e transientError) Unwrap() error { return e.err }
+
+// Transient marks err as retryable under retry_on: [transient]. It returns nil
+// for a nil err, so `return v, retry.Transient(err)` is safe on both paths.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{err: err}
+}
+
+// Retryable reports whether the policy retries err.
+func (p Policy) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, c := range p.RetryOn {
+		switch c {
+		case OnAny:
+			return true
+		case OnTimeout:
+			if isTimeout(err) {
+				return true
+			}
+		case OnTransient:
+			if isTransient(err) {
+				return true
+			}
+		default:
+			if hasErrorType(err, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Do calls fn until it succeeds, returns a non-retryable error, or the policy's
+// attempts are used up, and returns the last result. name is the function name
+// for the log lines.
+//
+// It never retries once ctx is done: that is the caller's deadline or a
+// shutdown/disconnect, and a retry could not deliver anything. The wait between
+// attempts is cancelled by ctx too, returning the last handler error (not
+// ctx.Err()) so the cell shows what actually failed.
+func Do[T any](ctx context.Context, name string, p Policy, fn func(context.Context) (T, error)) (T, error) {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	wait := p.Backoff
+	for attempt := 1; ; attempt++ {
+		v, err := fn(ctx)
+		if err == nil {
+			if attempt > 1 {
+				log.Info("retry: handler succeeded after retry", "func", name, "attempt", attempt, "attempts", attempts)
+			}
+			return v, nil
+		}
+		if attempt >= attempts || !p.Retryable(err) || ctx.Err() != nil {
+			if attempt > 1 {
+				log.Error("retry: handler failed after retries", "func", name, "attempt", attempt, "attempts", attempts, "err", err)
+			}
+			return v, err
+		}
+		log.Warn("retry: handler attempt failed, retrying", "func", name, "attempt", attempt, "attempts", attempts, "backoff", wait, "err", err)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			log.Error("retry: context done while waiting to retry", "func", name, "attempt", attempt, "attempts", attempts, "err", err)
+			return v, err
+		case <-t.C:
+		}
+		wait *= 2
+		if wait > p.MaxBackoff {
+			wait = p.MaxBackoff
+		}
+	}
+}
+
+// Wrap returns fn with the policy applied, for handing to a runner that takes
+// the handler as a func — rtd.RunOnce / rtd.RunOnceGrid. The runner still sees
+// exactly one result: the first success or the final failure.
+func Wrap[T any](name string, p Policy, fn func(context.Context) (T, error)) func(context.Context) (T, error) {
+	return func(ctx context.Context) (T, error) {
+		return Do(ctx, name, p, fn)
+	}
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
+
+func isTransient(err error) bool {
+	var te transientError
+	if errors.As(err, &te) {
+		return true
+	}
+	var t interface{ Temporary() bool }
+	return errors.As(err, &t) && t.Temporary()
+}
+
+// hasErrorType walks err's whole tree (Unwrap() error and Unwrap() []error)
+// looking for a link whose %T is name.
+func hasErrorType(err error, name string) bool {
+	if err == nil {
+		return false
+	}
+	if fmt.Sprintf("%T", err) == name {
+		return true
+	}
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return hasErrorType(u.Unwrap(), name)
+	case interface{ Unwrap() []error }:
+		for _, e := range u.Unwrap() {
+			if hasErrorType(e, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
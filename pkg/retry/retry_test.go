@@ -0,0 +1,140 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+type rateLimitError struct{}
+
+func (*rateLimitError) Error() string { return "rate limited" }
+
+func fastPolicy(t *testing.T, attempts int, retryOn ...string) Policy {
+	t.Helper()
+	p, err := ParsePolicy(attempts, "1ms", "2ms", retryOn)
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	return p
+}
+
+// TestDo_RetriesTransientThenSucceeds: the intermediate failures never leave Do.
+func TestDo_RetriesTransientThenSucceeds(t *testing.T) {
+	calls := 0
+	v, err := Do(context.Background(), "Flaky", fastPolicy(t, 3), func(context.Context) (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, Transient(errors.New("upstream 503"))
+		}
+		return 42, nil
+	})
+	if err != nil || v != 42 {
+		t.Fatalf("Do = (%d, %v), want (42, nil)", v, err)
+	}
+	if calls != 3 {
+		t.Fatalf("calls = %d, want 3", calls)
+	}
+}
+
+// TestDo_SurfacesOnlyTheFinalFailure: attempts are bounded and the LAST error
+// is what the caller (and so the cell) sees.
+func TestDo_SurfacesOnlyTheFinalFailure(t *testing.T) {
+	calls := 0
+	_, err := Do(context.Background(), "Flaky", fastPolicy(t, 3, OnAny), func(context.Context) (string, error) {
+		calls++
+		return "", fmt.Errorf("attempt %d failed", calls)
+	})
+	if calls != 3 {
+		t.Fatalf("calls = %d, want 3", calls)
+	}
+	if err == nil || err.Error() != "attempt 3 failed" {
+		t.Fatalf("err = %v, want the final attempt's error", err)
+	}
+}
+
+// TestDo_NonRetryableFailsImmediately: the default retry_on does not retry a
+// plain error (e.g. bad input), which would fail identically every time.
+func TestDo_NonRetryableFailsImmediately(t *testing.T) {
+	calls := 0
+	_, err := Do(context.Background(), "Strict", fastPolicy(t, 5), func(context.Context) (int, error) {
+		calls++
+		return 0, errors.New("invalid ticker")
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("calls = %d, err = %v; want one call and the error", calls, err)
+	}
+}
+
+// TestDo_StopsWhenContextDone: a cancelled caller (shutdown, disconnect,
+// function timeout) is never retried.
+func TestDo_StopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err := Do(ctx, "Cancelled", fastPolicy(t, 5, OnAny), func(context.Context) (int, error) {
+		calls++
+		cancel()
+		return 0, errors.New("boom")
+	})
+	if err == nil || calls != 1 {
+		t.Fatalf("calls = %d, err = %v; want one call and the handler error", calls, err)
+	}
+}
+
+func TestPolicy_Retryable(t *testing.T) {
+	p := fastPolicy(t, 2, OnTimeout, "*retry.rateLimitError")
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), true},
+		{"os deadline", os.ErrDeadlineExceeded, true},
+		{"named type", fmt.Errorf("wrapped: %w", &rateLimitError{}), true},
+		{"joined", errors.Join(errors.New("a"), &rateLimitError{}), true},
+		{"transient not listed", Transient(errors.New("x")), false},
+		{"plain", errors.New("x"), false},
+		{"nil", nil, false},
+	}
+	for _, c := range cases {
+		if got := p.Retryable(c.err); got != c.want {
+			t.Errorf("%s: Retryable = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy(3, "", "", nil)
+	if err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+	if p.Backoff != DefaultBackoff || p.MaxBackoff != DefaultMaxBackoff || len(p.RetryOn) != len(DefaultRetryOn) {
+		t.Errorf("defaults not applied: %+v", p)
+	}
+	if p, err := ParsePolicy(2, "10s", "", nil); err != nil || p.MaxBackoff != 10*time.Second {
+		t.Errorf("max_backoff must default to at least backoff, got %+v, %v", p, err)
+	}
+
+	bad := []struct {
+		attempts    int
+		backoff     string
+		maxBackoff  string
+		retryOn     []string
+		description string
+	}{
+		{0, "", "", nil, "zero attempts"},
+		{MaxAttempts + 1, "", "", nil, "too many attempts"},
+		{2, "soon", "", nil, "unparsable backoff"},
+		{2, "-1s", "", nil, "negative backoff"},
+		{2, "2s", "1s", nil, "max below backoff"},
+		{2, "", "", []string{"sometimes"}, "unknown class"},
+	}
+	for _, b := range bad {
+		if _, err := ParsePolicy(b.attempts, b.backoff, b.maxBackoff, b.retryOn); err == nil {
+			t.Errorf("%s: want an error", b.description)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package rtd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/internal/fbany"
+	"github.com/xll-gen/xll-gen/pkg/log"
+)
+
+// diskMemoExt is the extension of every file DiskMemo owns. PurgeDiskMemo and
+// the eviction scan only ever touch files with it (and the manifest), so a
+// memoize_dir pointed at a shared directory cannot lose unrelated files.
+const diskMemoExt = ".xllmemo"
+
+// diskMemoManifest records the salt the entries were written under.
+const diskMemoManifest = "store" + diskMemoExt + ".json"
+
+// diskMemoFormat is bumped if the entry layout changes; it is part of the
+// effective salt, so an old-format store is wiped rather than misread.
+const diskMemoFormat = 1
+
+// diskMemoEntry is one persisted rtd-once result. Value holds the protocol
+// mapping of the handler's result (see fbany.MapGo), so a replay pushes the
+// exact union member the live result would have; Kind "grid" holds the whole
+// serialized RtdOnceGridResult buffer instead.
+type diskMemoEntry struct {
+	Key      string          `json:"key"`
+	StoredAt time.Time       `json:"stored_at"`
+	Kind     string          `json:"kind"`
+	Value    json.RawMessage `json:"value"`
+}
+
+type diskMemoManifestFile struct {
+	Salt string `json:"salt"`
+}
+
+// DiskMemo persists completed rtd-once results across Excel sessions for the
+// functions declared memoize_store: disk. It sits in FRONT of the handler on
+// the Go side: a topic whose once-key has a stored result is answered from
+// disk without running the handler, and the host's RtdOnceRegistry then
+// memoizes that value for the session exactly as if it had been computed.
+//
+// Entries are keyed by the once-key (function name + topic args, which already
+// carry the content hash of composite args) and stamped with a salt derived
+// from project.version: opening the store under a different salt wipes it, so
+// an upgraded add-in never serves a result computed by the old code.
+//
+// Only successes are stored. A failure, including a cancelled handler, is never
+// memoized, on disk or in the host.
+//
+// A nil *DiskMemo is valid and stores nothing, so the generated server can keep
+// running uncached when the store could not be opened.
+type DiskMemo struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	total int64
+}
+
+// OpenDiskMemo opens (creating if needed) the store in dir. maxBytes caps the
+// total size of the entries; least-recently-used entries are evicted past it.
+// maxBytes <= 0 means no cap.
+func OpenDiskMemo(dir string, salt string, maxBytes int64) (*DiskMemo, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("rtd: create memoize store %s: %w", dir, err)
+	}
+	d := &DiskMemo{dir: dir, maxBytes: maxBytes}
+	salt = fmt.Sprintf("v%d:%s", diskMemoFormat, salt)
+
+	manifest := filepath.Join(dir, diskMemoManifest)
+	var mf diskMemoManifestFile
+	if data, err := os.ReadFile(manifest); err == nil && json.Unmarshal(data, &mf) == nil && mf.Salt == salt {
+		d.total = d.scan(nil)
+		return d, nil
+	}
+	// Missing, unreadable or from another version: start over.
+	if err := PurgeDiskMemo(dir); err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(diskMemoManifestFile{Salt: salt})
+	if err := writeFileAtomic(manifest, data); err != nil {
+		return nil, fmt.Errorf("rtd: write memoize store manifest: %w", err)
+	}
+	return d, nil
+}
+
+// PurgeDiskMemo deletes every entry and the manifest in dir. A missing dir is
+// not an error. Only files DiskMemo owns are removed.
+func PurgeDiskMemo(dir string) error {
+	ents, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("rtd: read memoize store %s: %w", dir, err)
+	}
+	var errs []error
+	for _, e := range ents {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), diskMemoExt) && e.Name() != diskMemoManifest {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WrapValue applies the store to a scalar rtd-once handler (rtd.RunOnce). A
+// stored result younger than maxAge (0 = no expiry, the memoize:true case) is
+// returned without calling fn; otherwise fn runs and a success is stored.
+func (d *DiskMemo) WrapValue(key string, maxAge time.Duration, fn func(context.Context) (any, error)) func(context.Context) (any, error) {
+	if d == nil {
+		return fn
+	}
+	return func(ctx context.Context) (any, error) {
+		if e, ok := d.get(key, maxAge); ok {
+			if v, err := e.value(); err == nil {
+				return v, nil
+			}
+			d.remove(key)
+		}
+		v, err := fn(ctx)
+		if err == nil {
+			d.putValue(key, v)
+		}
+		return v, err
+	}
+}
+
+// WrapGrid is WrapValue for a grid/numgrid rtd-once handler (rtd.RunOnceGrid):
+// the stored value is the serialized RtdOnceGridResult buffer.
+func (d *DiskMemo) WrapGrid(key string, maxAge time.Duration, fn func(context.Context) ([]byte, error)) func(context.Context) ([]byte, error) {
+	if d == nil {
+		return fn
+	}
+	return func(ctx context.Context) ([]byte, error) {
+		if e, ok := d.get(key, maxAge); ok && e.Kind == "grid" {
+			var b []byte
+			if err := json.Unmarshal(e.Value, &b); err == nil {
+				return b, nil
+			}
+			d.remove(key)
+		}
+		b, err := fn(ctx)
+		if err == nil {
+			raw, _ := json.Marshal(b)
+			d.put(diskMemoEntry{Key: key, Kind: "grid", Value: raw})
+		}
+		return b, err
+	}
+}
+
+func (d *DiskMemo) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+diskMemoExt)
+}
+
+func (d *DiskMemo) get(key string, maxAge time.Duration) (diskMemoEntry, bool) {
+	p := d.path(key)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return diskMemoEntry{}, false
+	}
+	var e diskMemoEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.Key != key {
+		d.remove(key)
+		return diskMemoEntry{}, false
+	}
+	if maxAge > 0 && time.Since(e.StoredAt) > maxAge {
+		d.remove(key)
+		return diskMemoEntry{}, false
+	}
+	// Touch: eviction is least-recently-USED, by modification time.
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return e, true
+}
+
+func (d *DiskMemo) remove(key string) {
+	p := d.path(key)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if fi, err := os.Stat(p); err == nil {
+		if os.Remove(p) == nil {
+			d.total -= fi.Size()
+		}
+	}
+}
+
+func (d *DiskMemo) putValue(key string, v any) {
+	tag, payload := fbany.MapGo(v)
+	var kind string
+	switch tag {
+	case protocol.AnyValueNil:
+		kind = "nil"
+	case protocol.AnyValueStr:
+		kind = "str"
+	case protocol.AnyValueInt:
+		kind = "int"
+	case protocol.AnyValueNum:
+		kind = "num"
+	case protocol.AnyValueBool:
+		kind = "bool"
+	case protocol.AnyValueDate:
+		kind = "date"
+	default:
+		return
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		// NaN/Inf: nothing JSON can hold; the host still memoizes it in-process.
+		return
+	}
+	d.put(diskMemoEntry{Key: key, Kind: kind, Value: raw})
+}
+
+func (d *DiskMemo) put(e diskMemoEntry) {
+	e.StoredAt = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	p := d.path(e.Key)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var old int64
+	if fi, err := os.Stat(p); err == nil {
+		old = fi.Size()
+	}
+	if err := writeFileAtomic(p, data); err != nil {
+		log.Warn("rtd: memoize store write failed", "dir", d.dir, "error", err)
+		return
+	}
+	d.total += int64(len(data)) - old
+	if d.maxBytes > 0 && d.total > d.maxBytes {
+		d.total = d.scan(&p)
+	}
+}
+
+// scan totals the entries and, when over the cap, evicts least-recently-used
+// ones (never keep, the entry just written) until under it. Caller holds mu,
+// or owns d exclusively.
+func (d *DiskMemo) scan(keep *string) int64 {
+	ents, err := os.ReadDir(d.dir)
+	if err != nil {
+		return d.total
+	}
+	type file struct {
+		path string
+		size int64
+		mod  time.Time
+	}
+	var files []file
+	var total int64
+	for _, e := range ents {
+		if e.IsDir() || e.Name() == diskMemoManifest || !strings.HasSuffix(e.Name(), diskMemoExt) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{filepath.Join(d.dir, e.Name()), fi.Size(), fi.ModTime()})
+		total += fi.Size()
+	}
+	if keep == nil || d.maxBytes <= 0 || total <= d.maxBytes {
+		return total
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.Before(files[j].mod) })
+	evicted := 0
+	for _, f := range files {
+		if total <= d.maxBytes {
+			break
+		}
+		if f.path == *keep {
+			continue
+		}
+		if os.Remove(f.path) == nil {
+			total -= f.size
+			evicted++
+		}
+	}
+	log.Info("rtd: memoize store over its size cap, evicted least-recently-used entries", "dir", d.dir, "evicted", evicted, "bytes", total, "max_bytes", d.maxBytes)
+	return total
+}
+
+// value decodes a scalar entry back into the Go value fbany.MapGo maps onto
+// the same union member it was stored from.
+func (e diskMemoEntry) value() (any, error) {
+	var err error
+	switch e.Kind {
+	case "nil":
+		return nil, nil
+	case "str":
+		var s string
+		err = json.Unmarshal(e.Value, &s)
+		return s, err
+	case "int":
+		var n int32
+		err = json.Unmarshal(e.Value, &n)
+		return n, err
+	case "num":
+		var f float64
+		err = json.Unmarshal(e.Value, &f)
+		return f, err
+	case "bool":
+		var b bool
+		err = json.Unmarshal(e.Value, &b)
+		return b, err
+	case "date":
+		var t time.Time
+		err = json.Unmarshal(e.Value, &t)
+		return t, err
+	default:
+		return nil, fmt.Errorf("unknown memoize entry kind %q", e.Kind)
+	}
+}
@@ -0,0 +1,168 @@
+package rtd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func countingValue(calls *int, v any, err error) func(context.Context) (any, error) {
+	return func(context.Context) (any, error) {
+		*calls++
+		return v, err
+	}
+}
+
+// TestDiskMemo_SurvivesReopen is the cross-session story: a result computed
+// under one store is served by a fresh store on the same dir (a new Excel
+// session) without running the handler, as the same union member.
+func TestDiskMemo_SurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	first, err := OpenDiskMemo(dir, "1.0.0", 0)
+	if err != nil {
+		t.Fatalf("OpenDiskMemo: %v", err)
+	}
+	calls := 0
+	if v, err := first.WrapValue("Calib\x1f7", 0, countingValue(&calls, int32(42), nil))(context.Background()); err != nil || v != int32(42) {
+		t.Fatalf("first run = (%v, %v)", v, err)
+	}
+
+	second, err := OpenDiskMemo(dir, "1.0.0", 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	v, err := second.WrapValue("Calib\x1f7", 0, countingValue(&calls, int32(0), nil))(context.Background())
+	if err != nil || v != int32(42) {
+		t.Fatalf("replay = (%#v, %v), want int32(42)", v, err)
+	}
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1 (the replay must not recompute)", calls)
+	}
+}
+
+// TestDiskMemo_NewSaltWipesTheStore: bumping project.version must invalidate
+// every result computed by the previous build.
+func TestDiskMemo_NewSaltWipesTheStore(t *testing.T) {
+	dir := t.TempDir()
+	old, _ := OpenDiskMemo(dir, "1.0.0", 0)
+	calls := 0
+	_, _ = old.WrapValue("k", 0, countingValue(&calls, "v1", nil))(context.Background())
+
+	upgraded, err := OpenDiskMemo(dir, "1.1.0", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := upgraded.WrapValue("k", 0, countingValue(&calls, "v2", nil))(context.Background())
+	if v != "v2" || calls != 2 {
+		t.Fatalf("after upgrade got %v with %d calls, want a recompute", v, calls)
+	}
+}
+
+// TestDiskMemo_FailuresAreNotStored: a failed handler must be retried next time.
+func TestDiskMemo_FailuresAreNotStored(t *testing.T) {
+	d, _ := OpenDiskMemo(t.TempDir(), "", 0)
+	calls := 0
+	_, _ = d.WrapValue("k", 0, countingValue(&calls, nil, errors.New("boom")))(context.Background())
+	_, _ = d.WrapValue("k", 0, countingValue(&calls, 1.5, nil))(context.Background())
+	if calls != 2 {
+		t.Fatalf("calls = %d, want 2 (an error must not be memoized)", calls)
+	}
+}
+
+// TestDiskMemo_MaxAgeExpires mirrors memoize_ttl on disk.
+func TestDiskMemo_MaxAgeExpires(t *testing.T) {
+	d, _ := OpenDiskMemo(t.TempDir(), "", 0)
+	calls := 0
+	_, _ = d.WrapValue("k", time.Nanosecond, countingValue(&calls, "a", nil))(context.Background())
+	time.Sleep(time.Millisecond)
+	_, _ = d.WrapValue("k", time.Nanosecond, countingValue(&calls, "b", nil))(context.Background())
+	if calls != 2 {
+		t.Fatalf("calls = %d, want 2 (the entry outlived its TTL)", calls)
+	}
+}
+
+// TestDiskMemo_GridRoundTrip: grid results are the serialized buffer, verbatim.
+func TestDiskMemo_GridRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	d, _ := OpenDiskMemo(dir, "", 0)
+	want := []byte{0xde, 0xad, 0xbe, 0xef}
+	run := func(context.Context) ([]byte, error) { return want, nil }
+	_, _ = d.WrapGrid("g", 0, run)(context.Background())
+
+	d2, _ := OpenDiskMemo(dir, "", 0)
+	got, err := d2.WrapGrid("g", 0, func(context.Context) ([]byte, error) {
+		t.Fatal("grid handler must not run on a disk hit")
+		return nil, nil
+	})(context.Background())
+	if err != nil || string(got) != string(want) {
+		t.Fatalf("grid replay = (%x, %v), want %x", got, err, want)
+	}
+}
+
+// TestDiskMemo_SizeCapEvictsLeastRecentlyUsed keeps the store under max bytes.
+func TestDiskMemo_SizeCapEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	d, _ := OpenDiskMemo(dir, "", 400)
+	big := strings.Repeat("x", 150)
+	calls := 0
+	for _, k := range []string{"a", "b", "c", "d"} {
+		_, _ = d.WrapValue(k, 0, countingValue(&calls, big, nil))(context.Background())
+		time.Sleep(10 * time.Millisecond) // distinct mtimes
+	}
+	var total int64
+	ents, _ := os.ReadDir(dir)
+	for _, e := range ents {
+		if e.Name() == diskMemoManifest {
+			continue
+		}
+		fi, _ := e.Info()
+		total += fi.Size()
+	}
+	if total > 400 {
+		t.Fatalf("store holds %d bytes, cap is 400", total)
+	}
+	if _, ok := d.get("d", 0); !ok {
+		t.Error("the most recent entry must survive eviction")
+	}
+	if _, ok := d.get("a", 0); ok {
+		t.Error("the least recently used entry must be evicted first")
+	}
+}
+
+// TestPurgeDiskMemo_OnlyOwnFiles: purge must not touch unrelated files in a
+// shared directory.
+func TestPurgeDiskMemo_OnlyOwnFiles(t *testing.T) {
+	dir := t.TempDir()
+	d, _ := OpenDiskMemo(dir, "", 0)
+	_, _ = d.WrapValue("k", 0, func(context.Context) (any, error) { return "v", nil })(context.Background())
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := PurgeDiskMemo(dir); err != nil {
+		t.Fatalf("PurgeDiskMemo: %v", err)
+	}
+	ents, _ := os.ReadDir(dir)
+	if len(ents) != 1 || ents[0].Name() != "notes.txt" {
+		t.Fatalf("after purge dir holds %v, want only notes.txt", ents)
+	}
+	if err := PurgeDiskMemo(filepath.Join(dir, "missing")); err != nil {
+		t.Fatalf("purging a missing dir must be a no-op, got %v", err)
+	}
+}
+
+// TestDiskMemo_NilIsPassThrough: the server keeps running uncached when the
+// store could not be opened.
+func TestDiskMemo_NilIsPassThrough(t *testing.T) {
+	var d *DiskMemo
+	calls := 0
+	_, _ = d.WrapValue("k", 0, countingValue(&calls, 1, nil))(context.Background())
+	_, _ = d.WrapValue("k", 0, countingValue(&calls, 1, nil))(context.Background())
+	if calls != 2 {
+		t.Fatalf("calls = %d, want 2", calls)
+	}
+}
@@ -116,6 +116,11 @@ type RtdManager struct {
 	// guest->host sends that are (or are about to be) touching the SHM mapping.
 	stopped bool
 	sendWG  sync.WaitGroup
+
+	// snap is the opt-in last-value snapshot (see EnableSnapshot); nil when
+	// rtd.snapshot is off. Guarded by mu for the pointer only — the store has
+	// its own lock for its contents.
+	snap *snapshotStore
 }
 
 // GlobalRtd is the singleton instance of RtdManager.
@@ -130,11 +135,13 @@ func NewRtdManager() *RtdManager {
 	}
 }
 
-// SetClient sets the SHM client used to send updates.
-func (m *RtdManager) SetClient(c *shm.Client) {
+// SetClient sets the client used to send updates: the *shm.Client in
+// production, or any other link to the host (pkg/xllhost's in-process host
+// in tests).
+func (m *RtdManager) SetClient(c rtdClient) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if c == nil {
+	if sc, ok := c.(*shm.Client); c == nil || (ok && sc == nil) {
 		// Avoid storing a typed-nil in the interface field, which would
 		// defeat the client == nil guards below.
 		m.client = nil
@@ -145,14 +152,54 @@ func (m *RtdManager) SetClient(c *shm.Client) {
 
 // Subscribe registers a TopicID to a logical key.
 // Future calls to Publish(key, value) will update this TopicID.
+//
+// With the snapshot enabled (EnableSnapshot), a key that has a persisted value
+// from a previous run but no live value yet has that value sent to the topic
+// right away, marked as coming from the snapshot. The check runs under the
+// store's lock, which Publish takes to record a live value, and the send runs
+// under a guard on the key alone, which a Publish to that key waits on before
+// it sends. So a racing Publish either suppresses the replay or lands after it
+// — the stale value never overwrites a live one — while Publishes to other
+// keys never wait on a slow replay. A failure is logged, not returned — the
+// live feed will overwrite the cell anyway.
 func (m *RtdManager) Subscribe(key string, topicID int32) {
+	if !m.subscribe(key, topicID) {
+		return
+	}
+	m.mu.RLock()
+	s := m.snap
+	m.mu.RUnlock()
+	if s == nil {
+		return
+	}
+	// The send runs outside s.mu, which Publish takes for every key; the
+	// replay's guard is what makes a Publish to THIS key wait until it is done.
+	v, guard, ok := s.beginReplay(key)
+	if !ok {
+		return
+	}
+	defer s.endReplay(key, guard)
+	client, err := m.beginSend()
+	if err != nil {
+		log.Warn("rtd: snapshot replay failed", "key", key, "topicID", topicID, "error", err)
+		return
+	}
+	defer m.endSend()
+	if err := sendUpdate(client, topicID, v, false); err != nil {
+		log.Warn("rtd: snapshot replay failed", "key", key, "topicID", topicID, "error", err)
+	}
+}
+
+// subscribe updates the subscription maps and reports whether topicID is newly
+// bound to key (false when it already was).
+func (m *RtdManager) subscribe(key string, topicID int32) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// If this topicID is already subscribed to a different key, unsubscribe first
 	if oldKey, ok := m.idToKey[topicID]; ok {
 		if oldKey == key {
-			return // Already subscribed to this key
+			return false // Already subscribed to this key
 		}
 		// Remove from old key's set
 		delete(m.keyToIDs[oldKey], topicID)
@@ -166,6 +213,7 @@ func (m *RtdManager) Subscribe(key string, topicID int32) {
 	}
 	m.keyToIDs[key][topicID] = struct{}{}
 	m.idToKey[topicID] = key
+	return true
 }
 
 // Unsubscribe removes a TopicID from management AND cancels any in-flight
@@ -318,6 +366,10 @@ func (m *RtdManager) Stop(timeout time.Duration) bool {
 	m.stopped = true
 	m.mu.Unlock()
 
+	// The snapshot is a local file, not the mapping: write the final copy now,
+	// before a possibly long drain, so a drain timeout cannot lose it.
+	m.stopSnapshot()
+
 	done := make(chan struct{})
 	go func() {
 		m.sendWG.Wait()
@@ -341,8 +393,15 @@ func (m *RtdManager) Stop(timeout time.Duration) bool {
 // host. A send failure for one topic does not starve the remaining topics:
 // every topic is attempted, each failure is logged, and the per-topic errors
 // are returned joined via errors.Join (nil when all sends succeed).
+//
+// With the snapshot enabled, the value is also recorded as the key's last
+// value — even when nobody is subscribed right now.
 func (m *RtdManager) Publish(key string, value interface{}) error {
 	m.mu.RLock()
+	var replay <-chan struct{}
+	if m.snap != nil {
+		replay = m.snap.record(key, value)
+	}
 	ids := m.keyToIDs[key]
 	topicIDs := make([]int32, 0, len(ids))
 	for id := range ids {
@@ -353,6 +412,11 @@ func (m *RtdManager) Publish(key string, value interface{}) error {
 	if len(topicIDs) == 0 {
 		return nil
 	}
+	// A snapshot replay of this key still sending must land first, or the
+	// stale marked value would overwrite the live one.
+	if replay != nil {
+		<-replay
+	}
 
 	// One registration for the whole fan-out; the sends themselves stay outside
 	// the lock as before. beginSends also replaces the old `client == nil` check,
@@ -406,6 +470,20 @@ func (m *RtdManager) SendErrorUpdate(topicID int32, value interface{}) error {
 	return sendUpdate(client, topicID, value, true)
 }
 
+// SendProgress pushes an INTERIM display value to an rtd-once topic (see
+// Progress). It is an RtdUpdate carrying text, tagged MsgRtdProgress instead of
+// MsgRtdUpdate, so the host paints it but never stores it as the topic's
+// one-shot result: the memoize / memoize_ttl lifecycle only ever sees the final
+// SendUpdate / SendErrorUpdate.
+func (m *RtdManager) SendProgress(topicID int32, text string) error {
+	client, err := m.beginSend()
+	if err != nil {
+		return err
+	}
+	defer m.endSend()
+	return sendRtdMessage(client, topicID, text, false, msgid.MsgRtdProgress)
+}
+
 // sendUpdate serializes value into an RtdUpdate message and sends it via
 // client. It takes the client as a parameter (instead of reading m.client)
 // so callers can snapshot the client under the manager lock and perform the
@@ -413,6 +491,13 @@ func (m *RtdManager) SendErrorUpdate(topicID int32, value interface{}) error {
 // SendErrorUpdate); the default-false flag is elided by flatc, so a false value
 // keeps the wire bytes byte-identical to the pre-is_error encoding.
 func sendUpdate(client rtdClient, topicID int32, value interface{}, isError bool) error {
+	return sendRtdMessage(client, topicID, value, isError, msgid.MsgRtdUpdate)
+}
+
+// sendRtdMessage is sendUpdate with the slot message type as a parameter: the
+// RtdUpdate table is shared by MsgRtdUpdate (a value) and MsgRtdProgress (a
+// display-only interim value).
+func sendRtdMessage(client rtdClient, topicID int32, value interface{}, isError bool, msgType shm.MsgType) error {
 	if client == nil {
 		return fmt.Errorf("server not connected")
 	}
@@ -433,7 +518,7 @@ func sendUpdate(client rtdClient, topicID int32, value interface{}, isError bool
 
 	data := b.FinishedBytes()
 
-	_, err := client.SendGuestCallWithTimeout(data, msgid.MsgRtdUpdate, 1000*time.Millisecond)
+	_, err := client.SendGuestCallWithTimeout(data, msgType, 1000*time.Millisecond)
 	return err
 }
 
@@ -29,7 +29,8 @@ type stubRtdClient struct {
 	calls       []stubCall
 	started     chan struct{} // closed when the first send begins (if non-nil)
 	startedOnce sync.Once
-	release     chan struct{} // sends block until closed (if non-nil)
+	release     chan struct{}  // sends block until closed (if non-nil)
+	holdTopics  map[int32]bool // when non-nil, only these topics wait on release
 	failTopics  map[int32]error
 }
 
@@ -46,7 +47,7 @@ func (s *stubRtdClient) SendGuestCallWithTimeout(data []byte, msgType shm.MsgTyp
 	if s.started != nil {
 		s.startedOnce.Do(func() { close(s.started) })
 	}
-	if s.release != nil {
+	if s.release != nil && (s.holdTopics == nil || s.holdTopics[topicID]) {
 		<-s.release
 	}
 	if err := s.failTopics[topicID]; err != nil {
@@ -362,6 +363,11 @@ func TestSendUpdate_NoClient(t *testing.T) {
 	if err := m.SendUpdate(1, "x"); err == nil {
 		t.Fatal("expected error after SetClient(nil)")
 	}
+	var typedNil *shm.Client
+	m.SetClient(typedNil)
+	if err := m.SendUpdate(1, "x"); err == nil {
+		t.Fatal("expected error after SetClient((*shm.Client)(nil))")
+	}
 }
 
 func TestPublish_NoSubscribers(t *testing.T) {
@@ -0,0 +1,97 @@
+package rtd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// progressSender is the surface Progress needs. *RtdManager satisfies it; a
+// RunOnce/RunOnceGrid caller whose manager does not (a test fake) simply gets
+// no progress reporting.
+type progressSender interface {
+	SendProgress(topicID int32, text string) error
+}
+
+// Compile-time assertion that *RtdManager implements progressSender.
+var _ progressSender = (*RtdManager)(nil)
+
+type progressKey struct{}
+
+// progressReporter is what RunOnce/RunOnceGrid attach to the handler ctx. It
+// remembers the last text pushed so a handler calling Progress in a tight loop
+// does not flood the host with identical updates.
+type progressReporter struct {
+	mgr     progressSender
+	topicID int32
+
+	mu   sync.Mutex
+	last string
+	done bool
+}
+
+// withProgress returns ctx carrying a progress reporter for topicID, or ctx
+// unchanged when mgr cannot send progress.
+func withProgress(ctx context.Context, mgr any, topicID int32) (context.Context, *progressReporter) {
+	ps, ok := mgr.(progressSender)
+	if !ok {
+		return ctx, nil
+	}
+	r := &progressReporter{mgr: ps, topicID: topicID}
+	return context.WithValue(ctx, progressKey{}, r), r
+}
+
+// finish stops the reporter: a Progress call racing the final result (from a
+// goroutine the handler forgot to stop) must not repaint over it. Progress
+// holds mu across its send, so finish also waits out one already in flight,
+// and the final result is always the last message for the topic.
+func (r *progressReporter) finish() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.done = true
+	r.mu.Unlock()
+}
+
+// Progress reports interim progress from inside a mode:"rtd-once" handler.
+// The cell shows it (e.g. "Running 45%") in place of the loading placeholder
+// until the handler returns; it is NEVER stored as the one-shot result, so
+// memoize / memoize_ttl retention only ever applies to the final value.
+//
+// fraction is clamped to [0, 1] and rendered as a whole percentage after msg
+// ("Running" when msg is empty). A negative or NaN fraction means
+// "indeterminate": only msg is shown. Repeating the previous text is a no-op.
+//
+// Outside an rtd-once handler (a sync/async handler, or a ctx that did not come
+// from RunOnce/RunOnceGrid) Progress does nothing and returns nil, so shared
+// helper code can call it unconditionally. Scalar rtd-once cells display the
+// progress text; a grid/numgrid cell keeps its placeholder, because a spilled
+// result cannot share its anchor cell with a text value.
+func Progress(ctx context.Context, fraction float64, msg string) error {
+	r, _ := ctx.Value(progressKey{}).(*progressReporter)
+	if r == nil {
+		return nil
+	}
+	text := progressText(fraction, msg)
+
+	// The send stays under mu so it cannot land after finish: see finish.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done || text == r.last {
+		return nil
+	}
+	r.last = text
+	return r.mgr.SendProgress(r.topicID, text)
+}
+
+func progressText(fraction float64, msg string) string {
+	if math.IsNaN(fraction) || fraction < 0 {
+		return msg
+	}
+	if msg == "" {
+		msg = "Running"
+	}
+	return fmt.Sprintf("%s %d%%", msg, int(math.Min(fraction, 1)*100))
+}
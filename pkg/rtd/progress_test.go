@@ -0,0 +1,134 @@
+package rtd
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/xll-gen/xll-gen/pkg/msgid"
+)
+
+// TestProgress_OutsideRunOnceIsNoop: shared helper code calls Progress
+// unconditionally, so a plain ctx must neither panic nor error.
+func TestProgress_OutsideRunOnceIsNoop(t *testing.T) {
+	if err := Progress(context.Background(), 0.5, "x"); err != nil {
+		t.Fatalf("Progress outside RunOnce = %v, want nil", err)
+	}
+}
+
+// TestProgress_RunOnceSendsProgressThenResult pins the wire order: interim
+// progress goes out as MsgRtdProgress (never MsgRtdUpdate, so the host cannot
+// mistake it for the one-shot result), deduped, followed by the real result.
+func TestProgress_RunOnceSendsProgressThenResult(t *testing.T) {
+	m := NewRtdManager()
+	client := &stubRtdClient{}
+	m.client = client
+
+	err := RunOnce(context.Background(), m, 5, func(ctx context.Context) (any, error) {
+		_ = Progress(ctx, 0.25, "")
+		_ = Progress(ctx, 0.25, "") // identical text: deduped
+		_ = Progress(ctx, 0.5, "Loading")
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	calls := client.snapshotCalls()
+	if len(calls) != 3 {
+		t.Fatalf("want 2 progress + 1 result sends, got %d", len(calls))
+	}
+	for i, want := range []string{"Running 25%", "Loading 50%"} {
+		if calls[i].msgType != msgid.MsgRtdProgress {
+			t.Errorf("send %d msgType = %d, want MsgRtdProgress", i, calls[i].msgType)
+		}
+		if got := sentString(t, calls[i]); got != want {
+			t.Errorf("send %d text = %q, want %q", i, got, want)
+		}
+	}
+	if calls[2].msgType != msgid.MsgRtdUpdate {
+		t.Errorf("final msgType = %d, want MsgRtdUpdate", calls[2].msgType)
+	}
+	if got := sentString(t, calls[2]); got != "done" {
+		t.Errorf("final value = %q", got)
+	}
+	m.Stop(time.Second)
+}
+
+// TestProgress_LateCallAfterResultIsDropped: a goroutine the handler forgot to
+// stop must not repaint progress over the delivered result.
+func TestProgress_LateCallAfterResultIsDropped(t *testing.T) {
+	m := NewRtdManager()
+	client := &stubRtdClient{}
+	m.client = client
+
+	var leaked context.Context
+	_ = RunOnce(context.Background(), m, 9, func(ctx context.Context) (any, error) {
+		leaked = ctx
+		return 1.0, nil
+	})
+	if err := Progress(leaked, 0.9, ""); err != nil {
+		t.Fatalf("late Progress = %v, want nil", err)
+	}
+	if calls := client.snapshotCalls(); len(calls) != 1 {
+		t.Fatalf("want only the result send, got %d", len(calls))
+	}
+	m.Stop(time.Second)
+}
+
+func TestProgressText(t *testing.T) {
+	cases := []struct {
+		fraction float64
+		msg      string
+		want     string
+	}{
+		{0, "", "Running 0%"},
+		{0.456, "Pricing", "Pricing 45%"},
+		{1.7, "", "Running 100%"},
+		{-1, "Waiting for feed", "Waiting for feed"},
+		{math.NaN(), "Queued", "Queued"},
+	}
+	for _, c := range cases {
+		if got := progressText(c.fraction, c.msg); got != c.want {
+			t.Errorf("progressText(%v, %q) = %q, want %q", c.fraction, c.msg, got, c.want)
+		}
+	}
+}
+
+// TestProgress_InFlightSendFinishesBeforeResult: a Progress send already under
+// way when the handler returns must complete before the result goes out, so
+// the host never receives progress after the final value.
+func TestProgress_InFlightSendFinishesBeforeResult(t *testing.T) {
+	m := NewRtdManager()
+	client := &stubRtdClient{started: make(chan struct{}), release: make(chan struct{})}
+	m.client = client
+
+	done := make(chan error, 1)
+	go func() {
+		done <- RunOnce(context.Background(), m, 3, func(ctx context.Context) (any, error) {
+			go func() { _ = Progress(ctx, 0.5, "") }()
+			<-client.started // the progress send is blocked in the host
+			return "done", nil
+		})
+	}()
+	<-client.started
+	select {
+	case <-done:
+		t.Fatal("RunOnce returned while a progress send was still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(client.release)
+	if err := <-done; err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	calls := client.snapshotCalls()
+	if len(calls) != 2 {
+		t.Fatalf("want the progress and the result, got %d sends", len(calls))
+	}
+	if calls[0].msgType != msgid.MsgRtdProgress || calls[1].msgType != msgid.MsgRtdUpdate {
+		t.Errorf("send order = %d, %d; want progress then result", calls[0].msgType, calls[1].msgType)
+	}
+	m.Stop(time.Second)
+}
@@ -47,6 +47,14 @@ var _ updateSender = (*RtdManager)(nil)
 // handler observing it and returning ctx.Err()), the cancellation is treated
 // as a handler error and pushed as its string — the cell will not hang. The
 // handler is responsible for honoring ctx; RunOnce does not preempt it.
+//
+// Progress: when mgr can send progress (*RtdManager can), the handler ctx
+// carries a reporter, so rtd.Progress(ctx, ...) inside fn paints interim text.
+//
+// Retry: a function's retry: policy is applied by passing fn through
+// retry.Wrap (the generated server does this), so "exactly once" is per
+// delivery — RunOnce still pushes one value, the first success or the final
+// failure; the failed attempts before it are only logged.
 func RunOnce(ctx context.Context, mgr updateSender, topicID int32, fn func(context.Context) (any, error)) error {
 	if fn == nil {
 		return fmt.Errorf("rtd.RunOnce: nil handler for topic %d", topicID)
@@ -63,7 +71,12 @@ func RunOnce(ctx context.Context, mgr updateSender, topicID int32, fn func(conte
 		return mgr.SendErrorUpdate(topicID, err.Error())
 	}
 
+	// The handler may report interim progress via rtd.Progress(ctx, ...); the
+	// reporter is finished before the final push so a stray late Progress
+	// cannot repaint over the result.
+	ctx, pr := withProgress(ctx, mgr, topicID)
 	value, err := fn(ctx)
+	pr.finish()
 	if err != nil {
 		log.Error("rtd.RunOnce: handler returned error", "topicID", topicID, "err", err)
 		// Push the error string as the topic value (is_error=true) so the cell
@@ -159,7 +172,9 @@ func RunOnceGrid(ctx context.Context, mgr gridSender, topicID int32, onceKey str
 		return mgr.SendErrorUpdate(topicID, err.Error())
 	}
 
+	ctx, pr := withProgress(ctx, mgr, topicID)
 	payload, err := run(ctx)
+	pr.finish()
 	if err != nil {
 		log.Error("rtd.RunOnceGrid: handler returned error", "topicID", topicID, "err", err)
 		// Push the error string as the topic value (is_error=true); never ship a
@@ -0,0 +1,404 @@
+package rtd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xll-gen/xll-gen/pkg/log"
+)
+
+// snapshotFlushInterval bounds how stale the on-disk snapshot can be when the
+// server dies without a clean Stop (Excel killed, machine lost power). Stop
+// always writes a final copy; the periodic flush only covers the unclean exit.
+const snapshotFlushInterval = 5 * time.Second
+
+// snapshotMaxIdleSessions is how many sessions in a row a key may go without a
+// Subscribe or a live Publish before it is dropped from the snapshot, so keys
+// from deleted workbooks or retired feeds do not accumulate in the file forever.
+const snapshotMaxIdleSessions = 10
+
+// snapshotFileVersion is bumped if the on-disk layout ever changes. A file with
+// a different version is ignored (treated as empty), never half-parsed.
+const snapshotFileVersion = 1
+
+// snapshotValue is one persisted last value. Only scalars are persisted: Kind
+// is "str", "num", "int" or "bool". A grid or any other composite value is not
+// something a single RTD cell can show anyway, so Publish simply skips it.
+//
+// Idle counts the sessions since the key was last subscribed or published; an
+// older file without it reads as 0.
+type snapshotValue struct {
+	Kind  string          `json:"kind"`
+	Value json.RawMessage `json:"value"`
+	Idle  int             `json:"idle,omitempty"`
+}
+
+// snapshotFile is the on-disk layout: last value per Publish key.
+type snapshotFile struct {
+	Version int                      `json:"version"`
+	Values  map[string]snapshotValue `json:"values"`
+}
+
+// snapshotStore is the opt-in (rtd.snapshot) last-value store behind
+// EnableSnapshot. It has its own mutex rather than sharing RtdManager.mu:
+// Publish only holds a READ lock on mu while it snapshots the topic set, and
+// the store must not widen that into a write lock on the hot publish path.
+type snapshotStore struct {
+	mu     sync.Mutex
+	path   string
+	marker string
+	// values holds the last value per key: loaded from disk at EnableSnapshot
+	// (minus the keys idle for snapshotMaxIdleSessions), then overwritten by
+	// every live Publish.
+	values map[string]snapshotValue
+	// live marks keys that have had a live Publish in THIS process. Only keys
+	// NOT in live are replayed on Subscribe: once the feed has ticked, the
+	// snapshot value is history and the cell already shows the real one.
+	live  map[string]bool
+	dirty bool
+	// replaying holds a guard per key whose replay is being sent. The send
+	// happens outside mu, so a Publish to the key waits on the guard rather
+	// than on mu, and a slow replay stalls only its own key.
+	replaying map[string]*replayGuard
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// replayGuard counts the replays of one key still sending; done is closed when
+// the last of them returns.
+type replayGuard struct {
+	n    int
+	done chan struct{}
+}
+
+// EnableSnapshot turns on the RTD last-value snapshot: the last value
+// Published per key is kept in path (written atomically, every few seconds
+// while dirty and once more on Stop), and a topic Subscribed to a key that has
+// a snapshot value but no live value yet is immediately sent that value
+// rendered as text with marker appended — so an illiquid feed's cell shows its
+// last known value, visibly flagged, instead of the loading placeholder until
+// the feed ticks again.
+//
+// A key that goes snapshotMaxIdleSessions sessions without a Subscribe or a
+// Publish is dropped at load, so the file does not grow with every key ever
+// published.
+//
+// Only Publish-keyed values are tracked; SendUpdate addresses a topicID, which
+// Excel reassigns on every session, so there is nothing stable to key it by.
+//
+// A missing file is a normal first run. An unreadable or corrupt one is
+// reported in the returned error, but the snapshot is still enabled with an
+// empty store, so the next save replaces the bad file instead of wedging the
+// feature off forever. Call it once, before the first Subscribe.
+func (m *RtdManager) EnableSnapshot(path string, marker string) error {
+	s := &snapshotStore{
+		path:      path,
+		marker:    marker,
+		values:    make(map[string]snapshotValue),
+		live:      make(map[string]bool),
+		stop:      make(chan struct{}),
+		replaying: make(map[string]*replayGuard),
+	}
+	loadErr := s.load()
+
+	m.mu.Lock()
+	m.snap = s
+	m.mu.Unlock()
+
+	go s.flushLoop()
+	return loadErr
+}
+
+// SaveSnapshot writes the snapshot to disk now if it changed since the last
+// write. It is a no-op when EnableSnapshot was never called.
+func (m *RtdManager) SaveSnapshot() error {
+	m.mu.RLock()
+	s := m.snap
+	m.mu.RUnlock()
+	if s == nil {
+		return nil
+	}
+	return s.save()
+}
+
+// stopSnapshot ends the periodic flush and writes the final copy. Called from
+// Stop; a write failure is logged, since shutdown has nobody to return it to.
+func (m *RtdManager) stopSnapshot() {
+	m.mu.RLock()
+	s := m.snap
+	m.mu.RUnlock()
+	if s == nil {
+		return
+	}
+	s.once.Do(func() { close(s.stop) })
+	if err := s.save(); err != nil {
+		log.Warn("rtd: failed to write snapshot on stop", "path", s.path, "error", err)
+	}
+}
+
+// record stores value as the live last value of key. Values that cannot be
+// persisted (composites, nil) still mark the key live — the feed HAS ticked,
+// so the old snapshot value must not be replayed over it.
+//
+// It returns a channel that is closed once the replays of key already sending
+// have returned, or nil when there are none. The caller waits on it, after
+// releasing its own locks, before sending the live value, so the stale replay
+// cannot land on top of it.
+func (s *snapshotStore) record(key string, value any) <-chan struct{} {
+	sv, ok := encodeSnapshotValue(value)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.live[key] = true
+	if ok {
+		s.values[key] = sv
+	} else {
+		delete(s.values, key)
+	}
+	s.dirty = true
+	if g := s.replaying[key]; g != nil {
+		return g.done
+	}
+	return nil
+}
+
+// beginReplay returns the marked value to replay for key and registers the
+// replay under the key's guard, or reports false when the key has already gone
+// live (or was never snapshotted). The caller sends the value without holding
+// s.mu and then calls endReplay.
+func (s *snapshotStore) beginReplay(key string) (string, *replayGuard, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text, ok := s.replayValueLocked(key)
+	if !ok {
+		return "", nil, false
+	}
+	g := s.replaying[key]
+	if g == nil {
+		g = &replayGuard{done: make(chan struct{})}
+		s.replaying[key] = g
+	}
+	g.n++
+	return text, g, true
+}
+
+// endReplay releases a replay registered by beginReplay, waking any Publish to
+// key that was waiting for it.
+func (s *snapshotStore) endReplay(key string, g *replayGuard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g.n--
+	if g.n == 0 {
+		delete(s.replaying, key)
+		close(g.done)
+	}
+}
+
+// replayValueLocked returns the marked value to replay for key; the caller
+// holds s.mu. A key it finds counts as seen this session, so it is not aged
+// out while a workbook still subscribes to it.
+func (s *snapshotStore) replayValueLocked(key string) (string, bool) {
+	if s.live[key] {
+		return "", false
+	}
+	sv, ok := s.values[key]
+	if !ok {
+		return "", false
+	}
+	text, err := sv.text()
+	if err != nil {
+		log.Warn("rtd: dropping unreadable snapshot value", "key", key, "error", err)
+		delete(s.values, key)
+		s.dirty = true
+		return "", false
+	}
+	if sv.Idle != 0 {
+		sv.Idle = 0
+		s.values[key] = sv
+		s.dirty = true
+	}
+	return text + s.marker, true
+}
+
+func (s *snapshotStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("rtd: read snapshot %s: %w", s.path, err)
+	}
+	var f snapshotFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("rtd: parse snapshot %s: %w", s.path, err)
+	}
+	if f.Version != snapshotFileVersion {
+		return fmt.Errorf("rtd: snapshot %s has version %d, want %d; ignoring it", s.path, f.Version, snapshotFileVersion)
+	}
+	// Each load starts a session: every key ages by one until a Subscribe or
+	// Publish resets it, and the ones idle too long are dropped. The aged
+	// counts are written back with the next save.
+	dropped := 0
+	for k, v := range f.Values {
+		v.Idle++
+		if v.Idle > snapshotMaxIdleSessions {
+			dropped++
+			continue
+		}
+		s.values[k] = v
+	}
+	if dropped > 0 {
+		log.Info("rtd: dropped idle snapshot values", "path", s.path, "count", dropped)
+	}
+	s.dirty = len(f.Values) > 0
+	return nil
+}
+
+// save writes the store via a temp file + rename, so a crash mid-write leaves
+// the previous snapshot intact rather than a truncated one.
+func (s *snapshotStore) save() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	f := snapshotFile{Version: snapshotFileVersion, Values: make(map[string]snapshotValue, len(s.values))}
+	for k, v := range s.values {
+		f.Values[k] = v
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.path, data)
+	}
+	if err != nil {
+		// Re-mark dirty so the next tick (or Stop) retries the write.
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return fmt.Errorf("rtd: write snapshot %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *snapshotStore) flushLoop() {
+	t := time.NewTicker(snapshotFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			if err := s.save(); err != nil {
+				log.Warn("rtd: periodic snapshot write failed", "path", s.path, "error", err)
+			}
+		}
+	}
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// encodeSnapshotValue maps a Published Go value onto a persistable scalar. It
+// accepts the same scalar kinds fbany.MapGo does; anything else reports false.
+func encodeSnapshotValue(value any) (snapshotValue, bool) {
+	var kind string
+	var raw any
+	switch v := value.(type) {
+	case string:
+		kind, raw = "str", v
+	case bool:
+		kind, raw = "bool", v
+	case int:
+		kind, raw = "int", int64(v)
+	case int8:
+		kind, raw = "int", int64(v)
+	case int16:
+		kind, raw = "int", int64(v)
+	case int32:
+		kind, raw = "int", int64(v)
+	case int64:
+		kind, raw = "int", v
+	case uint8:
+		kind, raw = "int", int64(v)
+	case uint16:
+		kind, raw = "int", int64(v)
+	case uint32:
+		kind, raw = "int", int64(v)
+	case float32:
+		kind, raw = "num", float64(v)
+	case float64:
+		// NaN/Inf have no JSON encoding and no meaningful cell text.
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return snapshotValue{}, false
+		}
+		kind, raw = "num", v
+	default:
+		return snapshotValue{}, false
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return snapshotValue{}, false
+	}
+	return snapshotValue{Kind: kind, Value: data}, true
+}
+
+// text renders a persisted value the way Excel would show it, for the marked
+// replay. Booleans use Excel's TRUE/FALSE, not Go's true/false.
+func (v snapshotValue) text() (string, error) {
+	switch v.Kind {
+	case "str":
+		var s string
+		err := json.Unmarshal(v.Value, &s)
+		return s, err
+	case "bool":
+		var b bool
+		if err := json.Unmarshal(v.Value, &b); err != nil {
+			return "", err
+		}
+		if b {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case "int":
+		var n int64
+		err := json.Unmarshal(v.Value, &n)
+		return strconv.FormatInt(n, 10), err
+	case "num":
+		var f float64
+		err := json.Unmarshal(v.Value, &f)
+		return strconv.FormatFloat(f, 'g', -1, 64), err
+	default:
+		return "", fmt.Errorf("unknown snapshot kind %q", v.Kind)
+	}
+}
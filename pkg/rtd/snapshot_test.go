@@ -0,0 +1,298 @@
+package rtd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/types/go/protocol"
+)
+
+// sentString decodes the string value of a recorded RtdUpdate.
+func sentString(t *testing.T, c stubCall) string {
+	t.Helper()
+	upd := protocol.GetRootAsRtdUpdate(c.data, 0)
+	val := upd.Val(nil)
+	if val == nil || val.ValType() != protocol.AnyValueStr {
+		t.Fatalf("topic %d: want a Str update, got %v", c.topicID, val)
+	}
+	tbl := new(flatbuffers.Table)
+	val.Val(tbl)
+	var str protocol.Str
+	str.Init(tbl.Bytes, tbl.Pos)
+	return string(str.Val())
+}
+
+// TestSnapshot_RoundTripReplaysMarkedValue pins the restart story: values
+// Published by one manager are written on Stop, and a fresh manager that loads
+// the same file replays them — marked — to a topic that re-subscribes.
+func TestSnapshot_RoundTripReplaysMarkedValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proj_rtd_snapshot.json")
+
+	first := NewRtdManager()
+	if err := first.EnableSnapshot(path, " (snapshot)"); err != nil {
+		t.Fatalf("EnableSnapshot on a missing file: %v", err)
+	}
+	first.client = &stubRtdClient{}
+	_ = first.Publish("px:ABC", 101.25)
+	_ = first.Publish("flag:ABC", true)
+	_ = first.Publish("grid:ABC", [][]any{{1}}) // composite: not persisted
+	if !first.Stop(time.Second) {
+		t.Fatal("Stop with nothing in flight must drain")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Stop did not write the snapshot: %v", err)
+	}
+
+	second := NewRtdManager()
+	if err := second.EnableSnapshot(path, " (snapshot)"); err != nil {
+		t.Fatalf("EnableSnapshot: %v", err)
+	}
+	client := &stubRtdClient{}
+	second.client = client
+	second.Subscribe("px:ABC", 7)
+	second.Subscribe("flag:ABC", 8)
+	second.Subscribe("grid:ABC", 9)
+
+	calls := client.snapshotCalls()
+	if len(calls) != 2 {
+		t.Fatalf("want 2 replays (composite skipped), got %d", len(calls))
+	}
+	if got := sentString(t, calls[0]); got != "101.25 (snapshot)" {
+		t.Errorf("num replay = %q", got)
+	}
+	if got := sentString(t, calls[1]); got != "TRUE (snapshot)" {
+		t.Errorf("bool replay = %q", got)
+	}
+}
+
+// TestSnapshot_LiveValueStopsReplay: once the feed has ticked in this process,
+// a later subscriber must not be handed the stale snapshot value.
+func TestSnapshot_LiveValueStopsReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"values":{"k":{"kind":"str","value":"old"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewRtdManager()
+	if err := m.EnableSnapshot(path, "*"); err != nil {
+		t.Fatalf("EnableSnapshot: %v", err)
+	}
+	client := &stubRtdClient{}
+	m.client = client
+
+	_ = m.Publish("k", "new") // no subscribers yet, but the key goes live
+	m.Subscribe("k", 1)
+
+	if calls := client.snapshotCalls(); len(calls) != 0 {
+		t.Fatalf("live key must not replay the snapshot, got %d sends", len(calls))
+	}
+	m.Stop(time.Second)
+}
+
+// TestSnapshot_ResubscribeSameKeyDoesNotReplayTwice: Subscribe on an already
+// bound topic is a no-op, including the replay.
+func TestSnapshot_ResubscribeSameKeyDoesNotReplayTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"values":{"k":{"kind":"int","value":42}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewRtdManager()
+	if err := m.EnableSnapshot(path, " (snapshot)"); err != nil {
+		t.Fatal(err)
+	}
+	client := &stubRtdClient{}
+	m.client = client
+
+	m.Subscribe("k", 1)
+	m.Subscribe("k", 1)
+
+	calls := client.snapshotCalls()
+	if len(calls) != 1 {
+		t.Fatalf("want exactly one replay, got %d", len(calls))
+	}
+	if got := sentString(t, calls[0]); got != "42 (snapshot)" {
+		t.Errorf("int replay = %q", got)
+	}
+	m.Stop(time.Second)
+}
+
+// TestSnapshot_CorruptFileIsReportedAndReplaced: a corrupt file must not
+// disable the feature; the next save overwrites it.
+func TestSnapshot_CorruptFileIsReportedAndReplaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewRtdManager()
+	if err := m.EnableSnapshot(path, "*"); err == nil {
+		t.Fatal("corrupt snapshot must be reported")
+	}
+	_ = m.Publish("k", "v") // no client, no subscribers: only recorded
+	if err := m.SaveSnapshot(); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"k"`) {
+		t.Errorf("snapshot was not rewritten:\n%s", data)
+	}
+	m.Stop(time.Second)
+}
+
+// TestSnapshot_DisabledIsInert: without EnableSnapshot nothing is written and
+// Subscribe sends nothing.
+func TestSnapshot_DisabledIsInert(t *testing.T) {
+	m := NewRtdManager()
+	client := &stubRtdClient{}
+	m.client = client
+	_ = m.Publish("k", 1.0)
+	m.Subscribe("k", 1)
+	if err := m.SaveSnapshot(); err != nil {
+		t.Fatalf("SaveSnapshot without a snapshot must be a no-op, got %v", err)
+	}
+	if calls := client.snapshotCalls(); len(calls) != 0 {
+		t.Fatalf("want no sends, got %d", len(calls))
+	}
+}
+
+// TestSnapshot_PublishDuringReplayLandsAfterIt: a Publish racing the replay of
+// a newly subscribed topic must not be overwritten by the stale value. Publish
+// records under the store lock the replay holds across its send, so its live
+// value goes out second.
+func TestSnapshot_PublishDuringReplayLandsAfterIt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"values":{"k":{"kind":"str","value":"old"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewRtdManager()
+	if err := m.EnableSnapshot(path, "*"); err != nil {
+		t.Fatal(err)
+	}
+	client := &stubRtdClient{started: make(chan struct{}), release: make(chan struct{})}
+	m.client = client
+
+	subscribed := make(chan struct{})
+	go func() {
+		m.Subscribe("k", 1)
+		close(subscribed)
+	}()
+	<-client.started // the replay is mid-send
+
+	published := make(chan struct{})
+	go func() {
+		_ = m.Publish("k", "new")
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("Publish completed while the replay was still sending")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(client.release)
+	<-subscribed
+	<-published
+
+	calls := client.snapshotCalls()
+	if len(calls) != 2 {
+		t.Fatalf("want the replay and the live value, got %d sends", len(calls))
+	}
+	if got := sentString(t, calls[0]); got != "old*" {
+		t.Errorf("first send = %q, want the replay", got)
+	}
+	if got := sentString(t, calls[1]); got != "new" {
+		t.Errorf("last send = %q, want the live value", got)
+	}
+	m.Stop(time.Second)
+}
+
+// TestSnapshot_SlowReplayDoesNotStallOtherKeys: a replay stuck in its send
+// holds only its own key, so a Publish to another key goes straight through.
+func TestSnapshot_SlowReplayDoesNotStallOtherKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"values":{"k":{"kind":"str","value":"old"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewRtdManager()
+	if err := m.EnableSnapshot(path, "*"); err != nil {
+		t.Fatal(err)
+	}
+	client := &stubRtdClient{
+		started:    make(chan struct{}),
+		release:    make(chan struct{}),
+		holdTopics: map[int32]bool{1: true},
+	}
+	m.client = client
+	m.Subscribe("other", 2)
+
+	subscribed := make(chan struct{})
+	go func() {
+		m.Subscribe("k", 1)
+		close(subscribed)
+	}()
+	<-client.started // the replay to topic 1 is blocked in its send
+
+	published := make(chan error, 1)
+	go func() { published <- m.Publish("other", 7) }()
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Errorf("Publish: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Publish to another key waited on the blocked replay")
+	}
+	close(client.release)
+	<-subscribed
+
+	calls := client.snapshotCalls()
+	if len(calls) != 2 || calls[0].topicID != 1 || calls[1].topicID != 2 {
+		t.Fatalf("want the replay to topic 1 then the publish to topic 2, got %+v", calls)
+	}
+	m.Stop(time.Second)
+}
+
+// TestSnapshot_IdleKeysAgeOut: every load ages the keys, a Subscribe resets
+// the age, and a key idle for more than snapshotMaxIdleSessions is dropped.
+func TestSnapshot_IdleKeysAgeOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snap.json")
+	data := fmt.Sprintf(`{"version":1,"values":{
+		"stale":{"kind":"int","value":1,"idle":%d},
+		"kept":{"kind":"int","value":2},
+		"used":{"kind":"int","value":3,"idle":4}}}`, snapshotMaxIdleSessions)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewRtdManager()
+	if err := m.EnableSnapshot(path, "*"); err != nil {
+		t.Fatal(err)
+	}
+	m.client = &stubRtdClient{}
+	m.Subscribe("used", 1)
+	m.Stop(time.Second)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f snapshotFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Values["stale"]; ok {
+		t.Errorf("a key idle for %d sessions must be dropped", snapshotMaxIdleSessions+1)
+	}
+	if v, ok := f.Values["kept"]; !ok || v.Idle != 1 {
+		t.Errorf("kept = %+v (present %v), want idle 1", v, ok)
+	}
+	if v, ok := f.Values["used"]; !ok || v.Idle != 0 {
+		t.Errorf("used = %+v (present %v), want idle reset by Subscribe", v, ok)
+	}
+}
@@ -63,15 +63,16 @@ func sendWithRetry(client asyncResultSender, payload []byte, msgType shm.MsgType
 
 // FlushAsyncBatch serializes a batch of async results and delivers it to the
 // XLL host, splitting or failing it explicitly when it cannot fit one
-// guest->host transfer (see flushAsyncBatchBounded).
-func FlushAsyncBatch(batch []PendingAsyncResult, client *shm.Client) {
+// guest->host transfer (see flushAsyncBatchBounded). client is normally the
+// *shm.Client; any GuestConn (e.g. pkg/xllhost's in-process host) will do.
+func FlushAsyncBatch(batch []PendingAsyncResult, client asyncResultSender) {
 	if len(batch) == 0 {
 		return
 	}
-	if client == nil {
-		// A typed-nil *shm.Client inside the asyncResultSender interface would
-		// NOT compare equal to nil further down and would panic on the first
-		// method call, so the check belongs here, at the concrete-type boundary.
+	if sc, ok := client.(*shm.Client); client == nil || (ok && sc == nil) {
+		// A typed-nil *shm.Client inside the asyncResultSender interface does
+		// NOT compare equal to nil and would panic on the first method call,
+		// so it is unwrapped and checked here, at the entry point.
 		log.Error("FlushAsyncBatch: no SHM client; dropping batch", "batchSize", len(batch))
 		return
 	}
@@ -262,7 +262,9 @@ func TestFlushAsyncBatchUsesTheReceiverCap(t *testing.T) {
 
 // TestFlushAsyncBatch_NilClientDoesNotPanic covers the typed-nil trap: handing a
 // nil *shm.Client to an interface parameter yields a NON-nil interface, so the
-// guard has to live at the concrete-type boundary in FlushAsyncBatch.
+// guard has to unwrap it in FlushAsyncBatch.
 func TestFlushAsyncBatch_NilClientDoesNotPanic(t *testing.T) {
 	FlushAsyncBatch([]PendingAsyncResult{strResult("a", 4)}, nil)
+	var typedNil *shm.Client
+	FlushAsyncBatch([]PendingAsyncResult{strResult("a", 4)}, typedNil)
 }
@@ -58,6 +58,21 @@ func InitServerLogging(logDir string, level string, projectName string) {
 }
 
 func InitLog(logDir string, level string, projectName string) (string, error) {
+	logPath := filepath.Join(ResolveLogDir(logDir), projectName+"_go.log")
+
+	if err := log.Init(logPath, level); err != nil {
+		return "", fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	shm.SetLogger(log.Default())
+	return logPath, nil
+}
+
+// ResolveLogDir expands the ${XLL_DIR}, ${BIN_DIR} and ${VAR} placeholders in
+// logging.dir and falls back to "." when it is empty. It is the one resolution
+// rule for every file the server keeps next to its log (the log itself, the
+// RTD snapshot and the default rtd-once disk store), so they can never end up
+// in different directories.
+func ResolveLogDir(logDir string) string {
 	exePath, _ := os.Executable()
 	binDir := filepath.Dir(exePath)
 
@@ -70,13 +85,32 @@ func InitLog(logDir string, level string, projectName string) (string, error) {
 	if logDir == "" {
 		logDir = "."
 	}
-	logPath := filepath.Join(logDir, projectName+"_go.log")
+	return logDir
+}
+
+// RtdSnapshotPath returns where the opt-in RTD last-value snapshot
+// (rtd.snapshot) lives: <logging.dir>/<project>_rtd_snapshot.json.
+func RtdSnapshotPath(logDir string, projectName string) string {
+	return filepath.Join(ResolveLogDir(logDir), projectName+"_rtd_snapshot.json")
+}
+
+// RtdMemoizeDir returns the rtd-once disk store directory: rtd.memoize_dir
+// with its placeholders expanded, or <logging.dir>/<project>_memo when unset.
+func RtdMemoizeDir(logDir string, memoizeDir string, projectName string) string {
+	if memoizeDir != "" {
+		return ResolveLogDir(memoizeDir)
+	}
+	return filepath.Join(ResolveLogDir(logDir), projectName+"_memo")
+}
 
-	if err := log.Init(logPath, level); err != nil {
-		return "", fmt.Errorf("failed to initialize logger: %w", err)
+// RecordDir returns server.record_dir with its placeholders expanded, or ""
+// when it is unset — unlike ResolveLogDir, which falls back to ".", because
+// an empty record_dir means "do not record".
+func RecordDir(recordDir string) string {
+	if recordDir == "" {
+		return ""
 	}
-	shm.SetLogger(log.Default())
-	return logPath, nil
+	return ResolveLogDir(recordDir)
 }
 
 // ResolveSHMName returns the shared-memory name to connect to: projectName by
@@ -204,6 +204,36 @@ func TestInitServerLogging_ExpandsLogDirPlaceholders(t *testing.T) {
 	}
 }
 
+// TestRtdSnapshotPath_SharesTheLogDirectory: the RTD snapshot lives next to the
+// log, so it must go through the same placeholder expansion — a snapshot that
+// resolved ${XLL_DIR} differently would silently never be found again.
+func TestRtdSnapshotPath_SharesTheLogDirectory(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("XLL_DIR", base)
+
+	got := RtdSnapshotPath(filepath.Join("${XLL_DIR}", "nested"), "Proj")
+	if want := filepath.Join(base, "nested", "Proj_rtd_snapshot.json"); got != want {
+		t.Errorf("RtdSnapshotPath = %q, want %q", got, want)
+	}
+	if got := RtdSnapshotPath("", "Proj"); got != "Proj_rtd_snapshot.json" {
+		t.Errorf("empty logging.dir must resolve to the working directory, got %q", got)
+	}
+}
+
+// TestRtdMemoizeDir: an explicit rtd.memoize_dir expands like logging.dir;
+// without one the store sits next to the log.
+func TestRtdMemoizeDir(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("XLL_DIR", base)
+
+	if got, want := RtdMemoizeDir("logs", filepath.Join("${XLL_DIR}", "memo"), "Proj"), filepath.Join(base, "memo"); got != want {
+		t.Errorf("explicit dir = %q, want %q", got, want)
+	}
+	if got, want := RtdMemoizeDir(filepath.Join("${XLL_DIR}", "logs"), "", "Proj"), filepath.Join(base, "logs", "Proj_memo"); got != want {
+		t.Errorf("default dir = %q, want %q", got, want)
+	}
+}
+
 // TestInitServerLogging_SurvivesAnUnusableLogDir is the "report but keep going"
 // rule. An add-in that works without a log beats one that refuses to start
 // because its log directory is read-only, so the bootstrap must neither panic
@@ -18,10 +18,20 @@ func SerialToTime(serial float64) time.Time {
 	return xldate.FromSerial(serial)
 }
 
-func ToScalar(v *protocol.Any) (ScalarValue, bool) {
+// ToScalar reads a scalar Any (int, num, bool, str, err or date; a date
+// becomes its serial as a num). It reports false for nil, for a composite or
+// empty union, and for an Any too malformed to read.
+func ToScalar(v *protocol.Any) (sv ScalarValue, ok bool) {
 	if v == nil {
 		return ScalarValue{}, false
 	}
+	if err := DecodeSafely("Any", func() { sv, ok = toScalar(v) }); err != nil {
+		return ScalarValue{}, false
+	}
+	return sv, ok
+}
+
+func toScalar(v *protocol.Any) (ScalarValue, bool) {
 	var tbl flatbuffers.Table
 	if !v.Val(&tbl) {
 		return ScalarValue{}, false
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"testing"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	shm "github.com/xll-gen/shm/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/chunk"
+)
+
+// The fuzz targets below cover the decoders that see host bytes before
+// anything has validated them. Run one with, e.g.,
+//
+//	go test ./pkg/server -run '^$' -fuzz '^FuzzHandleChunk$' -fuzztime 1m
+//
+// Without -fuzz they run their seeds as ordinary tests.
+
+// fuzzMaxBufferBytes is the per-transfer cap FuzzHandleChunk runs under: small,
+// so an input that slips past it is caught by the allocation check at once.
+const fuzzMaxBufferBytes = 4 << 10
+
+// FuzzHandleChunk feeds two frames for the same ChunkManager: the second lets
+// a fuzzed frame land on the state the first left. Every reply must be an ACK
+// that decodes, a SYSTEM_ERROR with no payload, or the completed transfer's
+// dispatch; reassembly may never hold more than the cap per transfer, and a
+// dispatched payload (inflated, for a compressed transfer) never exceeds it.
+func FuzzHandleChunk(f *testing.F) {
+	payload := []byte("0123456789abcdef")
+	f.Add(buildChunkRequest(f, 1, 16, 0, payload, MsgUserStart), buildChunkRequest(f, 2, 16, 0, payload[:8], MsgUserStart))
+	f.Add(buildChunkRequest(f, 7, 16, 0, payload[:8], MsgUserStart), buildChunkRequest(f, 7, 16, 8, payload[8:], MsgUserStart))
+	f.Add(buildChunkRequest(f, 7, 16, 0, payload[:8], MsgUserStart), buildChunkRequest(f, 7, 16, 4, payload[4:], MsgUserStart))
+	if z, err := chunk.Compress(payload); err == nil {
+		f.Add(buildChunkRequest(f, 9, uint32(len(z)), 0, z, MsgUserStart|chunk.CompressedFlag), []byte{})
+	}
+	f.Add([]byte{}, []byte{0xff, 0xff, 0xff, 0x7f})
+
+	f.Fuzz(func(t *testing.T, first, second []byte) {
+		cm := NewChunkManagerWithMax(fuzzMaxBufferBytes)
+		defer cm.Close()
+		h := NewSystemHandler(cm, nil, nil, nil, nil)
+		dispatch := func(data, respBuf []byte, mType shm.MsgType) (int32, shm.MsgType) {
+			if len(data) > fuzzMaxBufferBytes {
+				t.Fatalf("dispatched a %d-byte payload; the cap is %d", len(data), fuzzMaxBufferBytes)
+			}
+			return 0, mType
+		}
+		for _, frame := range [][]byte{first, second} {
+			respBuf := make([]byte, 1024)
+			b := flatbuffers.NewBuilder(0)
+			n, respType := h.HandleChunk(frame, respBuf, b, dispatch)
+			switch respType {
+			case shm.MsgTypeSystemError:
+				if n != 0 {
+					t.Fatalf("SYSTEM_ERROR with a %d-byte payload", n)
+				}
+			case MsgAck:
+				if n <= 0 || !protocol.GetRootAsAck(respBuf[:n], 0).Ok() {
+					t.Fatalf("malformed ACK (%d bytes)", n)
+				}
+			}
+			if s := cm.Stats(); s.PeakBufferedBytes > 2*fuzzMaxBufferBytes {
+				t.Fatalf("reassembly holds %d bytes for at most two transfers capped at %d", s.PeakBufferedBytes, fuzzMaxBufferBytes)
+			}
+		}
+	})
+}
+
+// FuzzClaimSegment claims the (offset, length) pairs packed in data, four
+// bytes each, against one buffer and checks the coverage contract after each:
+// segments stay sorted and disjoint, and only a new range is recorded.
+func FuzzClaimSegment(f *testing.F) {
+	f.Add([]byte{0, 0, 8, 0, 8, 0, 8, 0})
+	f.Add([]byte{0, 0, 8, 0, 0, 0, 8, 0, 4, 0, 8, 0})
+	f.Add([]byte{16, 0, 4, 0, 0, 0, 16, 0, 20, 0, 1, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var buf ChunkBuffer
+		for ; len(data) >= 4; data = data[4:] {
+			offset := uint32(data[0]) | uint32(data[1])<<8
+			length := uint32(data[2]) | uint32(data[3])<<8
+			if length == 0 {
+				continue // HandleChunk refuses these before claiming
+			}
+			before := len(buf.Segments)
+			claim := buf.ClaimSegment(offset, length)
+			if grew := len(buf.Segments) - before; (claim == ClaimNew) != (grew == 1) || grew > 1 {
+				t.Fatalf("claim %d of [%d,+%d) changed the segment count by %d", claim, offset, length, grew)
+			}
+			for i := 1; i < len(buf.Segments); i++ {
+				p, s := buf.Segments[i-1], buf.Segments[i]
+				if uint64(p.Offset)+uint64(p.Length) > uint64(s.Offset) {
+					t.Fatalf("segments %v and %v overlap or are out of order", p, s)
+				}
+			}
+		}
+	})
+}
+
+// FuzzResolveRefAny stores data as a SetRefCache payload and resolves it
+// through every typed accessor: a malformed payload is an error, never a
+// panic on the RTD connect path.
+func FuzzResolveRefAny(f *testing.F) {
+	f.Add(buildSetRefCacheGrid(f, "h:1", [][]any{{int32(1), "a"}, {true, 2.5}}))
+	f.Add([]byte{})
+	f.Add([]byte{4, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rc := NewRefCache()
+		const token = "h:fuzz"
+		rc.Set(token, data)
+		if _, err := resolveRefAny(rc, token); err != nil {
+			return
+		}
+		ResolveGridArg(rc, token)
+		ResolveNumGridArg(rc, token)
+		ResolveRangeArg(rc, token)
+		ResolveAnyArg(rc, token)
+	})
+}
+
+// FuzzToScalar reads data as an Any root. ToScalar can be handed an Any
+// straight off a request (an `any` argument passed on to ScheduleSet), so it
+// must report false for an unreadable one rather than panic.
+func FuzzToScalar(f *testing.F) {
+	for _, v := range []any{int32(7), 2.5, true, "text"} {
+		b := flatbuffers.NewBuilder(64)
+		b.Finish(BuildAnyFromGo(b, v))
+		f.Add(b.FinishedBytes())
+	}
+	f.Add([]byte{4, 0, 0, 0, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) < flatbuffers.SizeUOffsetT {
+			return // GetRootAs needs the root offset itself
+		}
+		ToScalar(protocol.GetRootAsAny(data, 0))
+	})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/xll-gen/pkg/log"
+)
+
+// Go FlatBuffers has no verifier. Every accessor trusts the offsets it reads,
+// so a frame that is short, truncated or simply not the table it claims to be
+// surfaces as an index-out-of-range PANIC on whichever field is read first —
+// on the shm worker goroutine, where nothing recovers it and the whole server
+// dies with Excel still attached. The two helpers below turn that panic back
+// into the protocol's answer for a bad frame: SYSTEM_ERROR with no payload,
+// which the XLL already handles for the chunk-reject paths.
+
+// DecodeSafely runs decode and reports a panic raised while it reads a
+// FlatBuffer as an error. Only wrap reads of wire data in it: a panic from
+// anything else is a bug and should not be relabelled "malformed". Exported
+// for the generated server, which decodes an async request with it before
+// ACKing: once the ACK is sent the XLL waits for a result on that handle, so
+// a frame that only fails to decode in the job would leave the cell pending.
+func DecodeSafely(what string, decode func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed %s: %v", what, r)
+		}
+	}()
+	decode()
+	return nil
+}
+
+// Guard returns dispatch with a panic in it answered as a SYSTEM_ERROR frame
+// instead of crashing the server. The generated server wraps its dispatch in
+// it because the ipc.GetRootAs<Name>Request accessors decode the request
+// before the handler's own recover is installed, so a malformed request panics
+// outside it. Handler panics never reach Guard; the generated handler bodies
+// recover those and answer with the function's error response.
+func Guard(dispatch Dispatcher) Dispatcher {
+	return func(req []byte, respBuf []byte, msgType shm.MsgType) (n int32, respType shm.MsgType) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error("Malformed request refused", "msgType", msgType, "len", len(req),
+					"error", r, "stack", string(debug.Stack()))
+				n, respType = 0, shm.MsgTypeSystemError
+			}
+		}()
+		return dispatch(req, respBuf, msgType)
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+
+	shm "github.com/xll-gen/shm/go"
+	"github.com/xll-gen/types/go/protocol"
+)
+
+// TestGuard_MalformedRequestIsSystemError decodes a truncated frame the way a
+// generated handler does, before any handler-level recover, and expects the
+// SYSTEM_ERROR reply instead of a panic on the shm worker.
+func TestGuard_MalformedRequestIsSystemError(t *testing.T) {
+	dispatch := Guard(func(req, respBuf []byte, mType shm.MsgType) (int32, shm.MsgType) {
+		protocol.GetRootAsChunk(req, 0).Id()
+		return 4, mType
+	})
+	if n, typ := dispatch([]byte{0xff}, nil, MsgUserStart); n != 0 || typ != shm.MsgTypeSystemError {
+		t.Errorf("malformed request = (%d, %d), want (0, SYSTEM_ERROR)", n, typ)
+	}
+	ok := buildChunkRequest(t, 1, 4, 0, []byte{1, 2, 3, 4}, MsgUserStart)
+	if n, typ := dispatch(ok, nil, MsgUserStart); n != 4 || typ != MsgUserStart {
+		t.Errorf("well-formed request = (%d, %d), want it passed through", n, typ)
+	}
+}
+
+func TestHandleChunk_MalformedFrame(t *testing.T) {
+	h := NewSystemHandler(NewChunkManager(), nil, nil, nil, nil)
+	defer h.ChunkManager.Close()
+	for _, frame := range [][]byte{nil, {1, 2}, {0xff, 0xff, 0, 0}, {8, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}} {
+		n, typ := h.HandleChunk(frame, make([]byte, 256), nil, nil)
+		if n != 0 || typ != shm.MsgTypeSystemError {
+			t.Errorf("HandleChunk(%x) = (%d, %d), want (0, SYSTEM_ERROR)", frame, n, typ)
+		}
+	}
+}
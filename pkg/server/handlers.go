@@ -9,6 +9,7 @@ import (
 	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/xll-gen/shm/go"
 	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/chunk"
 	"github.com/xll-gen/xll-gen/pkg/log"
 	"github.com/xll-gen/xll-gen/pkg/rtd"
 	"github.com/xll-gen/xll-gen/pkg/transferid"
@@ -58,12 +59,30 @@ func (h *SystemHandler) HandleAck(data []byte, respBuf []byte, b *flatbuffers.Bu
 
 // HandleChunk processes a chunk message.
 func (h *SystemHandler) HandleChunk(data []byte, respBuf []byte, b *flatbuffers.Builder, dispatch func([]byte, []byte, shm.MsgType) (int32, shm.MsgType)) (int32, shm.MsgType) {
-	reqObj := protocol.GetRootAsChunk(data, 0)
-	id := reqObj.Id()
-	total := int(reqObj.TotalSize())
-	offset := int(reqObj.Offset())
-	offsetU32 := reqObj.Offset()
-	dataLen := reqObj.DataLength()
+	// Read every field up front, outside buf.Mutex: a malformed frame panics
+	// on the first out-of-range read, and one that did so under the lock would
+	// wedge the transfer for good.
+	var (
+		id             uint64
+		total, offset  int
+		offsetU32      uint32
+		dataLen        int
+		chunkBytes     []byte
+		payloadMsgType uint32
+	)
+	if err := DecodeSafely("chunk", func() {
+		reqObj := protocol.GetRootAsChunk(data, 0)
+		id = reqObj.Id()
+		total = int(reqObj.TotalSize())
+		offset = int(reqObj.Offset())
+		offsetU32 = reqObj.Offset()
+		chunkBytes = reqObj.DataBytes()
+		dataLen = len(chunkBytes)
+		payloadMsgType = reqObj.MsgType()
+	}); err != nil {
+		log.Error("HandleChunk: refusing frame", "len", len(data), "err", err)
+		return 0, shm.MsgTypeSystemError
+	}
 
 	// A previous chunk of this transfer was refused for a protocol violation.
 	// Refuse everything else on that id until the poison entry expires: without
@@ -77,6 +96,18 @@ func (h *SystemHandler) HandleChunk(data []byte, respBuf []byte, b *flatbuffers.
 		return 0, shm.MsgTypeSystemError
 	}
 
+	// Chunk compression is guest->host only (pkg/chunk, DIRECTION): the XLL
+	// builds requests in the slot and never compresses, so a frame flagged
+	// chunk.CompressedFlag is a protocol violation. Refuse it on the first
+	// frame rather than buffer a transfer whose zstd bytes would then be
+	// dispatched as the request.
+	if payloadMsgType&chunk.CompressedFlag != 0 {
+		h.ChunkManager.PoisonTransfer(id)
+		log.Error("HandleChunk: compressed host->guest transfer; refusing",
+			"id", id, "msgType", payloadMsgType)
+		return 0, shm.MsgTypeSystemError
+	}
+
 	// LOCK HANDOFF, and why the gap between the two locks is safe.
 	//
 	// GetChunkBuffer takes and RELEASES cm.chunkMutex before this function takes
@@ -169,7 +200,7 @@ func (h *SystemHandler) HandleChunk(data []byte, respBuf []byte, b *flatbuffers.
 		return 0, shm.MsgTypeSystemError
 	}
 	if claim == ClaimNew {
-		copy(buf.Data[offset:], reqObj.DataBytes())
+		copy(buf.Data[offset:], chunkBytes)
 		buf.Received += dataLen
 	}
 
@@ -195,7 +226,6 @@ func (h *SystemHandler) HandleChunk(data []byte, respBuf []byte, b *flatbuffers.
 
 	if claimedDispatch {
 		h.ChunkManager.RemoveChunkBuffer(id)
-		payloadMsgType := reqObj.MsgType()
 		return dispatch(buf.Data, respBuf, shm.MsgType(payloadMsgType))
 	}
 
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/log"
+)
+
+// Handshake is what each side of a connection was generated from. The XLL
+// sends its own as the first message after connecting (MsgHandshake) and the
+// server answers with its own, so a stale server binary in temp_dir, or a
+// rebuild of only one side, is refused instead of routing a message ID to
+// whichever function happens to hold it on the other side.
+//
+// On the wire it is a protocol.Grid of N×2 Str cells, one key/value pair per
+// row (the protocol schema is owned by the types module): "version",
+// "schema_hash", "msg_user_start" and "msg_user_end". The server's reply adds
+// "status" ("ok" or "mismatch") and "error", the text the XLL logs and shows
+// in the cell.
+type Handshake struct {
+	// Version is the xll-gen version that generated this side.
+	Version string
+	// SchemaHash fingerprints the function table (names, order, modes,
+	// argument and return types) the user message IDs were assigned from.
+	SchemaHash string
+	// UserStart and UserEnd bound the user function message IDs: function i
+	// is UserStart+i, and UserEnd is one past the last.
+	UserStart uint32
+	UserEnd   uint32
+}
+
+// Mismatch describes how peer differs from h, or returns "" when the two were
+// generated from the same xll.yaml by the same xll-gen version.
+func (h Handshake) Mismatch(peer Handshake) string {
+	var diffs []string
+	if h.Version != peer.Version {
+		diffs = append(diffs, fmt.Sprintf("xll-gen version %s vs %s", peer.Version, h.Version))
+	}
+	if h.SchemaHash != peer.SchemaHash {
+		diffs = append(diffs, fmt.Sprintf("function table %s vs %s", peer.SchemaHash, h.SchemaHash))
+	}
+	if h.UserStart != peer.UserStart || h.UserEnd != peer.UserEnd {
+		diffs = append(diffs, fmt.Sprintf("message IDs %d-%d vs %d-%d", peer.UserStart, peer.UserEnd, h.UserStart, h.UserEnd))
+	}
+	return strings.Join(diffs, "; ")
+}
+
+// BuildHandshake serializes h, followed by any extra key/value pairs, as the
+// MsgHandshake payload.
+func BuildHandshake(b *flatbuffers.Builder, h Handshake, extra ...string) []byte {
+	pairs := append([]string{
+		"version", h.Version,
+		"schema_hash", h.SchemaHash,
+		"msg_user_start", strconv.FormatUint(uint64(h.UserStart), 10),
+		"msg_user_end", strconv.FormatUint(uint64(h.UserEnd), 10),
+	}, extra...)
+	g := &protocol.GridT{Rows: int32(len(pairs) / 2), Cols: 2}
+	for _, s := range pairs[:len(pairs)/2*2] {
+		g.Data = append(g.Data, &protocol.ScalarT{Val: &protocol.ScalarValueT{
+			Type: protocol.ScalarValueStr, Value: &protocol.StrT{Val: s},
+		}})
+	}
+	b.Reset()
+	b.Finish(g.Pack(b))
+	return b.FinishedBytes()
+}
+
+// ParseHandshake decodes a MsgHandshake payload into the Handshake and the
+// full key/value map (which carries the reply's "status" and "error"). A
+// payload that is not a key/value grid, or has no version, is an error — in
+// particular the first function's request from an XLL generated before the
+// handshake existed, which still sends it as message 141.
+func ParseHandshake(data []byte) (Handshake, map[string]string, error) {
+	var g *protocol.GridT
+	if err := DecodeSafely("handshake", func() { g = protocol.GetRootAsGrid(data, 0).UnPack() }); err != nil {
+		return Handshake{}, nil, err
+	}
+	if g == nil || g.Cols != 2 || int(g.Rows)*2 != len(g.Data) {
+		return Handshake{}, nil, errors.New("malformed handshake: not a key/value grid")
+	}
+	kv := make(map[string]string, g.Rows)
+	for i := 0; i < len(g.Data); i += 2 {
+		k, ok := handshakeCell(g.Data[i])
+		if !ok {
+			return Handshake{}, nil, errors.New("malformed handshake: non-string key")
+		}
+		v, _ := handshakeCell(g.Data[i+1])
+		kv[k] = v
+	}
+	if kv["version"] == "" {
+		return Handshake{}, nil, errors.New("malformed handshake: no version")
+	}
+	start, err1 := strconv.ParseUint(kv["msg_user_start"], 10, 32)
+	end, err2 := strconv.ParseUint(kv["msg_user_end"], 10, 32)
+	if err := errors.Join(err1, err2); err != nil {
+		return Handshake{}, nil, fmt.Errorf("malformed handshake: message ID range: %w", err)
+	}
+	return Handshake{
+		Version:    kv["version"],
+		SchemaHash: kv["schema_hash"],
+		UserStart:  uint32(start),
+		UserEnd:    uint32(end),
+	}, kv, nil
+}
+
+func handshakeCell(s *protocol.ScalarT) (string, bool) {
+	if s == nil || s.Val == nil || s.Val.Type != protocol.ScalarValueStr {
+		return "", false
+	}
+	str, ok := s.Val.Value.(*protocol.StrT)
+	if !ok || str == nil {
+		return "", false
+	}
+	return str.Val, true
+}
+
+// HandshakeEnvVar, set to "optional" in the server's environment, serves an
+// XLL that never handshakes: one generated before the handshake existed. A
+// failed handshake is still refused.
+const HandshakeEnvVar = "XLLGEN_HANDSHAKE"
+
+// InProcessConn is implemented by a GuestConn that drives the dispatch from
+// inside the server's own process, such as pkg/xllhost behind the generated
+// Client, the fuzz tests and replay. Such a peer is built against the same
+// generated package and never handshakes.
+type InProcessConn interface {
+	InProcess() bool
+}
+
+// HandshakeOptional reports whether the server on conn may serve a peer that
+// never handshakes: conn is an InProcessConn, or HandshakeEnvVar is
+// "optional".
+func HandshakeOptional(conn GuestConn) bool {
+	if c, ok := conn.(InProcessConn); ok && c.InProcess() {
+		return true
+	}
+	return os.Getenv(HandshakeEnvVar) == "optional"
+}
+
+// errNoHandshake is why user messages are refused before any handshake.
+const errNoHandshake = "the XLL has not completed the connect handshake; regenerate and rebuild both sides, " +
+	"or set " + HandshakeEnvVar + "=optional for an XLL generated before it existed"
+
+// Handshaker answers MsgHandshake for the generated server and refuses every
+// user function message with SYSTEM_ERROR until a peer has passed it, which
+// the XLL shows as a cell error rather than a value computed by the wrong
+// handler. The XLL handshakes at connect, before Excel can call a function.
+// After Optional, a peer that never handshakes is served as before; one that
+// fails the handshake is refused either way.
+type Handshaker struct {
+	local Handshake
+
+	mu       sync.Mutex
+	verified bool   // a handshake has succeeded
+	optional bool   // serve a peer that has not handshaken
+	refused  string // why the last handshake failed; "" unless it did
+}
+
+// NewHandshaker returns a Handshaker for the server generated as local.
+func NewHandshaker(local Handshake) *Handshaker {
+	return &Handshaker{local: local}
+}
+
+// Optional makes the handshake optional: user messages are served until a
+// handshake fails, as for a peer generated before the handshake existed. See
+// HandshakeOptional.
+func (h *Handshaker) Optional() {
+	h.mu.Lock()
+	h.optional = true
+	h.mu.Unlock()
+}
+
+// Refused reports why user function messages are being refused, or "" when
+// they are accepted.
+func (h *Handshaker) Refused() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.refused != "" || h.verified || h.optional {
+		return h.refused
+	}
+	return errNoHandshake
+}
+
+func (h *Handshaker) setRefused(why string) {
+	h.mu.Lock()
+	h.refused = why
+	h.verified = why == ""
+	h.mu.Unlock()
+}
+
+// Wrap returns dispatch with MsgHandshake answered and user function
+// messages refused until a handshake succeeds.
+func (h *Handshaker) Wrap(dispatch Dispatcher) Dispatcher {
+	return func(req []byte, respBuf []byte, msgType shm.MsgType) (int32, shm.MsgType) {
+		if msgType == MsgHandshake {
+			return h.handle(req, respBuf)
+		}
+		if uint32(msgType) >= MsgUserStart {
+			if why := h.Refused(); why != "" {
+				log.Debug("Refusing function call without a successful handshake", "msgType", msgType, "reason", why)
+				return 0, shm.MsgTypeSystemError
+			}
+		}
+		return dispatch(req, respBuf, msgType)
+	}
+}
+
+func (h *Handshaker) handle(req []byte, respBuf []byte) (int32, shm.MsgType) {
+	peer, _, err := ParseHandshake(req)
+	if err != nil {
+		why := "the XLL predates the connect handshake or sent a malformed one; regenerate and rebuild both sides"
+		h.setRefused(why)
+		log.Error("Handshake failed; refusing all function calls", "error", err, "reason", why,
+			"serverVersion", h.local.Version, "serverSchema", h.local.SchemaHash)
+		return 0, shm.MsgTypeSystemError
+	}
+	status, why := "ok", h.local.Mismatch(peer)
+	if why != "" {
+		status = "mismatch"
+		why = "XLL and server were generated differently (" + why + "); regenerate and rebuild both sides"
+		log.Error("Handshake mismatch; refusing all function calls", "reason", why,
+			"xllVersion", peer.Version, "serverVersion", h.local.Version,
+			"xllSchema", peer.SchemaHash, "serverSchema", h.local.SchemaHash)
+	} else {
+		log.Info("Handshake ok", "version", peer.Version, "schema", peer.SchemaHash)
+	}
+	h.setRefused(why)
+	payload := BuildHandshake(flatbuffers.NewBuilder(256), h.local, "status", status, "error", why)
+	if len(payload) > len(respBuf) {
+		log.Error("Handshake reply does not fit the response buffer", "bytes", len(payload), "respBufBytes", len(respBuf))
+		return 0, shm.MsgTypeSystemError
+	}
+	return int32(copy(respBuf, payload)), MsgHandshake
+}
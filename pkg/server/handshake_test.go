@@ -0,0 +1,166 @@
+package server
+
+import (
+	"testing"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	shm "github.com/xll-gen/shm/go"
+)
+
+func testHandshake() Handshake {
+	return Handshake{Version: "v1.2.3", SchemaHash: "0123456789abcdef", UserStart: MsgUserStart, UserEnd: MsgUserStart + 3}
+}
+
+// TestHandshake_RoundTrip checks the key/value grid encoding both sides share.
+func TestHandshake_RoundTrip(t *testing.T) {
+	want := testHandshake()
+	got, kv, err := ParseHandshake(BuildHandshake(flatbuffers.NewBuilder(0), want, "status", "ok", "error", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("ParseHandshake = %+v, want %+v", got, want)
+	}
+	if kv["status"] != "ok" {
+		t.Errorf("status = %q, want ok", kv["status"])
+	}
+	if _, ok := kv["error"]; !ok {
+		t.Error("an empty error value must still be present")
+	}
+	if why := want.Mismatch(got); why != "" {
+		t.Errorf("Mismatch of identical handshakes = %q", why)
+	}
+}
+
+func TestHandshake_ParseMalformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":      nil,
+		"truncated":  {0xff, 0xff},
+		"no version": BuildHandshake(flatbuffers.NewBuilder(0), Handshake{}),
+		"chunk":      buildChunkRequest(t, 1, 4, 0, []byte{1, 2, 3, 4}, MsgUserStart),
+	} {
+		if _, _, err := ParseHandshake(data); err == nil {
+			t.Errorf("%s: ParseHandshake accepted it", name)
+		}
+	}
+}
+
+// TestHandshaker_Mismatch drives the server side: a user message before any
+// handshake is refused, a matching XLL is served, a mismatched one is answered with the reason and every later user message is
+// refused, and a matching handshake after that is served again.
+func TestHandshaker_Mismatch(t *testing.T) {
+	local := testHandshake()
+	calls := 0
+	dispatch := NewHandshaker(local).Wrap(func(req, respBuf []byte, mType shm.MsgType) (int32, shm.MsgType) {
+		calls++
+		return 1, mType
+	})
+	respBuf := make([]byte, 4096)
+	handshake := func(peer Handshake) map[string]string {
+		t.Helper()
+		n, typ := dispatch(BuildHandshake(flatbuffers.NewBuilder(0), peer), respBuf, MsgHandshake)
+		if typ != MsgHandshake {
+			t.Fatalf("handshake reply type = %d, want MsgHandshake", typ)
+		}
+		got, kv, err := ParseHandshake(respBuf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != local {
+			t.Errorf("reply carries %+v, want the server's own %+v", got, local)
+		}
+		return kv
+	}
+
+	if _, typ := dispatch(nil, respBuf, MsgUserStart); typ != shm.MsgTypeSystemError || calls != 0 {
+		t.Errorf("user message before the handshake = %d (calls %d), want SYSTEM_ERROR", typ, calls)
+	}
+	if kv := handshake(local); kv["status"] != "ok" || kv["error"] != "" {
+		t.Errorf("matching handshake = %v, want ok", kv)
+	}
+	if _, typ := dispatch(nil, respBuf, MsgUserStart); typ != MsgUserStart || calls != 1 {
+		t.Errorf("user message after an ok handshake = %d (calls %d), want it dispatched", typ, calls)
+	}
+
+	stale := local
+	stale.SchemaHash = "fedcba9876543210"
+	if kv := handshake(stale); kv["status"] != "mismatch" || kv["error"] == "" {
+		t.Errorf("mismatched handshake = %v, want mismatch with a reason", kv)
+	}
+	if _, typ := dispatch(nil, respBuf, MsgUserStart+1); typ != shm.MsgTypeSystemError || calls != 1 {
+		t.Errorf("user message after a mismatch = %d (calls %d), want SYSTEM_ERROR", typ, calls)
+	}
+	if _, typ := dispatch(nil, respBuf, MsgCalculationEnded); typ != MsgCalculationEnded || calls != 2 {
+		t.Errorf("system message after a mismatch = %d, want it dispatched", typ)
+	}
+
+	handshake(local)
+	if _, typ := dispatch(nil, respBuf, MsgUserStart); typ != MsgUserStart {
+		t.Errorf("user message after a fresh ok handshake = %d, want it dispatched", typ)
+	}
+}
+
+// TestHandshaker_PreHandshakeXLL covers an XLL generated before the handshake:
+// its first function still goes out as 141, which is now MsgHandshake and
+// does not decode as one, so the server refuses instead of running function 0
+// of its own table on that request.
+func TestHandshaker_PreHandshakeXLL(t *testing.T) {
+	h := NewHandshaker(testHandshake())
+	dispatch := h.Wrap(func(req, respBuf []byte, mType shm.MsgType) (int32, shm.MsgType) {
+		t.Errorf("msgType %d reached the dispatch", mType)
+		return 0, 0
+	})
+	req := buildChunkRequest(t, 1, 4, 0, []byte{1, 2, 3, 4}, MsgUserStart)
+	if _, typ := dispatch(req, make([]byte, 256), MsgHandshake); typ != shm.MsgTypeSystemError {
+		t.Errorf("malformed handshake = %d, want SYSTEM_ERROR", typ)
+	}
+	if h.Refused() == "" {
+		t.Fatal("a malformed handshake must refuse later calls")
+	}
+	if _, typ := dispatch(nil, nil, MsgUserStart); typ != shm.MsgTypeSystemError {
+		t.Errorf("user message = %d, want SYSTEM_ERROR", typ)
+	}
+}
+
+// TestHandshaker_Optional covers the opt-out for a peer that never handshakes:
+// it is served, but a handshake that fails still refuses it.
+func TestHandshaker_Optional(t *testing.T) {
+	h := NewHandshaker(testHandshake())
+	if h.Refused() == "" {
+		t.Fatal("a Handshaker must refuse user messages until a handshake succeeds")
+	}
+	h.Optional()
+	if why := h.Refused(); why != "" {
+		t.Fatalf("Optional Handshaker refuses without a handshake: %s", why)
+	}
+	dispatch := h.Wrap(func(req, respBuf []byte, mType shm.MsgType) (int32, shm.MsgType) {
+		return 1, mType
+	})
+	if _, typ := dispatch(nil, nil, MsgUserStart); typ != MsgUserStart {
+		t.Errorf("user message without a handshake = %d, want it dispatched", typ)
+	}
+	stale := testHandshake()
+	stale.Version = "v0.0.1"
+	dispatch(BuildHandshake(flatbuffers.NewBuilder(0), stale), make([]byte, 4096), MsgHandshake)
+	if _, typ := dispatch(nil, nil, MsgUserStart); typ != shm.MsgTypeSystemError {
+		t.Errorf("user message after a mismatch = %d, want SYSTEM_ERROR even when optional", typ)
+	}
+}
+
+type inProcessConn struct{ GuestConn }
+
+func (inProcessConn) InProcess() bool { return true }
+
+func TestHandshakeOptional(t *testing.T) {
+	t.Setenv(HandshakeEnvVar, "")
+	if HandshakeOptional(nil) {
+		t.Error("HandshakeOptional(nil) = true without the env var")
+	}
+	if !HandshakeOptional(inProcessConn{}) {
+		t.Error("an in-process conn must not need a handshake")
+	}
+	t.Setenv(HandshakeEnvVar, "optional")
+	if !HandshakeOptional(nil) {
+		t.Errorf("HandshakeOptional ignores %s=optional", HandshakeEnvVar)
+	}
+}
@@ -201,6 +201,10 @@ type ChunkManager struct {
 	// panic on a second channel close.
 	stop      chan struct{}
 	closeOnce sync.Once
+
+	// opened and peakBytes feed Stats. Guarded by chunkMutex.
+	opened    uint64
+	peakBytes int64
 }
 
 func NewChunkManager() *ChunkManager {
@@ -313,6 +317,45 @@ func (cm *ChunkManager) TransferCount() int {
 	return len(cm.chunkCache)
 }
 
+// ChunkStats is a snapshot of inbound reassembly, for sizing server.chunk
+// under load (`xll-gen bench`).
+type ChunkStats struct {
+	// Active is the number of partially-reassembled transfers resident now.
+	Active int `json:"active"`
+	// Opened counts every reassembly buffer allocated since the manager was
+	// built, i.e. the chunked requests received.
+	Opened uint64 `json:"opened"`
+	// BufferedBytes is the reassembly memory held now, and PeakBufferedBytes
+	// the most it has held at once.
+	BufferedBytes     int64 `json:"buffered_bytes"`
+	PeakBufferedBytes int64 `json:"peak_buffered_bytes"`
+}
+
+// Stats reports the manager's reassembly counters.
+func (cm *ChunkManager) Stats() ChunkStats {
+	cm.chunkMutex.Lock()
+	defer cm.chunkMutex.Unlock()
+	return ChunkStats{
+		Active:            len(cm.chunkCache),
+		Opened:            cm.opened,
+		BufferedBytes:     cm.bufferedBytesLocked(),
+		PeakBufferedBytes: cm.peakBytes,
+	}
+}
+
+// bufferedBytesLocked sums the resident reassembly buffers; the caller holds
+// chunkMutex. A walk rather than a running total so that none of the several
+// removal paths (completion, poison, prune, reset) can leave it stale; the map
+// is bounded by MaxConcurrentTransfers and is walked only when a buffer is
+// allocated, which costs far more.
+func (cm *ChunkManager) bufferedBytesLocked() int64 {
+	var n int64
+	for _, b := range cm.chunkCache {
+		n += int64(b.TotalSize)
+	}
+	return n
+}
+
 // PoisonedCount reports how many transfer ids are currently recorded as refused
 // for a protocol violation (expired-but-unswept entries included, exactly like
 // the C++ mirror's poisonCount). Mirrors xll::ChunkRegistry::poisonCount.
@@ -372,6 +415,15 @@ func (cm *ChunkManager) effectiveTTL() time.Duration {
 	return DefaultChunkBufferTTL
 }
 
+// effectiveMaxChunkBufferBytes resolves the configured per-transfer byte cap,
+// falling back to DefaultMaxChunkBufferBytes for the zero value.
+func (cm *ChunkManager) effectiveMaxChunkBufferBytes() int64 {
+	if cm.MaxChunkBufferBytes > 0 {
+		return cm.MaxChunkBufferBytes
+	}
+	return DefaultMaxChunkBufferBytes
+}
+
 // effectiveMaxConcurrentTransfers resolves the configured concurrent-transfer
 // bound, falling back to DefaultMaxConcurrentTransfers for the zero value.
 func (cm *ChunkManager) effectiveMaxConcurrentTransfers() int {
@@ -414,10 +466,7 @@ func (cm *ChunkManager) GetChunkBuffer(id uint64, total int) (*ChunkBuffer, erro
 	if total <= 0 {
 		return nil, fmt.Errorf("%w: refusing chunk buffer allocation: total=%d (id=%#x)", ErrChunkTotalNonPositive, total, id)
 	}
-	maxBytes := cm.MaxChunkBufferBytes
-	if maxBytes <= 0 {
-		maxBytes = DefaultMaxChunkBufferBytes
-	}
+	maxBytes := cm.effectiveMaxChunkBufferBytes()
 	if int64(total) > maxBytes {
 		return nil, fmt.Errorf("%w: refusing chunk buffer allocation: total=%d exceeds max=%d (id=%#x)", ErrChunkTotalTooLarge, total, maxBytes, id)
 	}
@@ -472,6 +521,10 @@ func (cm *ChunkManager) GetChunkBuffer(id uint64, total int) (*ChunkBuffer, erro
 			LastAccess: cm.now(),
 		}
 		cm.chunkCache[id] = buf
+		cm.opened++
+		if n := cm.bufferedBytesLocked(); n > cm.peakBytes {
+			cm.peakBytes = n
+		}
 	}
 	buf.LastAccess = cm.now()
 	cm.chunkMutex.Unlock()
@@ -11,6 +11,7 @@ import (
 	flatbuffers "github.com/google/flatbuffers/go"
 	shm "github.com/xll-gen/shm/go"
 	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/chunk"
 )
 
 // mustGetChunkBuffer is a test helper: GetChunkBuffer now returns an error
@@ -28,7 +29,7 @@ func mustGetChunkBuffer(t *testing.T, cm *ChunkManager, id uint64, total int) *C
 
 // buildChunkRequest builds a flatbuffer-encoded Chunk request payload, the
 // same shape that HandleChunk consumes off the wire.
-func buildChunkRequest(t *testing.T, id uint64, totalSize uint32, offset uint32, data []byte, msgType uint32) []byte {
+func buildChunkRequest(t testing.TB, id uint64, totalSize uint32, offset uint32, data []byte, msgType uint32) []byte {
 	t.Helper()
 	b := flatbuffers.NewBuilder(1024)
 	dataOff := b.CreateByteVector(data)
@@ -1268,3 +1269,37 @@ func TestChunkManager_CloseStopsCleanupGoroutine(t *testing.T) {
 		time.Sleep(10 * time.Millisecond)
 	}
 }
+
+// TestHandleChunk_CompressedTransferRefused: compression is guest->host only,
+// so a host->guest frame flagged chunk.CompressedFlag is refused on arrival,
+// never buffered, and the rest of its transfer is refused with it.
+func TestHandleChunk_CompressedTransferRefused(t *testing.T) {
+	cm := NewChunkManager()
+	defer cm.Close()
+	h := &SystemHandler{ChunkManager: cm}
+	respBuf := make([]byte, 4096)
+	b := flatbuffers.NewBuilder(1024)
+	dispatch := func([]byte, []byte, shm.MsgType) (int32, shm.MsgType) {
+		t.Fatal("a compressed host->guest transfer must not be dispatched")
+		return 0, 0
+	}
+
+	payload := bytes.Repeat([]byte("compressible "), 100)
+	mt := uint32(MsgUserStart) | chunk.CompressedFlag
+	half := uint32(len(payload) / 2)
+	for _, off := range []uint32{0, half} {
+		req := buildChunkRequest(t, 0xC0, uint32(len(payload)), off, payload[off:off+half], mt)
+		if size, got := h.HandleChunk(req, respBuf, b, dispatch); size != 0 || got != shm.MsgTypeSystemError {
+			t.Fatalf("frame at %d: got (%d, %d), want (0, MsgTypeSystemError)", off, size, got)
+		}
+	}
+	if !cm.IsPoisoned(0xC0) {
+		t.Error("a refused compressed transfer must be poisoned")
+	}
+	cm.chunkMutex.Lock()
+	_, buffered := cm.chunkCache[0xC0]
+	cm.chunkMutex.Unlock()
+	if buffered {
+		t.Error("a refused compressed transfer must not be buffered")
+	}
+}
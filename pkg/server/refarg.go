@@ -48,9 +48,21 @@ func resolveRefAny(refCache *RefCache, token string) (*protocol.Any, error) {
 		return nil, fmt.Errorf("refcache: no payload for composite-arg token %q (the per-cycle cache was cleared before this RTD connect — the server may have restarted mid-cycle)", token)
 	}
 	// data is a fresh copy; the SetRefCacheRequest root (and the Any inside it)
-	// alias `data`, which outlives any cache Clear.
-	req := protocol.GetRootAsSetRefCacheRequest(data, 0)
-	any := req.Val(nil)
+	// alias `data`, which outlives any cache Clear. The host wrote it, so read
+	// it as wire data: a malformed payload is an error for this topic, not a
+	// panic on the RTD connect path. The union type and value are read here so
+	// the Resolve*Arg callers' ValType/Val cannot be the first to trip on it.
+	var any *protocol.Any
+	if err := DecodeSafely("refcache payload", func() {
+		any = protocol.GetRootAsSetRefCacheRequest(data, 0).Val(nil)
+		if any != nil {
+			var tbl flatbuffers.Table
+			any.ValType()
+			any.Val(&tbl)
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("refcache: token %q: %w", key, err)
+	}
 	if any == nil {
 		return nil, fmt.Errorf("refcache: payload for token %q has no value", key)
 	}
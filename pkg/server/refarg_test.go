@@ -10,7 +10,7 @@ import (
 // buildSetRefCacheGrid builds a SetRefCacheRequest{key, val=Any(Grid)} payload
 // — the exact bytes the C++ rtd/rtd-once wrapper ships over MSG_SETREFCACHE —
 // from a [][]any grid, and returns the finished FlatBuffer.
-func buildSetRefCacheGrid(t *testing.T, key string, grid [][]any) []byte {
+func buildSetRefCacheGrid(t testing.TB, key string, grid [][]any) []byte {
 	t.Helper()
 	b := flatbuffers.NewBuilder(256)
 	gridOff, err := BuildGridFromGo(b, grid)
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/xll-gen/pkg/chunk"
 	"github.com/xll-gen/xll-gen/pkg/log"
 )
 
@@ -21,6 +22,21 @@ type ShmRunner interface {
 	Wait()
 }
 
+// GuestConn is the whole link the generated server runs on (ServeConn): the
+// message loop RunAndDrain drives, plus the guest->host sends of the async
+// batch, RTD and one-shot grid paths and the request-buffer capacity their
+// chunking budgets read. *shm.Client is the production implementation;
+// pkg/xllhost plays the XLL host in-process so a project's dispatch can be
+// exercised by `go test` without Excel or a shared-memory segment.
+type GuestConn interface {
+	ShmRunner
+	chunk.MaxRequestSizer
+	SendGuestCall(data []byte, msgType shm.MsgType) ([]byte, error)
+	SendGuestCallWithTimeout(data []byte, msgType shm.MsgType, timeout time.Duration) ([]byte, error)
+}
+
+var _ GuestConn = (*shm.Client)(nil)
+
 // JobDrainer is the slice of *JobPool that RunAndDrain drives.
 type JobDrainer interface {
 	Drain(timeout time.Duration) bool
@@ -62,6 +62,14 @@ const (
 	// which is shm's MsgType::HEARTBEAT_RESP; see pkg/msgid.
 	MsgAck = msgid.MsgAck
 
+	// RTD-once interim progress (guest->host, display-only) — must stay in
+	// sync with MSG_RTD_PROGRESS in internal/assets/files/include/xll_ipc.h.
+	MsgRtdProgress = msgid.MsgRtdProgress
+
+	// Version handshake (host->guest, first message after connect) — must
+	// stay in sync with MSG_HANDSHAKE in internal/assets/files/include/xll_ipc.h.
+	MsgHandshake = msgid.MsgHandshake
+
 	// User Messages Start
 	MsgUserStart = msgid.MsgUserStart
 )
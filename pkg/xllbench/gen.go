@@ -0,0 +1,95 @@
+package xllbench
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/xll-gen/types/go/protocol"
+)
+
+// generator makes random arguments for each xll.yaml type. Grids, numgrids
+// and ranges are rows x cols, the size that decides whether a request goes
+// out chunked.
+type generator struct {
+	rng        *rand.Rand
+	rows, cols int
+}
+
+func newGenerator(seed int64, rows, cols int) *generator {
+	return &generator{rng: rand.New(rand.NewSource(seed)), rows: rows, cols: cols}
+}
+
+// args returns one random argument set for argument types types.
+func (g *generator) args(types []string) []any {
+	out := make([]any, len(types))
+	for i, t := range types {
+		out[i] = g.value(t)
+	}
+	return out
+}
+
+func (g *generator) value(typ string) any {
+	switch typ {
+	case "int":
+		return g.rng.Intn(2001) - 1000
+	case "float":
+		return g.rng.Float64()*2000 - 1000
+	case "bool":
+		return g.rng.Intn(2) == 0
+	case "string":
+		return g.text()
+	case "date":
+		// 2000-01-01 .. 2030-01-01, whole days, as a cell holds a date.
+		return time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, g.rng.Intn(10958))
+	case "grid":
+		grid := make([][]any, g.rows)
+		for r := range grid {
+			grid[r] = make([]any, g.cols)
+			for c := range grid[r] {
+				grid[r][c] = g.cell()
+			}
+		}
+		return grid
+	case "numgrid":
+		grid := make([][]float64, g.rows)
+		for r := range grid {
+			grid[r] = make([]float64, g.cols)
+			for c := range grid[r] {
+				grid[r][c] = g.rng.Float64() * 1000
+			}
+		}
+		return grid
+	case "range":
+		return &protocol.RangeT{
+			SheetName: "Sheet1",
+			Refs:      []*protocol.RectT{{RowFirst: 0, RowLast: int32(g.rows - 1), ColFirst: 0, ColLast: int32(g.cols - 1)}},
+		}
+	case "any":
+		return g.rng.Float64() * 1000
+	}
+	return nil
+}
+
+// cell is a grid cell: mostly numbers, some text and booleans, as a typical
+// sheet range holds.
+func (g *generator) cell() any {
+	switch n := g.rng.Intn(10); {
+	case n < 7:
+		return g.rng.Float64() * 1000
+	case n < 9:
+		return g.text()
+	default:
+		return g.rng.Intn(2) == 0
+	}
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// text is 4 to 24 random letters and digits.
+func (g *generator) text() string {
+	b := make([]byte, 4+g.rng.Intn(21))
+	for i := range b {
+		b[i] = letters[g.rng.Intn(len(letters))]
+	}
+	return string(b)
+}
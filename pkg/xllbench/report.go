@@ -0,0 +1,160 @@
+package xllbench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteReport saves r as JSON, for `xll-gen bench` to read back and for a
+// later run to compare with.
+func WriteReport(path string, r *Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ReadReport loads a report saved by WriteReport.
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("malformed bench report %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// WriteTable prints one row per function and a total row, then the chunk
+// reassembly counters.
+func WriteTable(w io.Writer, r *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "FUNCTION\tMODE\tCALLS\tERRORS\tBUSY\tCALLS/S\tP50\tP99\tMAX\t")
+	row := func(name, mode string, s Stats) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%.1f\t%s\t%s\t%s\t\n",
+			name, mode, s.Calls, s.Errors, s.Busy, s.Throughput, latency(s.P50), latency(s.P99), latency(s.Max))
+	}
+	for _, s := range r.Funcs {
+		row(s.Func, s.Mode, s)
+	}
+	row("total", "", r.Total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, s := range r.Funcs {
+		if s.FirstError != "" {
+			fmt.Fprintf(w, "%s: first error: %s\n", s.Func, s.FirstError)
+		}
+	}
+	if c := r.Chunk; c != nil {
+		fmt.Fprintf(w, "chunked requests: %d, reassembly peak %s (%s held at end)\n",
+			c.Opened, byteSize(c.PeakBufferedBytes), byteSize(c.BufferedBytes))
+	}
+	return nil
+}
+
+func latency(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	switch {
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	case d < time.Second:
+		return d.Round(10 * time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Regression is one metric that got worse between two reports beyond the
+// tolerance.
+type Regression struct {
+	// Func is the function, or "total".
+	Func   string
+	Metric string
+	Base   string
+	Now    string
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s %s: %s -> %s", r.Func, r.Metric, r.Base, r.Now)
+}
+
+// Compare reports what got worse from base to cur: throughput down or p50/p99
+// up by more than tolerance (0.1 = 10%), and any increase in the share of
+// busy rejects or errors. Functions only one report has are skipped.
+func Compare(base, cur *Report, tolerance float64) []Regression {
+	var out []Regression
+	out = append(out, compareStats("total", base.Total, cur.Total, tolerance)...)
+	byName := make(map[string]Stats, len(base.Funcs))
+	for _, s := range base.Funcs {
+		byName[s.Func] = s
+	}
+	names := make([]string, 0, len(cur.Funcs))
+	curByName := make(map[string]Stats, len(cur.Funcs))
+	for _, s := range cur.Funcs {
+		if _, ok := byName[s.Func]; ok {
+			names = append(names, s.Func)
+			curByName[s.Func] = s
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out = append(out, compareStats(name, byName[name], curByName[name], tolerance)...)
+	}
+	return out
+}
+
+func compareStats(name string, base, cur Stats, tol float64) []Regression {
+	var out []Regression
+	if base.Throughput > 0 && cur.Throughput < base.Throughput*(1-tol) {
+		out = append(out, Regression{name, "calls/s", fmt.Sprintf("%.1f", base.Throughput), fmt.Sprintf("%.1f", cur.Throughput)})
+	}
+	for _, m := range []struct {
+		metric    string
+		base, cur time.Duration
+	}{{"p50", base.P50, cur.P50}, {"p99", base.P99, cur.P99}} {
+		if m.base > 0 && float64(m.cur) > float64(m.base)*(1+tol) {
+			out = append(out, Regression{name, m.metric, latency(m.base), latency(m.cur)})
+		}
+	}
+	if rate(cur.Busy, cur.Calls) > rate(base.Busy, base.Calls) {
+		out = append(out, Regression{name, "busy", share(base.Busy, base.Calls), share(cur.Busy, cur.Calls)})
+	}
+	if rate(cur.Errors, cur.Calls) > rate(base.Errors, base.Calls) {
+		out = append(out, Regression{name, "errors", share(base.Errors, base.Calls), share(cur.Errors, cur.Calls)})
+	}
+	return out
+}
+
+func rate(n, calls int) float64 {
+	if calls == 0 {
+		return 0
+	}
+	return float64(n) / float64(calls)
+}
+
+func share(n, calls int) string {
+	return fmt.Sprintf("%d/%d", n, calls)
+}
@@ -0,0 +1,269 @@
+package xllbench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xll-gen/xll-gen/pkg/server"
+	"github.com/xll-gen/xll-gen/pkg/xllhost"
+	"github.com/xll-gen/xll-gen/pkg/xlltest"
+)
+
+// Report is the outcome of one run. It is saved as JSON so a later run can
+// be compared with it.
+type Report struct {
+	Started     time.Time     `json:"started"`
+	Elapsed     time.Duration `json:"elapsed"`
+	Concurrency int           `json:"concurrency"`
+	// Config records the server settings the run was made with (filled in by
+	// the caller, e.g. "server.workers"), so two reports say what changed.
+	Config map[string]string `json:"config,omitempty"`
+	Total  Stats             `json:"total"`
+	Funcs  []Stats           `json:"funcs"`
+	// Chunk is the server's reassembly counters at the end of the run; nil
+	// when Run was given no stats function.
+	Chunk *server.ChunkStats `json:"chunk,omitempty"`
+}
+
+// Stats summarizes the calls to one function, or to all of them for
+// Report.Total. Latencies are over the calls that succeeded: a busy reject
+// answers at once and would only pull them down.
+type Stats struct {
+	Func   string `json:"func,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+	Calls  int    `json:"calls"`
+	Errors int    `json:"errors"`
+	// Busy counts the calls rejected with "Server Busy"; they are not Errors.
+	Busy int `json:"busy"`
+	// Throughput is completed calls per second of the run, rejects included.
+	Throughput float64       `json:"throughput"`
+	P50        time.Duration `json:"p50"`
+	P99        time.Duration `json:"p99"`
+	Max        time.Duration `json:"max"`
+	// FirstError is the first error message seen, to tell a broken argument
+	// set from a loaded server at a glance.
+	FirstError string `json:"first_error,omitempty"`
+}
+
+// target is one function ready to call.
+type target struct {
+	sig  xllhost.Signature
+	sets [][]any
+	next atomic.Uint64
+}
+
+// tally is one caller's record of one target, merged after the run so the
+// callers never contend on a lock while measuring.
+type tally struct {
+	latencies  []time.Duration
+	errors     int
+	busy       int
+	firstError string
+}
+
+// Run drives h with the plan and returns the report. chunkStats, when not
+// nil, is the generated server's ChunkStats. h must already be served.
+func Run(ctx context.Context, h *xllhost.Host, p *Plan, chunkStats func() server.ChunkStats) (*Report, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	targets, schedule, err := prepare(h, p)
+	if err != nil {
+		return nil, err
+	}
+	timeout, _ := p.timeout()
+	duration, _ := p.duration()
+	workers := p.concurrency()
+
+	var deadline time.Time
+	if p.Requests == 0 {
+		deadline = time.Now().Add(duration)
+	}
+	var issued atomic.Int64
+	more := func() bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if p.Requests > 0 {
+			return issued.Add(1) <= int64(p.Requests)
+		}
+		return time.Now().Before(deadline)
+	}
+
+	tallies := make([][]tally, workers)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		tallies[w] = make([]tally, len(targets))
+		wg.Add(1)
+		go func(mine []tally, w int) {
+			defer wg.Done()
+			// Callers start at different points of the schedule so the first
+			// calls are not all to the same function.
+			for i := w; more(); i++ {
+				ti := schedule[i%len(schedule)]
+				t := targets[ti]
+				args := t.sets[t.next.Add(1)%uint64(len(t.sets))]
+				cctx, cancel := context.WithTimeout(ctx, timeout)
+				began := time.Now()
+				err := call(cctx, h, t.sig, args)
+				took := time.Since(began)
+				cancel()
+				mine[ti].record(took, err)
+			}
+		}(tallies[w], w)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	r := &Report{Started: start, Elapsed: elapsed, Concurrency: workers}
+	var all tally
+	for ti, t := range targets {
+		var merged tally
+		for w := range tallies {
+			merged.merge(tallies[w][ti])
+		}
+		s := merged.stats(elapsed)
+		s.Func, s.Mode = t.sig.Name, t.sig.Mode
+		r.Funcs = append(r.Funcs, s)
+		all.merge(merged)
+	}
+	r.Total = all.stats(elapsed)
+	if chunkStats != nil {
+		cs := chunkStats()
+		r.Chunk = &cs
+	}
+	return r, nil
+}
+
+// prepare resolves the plan's functions against h, converts or generates
+// their argument sets, and builds the weighted call schedule.
+func prepare(h *xllhost.Host, p *Plan) ([]*target, []int, error) {
+	funcs := p.Functions
+	if len(funcs) == 0 {
+		for _, name := range h.Functions() {
+			funcs = append(funcs, FuncPlan{Func: name})
+		}
+	}
+	if len(funcs) == 0 {
+		return nil, nil, errors.New("xll.yaml declares no functions")
+	}
+	rows, cols, _ := p.gridSize()
+	gen := newGenerator(p.Seed, rows, cols)
+	var targets []*target
+	var schedule []int
+	for _, f := range funcs {
+		sig, ok := h.Signature(f.Func)
+		if !ok {
+			return nil, nil, fmt.Errorf("no function %q in xll.yaml", f.Func)
+		}
+		t := &target{sig: sig}
+		for i, raw := range f.Args {
+			args, err := xlltest.ConvertArgs(sig, raw)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: argument set %d: %w", f.Func, i+1, err)
+			}
+			t.sets = append(t.sets, args)
+		}
+		if len(f.Args) == 0 {
+			for i := 0; i < randomSets; i++ {
+				t.sets = append(t.sets, gen.args(sig.ArgTypes))
+			}
+		}
+		weight := f.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		for i := 0; i < weight; i++ {
+			schedule = append(schedule, len(targets))
+		}
+		targets = append(targets, t)
+	}
+	return targets, schedule, nil
+}
+
+// call makes one call the way a cell would. A streaming rtd function has no
+// single result; the time to its first value stands in for it.
+func call(ctx context.Context, h *xllhost.Host, sig xllhost.Signature, args []any) error {
+	if sig.Mode != "rtd" {
+		_, err := h.Call(ctx, sig.Name, args...)
+		return err
+	}
+	topic, err := h.Subscribe(ctx, sig.Name, args...)
+	if err != nil {
+		return err
+	}
+	defer topic.Close()
+	for {
+		select {
+		case u := <-topic.Updates:
+			if u.Progress {
+				continue
+			}
+			if u.IsError {
+				return &xllhost.FuncError{Func: sig.Name, Msg: fmt.Sprint(u.Value)}
+			}
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("no value published: %w", ctx.Err())
+		}
+	}
+}
+
+func (t *tally) record(took time.Duration, err error) {
+	var fe *xllhost.FuncError
+	switch {
+	case err == nil:
+		t.latencies = append(t.latencies, took)
+		return
+	case errors.As(err, &fe) && fe.Msg == BusyMessage:
+		t.busy++
+		return
+	}
+	t.errors++
+	if t.firstError == "" {
+		t.firstError = err.Error()
+	}
+}
+
+func (t *tally) merge(o tally) {
+	t.latencies = append(t.latencies, o.latencies...)
+	t.errors += o.errors
+	t.busy += o.busy
+	if t.firstError == "" {
+		t.firstError = o.firstError
+	}
+}
+
+func (t *tally) stats(elapsed time.Duration) Stats {
+	s := Stats{
+		Calls:      len(t.latencies) + t.errors + t.busy,
+		Errors:     t.errors,
+		Busy:       t.busy,
+		FirstError: t.firstError,
+	}
+	if elapsed > 0 {
+		s.Throughput = float64(s.Calls) / elapsed.Seconds()
+	}
+	if n := len(t.latencies); n > 0 {
+		sort.Slice(t.latencies, func(i, j int) bool { return t.latencies[i] < t.latencies[j] })
+		s.P50 = percentile(t.latencies, 50)
+		s.P99 = percentile(t.latencies, 99)
+		s.Max = t.latencies[n-1]
+	}
+	return s
+}
+
+// percentile is the nearest-rank percentile of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
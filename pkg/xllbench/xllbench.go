@@ -0,0 +1,193 @@
+// Package xllbench is a synthetic load generator for a project's worksheet
+// functions, for sizing server.workers, timeouts and server.chunk before a
+// rollout. It drives the generated dispatch over pkg/xllhost from many
+// goroutines at once — the real wire path, chunking included — and reports
+// throughput, p50/p99 latency, "Server Busy" rejects and the chunk reassembly
+// memory the server needed. `xll-gen bench` drives it the way `xll-gen test`
+// drives pkg/xlltest: a throwaway go test in the project runs the plan and
+// hands the Report back, and two saved reports can be compared.
+//
+//	concurrency: 16          # concurrent callers (default: NumCPU)
+//	duration: 30s            # how long to run (default 10s) ...
+//	requests: 0              # ... or how many calls in total
+//	grid: 500x20             # generated grid/numgrid/range size (default 10x10)
+//	functions:               # default: every declared function, random args
+//	  - func: Add
+//	    args: [[1, 2], [3, 4]]   # argument sets, cycled; omit for random ones
+//	    weight: 3                # relative share of the calls (default 1)
+//	  - func: SumGrid            # random args at the grid size above
+//
+// Random arguments are deterministic for a given seed, so two runs of the
+// same plan send the same requests. A grid large enough to exceed the
+// request slot (512 KiB by default) goes out chunked, as it would from Excel.
+package xllbench
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the plan `xll-gen bench` reads when it exists, next to
+// xll.yaml.
+const DefaultFile = "xll.bench.yaml"
+
+// Environment variables through which `xll-gen bench` hands the plan and the
+// report file to the go test it generates.
+const (
+	EnvPlan   = "XLLGEN_BENCH_PLAN"
+	EnvReport = "XLLGEN_BENCH_REPORT"
+)
+
+// BusyMessage is the error an async call gets when the server's worker pool
+// is full (see pkg/server.JobPool.Submit).
+const BusyMessage = "Server Busy"
+
+// Defaults for what a plan leaves unset.
+const (
+	defaultDuration = 10 * time.Second
+	defaultTimeout  = 30 * time.Second
+	defaultRows     = 10
+	defaultCols     = 10
+	// randomSets is how many random argument sets are generated per function
+	// before the run, so generation stays out of the measured calls.
+	randomSets = 32
+)
+
+// Plan is a parsed bench plan. Its zero value benches every function with
+// random arguments for 10 seconds on NumCPU callers.
+type Plan struct {
+	Concurrency int `yaml:"concurrency" json:"concurrency,omitempty"`
+	// Duration is how long callers keep starting calls (e.g. "30s"). Ignored
+	// when Requests is set.
+	Duration string `yaml:"duration" json:"duration,omitempty"`
+	// Requests, when positive, runs exactly this many calls instead.
+	Requests int `yaml:"requests" json:"requests,omitempty"`
+	// Timeout bounds one call (default 30s); a call that exceeds it is an
+	// error.
+	Timeout string `yaml:"timeout" json:"timeout,omitempty"`
+	// Grid is the ROWSxCOLS size of generated grid, numgrid and range
+	// arguments.
+	Grid string `yaml:"grid" json:"grid,omitempty"`
+	Seed int64  `yaml:"seed" json:"seed,omitempty"`
+	// Functions restricts the run to these functions; empty means all.
+	Functions []FuncPlan `yaml:"functions" json:"functions,omitempty"`
+}
+
+// FuncPlan is one function's share of a plan.
+type FuncPlan struct {
+	Func string `yaml:"func" json:"func"`
+	// Args are argument sets as YAML values (see pkg/xlltest for how they
+	// map to each xll.yaml type), used in turn. Empty means random.
+	Args [][]any `yaml:"args" json:"args,omitempty"`
+	// Weight is the function's relative share of the calls; 0 means 1.
+	Weight int `yaml:"weight" json:"weight,omitempty"`
+}
+
+// LoadPlan reads and checks the plan at path. JSON is accepted too, which is
+// how `xll-gen bench` hands a plan with its flags applied to the go test.
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParsePlan(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ParsePlan is LoadPlan for content already in memory.
+func ParsePlan(data []byte) (*Plan, error) {
+	var p Plan
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks the plan's settings; unknown function names are only
+// caught by Run, which has the host.
+func (p *Plan) Validate() error {
+	if p.Concurrency < 0 {
+		return errors.New("concurrency must not be negative")
+	}
+	if p.Requests < 0 {
+		return errors.New("requests must not be negative")
+	}
+	if _, err := p.duration(); err != nil {
+		return err
+	}
+	if _, err := p.timeout(); err != nil {
+		return err
+	}
+	if _, _, err := p.gridSize(); err != nil {
+		return err
+	}
+	for _, f := range p.Functions {
+		if f.Func == "" {
+			return errors.New("a functions entry has no func")
+		}
+		if f.Weight < 0 {
+			return fmt.Errorf("%s: weight must not be negative", f.Func)
+		}
+	}
+	return nil
+}
+
+func (p *Plan) concurrency() int {
+	if p.Concurrency > 0 {
+		return p.Concurrency
+	}
+	return runtime.NumCPU()
+}
+
+func (p *Plan) duration() (time.Duration, error) {
+	return positiveDuration("duration", p.Duration, defaultDuration)
+}
+
+func (p *Plan) timeout() (time.Duration, error) {
+	return positiveDuration("timeout", p.Timeout, defaultTimeout)
+}
+
+func positiveDuration(name, s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %s", name, s)
+	}
+	return d, nil
+}
+
+// gridSize parses Grid as ROWSxCOLS.
+func (p *Plan) gridSize() (rows, cols int, err error) {
+	if p.Grid == "" {
+		return defaultRows, defaultCols, nil
+	}
+	r, c, ok := strings.Cut(strings.ToLower(p.Grid), "x")
+	if ok {
+		rows, err = strconv.Atoi(strings.TrimSpace(r))
+		if err == nil {
+			cols, err = strconv.Atoi(strings.TrimSpace(c))
+		}
+	}
+	if !ok || err != nil || rows <= 0 || cols <= 0 {
+		return 0, 0, fmt.Errorf("grid must be ROWSxCOLS with positive sizes, e.g. 500x20; got %q", p.Grid)
+	}
+	return rows, cols, nil
+}
@@ -0,0 +1,160 @@
+package xllbench
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xll-gen/xll-gen/pkg/xllhost"
+	"github.com/xll-gen/xll-gen/pkg/xllhost/xllhosttest"
+)
+
+// startGuest serves the shared test guest (pkg/xllhost/xllhosttest). Its Slow
+// runs on a one-worker JobPool and answers BusyMessage when it is full, as the
+// generated async case does.
+func startGuest(t *testing.T) (*xllhost.Host, *xllhosttest.Guest) {
+	t.Helper()
+	if xllhosttest.BusyMessage != BusyMessage {
+		t.Fatalf("the test guest answers busy with %q, Run counts %q", xllhosttest.BusyMessage, BusyMessage)
+	}
+	h, err := xllhost.Parse([]byte(xllhosttest.YAML))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return h, xllhosttest.Serve(t, h)
+}
+
+func TestParsePlan(t *testing.T) {
+	p, err := ParsePlan([]byte("grid: 500X20\nfunctions:\n  - func: Add\n    args: [[1, 2]]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows, cols, _ := p.gridSize(); rows != 500 || cols != 20 {
+		t.Errorf("grid = %dx%d, want 500x20", rows, cols)
+	}
+	if d, _ := p.duration(); d != defaultDuration {
+		t.Errorf("duration = %v, want the default", d)
+	}
+	for _, bad := range []string{
+		"grid: 10x",
+		"grid: 0x5",
+		"duration: -1s",
+		"timeout: soon",
+		"concurrency: -2",
+		"functions: [{weight: 2}]",
+		"functions: [{func: Add, weight: -1}]",
+	} {
+		if _, err := ParsePlan([]byte(bad)); err == nil {
+			t.Errorf("ParsePlan(%q) accepted", bad)
+		}
+	}
+}
+
+// TestRun drives three functions: the given Add arguments are used, the
+// generated numgrids Total gets are large enough to go out chunked, and the
+// one-worker pool behind Slow rejects some calls as busy.
+func TestRun(t *testing.T) {
+	h, g := startGuest(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	plan := &Plan{
+		Concurrency: 8,
+		Requests:    120,
+		Grid:        "300x300", // 720 KB of doubles: over the 512 KiB request slot
+		Functions: []FuncPlan{
+			{Func: "Add", Args: [][]any{{1, 2}, {3, 4}}},
+			{Func: "Total"},
+			{Func: "Slow", Weight: 2},
+		},
+	}
+	r, err := Run(ctx, h, plan, g.ChunkStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Total.Calls != 120 {
+		t.Errorf("total calls = %d, want 120", r.Total.Calls)
+	}
+	byName := map[string]Stats{}
+	sum := 0
+	for _, s := range r.Funcs {
+		byName[s.Func] = s
+		sum += s.Calls
+	}
+	if sum != r.Total.Calls {
+		t.Errorf("function calls add up to %d, total says %d", sum, r.Total.Calls)
+	}
+	for _, name := range []string{"Add", "Total"} {
+		if s := byName[name]; s.Calls == 0 || s.Errors != 0 || s.P50 == 0 || s.P99 < s.P50 || s.Max < s.P99 {
+			t.Errorf("%s: %+v", name, s)
+		}
+	}
+	if s := byName["Slow"]; s.Busy == 0 || s.Errors != 0 {
+		t.Errorf("Slow: %+v; want busy rejects from its one-worker pool", s)
+	}
+	if r.Chunk == nil || r.Chunk.Opened == 0 || r.Chunk.PeakBufferedBytes < 300*300*8 {
+		t.Errorf("chunk stats %+v; want chunked Total requests", r.Chunk)
+	}
+
+	var table strings.Builder
+	if err := WriteTable(&table, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Total", "total", "chunked requests:"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("table lacks %q:\n%s", want, table.String())
+		}
+	}
+
+	if _, err := Run(ctx, h, &Plan{Functions: []FuncPlan{{Func: "Nope"}}}, nil); err == nil {
+		t.Error("an undeclared function was benched")
+	}
+	if _, err := Run(ctx, h, &Plan{Functions: []FuncPlan{{Func: "Add", Args: [][]any{{1}}}}}, nil); err == nil {
+		t.Error("an argument set of the wrong length was accepted")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base := &Report{
+		Total: Stats{Calls: 1000, Throughput: 100, P50: 10 * time.Millisecond, P99: 50 * time.Millisecond},
+		Funcs: []Stats{
+			{Func: "Add", Calls: 500, Throughput: 50, P50: time.Millisecond, P99: 2 * time.Millisecond},
+			{Func: "Gone", Calls: 500, Throughput: 50},
+		},
+	}
+	cur := &Report{
+		Total: Stats{Calls: 1000, Busy: 10, Throughput: 95, P50: 10 * time.Millisecond, P99: 80 * time.Millisecond},
+		Funcs: []Stats{
+			{Func: "Add", Calls: 300, Errors: 3, Throughput: 30, P50: time.Millisecond, P99: 2 * time.Millisecond},
+			{Func: "New", Calls: 700, Throughput: 70},
+		},
+	}
+	var got []string
+	for _, r := range Compare(base, cur, 0.1) {
+		got = append(got, r.Func+" "+r.Metric)
+	}
+	want := []string{"total p99", "total busy", "Add calls/s", "Add errors"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("regressions = %v, want %v", got, want)
+	}
+	if regs := Compare(base, base, 0.1); len(regs) != 0 {
+		t.Errorf("a report regressed against itself: %v", regs)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var d []time.Duration
+	for i := 1; i <= 200; i++ {
+		d = append(d, time.Duration(i))
+	}
+	if p := percentile(d, 50); p != 100 {
+		t.Errorf("p50 = %d, want 100", p)
+	}
+	if p := percentile(d, 99); p != 198 {
+		t.Errorf("p99 = %d, want 198", p)
+	}
+	if p := percentile(d[:1], 99); p != 1 {
+		t.Errorf("p99 of one = %d, want 1", p)
+	}
+}
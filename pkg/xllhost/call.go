@@ -0,0 +1,384 @@
+package xllhost
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/server"
+)
+
+// Call invokes the worksheet function name with args, the way a cell would,
+// and returns its result (see the table in values.go for the Go types):
+//
+//   - sync: one request, the response decoded;
+//   - async: the request carries a fresh handle, the guest ACKs, and Call
+//     waits for that handle's entry in an async batch;
+//   - rtd-once: a topic is connected with the function's topic strings, Call
+//     waits for the one result (a grid result is read from the one-shot grid
+//     it announces) and then disconnects, as the XLL's wrapper does.
+//
+// A handler error is a *FuncError. Streaming rtd functions have no single
+// result; use Subscribe.
+func (h *Host) Call(ctx context.Context, name string, args ...any) (any, error) {
+	fi, ok := h.funcs[name]
+	if !ok {
+		return nil, fmt.Errorf("xllhost: no function %q in xll.yaml", name)
+	}
+	switch fi.fn.Mode {
+	case "rtd":
+		return nil, fmt.Errorf("xllhost: %s is a streaming rtd function; use Subscribe", name)
+	case "rtd-once":
+		return h.callOnce(ctx, fi, args)
+	case "async":
+		return h.callAsync(ctx, fi, args)
+	}
+	req, err := h.buildRequest(fi, args, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := h.Send(ctx, fi.msgType, req)
+	if err != nil {
+		return nil, fmt.Errorf("xllhost: %s: %w", name, err)
+	}
+	return decodeResponse(fi, resp)
+}
+
+func (h *Host) callAsync(ctx context.Context, fi funcInfo, args []any) (any, error) {
+	handle := h.NewAsyncHandle()
+	req, err := h.buildRequest(fi, args, handle)
+	if err != nil {
+		return nil, err
+	}
+	return h.SendAsync(ctx, fi.fn.Name, fi.msgType, req, handle)
+}
+
+// SendAsync delivers the request of the async function name, whose
+// async_handle field is handle (from NewAsyncHandle), checks that the guest
+// ACKs it, and waits for that handle's entry in an async batch. The result is
+// a Go value as in the table in values.go; a handler error is a *FuncError.
+func (h *Host) SendAsync(ctx context.Context, name string, msgType shm.MsgType, req, handle []byte) (any, error) {
+	// Register before sending: the result can be flushed before the ACK
+	// returns.
+	ch := make(chan asyncResult, 1)
+	h.mu.Lock()
+	h.async[string(handle)] = ch
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.async, string(handle))
+		h.mu.Unlock()
+	}()
+
+	resp, respType, err := h.Send(ctx, msgType, req)
+	if err != nil {
+		return nil, fmt.Errorf("xllhost: %s: %w", name, err)
+	}
+	if respType != server.MsgAck || !protocol.GetRootAsAck(resp, 0).Ok() {
+		return nil, fmt.Errorf("xllhost: %s: async call was not acknowledged (reply type %d)", name, respType)
+	}
+	select {
+	case res := <-ch:
+		if res.err != "" {
+			return nil, &FuncError{Func: name, Msg: res.err}
+		}
+		return res.value, nil
+	case <-h.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, fmt.Errorf("xllhost: %s: waiting for the async result: %w", name, ctx.Err())
+	}
+}
+
+func (h *Host) callOnce(ctx context.Context, fi funcInfo, args []any) (any, error) {
+	t, err := h.Subscribe(ctx, fi.fn.Name, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+
+	isGrid := fi.fn.Return == "grid" || fi.fn.Return == "numgrid"
+	var gridReady chan struct{}
+	if isGrid {
+		gridReady = h.awaitGrid(t.Key)
+	}
+	for {
+		select {
+		case u := <-t.Updates:
+			if u.Progress {
+				continue
+			}
+			if u.IsError {
+				return nil, &FuncError{Func: fi.fn.Name, Msg: fmt.Sprint(u.Value)}
+			}
+			if !isGrid {
+				return u.Value, nil
+			}
+			// The readiness token is pushed only after the grid was
+			// delivered (rtd.RunOnceGrid), so it is already stored.
+			select {
+			case <-gridReady:
+			default:
+				return nil, fmt.Errorf("xllhost: %s: readiness token arrived before the one-shot grid", fi.fn.Name)
+			}
+			v, _ := h.OnceGrid(t.Key)
+			return v, nil
+		case <-h.done:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, fmt.Errorf("xllhost: %s: waiting for the rtd-once result: %w", fi.fn.Name, ctx.Err())
+		}
+	}
+}
+
+// awaitGrid returns a channel closed once a one-shot grid is stored under key.
+func (h *Host) awaitGrid(key string) chan struct{} {
+	ch := make(chan struct{})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.grids[key]; ok {
+		close(ch)
+		return ch
+	}
+	h.gridWait[key] = append(h.gridWait[key], ch)
+	return ch
+}
+
+// Update is one value pushed to an RTD topic.
+type Update struct {
+	Value any
+	// IsError marks an error value (a handler error or a composite-argument
+	// resolve miss) rather than a result.
+	IsError bool
+	// Progress marks an interim rtd.Progress display value (MsgRtdProgress),
+	// which the XLL paints but never stores as the result.
+	Progress bool
+}
+
+// Topic is one connected RTD topic.
+type Topic struct {
+	ID int32
+	// Key is the topic strings joined with "\x1f": the XLL's once key, under
+	// which an rtd-once grid function delivers its grid.
+	Key string
+	// Updates receives every value pushed to the topic. It is buffered; when a
+	// test does not drain it, the oldest values are dropped — RTD semantics
+	// are "latest value wins" anyway.
+	Updates <-chan Update
+
+	h       *Host
+	updates chan Update
+}
+
+// Subscribe connects an RTD topic for the rtd or rtd-once function name, the
+// way the XLL's wrapper does: scalar arguments become topic strings, and
+// composite ones (grid, numgrid, range, any) are primed into the guest's
+// RefCache with MsgSetRefCache and passed as a token.
+func (h *Host) Subscribe(ctx context.Context, name string, args ...any) (*Topic, error) {
+	fi, ok := h.funcs[name]
+	if !ok {
+		return nil, fmt.Errorf("xllhost: no function %q in xll.yaml", name)
+	}
+	if fi.fn.Mode != "rtd" && fi.fn.Mode != "rtd-once" {
+		return nil, fmt.Errorf("xllhost: %s is not an rtd function; use Call", name)
+	}
+	if len(args) != len(fi.fn.Args) {
+		return nil, fmt.Errorf("xllhost: %s takes %d arguments, got %d", name, len(fi.fn.Args), len(args))
+	}
+	topics := []string{name}
+	for i, a := range fi.fn.Args {
+		var s string
+		var err error
+		if isComposite(a.Type) {
+			s, err = h.primeRefCache(ctx, a.Type, args[i])
+		} else {
+			s, err = topicString(a.Type, args[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xllhost: %s argument %s (%s): %w", name, a.Name, a.Type, err)
+		}
+		topics = append(topics, s)
+	}
+	return h.Connect(ctx, topics...)
+}
+
+// Connect connects a topic with raw topic strings, reaching the project's
+// OnRtdConnect for strings that do not name a declared function.
+func (h *Host) Connect(ctx context.Context, topics ...string) (*Topic, error) {
+	updates := make(chan Update, 256)
+	t := &Topic{
+		ID:      h.nextTopic.Add(1),
+		Key:     strings.Join(topics, "\x1f"),
+		Updates: updates,
+		h:       h,
+		updates: updates,
+	}
+	h.mu.Lock()
+	h.topics[t.ID] = t
+	h.mu.Unlock()
+
+	b := flatbuffers.NewBuilder(128)
+	offs := make([]flatbuffers.UOffsetT, len(topics))
+	for i, s := range topics {
+		offs[i] = b.CreateString(s)
+	}
+	protocol.RtdConnectRequestStartStringsVector(b, len(offs))
+	for i := len(offs) - 1; i >= 0; i-- {
+		b.PrependUOffsetT(offs[i])
+	}
+	vec := b.EndVector(len(offs))
+	protocol.RtdConnectRequestStart(b)
+	protocol.RtdConnectRequestAddTopicId(b, t.ID)
+	protocol.RtdConnectRequestAddStrings(b, vec)
+	protocol.RtdConnectRequestAddNewValues(b, true)
+	b.Finish(protocol.RtdConnectRequestEnd(b))
+
+	if _, _, err := h.Send(ctx, server.MsgRtdConnect, b.FinishedBytes()); err != nil {
+		h.dropTopic(t.ID)
+		return nil, fmt.Errorf("xllhost: RTD connect %q: %w", t.Key, err)
+	}
+	return t, nil
+}
+
+// Close disconnects the topic, cancelling its handler's context.
+func (t *Topic) Close() error {
+	t.h.dropTopic(t.ID)
+	b := flatbuffers.NewBuilder(32)
+	protocol.RtdDisconnectRequestStart(b)
+	protocol.RtdDisconnectRequestAddTopicId(b, t.ID)
+	b.Finish(protocol.RtdDisconnectRequestEnd(b))
+	_, _, err := t.h.Send(context.Background(), server.MsgRtdDisconnect, b.FinishedBytes())
+	if err == ErrClosed {
+		return nil
+	}
+	return err
+}
+
+func (h *Host) dropTopic(id int32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.topics, id)
+}
+
+func (h *Host) deliverUpdate(id int32, u Update) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.topics[id]
+	if !ok {
+		return
+	}
+	for {
+		select {
+		case t.updates <- u:
+			return
+		default:
+		}
+		select {
+		case <-t.updates:
+		default:
+		}
+	}
+}
+
+// primeRefCache stores a composite argument in the guest's per-cycle RefCache
+// and returns the token the topic string carries in its place.
+func (h *Host) primeRefCache(ctx context.Context, typ string, v any) (string, error) {
+	key := fmt.Sprintf("xllhost-%d", h.nextRef.Add(1))
+	b := flatbuffers.NewBuilder(256)
+	var val flatbuffers.UOffsetT
+	var err error
+	switch typ {
+	case "any":
+		val, err = buildAny(b, v)
+	default:
+		var off flatbuffers.UOffsetT
+		off, err = buildComposite(b, typ, v)
+		val = wrapAny(b, map[string]protocol.AnyValue{
+			"grid":    protocol.AnyValueGrid,
+			"numgrid": protocol.AnyValueNumGrid,
+			"range":   protocol.AnyValueRange,
+		}[typ], off)
+	}
+	if err != nil {
+		return "", err
+	}
+	keyOff := b.CreateString(key)
+	protocol.SetRefCacheRequestStart(b)
+	protocol.SetRefCacheRequestAddKey(b, keyOff)
+	protocol.SetRefCacheRequestAddVal(b, val)
+	b.Finish(protocol.SetRefCacheRequestEnd(b))
+	if _, _, err := h.Send(ctx, server.MsgSetRefCache, b.FinishedBytes()); err != nil {
+		return "", err
+	}
+	return server.RefArgTokenPrefix + key, nil
+}
+
+// Command is one sheet write a CalculationEnded handler scheduled
+// (ScheduleSet / ScheduleFormat).
+type Command struct {
+	Target *protocol.RangeT
+	// Value is the SetCommand value; Format the FormatCommand format. Exactly
+	// one kind is set, as reported by IsFormat.
+	Value    any
+	Format   string
+	IsFormat bool
+}
+
+// CalculationEnded sends the end-of-recalc event: the guest clears its
+// per-cycle RefCache, runs the OnCalculationEnded handler and answers with the
+// sheet writes it scheduled.
+func (h *Host) CalculationEnded(ctx context.Context) ([]Command, error) {
+	resp, _, err := h.Send(ctx, server.MsgCalculationEnded, nil)
+	if err != nil || len(resp) == 0 {
+		return nil, err
+	}
+	var cmds []Command
+	r := protocol.GetRootAsCalculationEndedResponse(resp, 0).UnPack()
+	for _, w := range r.Commands {
+		if w == nil || w.Cmd == nil {
+			continue
+		}
+		switch c := w.Cmd.Value.(type) {
+		case *protocol.SetCommandT:
+			cmd := Command{Target: c.Target}
+			if c.Value != nil && c.Value.Val != nil {
+				cmd.Value = goValue(c.Value.Val.Value)
+			}
+			cmds = append(cmds, cmd)
+		case *protocol.FormatCommandT:
+			cmds = append(cmds, Command{Target: c.Target, Format: c.Format, IsFormat: true})
+		}
+	}
+	return cmds, nil
+}
+
+// CalculationCanceled sends the recalc-canceled notification.
+func (h *Host) CalculationCanceled(ctx context.Context) error {
+	_, _, err := h.Send(ctx, server.MsgCalculationCanceled, nil)
+	return err
+}
+
+// InvokeCommand invokes a declared command as a ribbon click (controlID) or
+// shortcut (""). Like the XLL it only waits for the delivery acknowledgement;
+// the handler runs on its own goroutine.
+func (h *Host) InvokeCommand(ctx context.Context, name, controlID string) error {
+	b := flatbuffers.NewBuilder(64)
+	nameOff := b.CreateString(name)
+	ctlOff := b.CreateString(controlID)
+	protocol.CommandInvokeRequestStart(b)
+	protocol.CommandInvokeRequestAddCommandName(b, nameOff)
+	protocol.CommandInvokeRequestAddControlId(b, ctlOff)
+	b.Finish(protocol.CommandInvokeRequestEnd(b))
+	resp, _, err := h.Send(ctx, server.MsgCommandInvoke, b.FinishedBytes())
+	if err != nil {
+		return err
+	}
+	r := protocol.GetRootAsCommandInvokeResponse(resp, 0)
+	if !r.Ok() {
+		return fmt.Errorf("xllhost: command %s: %s", name, r.Error())
+	}
+	return nil
+}
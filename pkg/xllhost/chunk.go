@@ -0,0 +1,161 @@
+package xllhost
+
+import (
+	"errors"
+	"fmt"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/chunk"
+	"github.com/xll-gen/xll-gen/pkg/server"
+)
+
+// sendChunked sends an oversized host->guest request as protocol.Chunk frames
+// through the guest's HandleChunk, which dispatches the reassembled request on
+// the final frame. Every earlier frame must be acknowledged. The host never
+// compresses, like the XLL.
+func (h *Host) sendChunked(dispatch func([]byte, []byte, shm.MsgType) (int32, shm.MsgType), msgType shm.MsgType, req []byte) ([]byte, shm.MsgType, error) {
+	var resp []byte
+	var respType shm.MsgType
+	sender := &chunk.Sender{
+		ChunkSize:         chunk.Budget(h.requestBytes()),
+		CompressThreshold: -1,
+	}
+	send := func(frame []byte) error {
+		resp, respType = h.roundTrip(dispatch, server.MsgChunk, frame)
+		if respType == shm.MsgTypeSystemError {
+			return ErrSystem
+		}
+		return nil
+	}
+	if err := sender.Send(req, h.nextTransfer.Add(1), uint32(msgType), send, chunk.NoRetry); err != nil {
+		return nil, 0, fmt.Errorf("xllhost: chunked request: %w", err)
+	}
+	return resp, respType, nil
+}
+
+// pullChunks completes a reply that arrived as the first frame of an ACK-pull
+// transfer (server.HandleAck): each MsgAck carrying the transfer id returns the
+// next frame until the payload is whole.
+func (h *Host) pullChunks(dispatch func([]byte, []byte, shm.MsgType) (int32, shm.MsgType), first []byte) ([]byte, shm.MsgType, error) {
+	c := protocol.GetRootAsChunk(first, 0)
+	p, err := newPartialTransfer(c)
+	if err != nil {
+		return nil, 0, err
+	}
+	frame := c
+	for {
+		done, err := p.add(frame)
+		if err != nil {
+			return nil, 0, err
+		}
+		if done {
+			return p.finish()
+		}
+		ack := server.BuildAckResponse(flatbuffers.NewBuilder(64), p.id, true)
+		next, respType := h.roundTrip(dispatch, server.MsgAck, ack)
+		if respType != server.MsgChunk || len(next) == 0 {
+			return nil, 0, fmt.Errorf("xllhost: ACK-pull of transfer %d stopped at %d/%d bytes", p.id, p.received, len(p.data))
+		}
+		frame = protocol.GetRootAsChunk(next, 0)
+	}
+}
+
+// partialTransfer reassembles one chunked transfer. It enforces what the XLL's
+// HandleChunk enforces — a positive total within the per-transfer cap, frames
+// in bounds, no zero-length or overlapping frames — so a guest that would be
+// refused by the real host is refused here too.
+type partialTransfer struct {
+	id       uint64
+	msgType  uint32
+	data     []byte
+	received int
+	seen     map[uint32]int
+}
+
+func newPartialTransfer(c *protocol.Chunk) (*partialTransfer, error) {
+	total := int64(c.TotalSize())
+	if total <= 0 || total > chunk.MaxTransferBytes {
+		return nil, fmt.Errorf("xllhost: chunk transfer %d declares %d bytes", c.Id(), total)
+	}
+	return &partialTransfer{
+		id:      c.Id(),
+		msgType: c.MsgType(),
+		data:    make([]byte, total),
+		seen:    make(map[uint32]int),
+	}, nil
+}
+
+// add copies one frame in and reports whether the transfer is complete. An
+// exact retransmit is ignored.
+func (p *partialTransfer) add(c *protocol.Chunk) (bool, error) {
+	data := c.DataBytes()
+	off := c.Offset()
+	switch {
+	case c.MsgType() != p.msgType || int(c.TotalSize()) != len(p.data):
+		return false, fmt.Errorf("xllhost: chunk transfer %d changed its header mid-transfer", p.id)
+	case len(data) == 0:
+		return false, fmt.Errorf("xllhost: zero-length chunk in transfer %d", p.id)
+	case uint64(off)+uint64(len(data)) > uint64(len(p.data)):
+		return false, fmt.Errorf("xllhost: chunk out of bounds in transfer %d", p.id)
+	}
+	if n, ok := p.seen[off]; ok {
+		if n != len(data) {
+			return false, fmt.Errorf("xllhost: overlapping chunk in transfer %d", p.id)
+		}
+		return p.received == len(p.data), nil
+	}
+	p.seen[off] = len(data)
+	copy(p.data[off:], data)
+	p.received += len(data)
+	if p.received > len(p.data) {
+		return false, fmt.Errorf("xllhost: overlapping chunk in transfer %d", p.id)
+	}
+	return p.received == len(p.data), nil
+}
+
+// finish returns the reassembled payload and its real message type, inflating
+// a compressed transfer (chunk.CompressedFlag) under the same cap.
+func (p *partialTransfer) finish() ([]byte, shm.MsgType, error) {
+	if p.msgType&chunk.CompressedFlag == 0 {
+		return p.data, shm.MsgType(p.msgType), nil
+	}
+	out, err := chunk.Decompress(p.data, chunk.MaxTransferBytes)
+	if err != nil {
+		return nil, 0, fmt.Errorf("xllhost: compressed transfer %d: %w", p.id, err)
+	}
+	return out, shm.MsgType(p.msgType &^ chunk.CompressedFlag), nil
+}
+
+// receiveChunk feeds one guest->host chunk frame into its transfer and, when
+// the transfer completes, delivers the reassembled message.
+func (h *Host) receiveChunk(frame []byte) error {
+	if !flatbuffers.BufferHasIdentifier(frame, "XCHN") {
+		return errors.New("xllhost: chunk frame without the XCHN identifier")
+	}
+	c := protocol.GetRootAsChunk(frame, 0)
+	h.mu.Lock()
+	p, ok := h.chunks[c.Id()]
+	if !ok {
+		var err error
+		if p, err = newPartialTransfer(c); err != nil {
+			h.mu.Unlock()
+			return err
+		}
+		h.chunks[c.Id()] = p
+	}
+	done, err := p.add(c)
+	if err != nil || done {
+		delete(h.chunks, c.Id())
+	}
+	h.mu.Unlock()
+	if err != nil || !done {
+		return err
+	}
+	data, msgType, err := p.finish()
+	if err != nil {
+		return err
+	}
+	return h.receive(data, msgType)
+}
@@ -0,0 +1,189 @@
+package xllhost
+
+import (
+	"context"
+	"fmt"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/pkg/server"
+)
+
+// The two methods below back the per-function fuzz tests `xll-gen generate`
+// emits with gen.go.fuzz: SeedRequest is the seed corpus, CheckFrame the
+// property every mutated request must keep.
+
+// SeedRequest returns a well-formed request for the function name, built from
+// one sample value per argument, and the message type it travels as. rtd and
+// rtd-once functions have no request: their arguments arrive as topic
+// strings.
+func (h *Host) SeedRequest(name string) ([]byte, shm.MsgType, error) {
+	fi, err := h.requestFunc(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	args := make([]any, len(fi.fn.Args))
+	for i, a := range fi.fn.Args {
+		args[i] = sampleArg(a.Type)
+	}
+	var handle []byte
+	if fi.fn.Async {
+		handle = h.NewAsyncHandle()
+	}
+	req, err := h.buildRequest(fi, args, handle)
+	return req, fi.msgType, err
+}
+
+// CheckFrame hands data to the dispatch as the function name's request, in
+// one frame whatever its size and without any checking, and reports whether
+// the reply is one the XLL can handle: SYSTEM_ERROR with no payload, a
+// response whose result and error fields decode (a handler error is fine),
+// or, for an async function, an ACK followed by a result queued under the
+// frame's handle. An ACKed async frame whose handle cannot be read, or that
+// never gets its result, is an error: the XLL would wait on that cell
+// forever. A panic is not recovered; in the real server it would have killed
+// the process.
+func (h *Host) CheckFrame(ctx context.Context, name string, data []byte) error {
+	fi, err := h.requestFunc(name)
+	if err != nil {
+		return err
+	}
+	dispatch, err := h.awaitDispatch(ctx)
+	if err != nil {
+		return err
+	}
+	var result chan asyncResult
+	var handleErr error
+	if fi.fn.Async {
+		// Register before dispatching, as SendAsync does: the result can be
+		// flushed before the ACK returns.
+		var handle []byte
+		if handle, handleErr = asyncHandle(fi, data); handleErr == nil {
+			result = make(chan asyncResult, 1)
+			h.mu.Lock()
+			h.async[string(handle)] = result
+			h.mu.Unlock()
+			defer func() {
+				h.mu.Lock()
+				delete(h.async, string(handle))
+				h.mu.Unlock()
+			}()
+		}
+	}
+	respBuf := make([]byte, h.responseBytes())
+	n, respType := dispatch(append([]byte(nil), data...), respBuf, fi.msgType)
+	if n < 0 || int(n) > len(respBuf) {
+		return fmt.Errorf("xllhost: %s: reply length %d outside the %d-byte response buffer", name, n, len(respBuf))
+	}
+	resp := respBuf[:n]
+	switch respType {
+	case shm.MsgTypeSystemError:
+		if n != 0 {
+			return fmt.Errorf("xllhost: %s: SYSTEM_ERROR reply carries %d bytes", name, n)
+		}
+		return nil
+	case server.MsgChunk:
+		if resp, respType, err = h.pullChunks(dispatch, resp); err != nil {
+			return fmt.Errorf("xllhost: %s: chunked reply: %w", name, err)
+		}
+	}
+
+	if fi.fn.Async {
+		if respType != server.MsgAck {
+			return fmt.Errorf("xllhost: %s: async request answered with message %d, want an ACK", name, respType)
+		}
+		if err := decodeChecked(name, func() error {
+			if n == 0 || !protocol.GetRootAsAck(resp, 0).Ok() {
+				return fmt.Errorf("xllhost: %s: async request not acknowledged", name)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if handleErr != nil {
+			return fmt.Errorf("xllhost: %s: malformed async request acknowledged instead of SYSTEM_ERROR: %w", name, handleErr)
+		}
+		select {
+		case <-result:
+			return nil
+		case <-h.done:
+			return ErrClosed
+		case <-ctx.Done():
+			return fmt.Errorf("xllhost: %s: async request acknowledged but no result queued: %w", name, ctx.Err())
+		}
+	}
+	if respType != fi.msgType {
+		return fmt.Errorf("xllhost: %s: reply is message %d, want %d", name, respType, fi.msgType)
+	}
+	return decodeChecked(name, func() error {
+		_, err := decodeResponse(fi, resp)
+		if _, ok := err.(*FuncError); ok {
+			return nil
+		}
+		return err
+	})
+}
+
+// requestFunc looks up a function that is called with a request.
+func (h *Host) requestFunc(name string) (funcInfo, error) {
+	fi, ok := h.funcs[name]
+	if !ok {
+		return funcInfo{}, fmt.Errorf("xllhost: no function %q in xll.yaml", name)
+	}
+	if config.IsRtdLike(fi.fn.Mode) {
+		return funcInfo{}, fmt.Errorf("xllhost: %s is an %s function; it takes topic strings, not a request", name, fi.fn.Mode)
+	}
+	return fi, nil
+}
+
+// asyncHandle reads the async_handle field of an async function's request
+// the way the generated accessor does: by slot, after the arguments (see
+// buildRequest). An absent field is a nil handle, as it is to the guest.
+func asyncHandle(fi funcInfo, data []byte) (handle []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reading async_handle: %v", r)
+		}
+	}()
+	t := flatbuffers.Table{Bytes: data, Pos: flatbuffers.GetUOffsetT(data)}
+	if o := flatbuffers.UOffsetT(t.Offset(flatbuffers.VOffsetT(4 + 2*len(fi.fn.Args)))); o != 0 {
+		handle = append([]byte(nil), t.ByteVector(o+t.Pos)...)
+	}
+	return handle, nil
+}
+
+// decodeChecked runs decode over a reply and turns a panic while reading it
+// into an error: a reply the host cannot read is the guest's bug, and the
+// fuzz test should report it, not crash on it.
+func decodeChecked(name string, decode func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("xllhost: %s: malformed reply: %v", name, r)
+		}
+	}()
+	return decode()
+}
+
+// sampleArg is one value of the xll.yaml type typ (see the table in
+// values.go).
+func sampleArg(typ string) any {
+	switch typ {
+	case "int":
+		return 1
+	case "float", "date":
+		return 45292.5
+	case "bool":
+		return true
+	case "string":
+		return "xll-gen"
+	case "grid":
+		return [][]any{{1.5, "a"}, {true, nil}}
+	case "numgrid":
+		return [][]float64{{1, 2}, {3, 4}}
+	case "range":
+		return &protocol.RangeT{SheetName: "Sheet1", Refs: []*protocol.RectT{{RowLast: 1, ColLast: 1}}}
+	}
+	return 1.5 // any
+}
@@ -0,0 +1,366 @@
+// Package xllhost plays the XLL side of the SHM link in-process, so a project's
+// XllService can be tested with ordinary `go test` over the real wire path:
+// the requests it builds are the FlatBuffers the generated C++ wrappers send,
+// they go through the generated dispatch (ServeConn), and the replies — sync
+// responses, async batches, RTD updates, rtd-once grids, chunked transfers —
+// are decoded the way the XLL decodes them.
+//
+//	h, err := xllhost.Load("../xll.yaml")
+//	...
+//	go generated.ServeConn(myService{}, h)
+//	defer h.Close()
+//	v, err := h.Call(ctx, "Add", 1, 2) // v == int32(3)
+//
+// A Host implements server.GuestConn. The generated ServeConn can run only once
+// per process (the async batcher's worker is not restartable), so a test suite
+// shares one Host, typically started from TestMain.
+//
+// Function metadata comes from xll.yaml itself (the same Load + ApplyDefaults +
+// Validate as `xll-gen generate`), so the host and the generated server agree
+// on message IDs and request field slots by construction, not by a second copy.
+package xllhost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/internal/config"
+	"github.com/xll-gen/xll-gen/pkg/chunk"
+	"github.com/xll-gen/xll-gen/pkg/server"
+)
+
+// ErrClosed is returned by every call made after Close.
+var ErrClosed = errors.New("xllhost: host closed")
+
+// ErrSystem is returned when the guest answers a request with
+// shm.MsgTypeSystemError — what the XLL sees as a failed call (an oversized
+// response, a refused chunk, an unknown message).
+var ErrSystem = errors.New("xllhost: guest answered SYSTEM_ERROR")
+
+// FuncError is a handler error delivered on the wire: a sync or async
+// response's error field, or an rtd-once error update. Msg is the text the
+// cell would show.
+type FuncError struct {
+	Func string
+	Msg  string
+}
+
+func (e *FuncError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Func, e.Msg)
+}
+
+// Message is one guest->host message as the host received it, after chunk
+// reassembly and decompression.
+type Message struct {
+	Type shm.MsgType
+	Data []byte
+}
+
+// Host is an in-process XLL host. The zero value is not usable; construct one
+// with Load, Parse or New. The size fields may be changed before the Host is handed
+// to ServeConn.
+type Host struct {
+	// RequestBytes is the capacity of one request buffer, in both directions:
+	// a host->guest request larger than this is sent as chunks, and it is what
+	// MaxRequestSize reports to the guest's chunking budget. 0 means
+	// chunk.HalfSlotSize, the generated XLL's geometry.
+	RequestBytes int
+	// ResponseBytes is the capacity of the response buffer handed to the
+	// dispatch. 0 means chunk.HalfSlotSize.
+	ResponseBytes int
+	// Caller is the calling cell reported to functions declared caller:true.
+	// nil means Sheet1!A1.
+	Caller *CallerCell
+
+	cfg   *config.Config
+	funcs map[string]funcInfo
+
+	mu       sync.Mutex
+	dispatch func(req []byte, respBuf []byte, msgType shm.MsgType) (int32, shm.MsgType)
+	ready    chan struct{}
+	started  bool
+	done     chan struct{}
+	closed   sync.Once
+	received []Message
+	async    map[string]chan asyncResult
+	topics   map[int32]*Topic
+	grids    map[string]any
+	gridWait map[string][]chan struct{}
+	chunks   map[uint64]*partialTransfer
+
+	nextHandle   atomic.Uint64
+	nextTopic    atomic.Int32
+	nextTransfer atomic.Uint64
+	nextRef      atomic.Uint64
+}
+
+// CallerCell is the position reported as a function's caller.
+type CallerCell struct {
+	Sheet string
+	Row   int32
+	Col   int32
+}
+
+var (
+	_ server.GuestConn     = (*Host)(nil)
+	_ server.InProcessConn = (*Host)(nil)
+)
+
+type funcInfo struct {
+	fn      config.Function
+	msgType shm.MsgType
+}
+
+// Load reads xll.yaml at path and returns a Host for the functions it
+// declares, at the message IDs the xll.lock next to it pins.
+func Load(path string) (*Host, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return newHost(cfg)
+}
+
+// ParseWithLock is Load for xll.yaml content already in memory, with the
+// message IDs pinned by the xll.lock at lockPath, if there is one.
+func ParseWithLock(data []byte, lockPath string) (*Host, error) {
+	cfg, err := config.ParseWithLock(data, lockPath)
+	if err != nil {
+		return nil, err
+	}
+	return newHost(cfg)
+}
+
+// Parse is ParseWithLock without a lock: each function without an explicit
+// id is called at its position. Against a server generated with an xll.lock
+// that has reordered or removed functions, use Load or ParseWithLock, or the
+// calls reach the wrong handlers.
+func Parse(data []byte) (*Host, error) {
+	return ParseWithLock(data, "")
+}
+
+// New returns a Host with no xll.yaml behind it, for a caller that builds its
+// own requests, such as the generated Client: Send and SendAsync work, while
+// Call, Subscribe and the other methods that take a function name know no
+// functions.
+func New() *Host {
+	return allocHost(&config.Config{})
+}
+
+func newHost(cfg *config.Config) (*Host, error) {
+	config.ApplyDefaults(cfg)
+	if err := config.Validate(cfg); err != nil {
+		return nil, err
+	}
+	h := allocHost(cfg)
+	// The dispatch case of a function is MsgUserStart plus its ID, which
+	// ApplyDefaults (and an xll.lock read by config.Load) assigned to ALL
+	// functions, even though rtd-like ones are reached through MsgRtdConnect
+	// instead.
+	for i, fn := range cfg.Functions {
+		h.funcs[fn.Name] = funcInfo{fn: fn, msgType: shm.MsgType(server.MsgUserStart + fn.MsgOffset(i))}
+	}
+	return h, nil
+}
+
+func allocHost(cfg *config.Config) *Host {
+	return &Host{
+		cfg:      cfg,
+		funcs:    make(map[string]funcInfo, len(cfg.Functions)),
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
+		async:    make(map[string]chan asyncResult),
+		topics:   make(map[int32]*Topic),
+		grids:    make(map[string]any),
+		gridWait: make(map[string][]chan struct{}),
+		chunks:   make(map[uint64]*partialTransfer),
+	}
+}
+
+// Signature is a declared function's shape as xll.yaml states it, after
+// defaulting: Mode is "sync", "async", "rtd" or "rtd-once", and the types are
+// xll.yaml type names.
+type Signature struct {
+	Name     string
+	Mode     string
+	ArgNames []string
+	ArgTypes []string
+	Return   string
+	// Memoize and MemoizeTTL are an rtd-once function's result lifecycle
+	// (once when both are unset); the XLL, not the guest, applies them.
+	Memoize    bool
+	MemoizeTTL time.Duration
+	// Placeholder is what an rtd-once cell shows until its result arrives:
+	// protocol.XlErrorGettingData, protocol.XlErrorNA or the configured text.
+	Placeholder any
+}
+
+// Functions returns the names of the declared functions in xll.yaml order.
+func (h *Host) Functions() []string {
+	names := make([]string, len(h.cfg.Functions))
+	for i, fn := range h.cfg.Functions {
+		names[i] = fn.Name
+	}
+	return names
+}
+
+// Signature reports how the function name is declared, for callers that
+// convert loosely-typed input (a YAML test case, a recorded call) into the Go
+// values Call expects.
+func (h *Host) Signature(name string) (Signature, bool) {
+	fi, ok := h.funcs[name]
+	if !ok {
+		return Signature{}, false
+	}
+	sig := Signature{Name: fi.fn.Name, Mode: fi.fn.Mode, Return: fi.fn.Return, Memoize: fi.fn.Memoize}
+	if fi.fn.MemoizeTTL != "" {
+		// Validate has already rejected a malformed or non-positive TTL.
+		sig.MemoizeTTL, _ = time.ParseDuration(fi.fn.MemoizeTTL)
+	}
+	switch p := config.ResolveRtdPlaceholder(fi.fn, h.cfg.Rtd); p.Kind {
+	case config.PlaceholderNA:
+		sig.Placeholder = protocol.XlErrorNA
+	case config.PlaceholderText:
+		sig.Placeholder = p.Text
+	default:
+		sig.Placeholder = protocol.XlErrorGettingData
+	}
+	for _, a := range fi.fn.Args {
+		sig.ArgNames = append(sig.ArgNames, a.Name)
+		sig.ArgTypes = append(sig.ArgTypes, a.Type)
+	}
+	return sig, true
+}
+
+// Handle installs the generated dispatch (server.ShmRunner).
+func (h *Host) Handle(dispatch func(req []byte, respBuf []byte, msgType shm.MsgType) (int32, shm.MsgType)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dispatch = dispatch
+}
+
+// Start marks the host ready: calls made before it block until it runs
+// (server.ShmRunner). Like shm, a Start with no handler installed is an error.
+func (h *Host) Start() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.dispatch == nil {
+		return errors.New("xllhost: Start before Handle")
+	}
+	if !h.started {
+		h.started = true
+		close(h.ready)
+	}
+	return nil
+}
+
+// Wait blocks until Close, which is how the host ends the guest's message
+// loop (server.ShmRunner).
+func (h *Host) Wait() { <-h.done }
+
+// Close ends the session: ServeConn's Wait returns, and every call still
+// waiting on a result fails with ErrClosed.
+func (h *Host) Close() error {
+	h.closed.Do(func() { close(h.done) })
+	return nil
+}
+
+// InProcess marks the Host as a peer inside the server's own process
+// (server.InProcessConn): it is built against the same generated package and
+// never sends the connect handshake, so the server serves it without one.
+func (h *Host) InProcess() bool { return true }
+
+// MaxRequestSize reports the guest->host request-buffer capacity
+// (chunk.MaxRequestSizer), which sizes the guest's chunked sends.
+func (h *Host) MaxRequestSize() int { return h.requestBytes() }
+
+func (h *Host) requestBytes() int {
+	if h.RequestBytes > 0 {
+		return h.RequestBytes
+	}
+	return chunk.HalfSlotSize
+}
+
+func (h *Host) responseBytes() int {
+	if h.ResponseBytes > 0 {
+		return h.ResponseBytes
+	}
+	return chunk.HalfSlotSize
+}
+
+// SendGuestCallWithTimeout is SendGuestCall; delivery in-process is immediate.
+func (h *Host) SendGuestCallWithTimeout(data []byte, msgType shm.MsgType, _ time.Duration) ([]byte, error) {
+	return h.SendGuestCall(data, msgType)
+}
+
+// Received returns every guest->host message delivered so far, in arrival
+// order, with chunked transfers reassembled.
+func (h *Host) Received() []Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Message(nil), h.received...)
+}
+
+// Send delivers one host->guest request through the dispatch and returns the
+// reply, the way the XLL's slot.Send does: a request larger than RequestBytes
+// goes out as chunks (the reply to the final chunk is the dispatch's reply),
+// and a reply that arrives as a chunk frame is pulled to completion with
+// MsgAck. A SYSTEM_ERROR reply is ErrSystem.
+func (h *Host) Send(ctx context.Context, msgType shm.MsgType, req []byte) ([]byte, shm.MsgType, error) {
+	dispatch, err := h.awaitDispatch(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	var resp []byte
+	var respType shm.MsgType
+	if len(req) > h.requestBytes() {
+		resp, respType, err = h.sendChunked(dispatch, msgType, req)
+	} else {
+		resp, respType = h.roundTrip(dispatch, msgType, req)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if respType == shm.MsgTypeSystemError {
+		return nil, respType, ErrSystem
+	}
+	if respType == server.MsgChunk {
+		return h.pullChunks(dispatch, resp)
+	}
+	return resp, respType, nil
+}
+
+func (h *Host) awaitDispatch(ctx context.Context) (func([]byte, []byte, shm.MsgType) (int32, shm.MsgType), error) {
+	select {
+	case <-h.done:
+		return nil, ErrClosed
+	default:
+	}
+	select {
+	case <-h.ready:
+	case <-h.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, fmt.Errorf("xllhost: guest never started (is ServeConn running?): %w", ctx.Err())
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dispatch, nil
+}
+
+// roundTrip runs one slot exchange: the request is copied in (the guest may
+// not retain it, exactly as with a real slot) and the reply copied out.
+func (h *Host) roundTrip(dispatch func([]byte, []byte, shm.MsgType) (int32, shm.MsgType), msgType shm.MsgType, req []byte) ([]byte, shm.MsgType) {
+	respBuf := make([]byte, h.responseBytes())
+	n, respType := dispatch(append([]byte(nil), req...), respBuf, msgType)
+	if n <= 0 {
+		return nil, respType
+	}
+	return respBuf[:n], respType
+}
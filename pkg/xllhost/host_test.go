@@ -0,0 +1,242 @@
+package xllhost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/xll-gen/pkg/chunk"
+	"github.com/xll-gen/xll-gen/pkg/server"
+	"github.com/xll-gen/xll-gen/pkg/xllhost/xllhosttest"
+)
+
+// startGuest serves the shared test guest (pkg/xllhost/xllhosttest) on a Host
+// built from its YAML; configure, if set, adjusts the Host before it starts.
+func startGuest(t *testing.T, configure func(h *Host)) (*Host, *xllhosttest.Guest) {
+	t.Helper()
+	h, err := Parse([]byte(xllhosttest.YAML))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if configure != nil {
+		configure(h)
+	}
+	return h, xllhosttest.Serve(t, h)
+}
+
+func TestCall_Sync(t *testing.T) {
+	h, _ := startGuest(t, nil)
+	ctx := xllhosttest.Ctx(t)
+
+	if v, err := h.Call(ctx, "Add", 2, int64(3)); err != nil || v != int32(5) {
+		t.Errorf("Add = (%v, %v), want int32 5", v, err)
+	}
+	if v, err := h.Call(ctx, "Greet", "xll"); err != nil || v != "hello xll" {
+		t.Errorf("Greet = (%v, %v), want %q", v, err, "hello xll")
+	}
+	var fe *FuncError
+	if _, err := h.Call(ctx, "Fail"); !errors.As(err, &fe) || fe.Msg != "no luck" {
+		t.Errorf("Fail: err = %v, want a FuncError carrying the response error", err)
+	}
+	if _, err := h.Call(ctx, "Add", "2", 3); err == nil {
+		t.Error("a string for an int argument was accepted")
+	}
+	if _, err := h.Call(ctx, "Nope"); err == nil {
+		t.Error("an undeclared function was accepted")
+	}
+}
+
+func TestCall_Async(t *testing.T) {
+	h, _ := startGuest(t, nil)
+	ctx := xllhosttest.Ctx(t)
+
+	if v, err := h.Call(ctx, "Half", 3.0); err != nil || v != 1.5 {
+		t.Errorf("Half = (%v, %v), want 1.5 from the async batch", v, err)
+	}
+	var fe *FuncError
+	if _, err := h.Call(ctx, "Half", -1.0); !errors.As(err, &fe) || fe.Msg != "negative" {
+		t.Errorf("Half(-1): err = %v, want the async error result", err)
+	}
+}
+
+// TestCall_AsyncBatchChunked: with a small request buffer the guest chunks its
+// batch (compressed, when enabled); the host reassembles and inflates it before
+// matching the handle.
+func TestCall_AsyncBatchChunked(t *testing.T) {
+	for name, threshold := range map[string]int64{"Plain": 0, "Compressed": 1} {
+		t.Run(name, func(t *testing.T) {
+			defer chunk.SetCompressThreshold(0)
+			chunk.SetCompressThreshold(threshold)
+			h, _ := startGuest(t, func(h *Host) { h.RequestBytes = 300 })
+
+			v, err := h.Call(xllhosttest.Ctx(t), "Pad", 2000)
+			if s, ok := v.(string); err != nil || !ok || len(s) != 2000 {
+				t.Fatalf("Pad = (%d-byte %T, %v), want the 2000-byte string", len(fmt.Sprint(v)), v, err)
+			}
+			for _, m := range h.Received() {
+				if m.Type != server.MsgBatchAsyncResponse {
+					t.Errorf("received message type %d, want only the reassembled batch", m.Type)
+				}
+			}
+		})
+	}
+}
+
+// TestSend_ChunkedRequest: a request over RequestBytes goes out as chunks and
+// the guest's HandleChunk dispatches it whole.
+func TestSend_ChunkedRequest(t *testing.T) {
+	h, _ := startGuest(t, func(h *Host) { h.RequestBytes = 512 })
+	grid := make([][]float64, 100)
+	for i := range grid {
+		grid[i] = []float64{1, 2}
+	}
+	if v, err := h.Call(xllhosttest.Ctx(t), "Total", grid); err != nil || v != 300.0 {
+		t.Errorf("Total = (%v, %v), want 300", v, err)
+	}
+}
+
+func TestCall_RtdOnce(t *testing.T) {
+	h, _ := startGuest(t, nil)
+	ctx := xllhosttest.Ctx(t)
+
+	if v, err := h.Call(ctx, "Label", 7); err != nil || v != "label 7" {
+		t.Errorf("Label = (%v, %v), want %q", v, err, "label 7")
+	}
+	if v, err := h.Call(ctx, "Staged", 7); err != nil || v != "staged 7" {
+		t.Errorf("Staged = (%v, %v), want %q (the progress value is not the result)", v, err, "staged 7")
+	}
+	var fe *FuncError
+	if _, err := h.Call(ctx, "Label", 0); !errors.As(err, &fe) || fe.Msg != "zero" {
+		t.Errorf("Label(0): err = %v, want the error update", err)
+	}
+
+	v, err := h.Call(ctx, "Square", [][]float64{{1, 2}, {3, 4}})
+	if err != nil {
+		t.Fatalf("Square: %v", err)
+	}
+	got, ok := v.([][]float64)
+	if !ok || len(got) != 2 || got[1][1] != 16 {
+		t.Errorf("Square = %#v, want the one-shot grid [[1 4] [9 16]]", v)
+	}
+}
+
+func TestSubscribe_StreamAndDisconnect(t *testing.T) {
+	h, g := startGuest(t, nil)
+	ctx := xllhosttest.Ctx(t)
+
+	topic, err := h.Subscribe(ctx, "Ticker", "XLL")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if id := <-g.Tickers; id != topic.ID {
+		t.Fatalf("the handler got topic %d, want %d", id, topic.ID)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := g.Mgr.SendUpdate(topic.ID, float64(i)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case u := <-topic.Updates:
+			if u.Value != float64(i) || u.IsError {
+				t.Fatalf("update = %+v, want %v", u, float64(i))
+			}
+		case <-ctx.Done():
+			t.Fatal("no streaming update arrived")
+		}
+	}
+	if err := topic.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case id := <-g.Cancels:
+		if id != topic.ID {
+			t.Errorf("cancelled topic %d, want %d", id, topic.ID)
+		}
+	case <-ctx.Done():
+		t.Fatal("disconnect did not cancel the handler's context")
+	}
+}
+
+// TestClose_EndsServeLoop: Close is what makes the guest's Wait return, and a
+// call after it fails fast instead of hanging.
+func TestClose_EndsServeLoop(t *testing.T) {
+	h, err := Parse([]byte(xllhosttest.YAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	returned := make(chan struct{})
+	go func() {
+		server.RunAndDrain(h, func([]byte, []byte, shm.MsgType) (int32, shm.MsgType) { return 0, 0 }, nil, nil)
+		close(returned)
+	}()
+	h.Close()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunAndDrain did not return after Close")
+	}
+	if _, err := h.Call(context.Background(), "Add", 1, 2); !errors.Is(err, ErrClosed) {
+		t.Errorf("Call after Close: err = %v, want ErrClosed", err)
+	}
+}
+
+func TestSeedRequestAndCheckFrame(t *testing.T) {
+	h, _ := startGuest(t, nil)
+	ctx := xllhosttest.Ctx(t)
+	for _, name := range []string{"Add", "Greet", "Fail", "Half", "Total"} {
+		req, msgType, err := h.SeedRequest(name)
+		if err != nil {
+			t.Fatalf("SeedRequest(%s): %v", name, err)
+		}
+		if fi := h.funcs[name]; msgType != fi.msgType {
+			t.Errorf("%s seed travels as %d, want %d", name, msgType, fi.msgType)
+		}
+		if err := h.CheckFrame(ctx, name, req); err != nil {
+			t.Errorf("CheckFrame(%s, seed): %v", name, err)
+		}
+		// Cut short, the request makes the guest's decoder panic; the guarded
+		// dispatch answers SYSTEM_ERROR, which is a well-formed reply.
+		if err := h.CheckFrame(ctx, name, req[:3]); err != nil {
+			t.Errorf("CheckFrame(%s, truncated): %v", name, err)
+		}
+	}
+	if _, _, err := h.SeedRequest("Ticker"); err == nil {
+		t.Error("SeedRequest built a request for an rtd function")
+	}
+	if err := h.CheckFrame(ctx, "Nope", nil); err == nil {
+		t.Error("CheckFrame accepted an undeclared function")
+	}
+}
+
+// TestCheckFrame_AsyncAckWithoutResult: an ACK alone does not pass for an
+// async function. A frame whose handle cannot be read must be refused with
+// SYSTEM_ERROR, and a readable one must get its result queued.
+func TestCheckFrame_AsyncAckWithoutResult(t *testing.T) {
+	h, err := Parse([]byte(xllhosttest.YAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.RunAndDrain(h, func(_ []byte, respBuf []byte, _ shm.MsgType) (int32, shm.MsgType) {
+		b := flatbuffers.NewBuilder(64)
+		return server.SendAckOrChunk(server.BuildAckResponse(b, 0, true), respBuf, server.MsgAck, nil, b)
+	}, nil, nil)
+	t.Cleanup(func() { h.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	req, _, err := h.SeedRequest("Half")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.CheckFrame(ctx, "Half", req[:3]); err == nil || !strings.Contains(err.Error(), "instead of SYSTEM_ERROR") {
+		t.Errorf("CheckFrame(truncated) = %v, want the ACK of a malformed frame reported", err)
+	}
+	if err := h.CheckFrame(ctx, "Half", req); err == nil || !strings.Contains(err.Error(), "no result queued") {
+		t.Errorf("CheckFrame(seed) = %v, want the missing result reported", err)
+	}
+}
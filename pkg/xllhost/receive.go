@@ -0,0 +1,96 @@
+package xllhost
+
+import (
+	"fmt"
+
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/server"
+)
+
+// SendGuestCall receives one guest->host message: what the XLL's worker
+// thread handles in production. Chunk frames are reassembled first; async
+// batches are matched to their waiting Call, RTD updates go to their Topic,
+// and one-shot grids are stored under their key. Every completed message is
+// also recorded for Received.
+//
+// An error is what the XLL would answer SYSTEM_ERROR to (a malformed chunk,
+// an unknown message type), so the guest's own failure paths run as well.
+func (h *Host) SendGuestCall(data []byte, msgType shm.MsgType) ([]byte, error) {
+	select {
+	case <-h.done:
+		return nil, ErrClosed
+	default:
+	}
+	if msgType == server.MsgChunk {
+		return nil, h.receiveChunk(data)
+	}
+	// The guest reuses its builder once the call returns, like a slot.
+	return nil, h.receive(append([]byte(nil), data...), msgType)
+}
+
+func (h *Host) receive(data []byte, msgType shm.MsgType) error {
+	h.mu.Lock()
+	h.received = append(h.received, Message{Type: msgType, Data: data})
+	h.mu.Unlock()
+
+	switch msgType {
+	case server.MsgBatchAsyncResponse:
+		h.receiveAsyncBatch(data)
+	case server.MsgRtdUpdate, server.MsgRtdProgress:
+		u := protocol.GetRootAsRtdUpdate(data, 0)
+		h.deliverUpdate(u.TopicId(), Update{
+			Value:    AnyValue(u.Val(nil)),
+			IsError:  u.IsError(),
+			Progress: msgType == server.MsgRtdProgress,
+		})
+	case server.MsgRtdOnceGrid:
+		g := protocol.GetRootAsRtdOnceGridResult(data, 0)
+		h.storeGrid(string(g.Key()), AnyValue(g.Value(nil)))
+	default:
+		return fmt.Errorf("xllhost: unexpected guest->host message type %d", msgType)
+	}
+	return nil
+}
+
+type asyncResult struct {
+	value any
+	err   string
+}
+
+func (h *Host) receiveAsyncBatch(data []byte) {
+	batch := protocol.GetRootAsBatchAsyncResponse(data, 0)
+	var r protocol.AsyncResult
+	for i := 0; i < batch.ResultsLength(); i++ {
+		if !batch.Results(&r, i) {
+			continue
+		}
+		res := asyncResult{value: AnyValue(r.Result(nil)), err: string(r.Error())}
+		h.mu.Lock()
+		ch, ok := h.async[string(r.HandleBytes())]
+		delete(h.async, string(r.HandleBytes()))
+		h.mu.Unlock()
+		if ok {
+			ch <- res
+		}
+	}
+}
+
+func (h *Host) storeGrid(key string, v any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.grids[key] = v
+	for _, ch := range h.gridWait[key] {
+		close(ch)
+	}
+	delete(h.gridWait, key)
+}
+
+// OnceGrid returns the one-shot grid an rtd-once grid function delivered under
+// key (its topic strings joined with "\x1f"), as [][]any or [][]float64.
+func (h *Host) OnceGrid(key string) (any, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	v, ok := h.grids[key]
+	return v, ok
+}
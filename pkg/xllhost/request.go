@@ -0,0 +1,189 @@
+package xllhost
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/internal/fbany"
+)
+
+// buildRequest serializes a <Name>Request exactly as schema.fbs.tmpl lays it
+// out: the arguments in declaration order at field ids 0..n-1, then
+// async_handle (async functions only), then caller (caller:true only). Field
+// ids, not names, are what the generated ipc accessors read, so building the
+// table by slot needs no generated code on the host side.
+func (h *Host) buildRequest(fi funcInfo, args []any, handle []byte) ([]byte, error) {
+	fn := fi.fn
+	if len(args) != len(fn.Args) {
+		return nil, fmt.Errorf("xllhost: %s takes %d arguments, got %d", fn.Name, len(fn.Args), len(args))
+	}
+	b := flatbuffers.NewBuilder(256)
+
+	// Offsets (strings, tables, vectors) must exist before the table starts.
+	offs := make([]flatbuffers.UOffsetT, len(args))
+	scalars := make([]any, len(args))
+	for i, a := range fn.Args {
+		var err error
+		switch a.Type {
+		case "int":
+			scalars[i], err = toInt32(args[i])
+		case "float":
+			scalars[i], err = toFloat64(args[i])
+		case "date":
+			scalars[i], err = toSerial(args[i])
+		case "bool":
+			v, ok := args[i].(bool)
+			if !ok {
+				err = fmt.Errorf("cannot use %T as bool", args[i])
+			}
+			scalars[i] = v
+		case "string":
+			s, ok := args[i].(string)
+			if !ok {
+				err = fmt.Errorf("cannot use %T as string", args[i])
+			}
+			offs[i] = b.CreateString(s)
+		default:
+			offs[i], err = buildComposite(b, a.Type, args[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xllhost: %s argument %s (%s): %w", fn.Name, a.Name, a.Type, err)
+		}
+	}
+	var handleOff, callerOff flatbuffers.UOffsetT
+	if fn.Async {
+		handleOff = b.CreateByteVector(handle)
+	}
+	if fn.Caller {
+		callerOff = h.CallerRange().Pack(b)
+	}
+
+	fields := len(args)
+	if fn.Async {
+		fields++
+	}
+	if fn.Caller {
+		fields++
+	}
+	b.StartObject(fields)
+	for i, a := range fn.Args {
+		switch a.Type {
+		case "int":
+			b.PrependInt32Slot(i, scalars[i].(int32), 0)
+		case "float", "date":
+			b.PrependFloat64Slot(i, scalars[i].(float64), 0)
+		case "bool":
+			b.PrependBoolSlot(i, scalars[i].(bool), false)
+		default:
+			b.PrependUOffsetTSlot(i, offs[i], 0)
+		}
+	}
+	slot := len(args)
+	if fn.Async {
+		b.PrependUOffsetTSlot(slot, handleOff, 0)
+		slot++
+	}
+	if fn.Caller {
+		b.PrependUOffsetTSlot(slot, callerOff, 0)
+	}
+	b.Finish(b.EndObject())
+	return b.FinishedBytes(), nil
+}
+
+// buildComposite serializes a grid / numgrid / range / any argument table.
+func buildComposite(b *flatbuffers.Builder, typ string, v any) (flatbuffers.UOffsetT, error) {
+	switch typ {
+	case "grid":
+		g, ok := v.([][]any)
+		if !ok {
+			return 0, fmt.Errorf("cannot use %T as grid", v)
+		}
+		return fbany.BuildGrid(b, g)
+	case "numgrid":
+		g, ok := v.([][]float64)
+		if !ok {
+			return 0, fmt.Errorf("cannot use %T as numgrid", v)
+		}
+		return fbany.BuildNumGrid(b, g)
+	case "range":
+		r, ok := v.(*protocol.RangeT)
+		if !ok || r == nil {
+			return 0, fmt.Errorf("cannot use %T as range", v)
+		}
+		return r.Pack(b), nil
+	case "any":
+		return buildAny(b, v)
+	}
+	return 0, fmt.Errorf("unsupported argument type %q", typ)
+}
+
+// CallerRange is the range reported as the caller of a caller:true function:
+// the Caller cell, or Sheet1!A1.
+func (h *Host) CallerRange() *protocol.RangeT {
+	c := h.Caller
+	if c == nil {
+		c = &CallerCell{Sheet: "Sheet1"}
+	}
+	return &protocol.RangeT{
+		SheetName: c.Sheet,
+		Refs:      []*protocol.RectT{{RowFirst: c.Row, RowLast: c.Row, ColFirst: c.Col, ColLast: c.Col}},
+	}
+}
+
+// NewAsyncHandle returns a fresh async handle. The XLL's handle is an opaque
+// pointer-sized value; the guest only echoes the bytes back.
+func (h *Host) NewAsyncHandle() []byte {
+	handle := make([]byte, 8)
+	binary.LittleEndian.PutUint64(handle, h.nextHandle.Add(1))
+	return handle
+}
+
+// decodeResponse reads a <Name>Response: result at field id 0 (typed by the
+// function's return), error string at field id 1.
+func decodeResponse(fi funcInfo, data []byte) (any, error) {
+	if len(data) < flatbuffers.SizeUOffsetT {
+		return nil, fmt.Errorf("xllhost: %s: empty response", fi.fn.Name)
+	}
+	var t flatbuffers.Table
+	t.Bytes = data
+	t.Pos = flatbuffers.GetUOffsetT(data)
+
+	if o := flatbuffers.UOffsetT(t.Offset(6)); o != 0 {
+		return nil, &FuncError{Func: fi.fn.Name, Msg: string(t.ByteVector(o + t.Pos))}
+	}
+	o := flatbuffers.UOffsetT(t.Offset(4))
+	switch fi.fn.Return {
+	case "int":
+		return t.GetInt32Slot(4, 0), nil
+	case "float":
+		return t.GetFloat64Slot(4, 0), nil
+	case "bool":
+		return t.GetBoolSlot(4, false), nil
+	case "string":
+		if o == 0 {
+			return "", nil
+		}
+		return string(t.ByteVector(o + t.Pos)), nil
+	}
+	if o == 0 {
+		return nil, nil
+	}
+	pos := t.Indirect(o + t.Pos)
+	switch fi.fn.Return {
+	case "grid":
+		var g protocol.Grid
+		g.Init(data, pos)
+		return GridValue(&g), nil
+	case "numgrid":
+		var g protocol.NumGrid
+		g.Init(data, pos)
+		return NumGridValue(&g), nil
+	case "any":
+		var a protocol.Any
+		a.Init(data, pos)
+		return AnyValue(&a), nil
+	}
+	return nil, fmt.Errorf("xllhost: %s: unsupported return type %q", fi.fn.Name, fi.fn.Return)
+}
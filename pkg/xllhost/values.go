@@ -0,0 +1,241 @@
+package xllhost
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/internal/fbany"
+	"github.com/xll-gen/xll-gen/pkg/xldate"
+)
+
+// Values cross the host boundary as plain Go values, in both directions:
+//
+//	xll.yaml type   argument accepts                     result is
+//	int             any Go integer within int32          int32
+//	float           any Go integer or float              float64
+//	bool            bool                                 bool
+//	string          string                               string
+//	date            time.Time or a float64 serial        -
+//	grid            [][]any                              [][]any
+//	numgrid         [][]float64                          [][]float64
+//	range           *protocol.RangeT                     -
+//	any             any of the above, protocol.XlError   as decoded from protocol.Any
+//
+// An `any` result decodes Int to int32, Num to float64, Err to
+// protocol.XlError, Date to time.Time, Nil to nil and Range to
+// *protocol.RangeT.
+
+// AnyValue converts a wire protocol.Any to its Go value (nil for an absent or
+// empty Any).
+func AnyValue(a *protocol.Any) any {
+	if a == nil {
+		return nil
+	}
+	t := a.UnPack()
+	if t == nil || t.Val == nil {
+		return nil
+	}
+	return goValue(t.Val.Value)
+}
+
+// goValue maps an unpacked union member (AnyValue or ScalarValue; both use the
+// same object types) to its Go value.
+func goValue(v any) any {
+	switch x := v.(type) {
+	case *protocol.BoolT:
+		return x.Val
+	case *protocol.NumT:
+		return x.Val
+	case *protocol.IntT:
+		return x.Val
+	case *protocol.StrT:
+		return x.Val
+	case *protocol.ErrT:
+		return x.Val
+	case *protocol.DateT:
+		return xldate.FromSerial(x.Serial)
+	case *protocol.GridT:
+		return gridValue(x)
+	case *protocol.NumGridT:
+		return numGridValue(x)
+	case *protocol.RangeT:
+		return x
+	case *protocol.RefCacheT:
+		return x
+	case *protocol.AsyncHandleT:
+		return x.Val
+	}
+	return nil
+}
+
+// GridValue converts a wire protocol.Grid to [][]any (nil for an absent one).
+func GridValue(g *protocol.Grid) [][]any {
+	if g == nil {
+		return nil
+	}
+	return gridValue(g.UnPack())
+}
+
+// NumGridValue converts a wire protocol.NumGrid to [][]float64 (nil for an
+// absent one).
+func NumGridValue(g *protocol.NumGrid) [][]float64 {
+	if g == nil {
+		return nil
+	}
+	return numGridValue(g.UnPack())
+}
+
+func gridValue(g *protocol.GridT) [][]any {
+	rows, cols := int(g.Rows), int(g.Cols)
+	out := make([][]any, rows)
+	for r := range out {
+		out[r] = make([]any, cols)
+		for c := range out[r] {
+			if i := r*cols + c; i < len(g.Data) && g.Data[i] != nil && g.Data[i].Val != nil {
+				out[r][c] = goValue(g.Data[i].Val.Value)
+			}
+		}
+	}
+	return out
+}
+
+func numGridValue(g *protocol.NumGridT) [][]float64 {
+	rows, cols := int(g.Rows), int(g.Cols)
+	out := make([][]float64, rows)
+	for r := range out {
+		out[r] = make([]float64, cols)
+		if end := (r + 1) * cols; end <= len(g.Data) {
+			copy(out[r], g.Data[r*cols:end])
+		}
+	}
+	return out
+}
+
+// buildAny serializes v as a protocol.Any the way an Excel cell of that value
+// reaches an `any` argument.
+func buildAny(b *flatbuffers.Builder, v any) (flatbuffers.UOffsetT, error) {
+	switch x := v.(type) {
+	case protocol.XlError:
+		return fbany.Build(b, protocol.AnyValueErr, int16(x)), nil
+	case [][]any:
+		off, err := fbany.BuildGrid(b, x)
+		if err != nil {
+			return 0, err
+		}
+		return wrapAny(b, protocol.AnyValueGrid, off), nil
+	case [][]float64:
+		off, err := fbany.BuildNumGrid(b, x)
+		if err != nil {
+			return 0, err
+		}
+		return wrapAny(b, protocol.AnyValueNumGrid, off), nil
+	case *protocol.RangeT:
+		return wrapAny(b, protocol.AnyValueRange, x.Pack(b)), nil
+	}
+	return fbany.BuildGo(b, v), nil
+}
+
+func wrapAny(b *flatbuffers.Builder, tag protocol.AnyValue, off flatbuffers.UOffsetT) flatbuffers.UOffsetT {
+	protocol.AnyStart(b)
+	protocol.AnyAddValType(b, tag)
+	protocol.AnyAddVal(b, off)
+	return protocol.AnyEnd(b)
+}
+
+func toInt32(v any) (int32, error) {
+	var n int64
+	switch x := v.(type) {
+	case int:
+		n = int64(x)
+	case int8:
+		n = int64(x)
+	case int16:
+		n = int64(x)
+	case int32:
+		n = int64(x)
+	case int64:
+		n = x
+	case uint8:
+		n = int64(x)
+	case uint16:
+		n = int64(x)
+	case uint32:
+		n = int64(x)
+	default:
+		return 0, fmt.Errorf("cannot use %T as int", v)
+	}
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("%d overflows int", n)
+	}
+	return int32(n), nil
+}
+
+func toFloat64(v any) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case float32:
+		return float64(x), nil
+	case int:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	}
+	n, err := toInt32(v)
+	if err != nil {
+		return 0, fmt.Errorf("cannot use %T as float", v)
+	}
+	return float64(n), nil
+}
+
+func toSerial(v any) (float64, error) {
+	if t, ok := v.(time.Time); ok {
+		return xldate.ToSerial(t), nil
+	}
+	f, err := toFloat64(v)
+	if err != nil {
+		return 0, fmt.Errorf("cannot use %T as date", v)
+	}
+	return f, nil
+}
+
+// topicString renders a scalar argument the way the XLL writes it into an RTD
+// topic string; the generated connect case parses it back with
+// server.ParseInt / ParseFloat / ParseBool.
+func topicString(typ string, v any) (string, error) {
+	switch typ {
+	case "int":
+		n, err := toInt32(v)
+		return strconv.Itoa(int(n)), err
+	case "float":
+		f, err := toFloat64(v)
+		return strconv.FormatFloat(f, 'g', -1, 64), err
+	case "date":
+		f, err := toSerial(v)
+		return strconv.FormatFloat(f, 'g', -1, 64), err
+	case "bool":
+		bv, ok := v.(bool)
+		if !ok {
+			return "", fmt.Errorf("cannot use %T as bool", v)
+		}
+		if bv {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("cannot use %T as string", v)
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("type %q has no topic-string form", typ)
+}
+
+func isComposite(typ string) bool {
+	return typ == "grid" || typ == "numgrid" || typ == "range" || typ == "any"
+}
@@ -0,0 +1,388 @@
+// Package xllhosttest is the test guest shared by the tests of pkg/xllhost and
+// the packages built on it (xllsim, xlltest, xllbench). It serves YAML with a
+// hand-written dispatch over the same pkg/server and pkg/rtd pieces the
+// generated server uses, each function decoding its request by field slot as
+// the generated ipc accessors do, so there is one copy of it to keep in step
+// with the protocol.
+//
+//	h, err := xllhost.Parse([]byte(xllhosttest.YAML))
+//	...
+//	g := xllhosttest.Serve(t, h)
+//	v, err := h.Call(ctx, "Add", 1, 2) // v == int32(3)
+//
+// It takes the host as a Conn rather than an *xllhost.Host so that pkg/xllhost's
+// own tests can use it without an import cycle.
+package xllhosttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/shm/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/pool"
+	"github.com/xll-gen/xll-gen/pkg/rtd"
+	"github.com/xll-gen/xll-gen/pkg/server"
+)
+
+// YAML declares the functions Serve answers. Their order is their message ID
+// (MsgUserStart + index), which the fn* constants below mirror.
+const YAML = `
+project:
+  name: hosttest
+  version: "0.1.0"
+rtd:
+  enabled: true
+  prog_id: hosttest.Rtd
+  clsid: "{11111111-2222-3333-4444-555555555555}"
+functions:
+  - name: Add
+    args: [{name: a, type: int}, {name: b, type: int}]
+    return: int
+  - name: Div
+    args: [{name: a, type: float}, {name: b, type: float}]
+    return: float
+  - name: Greet
+    args: [{name: who, type: string}]
+    return: string
+  - name: Fail
+    return: string
+  - name: Half
+    mode: async
+    args: [{name: x, type: float}]
+    return: float
+  - name: Pad
+    mode: async
+    args: [{name: n, type: int}]
+    return: string
+  - name: Slow
+    mode: async
+    args: [{name: x, type: float}]
+    return: float
+  - name: Total
+    args: [{name: g, type: numgrid}]
+    return: float
+  - name: Where
+    caller: true
+    return: string
+  - name: Label
+    mode: rtd-once
+    args: [{name: n, type: int}]
+    return: string
+  - name: MemoLabel
+    mode: rtd-once
+    memoize: true
+    args: [{name: n, type: int}]
+    return: string
+  - name: TTLLabel
+    mode: rtd-once
+    memoize_ttl: 1m
+    args: [{name: n, type: int}]
+    return: string
+  - name: Staged
+    mode: rtd-once
+    args: [{name: n, type: int}]
+    return: string
+  - name: Square
+    mode: rtd-once
+    args: [{name: g, type: numgrid}]
+    return: numgrid
+  - name: Ticker
+    mode: rtd
+    args: [{name: sym, type: string}]
+    return: float
+`
+
+// Indexes of the sync and async functions in YAML; the rtd ones are routed by
+// name through RtdConnect instead.
+const (
+	fnAdd = iota
+	fnDiv
+	fnGreet
+	fnFail
+	fnHalf
+	fnPad
+	fnSlow
+	fnTotal
+	fnWhere
+)
+
+// BusyMessage is what Slow answers when its one-worker pool is full: the text
+// the generated async case queues for a rejected job.
+const BusyMessage = "Server Busy"
+
+// Conn is the host end Serve runs on; *xllhost.Host satisfies it.
+type Conn interface {
+	server.GuestConn
+	Close() error
+}
+
+// Guest is a running test guest. What each function does:
+//
+//   - Add(a, b) = a + b; Div(a, b) = a / b, erroring "division by zero".
+//   - Greet(who) = "hello " + who; Fail() always errors "no luck".
+//   - Half(x) = x / 2 through the async batch, erroring "negative" for x < 0.
+//   - Pad(n) = n "x"s through the async batch, to make it chunk.
+//   - Slow(x) = x after 20ms on a one-worker JobPool, BusyMessage when full.
+//   - Total(g) = the sum of the numgrid; Where() = "<sheet> R<row>C<col>" of
+//     the caller.
+//   - Label, MemoLabel and TTLLabel(n) = "label n" through rtd.RunOnce,
+//     erroring "zero" for n == 0; each run is counted (Runs).
+//   - Staged(n) sends the progress value "working" first, then "staged n".
+//   - Square(g) = the one-shot numgrid of g's first four cells squared.
+//   - Ticker(sym) only announces its topic on Tickers — the test pushes the
+//     values through Mgr — and reports on Cancels when its context ends.
+type Guest struct {
+	Mgr *rtd.RtdManager
+	// Tickers receives each Ticker topic as it connects, Cancels each one
+	// whose handler context is cancelled, and Disconnects every topic the host
+	// disconnects.
+	Tickers     chan int32
+	Cancels     chan int32
+	Disconnects chan int32
+
+	cm   *server.ChunkManager
+	cb   *server.CommandBatcher
+	done chan struct{}
+
+	mu       sync.Mutex
+	runs     map[string]int
+	onEnded  func(cb *server.CommandBatcher)
+	canceled int
+}
+
+// Serve starts the guest on conn and registers its shutdown, including
+// conn.Close, with t.Cleanup.
+func Serve(t testing.TB, conn Conn) *Guest {
+	t.Helper()
+	g := &Guest{
+		Mgr:         rtd.NewRtdManager(),
+		Tickers:     make(chan int32, 8),
+		Cancels:     make(chan int32, 8),
+		Disconnects: make(chan int32, 8),
+		cm:          server.NewChunkManager(),
+		cb:          server.NewCommandBatcher(),
+		done:        make(chan struct{}),
+		runs:        map[string]int{},
+	}
+	batcher := server.NewAsyncBatcher()
+	sys := server.NewSystemHandler(g.cm, batcher, g.cb, server.NewRefCache(), g.Mgr)
+	g.Mgr.SetClient(conn)
+	batcher.StartWorker(func(batch []server.PendingAsyncResult) { server.FlushAsyncBatch(batch, conn) })
+	jobs := server.NewJobPool(1)
+
+	var dispatch server.Dispatcher
+	dispatch = func(data, respBuf []byte, mType shm.MsgType) (int32, shm.MsgType) {
+		b := pool.GetBuilder(respBuf)
+		defer pool.PutBuilder(b)
+		req := slotTable(data)
+		switch uint32(mType) {
+		case server.MsgChunk:
+			return sys.HandleChunk(data, respBuf, b, dispatch)
+		case server.MsgAck:
+			return sys.HandleAck(data, respBuf, b)
+		case server.MsgSetRefCache:
+			return sys.HandleSetRefCache(data, respBuf, b)
+		case server.MsgCalculationEnded:
+			return sys.HandleCalculationEnded(respBuf, b, func(context.Context) error {
+				g.mu.Lock()
+				defer g.mu.Unlock()
+				if g.onEnded != nil {
+					g.onEnded(g.cb)
+				}
+				return nil
+			})
+		case server.MsgCalculationCanceled:
+			return sys.HandleCalculationCanceled(func(context.Context) error {
+				g.mu.Lock()
+				defer g.mu.Unlock()
+				g.canceled++
+				return nil
+			})
+		case server.MsgRtdConnect:
+			return sys.HandleRtdConnect(data, respBuf, b, g.onConnect(sys))
+		case server.MsgRtdDisconnect:
+			return sys.HandleRtdDisconnect(data, respBuf, b, func(_ context.Context, id int32) error {
+				g.report(g.Disconnects, id)
+				return nil
+			})
+		case server.MsgUserStart + fnAdd:
+			return respond(b, respBuf, mType, func() { b.PrependInt32Slot(0, req.GetInt32Slot(4, 0)+req.GetInt32Slot(6, 0), 0) })
+		case server.MsgUserStart + fnDiv:
+			if req.GetFloat64Slot(6, 0) == 0 {
+				e := b.CreateString("division by zero")
+				return respond(b, respBuf, mType, func() { b.PrependUOffsetTSlot(1, e, 0) })
+			}
+			return respond(b, respBuf, mType, func() { b.PrependFloat64Slot(0, req.GetFloat64Slot(4, 0)/req.GetFloat64Slot(6, 0), 0) })
+		case server.MsgUserStart + fnGreet:
+			s := b.CreateString("hello " + string(req.ByteVector(flatbuffers.UOffsetT(req.Offset(4))+req.Pos)))
+			return respond(b, respBuf, mType, func() { b.PrependUOffsetTSlot(0, s, 0) })
+		case server.MsgUserStart + fnFail:
+			e := b.CreateString("no luck")
+			return respond(b, respBuf, mType, func() { b.PrependUOffsetTSlot(1, e, 0) })
+		case server.MsgUserStart + fnHalf:
+			x := req.GetFloat64Slot(4, 0)
+			handle := asyncHandle(req)
+			go func() {
+				if x < 0 {
+					batcher.QueueResult(handle, nil, protocol.AnyValue(0), "negative")
+					return
+				}
+				batcher.QueueResult(handle, x/2, protocol.AnyValueNum, "")
+			}()
+			return server.SendAckOrChunk(server.BuildAckResponse(b, 0, true), respBuf, server.MsgAck, g.cm, b)
+		case server.MsgUserStart + fnPad:
+			n := int(req.GetInt32Slot(4, 0))
+			handle := asyncHandle(req)
+			go batcher.QueueResult(handle, strings.Repeat("x", n), protocol.AnyValueStr, "")
+			return server.SendAckOrChunk(server.BuildAckResponse(b, 0, true), respBuf, server.MsgAck, g.cm, b)
+		case server.MsgUserStart + fnSlow:
+			x := req.GetFloat64Slot(4, 0)
+			handle := asyncHandle(req)
+			if !jobs.Submit(func() {
+				time.Sleep(20 * time.Millisecond)
+				batcher.QueueResult(handle, x, protocol.AnyValueNum, "")
+			}) {
+				batcher.QueueResult(handle, nil, protocol.AnyValue(0), BusyMessage)
+			}
+			return server.SendAckOrChunk(server.BuildAckResponse(b, 0, true), respBuf, server.MsgAck, g.cm, b)
+		case server.MsgUserStart + fnTotal:
+			var ng protocol.NumGrid
+			ng.Init(data, req.Indirect(flatbuffers.UOffsetT(req.Offset(4))+req.Pos))
+			var sum float64
+			for i := 0; i < ng.DataLength(); i++ {
+				sum += ng.Data(i)
+			}
+			return respond(b, respBuf, mType, func() { b.PrependFloat64Slot(0, sum, 0) })
+		case server.MsgUserStart + fnWhere: // the caller is field 0
+			var caller protocol.Range
+			caller.Init(data, req.Indirect(flatbuffers.UOffsetT(req.Offset(4))+req.Pos))
+			var rect protocol.Rect
+			caller.Refs(&rect, 0)
+			s := b.CreateString(fmt.Sprintf("%s R%dC%d", caller.SheetName(), rect.RowFirst(), rect.ColFirst()))
+			return respond(b, respBuf, mType, func() { b.PrependUOffsetTSlot(0, s, 0) })
+		}
+		return 0, 0
+	}
+	go server.RunAndDrain(conn, server.Guard(dispatch), jobs, nil)
+	t.Cleanup(func() {
+		close(g.done)
+		conn.Close()
+		g.Mgr.Stop(time.Second)
+		batcher.Stop(time.Second)
+	})
+	return g
+}
+
+func (g *Guest) onConnect(sys *server.SystemHandler) func(context.Context, int32, []string, bool) error {
+	return func(ctx context.Context, topicID int32, args []string, _ bool) error {
+		switch args[0] {
+		case "Label", "MemoLabel", "TTLLabel", "Staged":
+			g.mu.Lock()
+			g.runs[args[0]+"("+args[1]+")"]++
+			g.mu.Unlock()
+			result := "label " + args[1]
+			if args[0] == "Staged" {
+				if err := g.Mgr.SendProgress(topicID, "working"); err != nil {
+					return err
+				}
+				result = "staged " + args[1]
+			}
+			return rtd.RunOnce(ctx, g.Mgr, topicID, func(context.Context) (any, error) {
+				if args[1] == "0" {
+					return nil, errors.New("zero")
+				}
+				return result, nil
+			})
+		case "Square":
+			ng, err := server.ResolveNumGridArg(sys.RefCache, args[1])
+			if err != nil {
+				return g.Mgr.SendErrorUpdate(topicID, err.Error())
+			}
+			onceKey := strings.Join(args, "\x1f")
+			return rtd.RunOnceGrid(ctx, g.Mgr, topicID, onceKey, func(context.Context) ([]byte, error) {
+				out := [][]float64{{0, 0}, {0, 0}}
+				for i := 0; i < 4; i++ {
+					out[i/2][i%2] = ng.Data(i) * ng.Data(i)
+				}
+				return server.BuildRtdOnceGridResult(onceKey, out)
+			})
+		case "Ticker":
+			g.report(g.Tickers, topicID)
+			go func() {
+				<-ctx.Done()
+				g.report(g.Cancels, topicID)
+			}()
+		}
+		return nil
+	}
+}
+
+// report delivers id on ch unless the guest has been shut down.
+func (g *Guest) report(ch chan int32, id int32) {
+	select {
+	case ch <- id:
+	case <-g.done:
+	}
+}
+
+// Runs reports how many times the rtd-once handler ran for key, e.g.
+// "Label(7)".
+func (g *Guest) Runs(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.runs[key]
+}
+
+// Canceled reports how many CalculationCanceled events the guest handled.
+func (g *Guest) Canceled() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.canceled
+}
+
+// SetOnEnded sets what the CalculationEnded handler does with the command
+// batcher; nil makes it do nothing.
+func (g *Guest) SetOnEnded(f func(cb *server.CommandBatcher)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onEnded = f
+}
+
+// ChunkStats reports the guest's chunk reassembly counters.
+func (g *Guest) ChunkStats() server.ChunkStats { return g.cm.Stats() }
+
+func slotTable(data []byte) flatbuffers.Table {
+	if len(data) < flatbuffers.SizeUOffsetT {
+		return flatbuffers.Table{}
+	}
+	return flatbuffers.Table{Bytes: data, Pos: flatbuffers.GetUOffsetT(data)}
+}
+
+// asyncHandle copies the async handle an async function's request carries
+// after its one argument.
+func asyncHandle(req flatbuffers.Table) []byte {
+	return append([]byte(nil), req.ByteVector(flatbuffers.UOffsetT(req.Offset(6))+req.Pos)...)
+}
+
+// respond finishes a two-field <Name>Response whose fields fill() prepends.
+func respond(b *flatbuffers.Builder, respBuf []byte, mType shm.MsgType, fill func()) (int32, shm.MsgType) {
+	b.StartObject(2)
+	fill()
+	b.Finish(b.EndObject())
+	return server.SendAckOrChunk(b.FinishedBytes(), respBuf, mType, nil, b)
+}
+
+// Ctx returns a context that times out after five seconds, cancelled when the
+// test ends.
+func Ctx(t testing.TB) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
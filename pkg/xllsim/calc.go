@@ -0,0 +1,448 @@
+package xllsim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/xldate"
+	"github.com/xll-gen/xll-gen/pkg/xllhost"
+)
+
+// eventTimeout is the budget of one calc-event round-trip, the XLL's 2000 ms.
+const eventTimeout = 2 * time.Second
+
+// Calculate takes the RTD updates pushed so far and runs calculation cycles
+// until no cell is dirty.
+//
+// Functions are called one cell at a time, and an async function's result is
+// waited for before the next cell, as Excel does not finish a calculation
+// while an async call is outstanding. When ctx is cancelled mid-cycle (the
+// user pressing Esc), the cells not yet calculated stay dirty, the guest gets
+// CalculationCanceled and then CalculationEnded — the order real Excel fires
+// them in — the calc-end writes are applied, and ctx's error is returned.
+func (w *Workbook) Calculate(ctx context.Context) error {
+	w.absorb()
+	for cycle := 0; len(w.dirty) > 0; cycle++ {
+		if cycle == w.maxCycles() {
+			return fmt.Errorf("xllsim: still dirty after %d calculation cycles; does a calc-end handler write on every cycle?", cycle)
+		}
+		if err := w.cycle(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CalculateFull dirties every formula and calculates (Ctrl+Alt+F9).
+func (w *Workbook) CalculateFull(ctx context.Context) error {
+	for a, c := range w.cells {
+		if c.formula != nil {
+			w.dirty[a] = true
+		}
+	}
+	return w.Calculate(ctx)
+}
+
+func (w *Workbook) maxCycles() int {
+	if w.MaxCycles > 0 {
+		return w.MaxCycles
+	}
+	return defaultMaxCycles
+}
+
+func (w *Workbook) cycle(ctx context.Context) error {
+	order, err := w.order()
+	if err != nil {
+		return err
+	}
+	w.dirty = make(map[Addr]bool)
+	canceled := false
+	for i, a := range order {
+		var v any
+		if ctx.Err() == nil {
+			v, err = w.eval(ctx, a, w.cells[a])
+		}
+		if ctx.Err() != nil {
+			for _, rest := range order[i:] {
+				w.dirty[rest] = true
+			}
+			canceled = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+		w.cells[a].value = v
+	}
+	if err := w.releaseTopics(); err != nil {
+		return err
+	}
+	if w.compositeConnect {
+		w.compositeConnect = false
+		w.connectGrace(ctx)
+	}
+	return w.endCalc(ctx, canceled)
+}
+
+// order returns the formula cells to calculate — the dirty ones and every
+// formula reading a dirty cell, transitively — each after the formulas it
+// reads.
+func (w *Workbook) order() ([]Addr, error) {
+	changed := make(map[Addr]bool, len(w.dirty))
+	for a := range w.dirty {
+		changed[a] = true
+	}
+	for grew := true; grew; {
+		grew = false
+		for a, c := range w.cells {
+			if c.formula != nil && !changed[a] && w.reads(c, changed) {
+				changed[a] = true
+				grew = true
+			}
+		}
+	}
+	calc := make(map[Addr]bool)
+	for a := range changed {
+		if c, ok := w.cells[a]; ok && c.formula != nil {
+			calc[a] = true
+		}
+	}
+
+	const visiting, done = 1, 2
+	state := make(map[Addr]int, len(calc))
+	var out []Addr
+	var visit func(a Addr) error
+	visit = func(a Addr) error {
+		switch state[a] {
+		case visiting:
+			return fmt.Errorf("xllsim: circular reference through %s", a)
+		case done:
+			return nil
+		}
+		state[a] = visiting
+		for _, dep := range sortedAddrs(calc) {
+			if w.reads(w.cells[a], map[Addr]bool{dep: true}) {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		state[a] = done
+		out = append(out, a)
+		return nil
+	}
+	for _, a := range sortedAddrs(calc) {
+		if err := visit(a); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// reads reports whether c's formula references any cell of set.
+func (w *Workbook) reads(c *cell, set map[Addr]bool) bool {
+	for _, arg := range c.formula.Args {
+		if arg.Ref == nil {
+			continue
+		}
+		for a := range set {
+			if arg.Ref.contains(a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eval calculates one formula cell. Only a closed host is an error; anything
+// the XLL would paint into the cell is returned as the value.
+func (w *Workbook) eval(ctx context.Context, at Addr, c *cell) (any, error) {
+	c.topic = ""
+	sig, ok := w.h.Signature(c.formula.Func)
+	if !ok {
+		return protocol.XlErrorName, nil
+	}
+	if len(c.formula.Args) > len(sig.ArgTypes) {
+		return protocol.XlErrorValue, nil
+	}
+	args := make([]any, len(sig.ArgTypes))
+	for i, typ := range sig.ArgTypes {
+		var expr argExpr
+		if i < len(c.formula.Args) {
+			expr = c.formula.Args[i]
+		}
+		v, xlErr := w.argValue(typ, expr)
+		if xlErr != 0 {
+			return xlErr, nil
+		}
+		args[i] = v
+	}
+	if sig.Mode == "rtd" || sig.Mode == "rtd-once" {
+		return w.evalRtd(ctx, c, sig, args)
+	}
+	// Calls are serial, so the caller can be set per cell.
+	w.h.Caller = &xllhost.CallerCell{Sheet: at.Sheet, Row: at.Row, Col: at.Col}
+	v, err := w.h.Call(ctx, sig.Name, args...)
+	return cellResult(sig, v, err)
+}
+
+// cellResult is what the XLL's wrapper paints for a call's outcome: a handler
+// error's text (an empty grid for numgrid, which cannot carry text), #VALUE!
+// for a call that failed outright.
+func cellResult(sig xllhost.Signature, v any, err error) (any, error) {
+	var fe *xllhost.FuncError
+	switch {
+	case err == nil:
+		return v, nil
+	case errors.As(err, &fe):
+		return errorText(sig.Return, fe.Msg), nil
+	case errors.Is(err, xllhost.ErrClosed):
+		return nil, err
+	}
+	return protocol.XlErrorValue, nil
+}
+
+func errorText(ret, msg string) any {
+	if ret == "numgrid" {
+		return [][]float64{}
+	}
+	return msg
+}
+
+// argValue converts an argument to the Go value Call takes for typ, the way
+// Excel coerces a cell for the registered argument type. A non-zero XlError is
+// the value the cell shows instead of calling: #VALUE! for a value the type
+// cannot take, or the error an argument cell already holds.
+func (w *Workbook) argValue(typ string, e argExpr) (any, protocol.XlError) {
+	switch typ {
+	case "range":
+		if e.Ref == nil {
+			return nil, protocol.XlErrorValue
+		}
+		return &protocol.RangeT{
+			SheetName: e.Ref.Sheet,
+			Refs: []*protocol.RectT{{
+				RowFirst: e.Ref.RowFirst, RowLast: e.Ref.RowLast,
+				ColFirst: e.Ref.ColFirst, ColLast: e.Ref.ColLast,
+			}},
+		}, 0
+	case "grid":
+		return w.rows(e), 0
+	case "numgrid":
+		rows := w.rows(e)
+		out := make([][]float64, len(rows))
+		for i, row := range rows {
+			out[i] = make([]float64, len(row))
+			for j, v := range row {
+				if v == nil {
+					continue
+				}
+				f, ok := v.(float64)
+				if !ok {
+					return nil, protocol.XlErrorValue
+				}
+				out[i][j] = f
+			}
+		}
+		return out, 0
+	case "any":
+		if e.Ref != nil && !e.Ref.single() {
+			return w.rows(e), 0
+		}
+		return w.scalar(e), 0
+	}
+
+	if e.Ref != nil && !e.Ref.single() {
+		return nil, protocol.XlErrorValue
+	}
+	v := w.scalar(e)
+	if x, ok := v.(protocol.XlError); ok {
+		return nil, x
+	}
+	switch typ {
+	case "string":
+		switch x := v.(type) {
+		case nil:
+			return "", 0
+		case string:
+			return x, 0
+		case bool:
+			return strings.ToUpper(strconv.FormatBool(x)), 0
+		case float64:
+			return strconv.FormatFloat(x, 'g', -1, 64), 0
+		}
+	case "bool":
+		switch x := v.(type) {
+		case nil:
+			return false, 0
+		case bool:
+			return x, 0
+		case float64:
+			return x != 0, 0
+		case string:
+			if b, err := strconv.ParseBool(x); err == nil {
+				return b, 0
+			}
+		}
+	default: // int, float, date
+		f, ok := number(v)
+		if !ok {
+			return nil, protocol.XlErrorValue
+		}
+		if typ == "int" {
+			t := math.Trunc(f)
+			if t < math.MinInt32 || t > math.MaxInt32 {
+				return nil, protocol.XlErrorNum
+			}
+			return int32(t), 0
+		}
+		return f, 0
+	}
+	return nil, protocol.XlErrorValue
+}
+
+func number(v any) (float64, bool) {
+	switch x := v.(type) {
+	case nil:
+		return 0, true
+	case float64:
+		return x, true
+	case bool:
+		if x {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// scalar is an argument's value: the literal, or the referenced cell's.
+func (w *Workbook) scalar(e argExpr) any {
+	if e.Ref == nil {
+		return e.Lit
+	}
+	return w.cellValue(e.Ref.topLeft())
+}
+
+// rows is an argument as a grid: the referenced cells row by row, or a
+// literal as a 1x1 grid.
+func (w *Workbook) rows(e argExpr) [][]any {
+	if e.Ref == nil {
+		return [][]any{{e.Lit}}
+	}
+	out := make([][]any, 0, e.Ref.RowLast-e.Ref.RowFirst+1)
+	for r := e.Ref.RowFirst; r <= e.Ref.RowLast; r++ {
+		row := make([]any, 0, e.Ref.ColLast-e.Ref.ColFirst+1)
+		for c := e.Ref.ColFirst; c <= e.Ref.ColLast; c++ {
+			row = append(row, w.cellValue(Addr{Sheet: e.Ref.Sheet, Row: r, Col: c}))
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+// cellValue is a cell's value as another formula reads it: a number as
+// float64, and for a grid result (which this model does not spill) its
+// top-left element.
+func (w *Workbook) cellValue(a Addr) any {
+	c, ok := w.cells[a]
+	if !ok {
+		return nil
+	}
+	switch x := c.value.(type) {
+	case int32:
+		return float64(x)
+	case time.Time:
+		return xldate.ToSerial(x)
+	case [][]any:
+		if len(x) > 0 && len(x[0]) > 0 {
+			return x[0][0]
+		}
+		return nil
+	case [][]float64:
+		if len(x) > 0 && len(x[0]) > 0 {
+			return x[0][0]
+		}
+		return nil
+	}
+	return c.value
+}
+
+// connectGrace waits ConnectGrace, or until ctx is done.
+func (w *Workbook) connectGrace(ctx context.Context) {
+	d := w.ConnectGrace
+	if d == 0 {
+		d = defaultConnectGrace
+	}
+	if d < 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// endCalc sends the calc-boundary events, with the XLL's per-cycle rtd-once
+// sweep in between, and applies the writes the guest answers with. The sends
+// outlive a cancelled ctx: a cancelled calculation still ends.
+func (w *Workbook) endCalc(ctx context.Context, canceled bool) error {
+	ectx, cancel := context.WithTimeout(context.WithoutCancel(ctx), eventTimeout)
+	defer cancel()
+	if canceled {
+		w.log(EventCalculationCanceled, "")
+		if err := w.h.CalculationCanceled(ectx); err != nil {
+			return fmt.Errorf("xllsim: CalculationCanceled: %w", err)
+		}
+	}
+	w.clearOnce()
+	w.log(EventCalculationEnded, "")
+	cmds, err := w.h.CalculationEnded(ectx)
+	if err != nil {
+		return fmt.Errorf("xllsim: CalculationEnded: %w", err)
+	}
+	w.apply(cmds)
+	if canceled {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// apply performs calc-end writes in order: a SetCommand's value to every cell
+// of its target (dirtying their dependents), a FormatCommand's format.
+func (w *Workbook) apply(cmds []xllhost.Command) {
+	for _, cmd := range cmds {
+		if cmd.Target == nil {
+			continue
+		}
+		sheet := cmd.Target.SheetName
+		if sheet == "" {
+			sheet = DefaultSheet
+		}
+		for _, rect := range cmd.Target.Refs {
+			r := area{Sheet: sheet, RowFirst: rect.RowFirst, RowLast: rect.RowLast, ColFirst: rect.ColFirst, ColLast: rect.ColLast}
+			for _, a := range r.cells() {
+				if cmd.IsFormat {
+					w.formats[a] = cmd.Format
+					continue
+				}
+				v, err := literal(cmd.Value)
+				if err != nil {
+					v = protocol.XlErrorValue
+				}
+				w.store(a, &cell{value: v})
+			}
+		}
+	}
+}
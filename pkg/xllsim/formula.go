@@ -0,0 +1,145 @@
+package xllsim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xll-gen/types/go/protocol"
+)
+
+// formula is a parsed cell formula: one call to a declared function, whose
+// arguments are literals or references. That is the shape of the cells the
+// smoketest workbook puts our functions in; nesting and operators are Excel's
+// business, not the add-in's, and are not modelled.
+type formula struct {
+	Func string
+	Args []argExpr
+}
+
+// argExpr is one argument: a reference (Ref non-nil) or a literal (float64,
+// string, bool, protocol.XlError, or nil for an omitted argument).
+type argExpr struct {
+	Ref *area
+	Lit any
+}
+
+// errorLiterals are the error values a formula or Set may spell out.
+var errorLiterals = map[string]protocol.XlError{
+	"#NULL!":        protocol.XlErrorNull,
+	"#DIV/0!":       protocol.XlErrorDiv0,
+	"#VALUE!":       protocol.XlErrorValue,
+	"#REF!":         protocol.XlErrorRef,
+	"#NAME?":        protocol.XlErrorName,
+	"#NUM!":         protocol.XlErrorNum,
+	"#N/A":          protocol.XlErrorNA,
+	"#GETTING_DATA": protocol.XlErrorGettingData,
+	"#SPILL!":       protocol.XlErrorSpill,
+	"#CALC!":        protocol.XlErrorCalc,
+	"#BLOCKED!":     protocol.XlErrorBlocked,
+	"#CONNECT!":     protocol.XlErrorConnect,
+	"#FIELD!":       protocol.XlErrorField,
+	"#UNKNOWN!":     protocol.XlErrorUnknown,
+}
+
+// parseFormula parses `=Func(arg, ...)` in a cell on sheet. An argument is a
+// number, a "string" ("" escapes a quote), TRUE/FALSE, an error literal, a
+// reference (A1, A1:B2, Data!A1, 'My Data'!A1:B2), or empty for an omitted
+// argument.
+func parseFormula(src, sheet string) (*formula, error) {
+	s := strings.TrimSpace(src)
+	if !strings.HasPrefix(s, "=") {
+		return nil, fmt.Errorf("formula %q does not start with =", src)
+	}
+	s = strings.TrimSpace(s[1:])
+	open := strings.IndexByte(s, '(')
+	if open <= 0 || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("formula %q is not a function call", src)
+	}
+	f := &formula{Func: strings.TrimSpace(s[:open])}
+	if !isIdent(f.Func) {
+		return nil, fmt.Errorf("formula %q: %q is not a function name", src, f.Func)
+	}
+	body := s[open+1 : len(s)-1]
+	if strings.TrimSpace(body) == "" {
+		return f, nil
+	}
+	parts, err := splitArgs(body)
+	if err != nil {
+		return nil, fmt.Errorf("formula %q: %w", src, err)
+	}
+	for _, p := range parts {
+		arg, err := parseArg(strings.TrimSpace(p), sheet)
+		if err != nil {
+			return nil, fmt.Errorf("formula %q: %w", src, err)
+		}
+		f.Args = append(f.Args, arg)
+	}
+	return f, nil
+}
+
+// splitArgs splits on the commas outside string literals and quoted sheet
+// names.
+func splitArgs(body string) ([]string, error) {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == ')':
+			return nil, fmt.Errorf("nested calls are not supported")
+		case c == ',':
+			parts = append(parts, body[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c", quote)
+	}
+	return append(parts, body[start:]), nil
+}
+
+func parseArg(s, sheet string) (argExpr, error) {
+	switch upper := strings.ToUpper(s); {
+	case s == "":
+		return argExpr{}, nil
+	case s[0] == '"':
+		if len(s) < 2 || s[len(s)-1] != '"' {
+			return argExpr{}, fmt.Errorf("malformed string %s", s)
+		}
+		return argExpr{Lit: strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)}, nil
+	case upper == "TRUE" || upper == "FALSE":
+		return argExpr{Lit: upper == "TRUE"}, nil
+	case s[0] == '#':
+		e, ok := errorLiterals[upper]
+		if !ok {
+			return argExpr{}, fmt.Errorf("unknown error literal %s", s)
+		}
+		return argExpr{Lit: e}, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return argExpr{Lit: f}, nil
+	}
+	r, err := parseArea(s, sheet)
+	if err != nil {
+		return argExpr{}, err
+	}
+	return argExpr{Ref: &r}, nil
+}
+
+func isIdent(s string) bool {
+	for i, c := range s {
+		letter := c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+		if !letter && (i == 0 || c != '.' && (c < '0' || c > '9')) {
+			return false
+		}
+	}
+	return s != ""
+}
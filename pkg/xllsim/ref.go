@@ -0,0 +1,132 @@
+package xllsim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultSheet is the sheet a reference without one names, and the sheet a
+// calc-end command with an empty sheet name writes to.
+const DefaultSheet = "Sheet1"
+
+// Addr is one cell: a sheet and a 0-based row and column, the coordinates
+// protocol.RectT uses.
+type Addr struct {
+	Sheet string
+	Row   int32
+	Col   int32
+}
+
+// String renders a in A1 notation with its sheet, e.g. "Sheet1!B2".
+func (a Addr) String() string {
+	return fmt.Sprintf("%s!%s%d", a.Sheet, colName(a.Col), a.Row+1)
+}
+
+func (a Addr) less(b Addr) bool {
+	if a.Sheet != b.Sheet {
+		return a.Sheet < b.Sheet
+	}
+	if a.Row != b.Row {
+		return a.Row < b.Row
+	}
+	return a.Col < b.Col
+}
+
+// area is a rectangular reference on one sheet.
+type area struct {
+	Sheet             string
+	RowFirst, RowLast int32
+	ColFirst, ColLast int32
+}
+
+func (r area) single() bool {
+	return r.RowFirst == r.RowLast && r.ColFirst == r.ColLast
+}
+
+func (r area) topLeft() Addr {
+	return Addr{Sheet: r.Sheet, Row: r.RowFirst, Col: r.ColFirst}
+}
+
+func (r area) contains(a Addr) bool {
+	return a.Sheet == r.Sheet && a.Row >= r.RowFirst && a.Row <= r.RowLast &&
+		a.Col >= r.ColFirst && a.Col <= r.ColLast
+}
+
+// cells lists the area's cells row by row.
+func (r area) cells() []Addr {
+	var out []Addr
+	for row := r.RowFirst; row <= r.RowLast; row++ {
+		for col := r.ColFirst; col <= r.ColLast; col++ {
+			out = append(out, Addr{Sheet: r.Sheet, Row: row, Col: col})
+		}
+	}
+	return out
+}
+
+func (r area) String() string {
+	s := r.topLeft().String()
+	if !r.single() {
+		s += fmt.Sprintf(":%s%d", colName(r.ColLast), r.RowLast+1)
+	}
+	return s
+}
+
+// parseArea parses "A1", "$B$2", "A1:C3" or "Data!A1:C3" ('Quoted Name'!A1
+// for a sheet name with spaces). A reference without a sheet is on sheet.
+func parseArea(s, sheet string) (area, error) {
+	ref := strings.TrimSpace(s)
+	if i := strings.LastIndexByte(ref, '!'); i >= 0 {
+		sheet = ref[:i]
+		if len(sheet) >= 2 && sheet[0] == '\'' && sheet[len(sheet)-1] == '\'' {
+			sheet = strings.ReplaceAll(sheet[1:len(sheet)-1], "''", "'")
+		}
+		if sheet == "" {
+			return area{}, fmt.Errorf("reference %q has an empty sheet name", s)
+		}
+		ref = ref[i+1:]
+	}
+	first, last, isRange := strings.Cut(ref, ":")
+	r1, c1, err := parseCell(first)
+	if err != nil {
+		return area{}, fmt.Errorf("reference %q: %w", s, err)
+	}
+	r2, c2 := r1, c1
+	if isRange {
+		if r2, c2, err = parseCell(last); err != nil {
+			return area{}, fmt.Errorf("reference %q: %w", s, err)
+		}
+	}
+	return area{
+		Sheet:    sheet,
+		RowFirst: min(r1, r2), RowLast: max(r1, r2),
+		ColFirst: min(c1, c2), ColLast: max(c1, c2),
+	}, nil
+}
+
+// parseCell parses one A1 cell ("$" anchors allowed) to 0-based row and
+// column, within Excel's 1048576 x 16384 grid.
+func parseCell(s string) (row, col int32, err error) {
+	s = strings.ReplaceAll(s, "$", "")
+	i := 0
+	for i < len(s) && (s[i] >= 'A' && s[i] <= 'Z' || s[i] >= 'a' && s[i] <= 'z') {
+		col = col*26 + int32(s[i]&^0x20-'A'+1)
+		if col > 16384 {
+			return 0, 0, fmt.Errorf("column of %q is past XFD", s)
+		}
+		i++
+	}
+	n, err := strconv.Atoi(s[i:])
+	if i == 0 || err != nil || n < 1 || n > 1048576 {
+		return 0, 0, fmt.Errorf("%q is not an A1 cell", s)
+	}
+	return int32(n - 1), col - 1, nil
+}
+
+func colName(col int32) string {
+	var b []byte
+	for n := col + 1; n > 0; n = (n - 1) / 26 {
+		b = append([]byte{byte('A' + (n-1)%26)}, b...)
+	}
+	return string(b)
+}
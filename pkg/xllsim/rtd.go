@@ -0,0 +1,332 @@
+package xllsim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/xllhost"
+)
+
+// liveTopic is a connected RTD topic, shared by every cell whose formula
+// makes the same call (Excel keeps one topic per distinct topic-string list).
+type liveTopic struct {
+	t   *xllhost.Topic
+	sig xllhost.Signature
+	// latest is a streaming topic's last pushed value; has reports whether one
+	// arrived yet.
+	latest any
+	has    bool
+}
+
+// onceEntry is a stored rtd-once result, the RtdOnceRegistry entry of the
+// XLL: the retention policy is copied from the function so the sweep needs
+// no lookup.
+type onceEntry struct {
+	value     any
+	stored    time.Time
+	transient bool
+	memoize   bool
+	ttl       time.Duration
+}
+
+// evalRtd is the XLL's rtd and rtd-once wrappers. A streaming cell shows its
+// topic's latest value (#GETTING_DATA before the first). An rtd-once cell
+// returns a stored result without touching RTD — which is what lets the
+// topic disconnect at the end of the cycle — and otherwise keeps (or
+// connects) its topic and shows the latest progress or the loading
+// placeholder.
+func (w *Workbook) evalRtd(ctx context.Context, c *cell, sig xllhost.Signature, args []any) (any, error) {
+	key := topicKey(sig.Name, args)
+	if sig.Mode == "rtd-once" {
+		if v, ok := w.onceResult(key); ok {
+			return v, nil
+		}
+	}
+	lt, live := w.topics[key]
+	if !live {
+		t, err := w.h.Subscribe(ctx, sig.Name, args...)
+		if err != nil {
+			return cellResult(sig, nil, err)
+		}
+		lt = &liveTopic{t: t, sig: sig}
+		w.topics[key] = lt
+		w.log(EventConnect, key)
+		for _, typ := range sig.ArgTypes {
+			if typ == "grid" || typ == "numgrid" || typ == "range" || typ == "any" {
+				w.compositeConnect = true
+			}
+		}
+	}
+	c.topic = key
+	if sig.Mode == "rtd" {
+		if !lt.has {
+			return protocol.XlErrorGettingData, nil
+		}
+		return lt.latest, nil
+	}
+	if p, ok := w.progress[key]; ok {
+		return p, nil
+	}
+	return sig.Placeholder, nil
+}
+
+// onceResult is RtdOnceRegistry::TryGetResult: a stored result, unless it is
+// an error or an expired memoize_ttl result whose topic is gone, which is
+// dropped so the cell recomputes.
+func (w *Workbook) onceResult(key string) (any, bool) {
+	e, ok := w.once[key]
+	if !ok {
+		return nil, false
+	}
+	if _, live := w.topics[key]; !live {
+		if e.transient || e.ttl > 0 && w.now().Sub(e.stored) > e.ttl {
+			delete(w.once, key)
+			return nil, false
+		}
+	}
+	return e.value, true
+}
+
+// clearOnce is RtdOnceRegistry::ClearNonMemoized, run at every
+// CalculationEnded: a result whose topic is gone is dropped for once, after
+// its TTL for memoize_ttl, never for memoize — and always for an error. A
+// result whose topic is still connected is kept whatever the policy, or the
+// cell would re-connect to a topic that never pushes again.
+func (w *Workbook) clearOnce() {
+	for key := range w.progress {
+		if _, live := w.topics[key]; !live {
+			delete(w.progress, key)
+		}
+	}
+	now := w.now()
+	for key, e := range w.once {
+		if _, live := w.topics[key]; live {
+			continue
+		}
+		if e.transient || !e.memoize && (e.ttl == 0 || now.Sub(e.stored) > e.ttl) {
+			delete(w.once, key)
+		}
+	}
+}
+
+// releaseTopics disconnects the topics no cell references any more: those of
+// rtd-once cells that read their stored result this cycle, and of formulas
+// that changed or were cleared.
+func (w *Workbook) releaseTopics() error {
+	used := make(map[string]bool)
+	for _, c := range w.cells {
+		if c.formula != nil && c.topic != "" {
+			used[c.topic] = true
+		}
+	}
+	for _, key := range w.topicKeys() {
+		if used[key] {
+			continue
+		}
+		t := w.topics[key].t
+		delete(w.topics, key)
+		w.log(EventDisconnect, key)
+		if err := t.Close(); err != nil {
+			return fmt.Errorf("xllsim: disconnecting %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Close disconnects every topic still connected. It does not close the host.
+func (w *Workbook) Close() error {
+	var errs []error
+	for _, key := range w.topicKeys() {
+		t := w.topics[key].t
+		delete(w.topics, key)
+		w.log(EventDisconnect, key)
+		errs = append(errs, t.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (w *Workbook) topicKeys() []string {
+	keys := make([]string, 0, len(w.topics))
+	for key := range w.topics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// absorb takes every update already pushed to a connected topic and reports
+// whether there was one.
+func (w *Workbook) absorb() bool {
+	got := false
+	for _, key := range w.topicKeys() {
+		lt := w.topics[key]
+		for drained := false; !drained; {
+			select {
+			case u := <-lt.t.Updates:
+				w.push(key, lt, u)
+				got = true
+			default:
+				drained = true
+			}
+		}
+	}
+	return got
+}
+
+// push applies one update: a streaming topic's new value, or an rtd-once
+// topic's progress or result — stored, as ProcessRtdUpdate stores it, with an
+// error marked transient — and dirties the cells showing the topic.
+func (w *Workbook) push(key string, lt *liveTopic, u xllhost.Update) {
+	switch {
+	case lt.sig.Mode == "rtd":
+		lt.latest, lt.has = u.Value, true
+	case u.Progress:
+		// A progress push that raced the result is ignored.
+		if _, done := w.once[key]; !done {
+			w.progress[key] = u.Value
+		}
+	default:
+		delete(w.progress, key)
+		v := u.Value
+		if ret := lt.sig.Return; ret == "grid" || ret == "numgrid" {
+			// The update is only the readiness token; the grid arrived on
+			// its own message first. An error has no grid behind it.
+			if u.IsError {
+				v = errorText(ret, fmt.Sprint(u.Value))
+			} else {
+				v, _ = w.h.OnceGrid(lt.t.Key)
+			}
+		}
+		w.once[key] = &onceEntry{
+			value:     v,
+			stored:    w.now(),
+			transient: u.IsError,
+			memoize:   lt.sig.Memoize,
+			ttl:       lt.sig.MemoizeTTL,
+		}
+	}
+	for a, c := range w.cells {
+		if c.formula != nil && c.topic == key {
+			w.dirty[a] = true
+		}
+	}
+}
+
+// WaitRTD blocks until an update reaches a connected topic, then takes it and
+// every other update already pushed; the cells showing those topics are
+// recalculated by the next Calculate.
+func (w *Workbook) WaitRTD(ctx context.Context) error {
+	if w.absorb() {
+		return nil
+	}
+	keys := w.topicKeys()
+	if len(keys) == 0 {
+		return errors.New("xllsim: no RTD topic is connected")
+	}
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}
+	for _, key := range keys {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(w.topics[key].t.Updates)})
+	}
+	chosen, v, _ := reflect.Select(cases)
+	if chosen == 0 {
+		return fmt.Errorf("xllsim: waiting for an RTD update: %w", ctx.Err())
+	}
+	key := keys[chosen-1]
+	w.push(key, w.topics[key], v.Interface().(xllhost.Update))
+	w.absorb()
+	return nil
+}
+
+// Settle calculates, and while an rtd-once cell still waits on its result,
+// waits for RTD updates and calculates again. Streaming topics never settle;
+// they are recalculated along the way but not waited for.
+func (w *Workbook) Settle(ctx context.Context) error {
+	for {
+		if err := w.Calculate(ctx); err != nil {
+			return err
+		}
+		if !w.pendingOnce() {
+			return nil
+		}
+		if err := w.WaitRTD(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *Workbook) pendingOnce() bool {
+	for key, lt := range w.topics {
+		if _, done := w.once[key]; lt.sig.Mode == "rtd-once" && !done {
+			return true
+		}
+	}
+	return false
+}
+
+// topicKey identifies a topic by its call, e.g. `Quote("MSFT", 2)`, with a
+// grid argument as an Excel array constant and a range as its reference. Like
+// the XLL's key it depends on the argument values only, so identical calls in
+// different cells share one topic and one stored result.
+func topicKey(name string, args []any) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = keyValue(a)
+	}
+	return name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func keyValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strconv.Quote(x)
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(x))
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case int32:
+		return strconv.Itoa(int(x))
+	case protocol.XlError:
+		for lit, e := range errorLiterals {
+			if e == x {
+				return lit
+			}
+		}
+		return fmt.Sprintf("#ERR%d", int(x))
+	case *protocol.RangeT:
+		var areas []string
+		for _, r := range x.Refs {
+			areas = append(areas, area{Sheet: x.SheetName, RowFirst: r.RowFirst, RowLast: r.RowLast, ColFirst: r.ColFirst, ColLast: r.ColLast}.String())
+		}
+		return strings.Join(areas, ",")
+	case [][]any:
+		rows := make([]string, len(x))
+		for i, row := range x {
+			cells := make([]string, len(row))
+			for j, c := range row {
+				cells[j] = keyValue(c)
+			}
+			rows[i] = strings.Join(cells, ",")
+		}
+		return "{" + strings.Join(rows, ";") + "}"
+	case [][]float64:
+		rows := make([]string, len(x))
+		for i, row := range x {
+			cells := make([]string, len(row))
+			for j, c := range row {
+				cells[j] = keyValue(c)
+			}
+			rows[i] = strings.Join(cells, ",")
+		}
+		return "{" + strings.Join(rows, ";") + "}"
+	}
+	return fmt.Sprint(v)
+}
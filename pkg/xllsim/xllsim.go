@@ -0,0 +1,297 @@
+// Package xllsim is an offline stand-in for the Excel workbook around an
+// add-in: cells holding literals or calls to the project's functions,
+// calculated in dependency order, with the calc-cycle events, calc-end sheet
+// writes and RTD topic lifecycle Excel drives. It runs on pkg/xllhost, so the
+// generated server under test is the real one; what it replaces is Excel and
+// the XLL's cell-side bookkeeping — the rtd-once result cache, its
+// once/memoize/memoize_ttl retention, and topic connect/disconnect — so that
+// lifecycle behavior can be tested on Linux CI instead of only in the Windows
+// smoketest.
+//
+//	h, _ := xllhost.Load("../xll.yaml")
+//	go generated.ServeConn(myService{}, h)
+//	wb := xllsim.New(h)
+//	wb.Set("A1", 2)
+//	wb.SetFormula("B1", "=Double(A1)")
+//	wb.SetFormula("C1", "=Quote(B1)") // rtd-once
+//	err := wb.Settle(ctx)            // calc, wait for the push, recalc
+//	wb.Value("C1")
+//
+// A calculation cycle evaluates the dirty formula cells (and everything that
+// depends on them) in dependency order, disconnects the RTD topics no cell
+// references any more, clears the rtd-once results the XLL would clear, sends
+// CalculationEnded and applies the SetCommand/FormatCommand writes the guest
+// answers with. A write dirties its dependents, so Calculate repeats cycles
+// until nothing is dirty — the recalc Excel runs after the deferred xlSet.
+//
+// RTD values do not arrive during a cycle. Each Calculate first takes the
+// updates pushed so far (a push dirties the cells showing the topic, as
+// Excel's RTD throttle recalc does); WaitRTD blocks for the next one, and
+// Settle alternates the two until no rtd-once cell is still waiting.
+//
+// A Workbook is not safe for concurrent use.
+package xllsim
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/xldate"
+	"github.com/xll-gen/xll-gen/pkg/xllhost"
+)
+
+// defaultMaxCycles bounds Calculate when MaxCycles is 0.
+const defaultMaxCycles = 16
+
+// defaultConnectGrace is the ConnectGrace used when it is 0.
+const defaultConnectGrace = 50 * time.Millisecond
+
+// Workbook is a simulated workbook over one Host. Construct it with New.
+type Workbook struct {
+	// MaxCycles bounds the calculation cycles one Calculate runs; a calc-end
+	// handler that writes on every cycle would otherwise never settle. 0 means
+	// 16.
+	MaxCycles int
+	// Now is the clock memoize_ttl ages are measured with. nil means time.Now.
+	Now func() time.Time
+	// ConnectGrace is how long a cycle that connected an RTD topic with a
+	// grid, numgrid, range or any argument waits before CalculationEnded. The
+	// guest resolves such an argument from its RefCache on the connect
+	// goroutine and CalculationEnded clears the RefCache; in Excel the rest of
+	// the recalc gives the goroutine that time, here nothing would. 0 means
+	// 50ms; a negative value does not wait, which exposes the resolve-miss
+	// path.
+	ConnectGrace time.Duration
+
+	h        *xllhost.Host
+	cells    map[Addr]*cell
+	formats  map[Addr]string
+	dirty    map[Addr]bool
+	topics   map[string]*liveTopic
+	once     map[string]*onceEntry
+	progress map[string]any
+	events   []Event
+	// compositeConnect records that this cycle connected a topic whose
+	// arguments the guest resolves from its RefCache.
+	compositeConnect bool
+}
+
+// cell is a literal (formula nil) or a formula with its last computed value.
+type cell struct {
+	value   any
+	formula *formula
+	source  string
+	// topic is the key of the RTD topic the formula references, "" for none.
+	topic string
+}
+
+// New returns an empty workbook calculating against h, which must already be
+// served (ServeConn) for Calculate to get anywhere.
+func New(h *xllhost.Host) *Workbook {
+	return &Workbook{
+		h:        h,
+		cells:    make(map[Addr]*cell),
+		formats:  make(map[Addr]string),
+		dirty:    make(map[Addr]bool),
+		topics:   make(map[string]*liveTopic),
+		once:     make(map[string]*onceEntry),
+		progress: make(map[string]any),
+	}
+}
+
+// Set writes the literal v to every cell of ref, or, for a [][]any or
+// [][]float64, element by element from ref's top-left cell. Numbers are stored
+// as float64 and a time.Time as its date serial, as Excel stores them; an
+// error value is a protocol.XlError. The cells and their dependents are
+// recalculated by the next Calculate.
+func (w *Workbook) Set(ref string, v any) error {
+	r, err := parseArea(ref, DefaultSheet)
+	if err != nil {
+		return err
+	}
+	switch rows := v.(type) {
+	case [][]any:
+		return w.setRows(r.topLeft(), len(rows), func(i int) []any { return rows[i] })
+	case [][]float64:
+		return w.setRows(r.topLeft(), len(rows), func(i int) []any {
+			row := make([]any, len(rows[i]))
+			for j, f := range rows[i] {
+				row[j] = f
+			}
+			return row
+		})
+	}
+	lit, err := literal(v)
+	if err != nil {
+		return err
+	}
+	for _, a := range r.cells() {
+		w.store(a, &cell{value: lit})
+	}
+	return nil
+}
+
+func (w *Workbook) setRows(at Addr, n int, row func(int) []any) error {
+	for i := 0; i < n; i++ {
+		for j, v := range row(i) {
+			lit, err := literal(v)
+			if err != nil {
+				return err
+			}
+			w.store(Addr{Sheet: at.Sheet, Row: at.Row + int32(i), Col: at.Col + int32(j)}, &cell{value: lit})
+		}
+	}
+	return nil
+}
+
+// SetFormula puts a formula in the cell ref: `=Func(arg, ...)`, one call to a
+// declared function (matched by its xll.yaml name) whose arguments are
+// numbers, "strings", TRUE/FALSE, error literals, references (A1, A1:B2,
+// Data!A1) or empty. The cell is calculated by the next Calculate.
+func (w *Workbook) SetFormula(ref, src string) error {
+	r, err := parseArea(ref, DefaultSheet)
+	if err != nil {
+		return err
+	}
+	if !r.single() {
+		return fmt.Errorf("xllsim: %s: a formula goes in one cell", ref)
+	}
+	f, err := parseFormula(src, r.Sheet)
+	if err != nil {
+		return fmt.Errorf("xllsim: %s: %w", ref, err)
+	}
+	w.store(r.topLeft(), &cell{formula: f, source: src})
+	return nil
+}
+
+// Clear empties every cell of ref, formulas included.
+func (w *Workbook) Clear(ref string) error {
+	r, err := parseArea(ref, DefaultSheet)
+	if err != nil {
+		return err
+	}
+	for _, a := range r.cells() {
+		delete(w.cells, a)
+		w.dirty[a] = true
+	}
+	return nil
+}
+
+func (w *Workbook) store(a Addr, c *cell) {
+	w.cells[a] = c
+	w.dirty[a] = true
+}
+
+// Value returns what the cell ref shows: its literal, or its formula's last
+// result (nil for an empty cell or a formula not yet calculated). A result is
+// the function's return value as xllhost decodes it, a handler error's text,
+// or a protocol.XlError (#VALUE! for an argument the function cannot take,
+// #NAME? for an undeclared function, the loading placeholder for a pending
+// RTD topic). It panics on a malformed reference, which is a bug in the test.
+func (w *Workbook) Value(ref string) any {
+	a := mustAddr(ref)
+	if c, ok := w.cells[a]; ok {
+		return c.value
+	}
+	return nil
+}
+
+// Format returns the number format a FormatCommand applied to the cell ref, or
+// "". It panics on a malformed reference.
+func (w *Workbook) Format(ref string) string {
+	return w.formats[mustAddr(ref)]
+}
+
+// Formula returns the formula in the cell ref as it was set, or "". It panics
+// on a malformed reference.
+func (w *Workbook) Formula(ref string) string {
+	if c, ok := w.cells[mustAddr(ref)]; ok {
+		return c.source
+	}
+	return ""
+}
+
+func mustAddr(ref string) Addr {
+	r, err := parseArea(ref, DefaultSheet)
+	if err != nil || !r.single() {
+		panic(fmt.Sprintf("xllsim: %q is not a single-cell reference", ref))
+	}
+	return r.topLeft()
+}
+
+// literal normalizes a value written to a cell.
+func literal(v any) (any, error) {
+	switch x := v.(type) {
+	case nil, float64, string, bool, protocol.XlError:
+		return x, nil
+	case int:
+		return float64(x), nil
+	case int32:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case float32:
+		return float64(x), nil
+	case time.Time:
+		return xldate.ToSerial(x), nil
+	}
+	return nil, fmt.Errorf("xllsim: a cell cannot hold %T", v)
+}
+
+// EventKind names what the simulated Excel did.
+type EventKind string
+
+const (
+	// EventConnect is an RTD topic connecting (ConnectData).
+	EventConnect EventKind = "connect"
+	// EventDisconnect is an RTD topic no cell references disconnecting
+	// (DisconnectData), at the end of a cycle's evaluation.
+	EventDisconnect EventKind = "disconnect"
+	// EventCalculationCanceled is MSG_CALCULATION_CANCELED.
+	EventCalculationCanceled EventKind = "calculation-canceled"
+	// EventCalculationEnded is MSG_CALCULATION_ENDED.
+	EventCalculationEnded EventKind = "calculation-ended"
+)
+
+// Event is one entry of the workbook's event log. Topic is the topic's key —
+// the function and its arguments as a call, e.g. `Quote("MSFT")` — for a
+// connect or disconnect.
+type Event struct {
+	Kind  EventKind
+	Topic string
+}
+
+func (e Event) String() string {
+	if e.Topic == "" {
+		return string(e.Kind)
+	}
+	return string(e.Kind) + " " + e.Topic
+}
+
+// Events returns everything the workbook has sent the guest besides function
+// calls, in order.
+func (w *Workbook) Events() []Event {
+	return append([]Event(nil), w.events...)
+}
+
+func (w *Workbook) log(kind EventKind, topic string) {
+	w.events = append(w.events, Event{Kind: kind, Topic: topic})
+}
+
+func (w *Workbook) now() time.Time {
+	if w.Now != nil {
+		return w.Now()
+	}
+	return time.Now()
+}
+
+func sortedAddrs(m map[Addr]bool) []Addr {
+	out := make([]Addr, 0, len(m))
+	for a := range m {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].less(out[j]) })
+	return out
+}
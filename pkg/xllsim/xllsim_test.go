@@ -0,0 +1,317 @@
+package xllsim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/internal/fbany"
+	"github.com/xll-gen/xll-gen/pkg/server"
+	"github.com/xll-gen/xll-gen/pkg/xllhost"
+	"github.com/xll-gen/xll-gen/pkg/xllhost/xllhosttest"
+)
+
+// startGuest serves the shared test guest (pkg/xllhost/xllhosttest).
+func startGuest(t *testing.T) (*xllhost.Host, *xllhosttest.Guest) {
+	t.Helper()
+	h, err := xllhost.Parse([]byte(xllhosttest.YAML))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return h, xllhosttest.Serve(t, h)
+}
+
+// scheduleSet is what a calc-end handler's ScheduleSet does for one cell.
+func scheduleSet(cb *server.CommandBatcher, row, col int32, v any) {
+	rb := flatbuffers.NewBuilder(64)
+	rb.Finish((&protocol.RangeT{SheetName: DefaultSheet, Refs: []*protocol.RectT{{RowFirst: row, RowLast: row, ColFirst: col, ColLast: col}}}).Pack(rb))
+	vb := flatbuffers.NewBuilder(64)
+	vb.Finish(fbany.BuildGo(vb, v))
+	cb.ScheduleSet(protocol.GetRootAsRange(rb.FinishedBytes(), 0), protocol.GetRootAsAny(vb.FinishedBytes(), 0))
+}
+
+func scheduleFormat(cb *server.CommandBatcher, row, col int32, format string) {
+	rb := flatbuffers.NewBuilder(64)
+	rb.Finish((&protocol.RangeT{SheetName: DefaultSheet, Refs: []*protocol.RectT{{RowFirst: row, RowLast: row, ColFirst: col, ColLast: col}}}).Pack(rb))
+	cb.ScheduleFormat(protocol.GetRootAsRange(rb.FinishedBytes(), 0), format)
+}
+
+func mustFormula(t *testing.T, w *Workbook, ref, src string) {
+	t.Helper()
+	if err := w.SetFormula(ref, src); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func wantValues(t *testing.T, w *Workbook, want map[string]any) {
+	t.Helper()
+	for ref, v := range want {
+		if got := w.Value(ref); !reflect.DeepEqual(got, v) {
+			t.Errorf("%s = %#v, want %#v", ref, got, v)
+		}
+	}
+}
+
+func TestParseFormula(t *testing.T) {
+	f, err := parseFormula(`=Fn(1.5, "a,""b", true, #N/A, , $B$2:A1, 'My Data'!C3)`, "Sheet2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Func != "Fn" || len(f.Args) != 7 {
+		t.Fatalf("formula = %+v", f)
+	}
+	lits := []any{1.5, `a,"b`, true, protocol.XlErrorNA, nil}
+	for i, want := range lits {
+		if f.Args[i].Ref != nil || f.Args[i].Lit != want {
+			t.Errorf("arg %d = %+v, want literal %#v", i, f.Args[i], want)
+		}
+	}
+	if r := f.Args[5].Ref; r == nil || r.String() != "Sheet2!A1:B2" {
+		t.Errorf("arg 5 = %+v, want Sheet2!A1:B2", r)
+	}
+	if r := f.Args[6].Ref; r == nil || r.String() != "My Data!C3" {
+		t.Errorf("arg 6 = %+v, want My Data!C3", r)
+	}
+
+	for _, src := range []string{"Fn(1)", "=Fn(1", "=1+2", "=Fn(G(1))", `=Fn("x)`, "=Fn(#WHAT)", "=Fn(A0)"} {
+		if _, err := parseFormula(src, DefaultSheet); err == nil {
+			t.Errorf("parseFormula accepted %q", src)
+		}
+	}
+}
+
+func TestCalculate_DependencyOrder(t *testing.T) {
+	h, _ := startGuest(t)
+	ctx := xllhosttest.Ctx(t)
+	w := New(h)
+
+	// Formulas set before the cells they read, in reverse order.
+	mustFormula(t, w, "C1", "=Add(B1, B1)")
+	mustFormula(t, w, "B1", "=Add(A1, 3)")
+	mustFormula(t, w, "D1", "=Half(C1)")
+	mustFormula(t, w, "E1", "=Div(1, 0)")
+	mustFormula(t, w, "F1", "=Nope(1)")
+	mustFormula(t, w, "G1", `=Add("x", 1)`)
+	mustFormula(t, w, "H1", "=Add(A1:A2, 1)")
+	mustFormula(t, w, "Data!B3", "=Where()")
+	if err := w.Set("A1", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Calculate(ctx); err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+	wantValues(t, w, map[string]any{
+		"B1": int32(5), "C1": int32(10), "D1": 5.0,
+		"E1":      "division by zero",
+		"F1":      protocol.XlErrorName,
+		"G1":      protocol.XlErrorValue,
+		"H1":      protocol.XlErrorValue,
+		"Data!B3": "Data R2C1",
+	})
+
+	// Only A1's dependents recalculate; one cycle, one CalculationEnded.
+	if err := w.Set("A1", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Calculate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantValues(t, w, map[string]any{"B1": int32(13), "C1": int32(26), "D1": 13.0})
+	if got := fmt.Sprint(w.Events()); got != "[calculation-ended calculation-ended]" {
+		t.Errorf("events = %s", got)
+	}
+
+	mustFormula(t, w, "J1", "=Add(J2, 1)")
+	mustFormula(t, w, "J2", "=Add(J1, 1)")
+	if err := w.Calculate(ctx); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("a circular reference calculated: %v", err)
+	}
+}
+
+// TestCalculate_CalcEndCommands: writes scheduled at calc end land after the
+// cycle and recalculate their dependents in the next one.
+func TestCalculate_CalcEndCommands(t *testing.T) {
+	h, g := startGuest(t)
+	ctx := xllhosttest.Ctx(t)
+	w := New(h)
+
+	var once sync.Once
+	g.SetOnEnded(func(cb *server.CommandBatcher) {
+		once.Do(func() {
+			scheduleSet(cb, 0, 0, 5.0)       // A1
+			scheduleFormat(cb, 0, 1, "0.00") // B1
+		})
+	})
+	mustFormula(t, w, "B1", "=Add(A1, 1)")
+	if err := w.Calculate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantValues(t, w, map[string]any{"A1": 5.0, "B1": int32(6)})
+	if f := w.Format("B1"); f != "0.00" {
+		t.Errorf("B1 format = %q", f)
+	}
+	if n := len(w.Events()); n != 2 {
+		t.Errorf("%d calc cycles, want 2: the one that scheduled the write and the recalc after it", n)
+	}
+
+	g.SetOnEnded(func(cb *server.CommandBatcher) { scheduleSet(cb, 0, 0, 1.0) })
+	w.MaxCycles = 3
+	w.Set("A1", 0)
+	if err := w.Calculate(ctx); err == nil {
+		t.Error("a handler writing every cycle settled")
+	}
+}
+
+// TestCalculate_Canceled: an interrupted calculation fires Canceled then
+// Ended, still applies the writes, and leaves its cells for the next one.
+func TestCalculate_Canceled(t *testing.T) {
+	h, g := startGuest(t)
+	w := New(h)
+	g.SetOnEnded(func(cb *server.CommandBatcher) { scheduleFormat(cb, 0, 0, "@") })
+	mustFormula(t, w, "A1", "=Add(1, 2)")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.Calculate(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Calculate = %v, want context.Canceled", err)
+	}
+	if got := fmt.Sprint(w.Events()); got != "[calculation-canceled calculation-ended]" {
+		t.Errorf("events = %s", got)
+	}
+	if canceled := g.Canceled(); canceled != 1 || w.Value("A1") != nil || w.Format("A1") != "@" {
+		t.Errorf("canceled=%d A1=%v format=%q; want the handler run, A1 uncalculated, the write applied", canceled, w.Value("A1"), w.Format("A1"))
+	}
+
+	g.SetOnEnded(nil)
+	if err := w.Calculate(xllhosttest.Ctx(t)); err != nil || w.Value("A1") != int32(3) {
+		t.Errorf("the next calculation: A1 = %v, err = %v", w.Value("A1"), err)
+	}
+}
+
+// TestRtdOnce_Lifecycle follows each retention policy through the XLL's
+// miss -> connect -> push -> hit -> disconnect -> calc-end sweep.
+func TestRtdOnce_Lifecycle(t *testing.T) {
+	h, g := startGuest(t)
+	ctx := xllhosttest.Ctx(t)
+	w := New(h)
+	clock := time.Unix(0, 0)
+	w.Now = func() time.Time { return clock }
+
+	mustFormula(t, w, "A1", "=Label(7)")
+	mustFormula(t, w, "A2", "=Label(7)")
+	mustFormula(t, w, "B1", "=MemoLabel(7)")
+	mustFormula(t, w, "C1", "=TTLLabel(7)")
+	mustFormula(t, w, "D1", "=MemoLabel(0)")
+	if err := w.Calculate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Value("A1"); v != protocol.XlErrorGettingData {
+		t.Errorf("A1 = %#v before the push, want #GETTING_DATA", v)
+	}
+	if err := w.Settle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantValues(t, w, map[string]any{"A1": "label 7", "A2": "label 7", "B1": "label 7", "C1": "label 7", "D1": "zero"})
+	events := fmt.Sprint(w.Events())
+	for _, want := range []string{"connect Label(7)", "disconnect Label(7)", "disconnect MemoLabel(0)"} {
+		if !strings.Contains(events, want) {
+			t.Errorf("events lack %q: %s", want, events)
+		}
+	}
+	if strings.Count(events, "connect Label(7)") != 2 {
+		t.Errorf("two cells with one call should share one topic: %s", events)
+	}
+
+	// A full recalc: once recomputes; memoize and memoize_ttl (within its TTL)
+	// do not; an error recomputes whatever the function declares.
+	clock = clock.Add(30 * time.Second)
+	if err := w.CalculateFull(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantValues(t, w, map[string]any{"A1": protocol.XlErrorGettingData, "B1": "label 7", "C1": "label 7"})
+	if err := w.Settle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]int{"Label(7)": 2, "MemoLabel(7)": 1, "TTLLabel(7)": 1, "MemoLabel(0)": 2} {
+		if got := g.Runs(key); got != want {
+			t.Errorf("%s ran %d times, want %d", key, got, want)
+		}
+	}
+
+	clock = clock.Add(time.Minute)
+	if err := w.CalculateFull(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.Value("C1"); v != protocol.XlErrorGettingData {
+		t.Errorf("C1 = %#v past its TTL, want a recompute", v)
+	}
+	if err := w.Settle(ctx); err != nil || g.Runs("TTLLabel(7)") != 2 || w.Value("B1") != "label 7" {
+		t.Errorf("after the TTL: err=%v TTLLabel runs=%d B1=%v", err, g.Runs("TTLLabel(7)"), w.Value("B1"))
+	}
+}
+
+func TestRtdOnce_Grid(t *testing.T) {
+	h, _ := startGuest(t)
+	ctx := xllhosttest.Ctx(t)
+	w := New(h)
+	w.Set("A1", [][]float64{{1, 2}, {3, 4}})
+	mustFormula(t, w, "C1", "=Square(A1:B2)")
+	if err := w.Settle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantValues(t, w, map[string]any{"C1": [][]float64{{1, 4}, {9, 16}}})
+}
+
+// TestRtd_PushDrivenRecalc: a streaming topic's pushes recalculate the cell
+// and its dependents, and changing the formula disconnects the old topic.
+func TestRtd_PushDrivenRecalc(t *testing.T) {
+	h, g := startGuest(t)
+	ctx := xllhosttest.Ctx(t)
+	w := New(h)
+	mustFormula(t, w, "A1", `=Ticker("X")`)
+	mustFormula(t, w, "B1", "=Add(A1, 1)")
+	if err := w.Calculate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantValues(t, w, map[string]any{"A1": protocol.XlErrorGettingData, "B1": protocol.XlErrorGettingData})
+
+	id := <-g.Tickers
+	for _, v := range []float64{1.5, 41.9} {
+		if err := g.Mgr.SendUpdate(id, v); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WaitRTD(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Calculate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		wantValues(t, w, map[string]any{"A1": v, "B1": int32(v) + 1})
+	}
+
+	mustFormula(t, w, "A1", `=Ticker("Y")`)
+	if err := w.Calculate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-g.Disconnects:
+		if got != id {
+			t.Errorf("disconnected topic %d, want %d", got, id)
+		}
+	case <-ctx.Done():
+		t.Fatal(`Ticker("X") was not disconnected`)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(w.Events()); !strings.HasSuffix(got, `disconnect Ticker("Y")]`) {
+		t.Errorf("events = %s", got)
+	}
+}
@@ -0,0 +1,117 @@
+package xlltest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteResults saves results for `xll-gen test` to read back with ReadResults.
+func WriteResults(path string, results []Result) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ReadResults loads results saved by WriteResults.
+func ReadResults(path string) ([]Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("malformed test results %s: %w", path, err)
+	}
+	return results, nil
+}
+
+// WriteTable prints one row per result: status, case name, function, and for
+// a failure what went wrong (for a pass, how long it took).
+func WriteTable(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCASE\tFUNCTION\tDETAIL")
+	for _, r := range results {
+		status, detail := "PASS", r.Duration.Round(time.Millisecond).String()
+		if !r.Pass {
+			status, detail = "FAIL", oneLine(r.Message)
+			if r.Line > 0 {
+				detail = fmt.Sprintf("line %d: %s", r.Line, detail)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", status, oneLine(r.Name), r.Func, detail)
+	}
+	return tw.Flush()
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// JUnit XML, in the shape CI systems (Jenkins, GitLab, GitHub test reporters)
+// read: one <testsuite> named after the project, one <testcase> per case with
+// the function as its classname.
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as a JUnit XML report for suite.
+func WriteJUnit(w io.Writer, suite string, results []Result) error {
+	s := junitSuite{Name: suite, Tests: len(results), Failures: Failed(results)}
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration
+		c := junitCase{Name: r.Name, ClassName: r.Func, Time: seconds(r.Duration)}
+		if !r.Pass {
+			body := fmt.Sprintf("got:  %s\nwant: %s", r.Got, r.Want)
+			if r.Line > 0 {
+				body += fmt.Sprintf("\nline: %d", r.Line)
+			}
+			c.Failure = &junitFailure{Message: r.Message, Body: body}
+		}
+		s.Cases = append(s.Cases, c)
+	}
+	s.Time = seconds(total)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{s}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
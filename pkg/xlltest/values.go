@@ -0,0 +1,454 @@
+package xlltest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/xldate"
+)
+
+// YAML values map to arguments by the declared xll.yaml type:
+//
+//	int       an integer (1, -3; 2.0 is accepted)
+//	float     any number
+//	bool      true / false
+//	string    a string (quote digits: "123")
+//	date      "2024-01-31", an RFC 3339 timestamp, or an Excel serial number
+//	grid      rows of cells, [[1, "a"], [true, ~]]; a flat list is one row
+//	numgrid   rows of numbers, [[1, 2], [3, 4]]
+//	range     {sheet: Sheet1, ref: "A1:B2"} (ref may list areas: "A1,C3:D4")
+//	any       a cell value, a grid, or a range, as above
+//
+// A cell is a number, string, bool, ~ (empty) or an Excel error literal such
+// as "#N/A" — in a grid or `any` argument, and in an expected value, those
+// literals mean the error, not the text.
+//
+// Expected values use the same forms; numbers compare within the case's
+// tolerance, and an int result compares exactly.
+
+// errorLiterals are Excel's spellings of the protocol error codes.
+var errorLiterals = map[protocol.XlError]string{
+	protocol.XlErrorNull:        "#NULL!",
+	protocol.XlErrorDiv0:        "#DIV/0!",
+	protocol.XlErrorValue:       "#VALUE!",
+	protocol.XlErrorRef:         "#REF!",
+	protocol.XlErrorName:        "#NAME?",
+	protocol.XlErrorNum:         "#NUM!",
+	protocol.XlErrorNA:          "#N/A",
+	protocol.XlErrorGettingData: "#GETTING_DATA",
+	protocol.XlErrorSpill:       "#SPILL!",
+	protocol.XlErrorConnect:     "#CONNECT!",
+	protocol.XlErrorBlocked:     "#BLOCKED!",
+	protocol.XlErrorUnknown:     "#UNKNOWN!",
+	protocol.XlErrorField:       "#FIELD!",
+	protocol.XlErrorCalc:        "#CALC!",
+}
+
+// parseErrorLiteral returns the error code s spells, if any.
+func parseErrorLiteral(s string) (protocol.XlError, bool) {
+	for code, lit := range errorLiterals {
+		if strings.EqualFold(s, lit) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// convertArg turns a decoded YAML value into the Go value xllhost.Call takes
+// for an argument of type typ.
+func convertArg(typ string, v any) (any, error) {
+	switch typ {
+	case "int":
+		f, ok := number(v)
+		if !ok || f != math.Trunc(f) {
+			return nil, fmt.Errorf("want an integer, got %s", formatValue(v))
+		}
+		if f < math.MinInt32 || f > math.MaxInt32 {
+			return nil, fmt.Errorf("%s overflows int", formatValue(v))
+		}
+		return int(f), nil
+	case "float":
+		f, ok := number(v)
+		if !ok {
+			return nil, fmt.Errorf("want a number, got %s", formatValue(v))
+		}
+		return f, nil
+	case "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("want true or false, got %s", formatValue(v))
+		}
+		return b, nil
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("want a string, got %s (quote it)", formatValue(v))
+		}
+		return s, nil
+	case "date":
+		return toDate(v)
+	case "grid":
+		rows, err := toRows(v)
+		if err != nil {
+			return nil, err
+		}
+		grid := make([][]any, len(rows))
+		for r, row := range rows {
+			grid[r] = make([]any, len(row))
+			for c, cell := range row {
+				if grid[r][c], err = toCell(cell); err != nil {
+					return nil, fmt.Errorf("cell [%d][%d]: %w", r, c, err)
+				}
+			}
+		}
+		return grid, nil
+	case "numgrid":
+		rows, err := toRows(v)
+		if err != nil {
+			return nil, err
+		}
+		grid := make([][]float64, len(rows))
+		for r, row := range rows {
+			grid[r] = make([]float64, len(row))
+			for c, cell := range row {
+				f, ok := number(cell)
+				if !ok {
+					return nil, fmt.Errorf("cell [%d][%d]: want a number, got %s", r, c, formatValue(cell))
+				}
+				grid[r][c] = f
+			}
+		}
+		return grid, nil
+	case "range":
+		return toRange(v)
+	case "any":
+		switch v.(type) {
+		case []any:
+			return convertArg("grid", v)
+		case map[string]any:
+			return toRange(v)
+		}
+		return toCell(v)
+	}
+	return nil, fmt.Errorf("unsupported argument type %q", typ)
+}
+
+// number accepts YAML's int and float forms.
+func number(v any) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case int32:
+		return float64(x), true
+	}
+	return 0, false
+}
+
+// toCell converts one grid / any cell the way Excel hands it over: every
+// number is a float64, and an error literal is the error.
+func toCell(v any) (any, error) {
+	switch x := v.(type) {
+	case nil, bool:
+		return x, nil
+	case string:
+		if code, ok := parseErrorLiteral(x); ok {
+			return code, nil
+		}
+		return x, nil
+	}
+	if f, ok := number(v); ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("want a cell value, got %s", formatValue(v))
+}
+
+// toRows reads a grid as rows; a flat list of cells is a single row.
+func toRows(v any) ([][]any, error) {
+	list, ok := v.([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("want a non-empty list of rows, got %s", formatValue(v))
+	}
+	if _, nested := list[0].([]any); !nested {
+		return [][]any{list}, nil
+	}
+	rows := make([][]any, len(list))
+	width := len(list[0].([]any))
+	for i, r := range list {
+		row, ok := r.([]any)
+		if !ok || len(row) == 0 || len(row) != width {
+			return nil, fmt.Errorf("row %d: every row must be a non-empty list of the same length", i)
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func toDate(v any) (any, error) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, nil
+	case string:
+		for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, x); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot read %q as a date (want YYYY-MM-DD or RFC 3339)", x)
+	}
+	if f, ok := number(v); ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("want a date, got %s", formatValue(v))
+}
+
+// toRange reads {sheet, ref} into the range an Excel reference arrives as.
+func toRange(v any) (*protocol.RangeT, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("want {sheet: ..., ref: ...}, got %s", formatValue(v))
+	}
+	for k := range m {
+		if k != "sheet" && k != "ref" {
+			return nil, fmt.Errorf("unknown range key %q (want sheet and ref)", k)
+		}
+	}
+	sheet, _ := m["sheet"].(string)
+	ref, _ := m["ref"].(string)
+	if ref == "" {
+		return nil, fmt.Errorf("a range needs a ref such as \"A1:B2\"")
+	}
+	if sheet == "" {
+		sheet = "Sheet1"
+	}
+	r := &protocol.RangeT{SheetName: sheet}
+	for _, area := range strings.Split(ref, ",") {
+		rect, err := parseArea(strings.TrimSpace(area))
+		if err != nil {
+			return nil, err
+		}
+		r.Refs = append(r.Refs, rect)
+	}
+	return r, nil
+}
+
+// parseArea reads an A1-style area ("B3" or "A1:C4") into a 0-based rectangle,
+// the XLREF12 convention the protocol carries.
+func parseArea(s string) (*protocol.RectT, error) {
+	from, to, isArea := strings.Cut(s, ":")
+	r1, c1, err := parseCell(from)
+	if err != nil {
+		return nil, err
+	}
+	r2, c2 := r1, c1
+	if isArea {
+		if r2, c2, err = parseCell(to); err != nil {
+			return nil, err
+		}
+	}
+	return &protocol.RectT{
+		RowFirst: min(r1, r2), RowLast: max(r1, r2),
+		ColFirst: min(c1, c2), ColLast: max(c1, c2),
+	}, nil
+}
+
+func parseCell(s string) (row, col int32, err error) {
+	s = strings.ToUpper(strings.ReplaceAll(s, "$", ""))
+	i := 0
+	for i < len(s) && s[i] >= 'A' && s[i] <= 'Z' {
+		col = col*26 + int32(s[i]-'A'+1)
+		i++
+	}
+	n, convErr := strconv.Atoi(s[i:])
+	// Excel's limits: 16384 columns (XFD), 1048576 rows.
+	if i == 0 || i > 3 || convErr != nil || n < 1 || n > 1048576 || col > 16384 {
+		return 0, 0, fmt.Errorf("%q is not an A1 cell reference", s)
+	}
+	return int32(n - 1), col - 1, nil
+}
+
+// match compares a result of xll.yaml return type ret with the expected value.
+func match(ret string, got, want any, tol float64) error {
+	switch ret {
+	case "int":
+		w, ok := number(want)
+		g, isInt := got.(int32)
+		if !ok || !isInt || float64(g) != w {
+			return mismatch(got, want)
+		}
+		return nil
+	case "grid", "numgrid":
+		return matchGrid(got, want, tol)
+	case "any":
+		switch got.(type) {
+		case [][]any, [][]float64:
+			return matchGrid(got, want, tol)
+		}
+	}
+	if !cellMatches(got, want, tol) {
+		return mismatch(got, want)
+	}
+	return nil
+}
+
+func mismatch(got, want any) error {
+	return fmt.Errorf("got %s, want %s", formatValue(got), formatValue(want))
+}
+
+func matchGrid(got, want any, tol float64) error {
+	rows := gridRows(got)
+	wantRows, err := toRows(want)
+	if err != nil {
+		return fmt.Errorf("expect: %w", err)
+	}
+	if len(rows) != len(wantRows) || len(rows) > 0 && len(rows[0]) != len(wantRows[0]) {
+		return fmt.Errorf("got a %s grid, want %s: %s", dims(rows), dims(wantRows), formatValue(got))
+	}
+	for r := range rows {
+		for c := range rows[r] {
+			if !cellMatches(rows[r][c], wantRows[r][c], tol) {
+				return fmt.Errorf("cell [%d][%d]: got %s, want %s", r, c, formatValue(rows[r][c]), formatValue(wantRows[r][c]))
+			}
+		}
+	}
+	return nil
+}
+
+func gridRows(v any) [][]any {
+	switch g := v.(type) {
+	case [][]any:
+		return g
+	case [][]float64:
+		rows := make([][]any, len(g))
+		for r := range g {
+			rows[r] = make([]any, len(g[r]))
+			for c, f := range g[r] {
+				rows[r][c] = f
+			}
+		}
+		return rows
+	}
+	return nil
+}
+
+func dims(rows [][]any) string {
+	if len(rows) == 0 {
+		return "0x0"
+	}
+	return fmt.Sprintf("%dx%d", len(rows), len(rows[0]))
+}
+
+// cellMatches compares one scalar result with one expected YAML value.
+func cellMatches(got, want any, tol float64) bool {
+	switch w := want.(type) {
+	case nil:
+		return got == nil
+	case bool:
+		g, ok := got.(bool)
+		return ok && g == w
+	case string:
+		switch g := got.(type) {
+		case protocol.XlError:
+			code, ok := parseErrorLiteral(w)
+			return ok && code == g
+		case time.Time:
+			t, err := toDate(w)
+			wt, ok := t.(time.Time)
+			return err == nil && ok && g.Equal(wt)
+		case string:
+			return g == w
+		}
+		return false
+	}
+	w, ok := number(want)
+	if !ok {
+		return false
+	}
+	var g float64
+	switch x := got.(type) {
+	case time.Time:
+		g = xldate.ToSerial(x)
+	default:
+		if g, ok = number(got); !ok {
+			return false
+		}
+	}
+	if math.IsNaN(g) || math.IsNaN(w) {
+		return math.IsNaN(g) && math.IsNaN(w)
+	}
+	return math.Abs(g-w) <= tol
+}
+
+// formatValue renders a result or expected value for the report.
+func formatValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "<empty>"
+	case string:
+		return strconv.Quote(x)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case protocol.XlError:
+		if lit, ok := errorLiterals[x]; ok {
+			return lit
+		}
+		return x.String()
+	case time.Time:
+		if x.Hour() == 0 && x.Minute() == 0 && x.Second() == 0 && x.Nanosecond() == 0 {
+			return x.Format("2006-01-02")
+		}
+		return x.Format(time.RFC3339)
+	case [][]any, [][]float64:
+		return formatRows(gridRows(x))
+	case []any:
+		parts := make([]string, len(x))
+		for i, e := range x {
+			parts[i] = formatValue(e)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *protocol.RangeT:
+		areas := make([]string, len(x.Refs))
+		for i, r := range x.Refs {
+			areas[i] = formatArea(r)
+		}
+		return x.SheetName + "!" + strings.Join(areas, ",")
+	case map[string]any:
+		if r, err := toRange(x); err == nil {
+			return formatValue(r)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+func formatRows(rows [][]any) string {
+	parts := make([]string, len(rows))
+	for i, row := range rows {
+		parts[i] = formatValue(row)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func formatArea(r *protocol.RectT) string {
+	first := colName(r.ColFirst) + strconv.Itoa(int(r.RowFirst)+1)
+	if r.RowFirst == r.RowLast && r.ColFirst == r.ColLast {
+		return first
+	}
+	return first + ":" + colName(r.ColLast) + strconv.Itoa(int(r.RowLast)+1)
+}
+
+func colName(col int32) string {
+	name := ""
+	for n := col + 1; n > 0; n = (n - 1) / 26 {
+		name = string(rune('A'+(n-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,321 @@
+// Package xlltest runs YAML-declared worksheet-function test cases through the
+// generated server, with no Excel: each case is a pkg/xllhost Call over the
+// real dispatch path, and the result is compared with what the case expects.
+// `xll-gen test` drives it — it writes a throwaway go test into the project
+// that loads xll.test.yaml, runs the suite and hands the Results back for the
+// pass/fail table and the JUnit report — so the cases themselves need no Go.
+//
+//	tolerance: 1e-9          # default float tolerance (absolute)
+//	timeout: 10s             # per case
+//	tests:
+//	  - func: Add
+//	    args: [1, 2]
+//	    expect: 3
+//	  - name: divide by zero
+//	    func: Divide
+//	    args: [1, 0]
+//	    error: "division by zero"   # substring of the handler's error
+//	  - func: SumGrid
+//	    args: [[[1, 2], [3, 4]]]     # an inline grid / numgrid: rows of cells
+//	    expect: 10
+//	  - func: Address
+//	    args: [{sheet: Sheet1, ref: "A1:B2"}]   # a range
+//	    expect: "Sheet1!A1:B2"
+//
+// See values.go for how YAML values map to each xll.yaml type.
+package xlltest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xll-gen/xll-gen/pkg/xllhost"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the test-case file `xll-gen test` reads, next to xll.yaml.
+const DefaultFile = "xll.test.yaml"
+
+// Environment variables through which `xll-gen test` hands the case file and
+// the results file to the go test it generates.
+const (
+	EnvCases   = "XLLGEN_TEST_CASES"
+	EnvResults = "XLLGEN_TEST_RESULTS"
+)
+
+// defaultTimeout bounds one case when the file sets no timeout: long enough
+// for an rtd-once or async handler doing real work, short enough that a
+// handler that never answers fails its case instead of hanging the run.
+const defaultTimeout = 10 * time.Second
+
+// Suite is a parsed test-case file.
+type Suite struct {
+	// Tolerance is the absolute tolerance for float comparisons in cases that
+	// set none.
+	Tolerance float64
+	// Timeout bounds each case.
+	Timeout time.Duration
+	Cases   []Case
+}
+
+// Case is one test case. Exactly one of Expect (HasExpect) and Error
+// (WantError) is set.
+type Case struct {
+	Name      string
+	Func      string
+	Args      []any
+	Expect    any
+	HasExpect bool
+	// Error is a substring the handler's error must contain; "" accepts any
+	// error.
+	Error     string
+	WantError bool
+	Tolerance float64
+	// Line is the case's line in the file, for messages.
+	Line int
+}
+
+type suiteYAML struct {
+	Tolerance float64    `yaml:"tolerance"`
+	Timeout   string     `yaml:"timeout"`
+	Tests     []caseYAML `yaml:"tests"`
+}
+
+// caseYAML keeps expect and error as nodes so an absent key is told apart from
+// an explicit null (`expect: ~` expects an empty result).
+type caseYAML struct {
+	Name      string    `yaml:"name"`
+	Func      string    `yaml:"func"`
+	Args      []any     `yaml:"args"`
+	Expect    yaml.Node `yaml:"expect"`
+	Error     yaml.Node `yaml:"error"`
+	Tolerance *float64  `yaml:"tolerance"`
+}
+
+// Load reads and parses the test-case file at path.
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test cases: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes test-case YAML with the same strict unknown-key detection as
+// xll.yaml, so a misspelled `expcet:` fails instead of silently testing
+// nothing.
+func Parse(data []byte) (*Suite, error) {
+	var raw suiteYAML
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse test cases: %w", err)
+	}
+	s := &Suite{Tolerance: raw.Tolerance, Timeout: defaultTimeout}
+	if raw.Tolerance < 0 {
+		return nil, fmt.Errorf("tolerance must be non-negative, got %v", raw.Tolerance)
+	}
+	if raw.Timeout != "" {
+		d, err := time.ParseDuration(raw.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("timeout %q is not a positive duration", raw.Timeout)
+		}
+		s.Timeout = d
+	}
+	if len(raw.Tests) == 0 {
+		return nil, errors.New("no test cases (a `tests:` list is required)")
+	}
+	for i, rc := range raw.Tests {
+		c, err := rc.toCase(s.Tolerance)
+		if err != nil {
+			return nil, fmt.Errorf("test %d: %w", i+1, err)
+		}
+		s.Cases = append(s.Cases, c)
+	}
+	return s, nil
+}
+
+func (rc caseYAML) toCase(tol float64) (Case, error) {
+	c := Case{Name: rc.Name, Func: rc.Func, Args: rc.Args, Tolerance: tol}
+	if rc.Func == "" {
+		return c, errors.New("func is required")
+	}
+	if rc.Tolerance != nil {
+		if *rc.Tolerance < 0 {
+			return c, fmt.Errorf("%s: tolerance must be non-negative", rc.Func)
+		}
+		c.Tolerance = *rc.Tolerance
+	}
+	if rc.Expect.Kind != 0 {
+		c.HasExpect = true
+		c.Line = rc.Expect.Line
+		if err := rc.Expect.Decode(&c.Expect); err != nil {
+			return c, fmt.Errorf("%s: expect: %w", rc.Func, err)
+		}
+	}
+	if rc.Error.Kind != 0 {
+		c.WantError = true
+		c.Line = rc.Error.Line
+		if rc.Error.Kind != yaml.ScalarNode {
+			return c, fmt.Errorf("%s: error must be a string", rc.Func)
+		}
+		if rc.Error.Tag != "!!null" {
+			c.Error = rc.Error.Value
+		}
+	}
+	if c.HasExpect == c.WantError {
+		return c, fmt.Errorf("%s: set exactly one of expect and error", rc.Func)
+	}
+	if c.Name == "" {
+		c.Name = defaultName(c)
+	}
+	return c, nil
+}
+
+// defaultName names a case after its call, e.g. Add(1, 2).
+func defaultName(c Case) string {
+	parts := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		parts[i] = formatValue(a)
+	}
+	return c.Func + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// Result is the outcome of one case. It is plain data (JSON-encodable) because
+// it crosses from the generated go test back to `xll-gen test`.
+type Result struct {
+	Name     string        `json:"name"`
+	Func     string        `json:"func"`
+	Line     int           `json:"line,omitempty"`
+	Pass     bool          `json:"pass"`
+	Got      string        `json:"got,omitempty"`
+	Want     string        `json:"want,omitempty"`
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Run executes every case of s against h, in order, and returns one Result
+// per case. h must already be served (generated ServeConn). A case never
+// aborts the run: a failure, error or timeout is that case's Result.
+func Run(ctx context.Context, h *xllhost.Host, s *Suite) []Result {
+	results := make([]Result, 0, len(s.Cases))
+	for _, c := range s.Cases {
+		start := time.Now()
+		r := runCase(ctx, h, s, c)
+		r.Duration = time.Since(start)
+		results = append(results, r)
+	}
+	return results
+}
+
+// ConvertArgs turns decoded YAML values into the Go values xllhost.Call takes
+// for sig's arguments, by the table in values.go.
+func ConvertArgs(sig xllhost.Signature, raw []any) ([]any, error) {
+	if len(raw) != len(sig.ArgTypes) {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", sig.Name, len(sig.ArgTypes), len(raw))
+	}
+	args := make([]any, len(raw))
+	for i, a := range raw {
+		v, err := convertArg(sig.ArgTypes[i], a)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s (%s): %v", sig.ArgNames[i], sig.ArgTypes[i], err)
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+func runCase(ctx context.Context, h *xllhost.Host, s *Suite, c Case) Result {
+	r := Result{Name: c.Name, Func: c.Func, Line: c.Line}
+	if c.WantError {
+		r.Want = "error"
+		if c.Error != "" {
+			r.Want = fmt.Sprintf("error containing %q", c.Error)
+		}
+	} else {
+		r.Want = formatValue(c.Expect)
+	}
+	fail := func(format string, args ...any) Result {
+		r.Message = fmt.Sprintf(format, args...)
+		return r
+	}
+
+	sig, ok := h.Signature(c.Func)
+	if !ok {
+		return fail("no function %q in xll.yaml", c.Func)
+	}
+	args, err := ConvertArgs(sig, c.Args)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	got, err := call(cctx, h, sig, args)
+	var fe *xllhost.FuncError
+	switch {
+	case err != nil && errors.As(err, &fe):
+		r.Got = "error: " + fe.Msg
+		if !c.WantError {
+			return fail("handler returned an error: %s", fe.Msg)
+		}
+		if !strings.Contains(fe.Msg, c.Error) {
+			return fail("error %q does not contain %q", fe.Msg, c.Error)
+		}
+	case err != nil:
+		return fail("%v", err)
+	default:
+		r.Got = formatValue(got)
+		if c.WantError {
+			return fail("expected an error, got %s", r.Got)
+		}
+		if err := match(sig.Return, got, c.Expect, c.Tolerance); err != nil {
+			return fail("%v", err)
+		}
+	}
+	r.Pass = true
+	return r
+}
+
+// call is Call, plus streaming rtd functions, whose case checks the first
+// value the topic publishes.
+func call(ctx context.Context, h *xllhost.Host, sig xllhost.Signature, args []any) (any, error) {
+	if sig.Mode != "rtd" {
+		return h.Call(ctx, sig.Name, args...)
+	}
+	topic, err := h.Subscribe(ctx, sig.Name, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer topic.Close()
+	for {
+		select {
+		case u := <-topic.Updates:
+			if u.Progress {
+				continue
+			}
+			if u.IsError {
+				return nil, &xllhost.FuncError{Func: sig.Name, Msg: fmt.Sprint(u.Value)}
+			}
+			return u.Value, nil
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no value published: %w", ctx.Err())
+		}
+	}
+}
+
+// Failed reports how many results did not pass.
+func Failed(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if !r.Pass {
+			n++
+		}
+	}
+	return n
+}
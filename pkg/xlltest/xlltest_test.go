@@ -0,0 +1,206 @@
+package xlltest
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xll-gen/types/go/protocol"
+	"github.com/xll-gen/xll-gen/pkg/xllhost"
+	"github.com/xll-gen/xll-gen/pkg/xllhost/xllhosttest"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse([]byte(`
+tolerance: 0.01
+timeout: 2s
+tests:
+  - func: Add
+    args: [1, 2]
+    expect: 3
+  - name: blank
+    func: Echo
+    args: [""]
+    expect: ~
+  - func: Div
+    args: [1, 0]
+    error: by zero
+    tolerance: 0
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if s.Timeout != 2*time.Second || len(s.Cases) != 3 {
+		t.Fatalf("suite = %+v", s)
+	}
+	if c := s.Cases[0]; c.Name != "Add(1, 2)" || !c.HasExpect || c.Expect != 3 || c.Tolerance != 0.01 {
+		t.Errorf("case 0 = %+v", c)
+	}
+	if c := s.Cases[1]; !c.HasExpect || c.Expect != nil {
+		t.Errorf("`expect: ~` should expect an empty result, got %+v", c)
+	}
+	if c := s.Cases[2]; !c.WantError || c.Error != "by zero" || c.Tolerance != 0 || c.Line != 14 {
+		t.Errorf("case 2 = %+v", c)
+	}
+
+	for name, src := range map[string]string{
+		"UnknownKey":  "tests:\n  - func: Add\n    expcet: 3\n",
+		"NoCases":     "tolerance: 1\n",
+		"NoFunc":      "tests:\n  - expect: 3\n",
+		"Neither":     "tests:\n  - func: Add\n",
+		"Both":        "tests:\n  - func: Add\n    expect: 3\n    error: x\n",
+		"BadTimeout":  "timeout: soon\ntests:\n  - func: Add\n    expect: 3\n",
+		"NegativeTol": "tests:\n  - func: Add\n    expect: 3\n    tolerance: -1\n",
+	} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Errorf("%s: Parse accepted %q", name, src)
+		}
+	}
+}
+
+func TestConvertArg(t *testing.T) {
+	ok := []struct {
+		typ  string
+		in   any
+		want string
+	}{
+		{"int", 2, "2"},
+		{"int", 2.0, "2"},
+		{"float", 3, "3"},
+		{"date", "2024-01-31", "2024-01-31"},
+		{"grid", []any{1, "a"}, `[[1, "a"]]`},
+		{"grid", []any{[]any{true, nil}, []any{"#N/A", 2.5}}, "[[true, <empty>], [#N/A, 2.5]]"},
+		{"numgrid", []any{[]any{1, 2}, []any{3, 4}}, "[[1, 2], [3, 4]]"},
+		{"range", map[string]any{"sheet": "Data", "ref": "$B$2:A1,AA10"}, "Data!A1:B2,AA10"},
+		{"any", "#div/0!", "#DIV/0!"},
+		{"any", 7, "7"},
+	}
+	for _, tc := range ok {
+		got, err := convertArg(tc.typ, tc.in)
+		if err != nil || formatValue(got) != tc.want {
+			t.Errorf("convertArg(%s, %v) = (%s, %v), want %s", tc.typ, tc.in, formatValue(got), err, tc.want)
+		}
+	}
+
+	bad := []struct {
+		typ string
+		in  any
+	}{
+		{"int", 2.5},
+		{"int", 1 << 40},
+		{"string", 123},
+		{"bool", "yes"},
+		{"date", "31/01/2024"},
+		{"grid", []any{[]any{1, 2}, []any{3}}},
+		{"numgrid", []any{[]any{1, "x"}}},
+		{"range", map[string]any{"ref": "A0"}},
+		{"range", map[string]any{"ref": "A1", "cols": 2}},
+	}
+	for _, tc := range bad {
+		if got, err := convertArg(tc.typ, tc.in); err == nil {
+			t.Errorf("convertArg(%s, %v) = %v, want an error", tc.typ, tc.in, got)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	day := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		ret       string
+		got, want any
+		tol       float64
+		ok        bool
+	}{
+		{"int", int32(3), 3, 0, true},
+		{"int", int32(3), 3.5, 1, false},
+		{"float", 0.30000000000000004, 0.3, 1e-9, true},
+		{"float", 0.30000000000000004, 0.3, 0, false},
+		{"string", "x", "x", 0, true},
+		{"string", "1", 1, 0, false},
+		{"bool", true, true, 0, true},
+		{"any", protocol.XlErrorNA, "#N/A", 0, true},
+		{"any", "#N/A", "#N/A", 0, true},
+		{"any", nil, nil, 0, true},
+		{"any", day, "2024-01-31", 0, true},
+		{"grid", [][]any{{1.0, "a"}, {nil, true}}, []any{[]any{1, "a"}, []any{nil, true}}, 0, true},
+		{"grid", [][]any{{1.0, "a"}}, []any{[]any{1, "b"}}, 0, false},
+		{"numgrid", [][]float64{{1, 2}}, []any{1, 2.001}, 0.01, true},
+		{"numgrid", [][]float64{{1, 2}}, []any{[]any{1}, []any{2}}, 0, false},
+	}
+	for _, tc := range cases {
+		if err := match(tc.ret, tc.got, tc.want, tc.tol); (err == nil) != tc.ok {
+			t.Errorf("match(%s, %s, %s, %g) = %v, want ok=%v", tc.ret, formatValue(tc.got), formatValue(tc.want), tc.tol, err, tc.ok)
+		}
+	}
+}
+
+// TestRun drives a suite through xllhost against the shared test guest
+// (pkg/xllhost/xllhosttest).
+func TestRun(t *testing.T) {
+	h, err := xllhost.Parse([]byte(xllhosttest.YAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xllhosttest.Serve(t, h)
+
+	s, err := Parse([]byte(`
+tolerance: 1e-9
+tests:
+  - {func: Add, args: [1, 2], expect: 3}
+  - {func: Add, args: [1, 2], expect: 4}
+  - {func: Div, args: [1, 3], expect: 0.333333333333}
+  - {func: Div, args: [1, 0], error: by zero}
+  - {func: Div, args: [1, 1], error: ""}
+  - {func: Add, args: [1], expect: 1}
+  - {func: Nope, expect: 1}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := Run(context.Background(), h, s)
+	want := []bool{true, false, true, true, false, false, false}
+	for i, r := range results {
+		if r.Pass != want[i] {
+			t.Errorf("case %d %s: pass=%v (%s), want %v", i, r.Name, r.Pass, r.Message, want[i])
+		}
+	}
+	if results[1].Got != "3" || !strings.Contains(results[1].Message, "want 4") {
+		t.Errorf("a mismatch should report got and want, got %+v", results[1])
+	}
+	if Failed(results) != 4 {
+		t.Errorf("Failed = %d, want 4", Failed(results))
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	results := []Result{
+		{Name: "Add(1, 2)", Func: "Add", Pass: true, Duration: 1500 * time.Microsecond},
+		{Name: "bad <one>", Func: "Div", Got: "1", Want: "2", Message: "got 1, want 2", Line: 7},
+	}
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, "proj", results); err != nil {
+		t.Fatal(err)
+	}
+	var doc junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("the report is not XML: %v\n%s", err, buf.String())
+	}
+	s := doc.Suites[0]
+	if s.Name != "proj" || s.Tests != 2 || s.Failures != 1 || s.Cases[0].Time != "0.002" {
+		t.Errorf("suite = %+v", s)
+	}
+	if f := s.Cases[1].Failure; f == nil || f.Message != "got 1, want 2" || !strings.Contains(f.Body, "line: 7") || s.Cases[1].Name != "bad <one>" {
+		t.Errorf("failing case = %+v", s.Cases[1])
+	}
+
+	buf.Reset()
+	if err := WriteTable(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "PASS") || !strings.Contains(out, "line 7: got 1, want 2") {
+		t.Errorf("table:\n%s", out)
+	}
+}
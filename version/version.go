@@ -2,4 +2,4 @@ package version
 
 // Version defines the current version of the xll-gen tool.
 // This version string is used in the CLI output and generated code headers.
-const Version = "v0.8.55"
+const Version = "v0.8.56"